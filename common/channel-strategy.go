@@ -0,0 +1,62 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	ChannelStrategyWeightedRandom = "weighted_random"
+	ChannelStrategyRoundRobin     = "round_robin"
+	ChannelStrategyLeastInFlight  = "least_inflight"
+	ChannelStrategyLowestLatency  = "lowest_latency"
+	ChannelStrategyLowestTTFT     = "lowest_ttft"
+	ChannelStrategyLowestCost     = "lowest_cost"
+)
+
+var channelStrategies = map[string]bool{
+	ChannelStrategyWeightedRandom: true,
+	ChannelStrategyRoundRobin:     true,
+	ChannelStrategyLeastInFlight:  true,
+	ChannelStrategyLowestLatency:  true,
+	ChannelStrategyLowestTTFT:     true,
+	ChannelStrategyLowestCost:     true,
+}
+
+// ChannelStrategy 同一优先级内的渠道选择策略，键可以是 "分组:模型"、"*:模型"、"分组" 或 "*"，
+// 按此顺序匹配，均未配置时使用加权随机
+var ChannelStrategy = map[string]string{}
+
+func ChannelStrategy2JSONString() string {
+	jsonBytes, err := json.Marshal(ChannelStrategy)
+	if err != nil {
+		SysError("error marshalling channel strategy: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateChannelStrategyByJSONString(jsonStr string) error {
+	strategy := make(map[string]string)
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &strategy); err != nil {
+			return err
+		}
+	}
+	for key, name := range strategy {
+		if !channelStrategies[name] {
+			return fmt.Errorf("unknown channel strategy %q for %q", name, key)
+		}
+	}
+	ChannelStrategy = strategy
+	return nil
+}
+
+func GetChannelStrategy(group string, model string) string {
+	strategy := ChannelStrategy
+	for _, key := range []string{group + ":" + model, "*:" + model, group, "*"} {
+		if name, ok := strategy[key]; ok {
+			return name
+		}
+	}
+	return ChannelStrategyWeightedRandom
+}
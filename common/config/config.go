@@ -15,6 +15,8 @@ var OutProxyUrl = ""
 var PayAddress = ""
 var EpayId = ""
 var EpayKey = ""
+var StripeApiSecret = ""
+var StripeWebhookSecret = ""
 var Price = 7.3
 var RedempTionCount = 30
 var Footer = ""
@@ -39,6 +41,10 @@ var DataExportEnabled = true
 var DataExportInterval = 5 // unit: minute
 var MiniQuota = 1.0
 var ProporTions = 10
+var FileMaxSize = 512        // 单个文件大小上限，单位 MB
+var FileStorageLimit = 1024  // 每个用户的文件存储上限，单位 MB，0 表示不限制
+var BatchConcurrency = 8     // 单个批处理任务的并发请求数
+var BatchDiscountRatio = 0.5 // 批处理请求的计费折扣
 var UserGroup = "default"
 var VipUserGroup = "default"
 var DebugEnabled = os.Getenv("DEBUG") == "true"
@@ -96,6 +102,42 @@ var QuotaForInvitee = 0
 var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
+
+// 渠道熔断：按渠道和模型统计滚动窗口内的错误率，超过阈值后暂时熔断，冷却时间按指数退避
+var ChannelBreakerEnabled = true
+var ChannelBreakerWindow = 60        // 错误率统计窗口，单位秒
+var ChannelBreakerMinRequests = 10   // 窗口内请求数达到该值才计算错误率
+var ChannelBreakerErrorRate = 0.5    // 触发熔断的错误率
+var ChannelBreakerCooldown = 30      // 首次熔断的冷却时间，单位秒
+var ChannelBreakerMaxCooldown = 1800 // 冷却时间上限，单位秒
+
+// 渠道排队：分组下没有可用渠道时请求进入等待队列，按分组优先级在渠道空闲后放行
+var ChannelQueueEnabled = false
+var ChannelQueueMaxSize = 100 // 每个分组、模型的最大排队请求数
+var ChannelQueueMaxWait = 5   // 最长等待时间，单位秒
+
+// 流式请求超时，单位秒，0 表示不限制；首个内容到达前超时会切换渠道重试
+var StreamFirstTokenTimeout = 0
+var StreamIdleTimeout = 0
+
+// 缓存亲和路由：相同提示词前缀的请求在有效期内固定到同一渠道，以命中上游的提示词缓存
+var StickyRoutingEnabled = false
+var StickyRoutingTTL = 300 // 单位秒
+
+// 是否允许组织添加自己的渠道，组织渠道的上游地址不能指向内网
+var OrgChannelEnabled = false
+
+// 额度账本对账间隔，单位分钟，0 表示不对账
+var LedgerReconcileInterval = 60
+
+// 充值订单对账间隔，单位分钟，0 表示不对账
+var TopUpReconcileInterval = 10
+
+// 赠送额度（注册赠送、邀请奖励）的有效期，单位天，0 表示不过期
+var PromoQuotaValidDays = 90
+
+// 额度批次过期前多少天发送提醒邮件，0 表示不提醒
+var QuotaExpiryNotifyDays = 3
 var TopupRatioEnabled = true
 var TopupAmountEnabled = false
 var QuotaRemindThreshold = 1000
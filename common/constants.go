@@ -25,6 +25,9 @@ var BatchUpdateInterval = GetOrDefault("BATCH_UPDATE_INTERVAL", 5)
 
 var RelayTimeout = GetOrDefault("RELAY_TIMEOUT", 0) // unit is second
 
+var BatchMaxRunning = GetOrDefault("BATCH_MAX_RUNNING", 4)
+var BatchWorkPath = GetOrDefaultString("BATCH_WORK_PATH", "./batch_work")
+
 const (
 	RequestIdKey = "X-Oneapi-Request-Id"
 )
@@ -134,6 +137,8 @@ const (
 	ChannelTypeDouBao         = 41
 	ChannelTypeGCP            = 42
 	ChannelTypeXAI            = 43
+	ChannelTypeJina           = 44
+	ChannelTypeVoyage         = 45
 )
 
 var ChannelBaseURLs = []string{
@@ -181,6 +186,8 @@ var ChannelBaseURLs = []string{
 	"https://ark.cn-beijing.volces.com", // 41
 	"",                                  // 42
 	"https://api.x.ai",                  // 43
+	"https://api.jina.ai",               // 44
+	"https://api.voyageai.com",          // 45
 }
 
 const (
@@ -8,12 +8,14 @@ const (
 	Status            = "status"
 	Channel           = "channel"
 	ChannelId         = "channel_id"
+	ChannelKeyId      = "channel_key_id"
 	SpecificChannelId = "specific_channel_id"
 	RequestModel      = "request_model"
 	Cross             = "cross"
 	ConvertedRequest  = "converted_request"
 	OriginalModel     = "original_model"
 	Group             = "group"
+	ChannelGroup      = "channel_group"
 	ModelMapping      = "model_mapping"
 	ChannelName       = "channel_name"
 	TokenId           = "token_id"
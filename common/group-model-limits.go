@@ -0,0 +1,78 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"one-api/common/config"
+	"strconv"
+)
+
+// GroupModelLimit 分组内单个模型的吞吐限制，0 表示不限制，
+// RPM/TPM 为整个分组共享的额度，UserRPM/UserTPM 为分组内每个用户的额度
+type GroupModelLimit struct {
+	RPM     int `json:"rpm,omitempty"`
+	TPM     int `json:"tpm,omitempty"`
+	UserRPM int `json:"user_rpm,omitempty"`
+	UserTPM int `json:"user_tpm,omitempty"`
+}
+
+// GroupModelLimits 键可以是 "分组:模型"、"*:模型"、"分组" 或 "*"，按此顺序匹配
+var GroupModelLimits = map[string]GroupModelLimit{}
+
+func GroupModelLimits2JSONString() string {
+	jsonBytes, err := json.Marshal(GroupModelLimits)
+	if err != nil {
+		SysError("error marshalling group model limits: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupModelLimitsByJSONString(jsonStr string) error {
+	limits := make(map[string]GroupModelLimit)
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &limits); err != nil {
+			return err
+		}
+	}
+	for key, limit := range limits {
+		if limit.RPM < 0 || limit.TPM < 0 || limit.UserRPM < 0 || limit.UserTPM < 0 {
+			return fmt.Errorf("invalid group model limit for %q", key)
+		}
+	}
+	GroupModelLimits = limits
+	return nil
+}
+
+func GetGroupModelLimit(group string, model string) (GroupModelLimit, bool) {
+	limits := GroupModelLimits
+	for _, key := range []string{group + ":" + model, "*:" + model, group, "*"} {
+		if limit, ok := limits[key]; ok {
+			return limit, true
+		}
+	}
+	return GroupModelLimit{}, false
+}
+
+// GroupModelLimitScopes 返回分组和分组内用户两个计数维度的键
+func GroupModelLimitScopes(group string, model string, userId int) (string, string) {
+	scope := group + ":" + model
+	return scope, scope + ":" + strconv.Itoa(userId)
+}
+
+// RecordGroupModelTokens 请求完成后把实际消耗的 token 计入 TPM 窗口
+func RecordGroupModelTokens(group string, model string, userId int, tokens int) {
+	if !config.GroupModelLimitsEnabled || tokens <= 0 {
+		return
+	}
+	limit, ok := GetGroupModelLimit(group, model)
+	if !ok {
+		return
+	}
+	scope, userScope := GroupModelLimitScopes(group, model, userId)
+	if limit.TPM > 0 {
+		RateWindowAdd("tpm:"+scope, int64(tokens))
+	}
+	if limit.UserTPM > 0 {
+		RateWindowAdd("tpm:"+userScope, int64(tokens))
+	}
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"encoding/json"
+)
+
+// GroupQueuePriority 渠道排队时各分组的优先级，数值越大越先放行，未配置的分组为 0
+var GroupQueuePriority = map[string]int{}
+
+func GroupQueuePriority2JSONString() string {
+	jsonBytes, err := json.Marshal(GroupQueuePriority)
+	if err != nil {
+		SysError("error marshalling group queue priority: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateGroupQueuePriorityByJSONString(jsonStr string) error {
+	priority := make(map[string]int)
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &priority); err != nil {
+			return err
+		}
+	}
+	GroupQueuePriority = priority
+	return nil
+}
+
+func GetGroupQueuePriority(group string) int {
+	return GroupQueuePriority[group]
+}
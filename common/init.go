@@ -7,6 +7,7 @@ import (
 	"one-api/common/config"
 	"os"
 	"path/filepath"
+	"testing"
 )
 
 var (
@@ -24,6 +25,10 @@ func printHelp() {
 }
 
 func init() {
+	// 测试时由 testing 包解析 -test.* 参数
+	if testing.Testing() {
+		return
+	}
 	flag.Parse()
 
 	if *PrintVersion {
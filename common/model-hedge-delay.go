@@ -0,0 +1,38 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ModelHedgeDelay 开启请求对冲的模型及等待首字的时间，单位毫秒，
+// 超过该时间仍未返回首个内容时向另一个渠道发送相同的请求
+var ModelHedgeDelay = map[string]int{}
+
+func ModelHedgeDelay2JSONString() string {
+	jsonBytes, err := json.Marshal(ModelHedgeDelay)
+	if err != nil {
+		SysError("error marshalling model hedge delay: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelHedgeDelayByJSONString(jsonStr string) error {
+	delays := make(map[string]int)
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &delays); err != nil {
+			return err
+		}
+	}
+	for model, delay := range delays {
+		if delay < 0 {
+			return fmt.Errorf("invalid hedge delay for %q", model)
+		}
+	}
+	ModelHedgeDelay = delays
+	return nil
+}
+
+func GetModelHedgeDelay(model string) int {
+	return ModelHedgeDelay[model]
+}
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 模型名支持通配符和正则：包含 * 或 ? 时按通配符匹配，以 re: 开头时按正则匹配，
+// 用于渠道模型列表、令牌可用模型、模型映射和模型倍率
+
+const modelRegexPrefix = "re:"
+
+type ModelPattern struct {
+	Raw         string
+	re          *regexp.Regexp
+	specificity int
+	regex       bool
+}
+
+// 编译后的模式按原始字符串缓存，无效的模式缓存为 nil
+var compiledModelPatterns sync.Map
+
+func IsModelPattern(s string) bool {
+	return strings.HasPrefix(s, modelRegexPrefix) || strings.ContainsAny(s, "*?")
+}
+
+// GetModelPattern 返回编译后的模式，s 不是模式或无法编译时返回 nil
+func GetModelPattern(s string) *ModelPattern {
+	if !IsModelPattern(s) {
+		return nil
+	}
+	if cached, ok := compiledModelPatterns.Load(s); ok {
+		return cached.(*ModelPattern)
+	}
+	pattern := compileModelPattern(s)
+	compiledModelPatterns.Store(s, pattern)
+	return pattern
+}
+
+func compileModelPattern(s string) *ModelPattern {
+	if expr, ok := strings.CutPrefix(s, modelRegexPrefix); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			SysError("invalid model pattern " + s + ": " + err.Error())
+			return nil
+		}
+		return &ModelPattern{Raw: s, re: re, regex: true}
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	specificity := 0
+	for _, r := range s {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+			specificity++
+		}
+	}
+	expr.WriteString("$")
+	return &ModelPattern{Raw: s, re: regexp.MustCompile(expr.String()), specificity: specificity}
+}
+
+func (p *ModelPattern) Match(name string) bool {
+	return p != nil && p.re.MatchString(name)
+}
+
+// MatchModelName 判断模型名是否等于 pattern 或被 pattern 匹配
+func MatchModelName(pattern string, name string) bool {
+	if pattern == name {
+		return true
+	}
+	return GetModelPattern(pattern).Match(name)
+}
+
+// ModelPatternSet 预编译的一组模式，多个模式都能匹配时结果是确定的：
+// 通配符优先于正则，通配符中字面字符多的优先，其余按原始字符串排序
+type ModelPatternSet []*ModelPattern
+
+func NewModelPatternSet(keys []string) ModelPatternSet {
+	var set ModelPatternSet
+	for _, key := range keys {
+		if pattern := GetModelPattern(key); pattern != nil {
+			set = append(set, pattern)
+		}
+	}
+	sort.Slice(set, func(i, j int) bool {
+		if set[i].regex != set[j].regex {
+			return !set[i].regex
+		}
+		if set[i].specificity != set[j].specificity {
+			return set[i].specificity > set[j].specificity
+		}
+		return set[i].Raw < set[j].Raw
+	})
+	return set
+}
+
+// Match 返回第一个匹配 name 的模式
+func (s ModelPatternSet) Match(name string) (string, bool) {
+	for _, pattern := range s {
+		if pattern.Match(name) {
+			return pattern.Raw, true
+		}
+	}
+	return "", false
+}
+
+// ModelPatternSetOf 返回 m 的键中的模式
+func ModelPatternSetOf[T any](m map[string]T) ModelPatternSet {
+	keys := make([]string, 0)
+	for key := range m {
+		if IsModelPattern(key) {
+			keys = append(keys, key)
+		}
+	}
+	return NewModelPatternSet(keys)
+}
+
+// LookupModelMap 先精确查找，找不到时使用匹配的模式对应的值，patterns 为 m 中的模式，在 m 更新时生成
+func LookupModelMap[T any](m map[string]T, patterns ModelPatternSet, name string) (T, bool) {
+	if value, ok := m[name]; ok {
+		return value, true
+	}
+	if key, ok := patterns.Match(name); ok {
+		return m[key], true
+	}
+	var zero T
+	return zero, false
+}
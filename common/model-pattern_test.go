@@ -0,0 +1,92 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMatchModelName(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"gpt-4o", "gpt-4o", true},
+		{"gpt-4o", "gpt-4o-mini", false},
+		{"gpt-4o*", "gpt-4o-mini", true},
+		{"gpt-4o*", "gpt-4", false},
+		{"gpt-?o", "gpt-4o", true},
+		{"gpt-?o", "gpt-40o", false},
+		{"gpt-4.1*", "gpt-401", false},
+		{"re:^claude-3-(opus|sonnet)", "claude-3-sonnet-20240229", true},
+		{"re:^claude-3-(opus|sonnet)", "claude-3-haiku-20240307", false},
+		{"re:([", "re:([", true},
+		{"re:([", "anything", false},
+	}
+	Convey("TestMatchModelName", t, func() {
+		for _, c := range cases {
+			Convey(c.pattern+" "+c.name, func() {
+				So(MatchModelName(c.pattern, c.name), ShouldEqual, c.match)
+			})
+		}
+	})
+}
+
+func TestModelPatternSetPrecedence(t *testing.T) {
+	cases := []struct {
+		name     string
+		keys     []string
+		model    string
+		expected string
+		match    bool
+	}{
+		{"wildcard before regex", []string{"re:^gpt-4o.*", "gpt-*"}, "gpt-4o-mini", "gpt-*", true},
+		{"more literal characters first", []string{"gpt-*", "gpt-4o-*"}, "gpt-4o-mini", "gpt-4o-*", true},
+		{"question mark counts as non literal", []string{"gpt-4?-mini", "gpt-4o*"}, "gpt-4o-mini", "gpt-4?-mini", true},
+		{"ties sorted by raw string", []string{"gpt-*", "*mini"}, "gpt-mini", "*mini", true},
+		{"regex used when no wildcard matches", []string{"claude-*", "re:^gpt-4o.*"}, "gpt-4o-mini", "re:^gpt-4o.*", true},
+		{"exact keys are ignored", []string{"gpt-4o-mini"}, "gpt-4o-mini", "", false},
+		{"invalid regex is ignored", []string{"re:(["}, "re:([", "", false},
+		{"no match", []string{"claude-*"}, "gpt-4o", "", false},
+	}
+	Convey("TestModelPatternSetPrecedence", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				matched, ok := NewModelPatternSet(c.keys).Match(c.model)
+				So(ok, ShouldEqual, c.match)
+				So(matched, ShouldEqual, c.expected)
+			})
+		}
+	})
+}
+
+func TestLookupModelMap(t *testing.T) {
+	m := map[string]float64{
+		"gpt-4o":      1,
+		"gpt-4o*":     2,
+		"gpt-*":       3,
+		"re:^claude-": 4,
+	}
+	patterns := ModelPatternSetOf(m)
+	cases := []struct {
+		model string
+		value float64
+		found bool
+	}{
+		{"gpt-4o", 1, true},
+		{"gpt-4o-mini", 2, true},
+		{"gpt-4.1", 3, true},
+		{"claude-3-opus", 4, true},
+		{"gemini-pro", 0, false},
+	}
+	Convey("TestLookupModelMap", t, func() {
+		for _, c := range cases {
+			Convey(c.model, func() {
+				value, found := LookupModelMap(m, patterns, c.model)
+				So(found, ShouldEqual, c.found)
+				So(value, ShouldEqual, c.value)
+			})
+		}
+	})
+}
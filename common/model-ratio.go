@@ -231,10 +231,83 @@ var ModelRatio = map[string]float64{
 	"deepl-zh":                  25.0 / 1000 * USD,
 	"deepl-en":                  25.0 / 1000 * USD,
 	"deepl-ja":                  25.0 / 1000 * USD,
+	// rerank，Cohere 按 search unit 计费，1 search unit 折算为 1000 token
+	"rerank-v3.5":                        1,
+	"rerank-english-v3.0":                1,
+	"rerank-multilingual-v3.0":           1,
+	"jina-reranker-v2-base-multilingual": 0.02 / 1000 * USD,
+	"jina-reranker-m0":                   0.02 / 1000 * USD,
+	"jina-colbert-v2":                    0.02 / 1000 * USD,
+	"jina-embeddings-v3":                 0.02 / 1000 * USD,
+	"jina-clip-v2":                       0.02 / 1000 * USD,
+	"rerank-2":                           0.05 / 1000 * USD,
+	"rerank-2-lite":                      0.02 / 1000 * USD,
+	"voyage-3":                           0.06 / 1000 * USD,
+	"voyage-3-lite":                      0.02 / 1000 * USD,
+	"voyage-3-large":                     0.18 / 1000 * USD,
+	"voyage-code-3":                      0.18 / 1000 * USD,
+	"voyage-finance-2":                   0.12 / 1000 * USD,
+	"voyage-law-2":                       0.12 / 1000 * USD,
 }
 
 var CompletionRatio = map[string]float64{}
 
+// 以下倍率均为相对模型倍率的附加倍率，未配置时使用 Get 函数中的默认值
+
+// CacheRatio 命中提示词缓存的输入 token 相对输入价格的倍率，未匹配的模型为 1
+var CacheRatio = map[string]float64{
+	"claude*":     0.1,
+	"deepseek*":   0.1,
+	"gpt-5*":      0.1,
+	"gpt-4.1*":    0.25,
+	"o3*":         0.25,
+	"o4*":         0.25,
+	"gemini-2.5*": 0.25,
+	"gpt-4o*":     0.5,
+	"chatgpt-4o*": 0.5,
+	"o1*":         0.5,
+}
+
+// CacheCreationRatio 写入提示词缓存的输入 token（Claude 的 cache_creation_input_tokens）相对输入价格的倍率，未匹配的模型为 1
+var CacheCreationRatio = map[string]float64{
+	"claude*": 1.25,
+}
+
+// ReasoningRatio 推理 token 相对补全价格的倍率，推理 token 包含在补全 token 中，默认与补全同价
+var ReasoningRatio = map[string]float64{}
+
+// ImageInputRatio 图片输入 token 相对输入价格的倍率
+var ImageInputRatio = map[string]float64{}
+
+// AudioRatio 音频输入 token 相对输入价格的倍率，音频输出再乘以 AudioCompletionRatio
+var AudioRatio = map[string]float64{}
+var AudioCompletionRatio = map[string]float64{}
+
+// ContextTier 长上下文分档，输入 token 超过 Threshold 时整个请求的输入、输出价格分别乘以对应倍率
+type ContextTier struct {
+	Threshold       int     `json:"threshold"`
+	PromptRatio     float64 `json:"prompt_ratio"`
+	CompletionRatio float64 `json:"completion_ratio"`
+}
+
+var ModelContextTiers = map[string][]ContextTier{
+	"claude-sonnet-4*": {{Threshold: 200000, PromptRatio: 2, CompletionRatio: 1.5}},
+	"gemini-2.5-pro*":  {{Threshold: 200000, PromptRatio: 2, CompletionRatio: 1.5}},
+	"gemini-1.5-pro*":  {{Threshold: 128000, PromptRatio: 2, CompletionRatio: 2}},
+}
+
+// 倍率中以通配符、正则表示的模型，更新倍率时重新编译
+var modelRatioPatterns = ModelPatternSetOf(ModelRatio)
+var modelPricePatterns = ModelPatternSetOf(ModelPrice)
+var completionRatioPatterns = ModelPatternSetOf(CompletionRatio)
+var cacheRatioPatterns = ModelPatternSetOf(CacheRatio)
+var cacheCreationRatioPatterns = ModelPatternSetOf(CacheCreationRatio)
+var reasoningRatioPatterns = ModelPatternSetOf(ReasoningRatio)
+var imageInputRatioPatterns = ModelPatternSetOf(ImageInputRatio)
+var audioRatioPatterns = ModelPatternSetOf(AudioRatio)
+var audioCompletionRatioPatterns = ModelPatternSetOf(AudioCompletionRatio)
+var modelContextTierPatterns = ModelPatternSetOf(ModelContextTiers)
+
 var DalleSizeRatios = map[string]map[string]float64{
 	"dall-e-2": {
 		"256x256":   1,
@@ -306,7 +379,9 @@ func ModelRatioJSONString() string {
 
 func UpdateModelRatioByJSONString(jsonStr string) error {
 	ModelRatio = make(map[string]float64)
-	return json.Unmarshal([]byte(jsonStr), &ModelRatio)
+	err := json.Unmarshal([]byte(jsonStr), &ModelRatio)
+	modelRatioPatterns = ModelPatternSetOf(ModelRatio)
+	return err
 }
 
 func ModelRatio2JSONString() string {
@@ -319,7 +394,9 @@ func ModelRatio2JSONString() string {
 
 func UpdateModelRatio2ByJSONString(jsonStr string) error {
 	ModelPrice = make(map[string]float64)
-	return json.Unmarshal([]byte(jsonStr), &ModelPrice)
+	err := json.Unmarshal([]byte(jsonStr), &ModelPrice)
+	modelPricePatterns = ModelPatternSetOf(ModelPrice)
+	return err
 }
 
 func GetModelRatio(name string) float64 {
@@ -328,6 +405,9 @@ func GetModelRatio(name string) float64 {
 	}
 	ratio, ok := ModelRatio[name]
 	if !ok {
+		if key, matched := modelRatioPatterns.Match(name); matched {
+			return ModelRatio[key]
+		}
 		SysError("model ratio not found: " + name)
 		return 15
 	}
@@ -340,6 +420,9 @@ func GetModelRatio2(name string) (float64, bool) {
 	}
 	ratio, ok := ModelPrice[name]
 	if !ok {
+		if key, matched := modelPricePatterns.Match(name); matched {
+			return ModelPrice[key], true
+		}
 		ratio, ok = ModelPrice["default"] // 尝试获取默认
 	}
 	return ratio, ok
@@ -354,13 +437,18 @@ func CompletionRatio2JSONString() string {
 }
 func UpdateCompletionRatioByJSONString(jsonStr string) error {
 	CompletionRatio = make(map[string]float64)
-	return json.Unmarshal([]byte(jsonStr), &CompletionRatio)
+	err := json.Unmarshal([]byte(jsonStr), &CompletionRatio)
+	completionRatioPatterns = ModelPatternSetOf(CompletionRatio)
+	return err
 }
 
 func GetCompletionRatio(name string) float64 {
 	if ratio, ok := CompletionRatio[name]; ok {
 		return ratio
 	}
+	if key, ok := completionRatioPatterns.Match(name); ok {
+		return CompletionRatio[key]
+	}
 	if strings.HasPrefix(name, "gpt-3.5") {
 		if strings.HasSuffix(name, "1106") {
 			return 2
@@ -446,6 +534,9 @@ func GetCompletionRatio(name string) float64 {
 }
 
 func GetAudioRatio(name string) float64 {
+	if ratio, ok := LookupModelMap(AudioRatio, audioRatioPatterns, name); ok {
+		return ratio
+	}
 	if strings.HasPrefix(name, "gpt-4o-realtime") {
 		return 20
 	} else if strings.HasPrefix(name, "gpt-4o-audio") {
@@ -454,8 +545,138 @@ func GetAudioRatio(name string) float64 {
 	return 20
 }
 func GetAudioCompletionRatio(name string) float64 {
+	if ratio, ok := LookupModelMap(AudioCompletionRatio, audioCompletionRatioPatterns, name); ok {
+		return ratio
+	}
 	if strings.HasPrefix(name, "gpt-4o-realtime") {
 		return 2
 	}
 	return 2
 }
+
+func GetCacheRatio(name string) float64 {
+	if ratio, ok := LookupModelMap(CacheRatio, cacheRatioPatterns, name); ok {
+		return ratio
+	}
+	return 1
+}
+
+func GetCacheCreationRatio(name string) float64 {
+	if ratio, ok := LookupModelMap(CacheCreationRatio, cacheCreationRatioPatterns, name); ok {
+		return ratio
+	}
+	return 1
+}
+
+func GetReasoningRatio(name string) float64 {
+	if ratio, ok := LookupModelMap(ReasoningRatio, reasoningRatioPatterns, name); ok {
+		return ratio
+	}
+	return 1
+}
+
+func GetImageInputRatio(name string) float64 {
+	if ratio, ok := LookupModelMap(ImageInputRatio, imageInputRatioPatterns, name); ok {
+		return ratio
+	}
+	return 1
+}
+
+// GetContextTier 返回输入 token 数超过的最高一档
+func GetContextTier(name string, promptTokens int) (ContextTier, bool) {
+	var matched ContextTier
+	found := false
+	tiers, _ := LookupModelMap(ModelContextTiers, modelContextTierPatterns, name)
+	for _, tier := range tiers {
+		if promptTokens > tier.Threshold && (!found || tier.Threshold > matched.Threshold) {
+			matched = tier
+			found = true
+		}
+	}
+	return matched, found
+}
+
+func ratioMap2JSONString(name string, m any) string {
+	jsonBytes, err := json.Marshal(m)
+	if err != nil {
+		SysError("error marshalling " + name + ": " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func CacheRatio2JSONString() string {
+	return ratioMap2JSONString("cache ratio", CacheRatio)
+}
+
+func UpdateCacheRatioByJSONString(jsonStr string) error {
+	CacheRatio = make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &CacheRatio)
+	cacheRatioPatterns = ModelPatternSetOf(CacheRatio)
+	return err
+}
+
+func CacheCreationRatio2JSONString() string {
+	return ratioMap2JSONString("cache creation ratio", CacheCreationRatio)
+}
+
+func UpdateCacheCreationRatioByJSONString(jsonStr string) error {
+	CacheCreationRatio = make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &CacheCreationRatio)
+	cacheCreationRatioPatterns = ModelPatternSetOf(CacheCreationRatio)
+	return err
+}
+
+func ReasoningRatio2JSONString() string {
+	return ratioMap2JSONString("reasoning ratio", ReasoningRatio)
+}
+
+func UpdateReasoningRatioByJSONString(jsonStr string) error {
+	ReasoningRatio = make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &ReasoningRatio)
+	reasoningRatioPatterns = ModelPatternSetOf(ReasoningRatio)
+	return err
+}
+
+func ImageInputRatio2JSONString() string {
+	return ratioMap2JSONString("image input ratio", ImageInputRatio)
+}
+
+func UpdateImageInputRatioByJSONString(jsonStr string) error {
+	ImageInputRatio = make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &ImageInputRatio)
+	imageInputRatioPatterns = ModelPatternSetOf(ImageInputRatio)
+	return err
+}
+
+func AudioRatio2JSONString() string {
+	return ratioMap2JSONString("audio ratio", AudioRatio)
+}
+
+func UpdateAudioRatioByJSONString(jsonStr string) error {
+	AudioRatio = make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &AudioRatio)
+	audioRatioPatterns = ModelPatternSetOf(AudioRatio)
+	return err
+}
+
+func AudioCompletionRatio2JSONString() string {
+	return ratioMap2JSONString("audio completion ratio", AudioCompletionRatio)
+}
+
+func UpdateAudioCompletionRatioByJSONString(jsonStr string) error {
+	AudioCompletionRatio = make(map[string]float64)
+	err := json.Unmarshal([]byte(jsonStr), &AudioCompletionRatio)
+	audioCompletionRatioPatterns = ModelPatternSetOf(AudioCompletionRatio)
+	return err
+}
+
+func ModelContextTiers2JSONString() string {
+	return ratioMap2JSONString("model context tiers", ModelContextTiers)
+}
+
+func UpdateModelContextTiersByJSONString(jsonStr string) error {
+	ModelContextTiers = make(map[string][]ContextTier)
+	err := json.Unmarshal([]byte(jsonStr), &ModelContextTiers)
+	modelContextTierPatterns = ModelPatternSetOf(ModelContextTiers)
+	return err
+}
@@ -0,0 +1,41 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetCacheRatio(t *testing.T) {
+	cases := []struct {
+		name          string
+		cacheRatio    float64
+		creationRatio float64
+	}{
+		{"claude-sonnet-4-20250514", 0.1, 1.25},
+		{"deepseek-chat", 0.1, 1},
+		{"gpt-5-mini", 0.1, 1},
+		{"gpt-4.1-nano", 0.25, 1},
+		{"o4-mini", 0.25, 1},
+		{"gemini-2.5-pro", 0.25, 1},
+		{"gpt-4o-mini", 0.5, 1},
+		{"o1-preview", 0.5, 1},
+		{"gpt-3.5-turbo", 1, 1},
+	}
+	Convey("default cache ratios", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				So(GetCacheRatio(c.name), ShouldEqual, c.cacheRatio)
+				So(GetCacheCreationRatio(c.name), ShouldEqual, c.creationRatio)
+			})
+		}
+	})
+	Convey("configured cache ratios replace the defaults", t, func() {
+		defaults := CacheRatio2JSONString()
+		defer UpdateCacheRatioByJSONString(defaults)
+		So(UpdateCacheRatioByJSONString(`{"claude-3-haiku*":0.2}`), ShouldBeNil)
+		So(GetCacheRatio("claude-3-haiku-20240307"), ShouldEqual, 0.2)
+		So(GetCacheRatio("claude-sonnet-4-20250514"), ShouldEqual, 1)
+		So(GetCacheRatio("gpt-4o"), ShouldEqual, 1)
+	})
+}
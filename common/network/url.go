@@ -0,0 +1,46 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// isPublicIP 判断地址是否为公网地址，回环、内网、链路本地等地址都不是公网地址
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// ValidatePublicURL 校验地址的协议在 schemes 中，并且主机解析到的所有地址都是公网地址
+func ValidatePublicURL(rawURL string, schemes ...string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	allowed := false
+	for _, scheme := range schemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("url has no host")
+	}
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve host %s: %w", host, err)
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return fmt.Errorf("host %s resolves to non-public address %s", host, ip.String())
+		}
+	}
+	return nil
+}
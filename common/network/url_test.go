@@ -0,0 +1,34 @@
+package network
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidatePublicURL(t *testing.T) {
+	cases := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://1.1.1.1/v1", true},
+		{"http://1.1.1.1", true},
+		{"ftp://1.1.1.1", false},
+		{"https://", false},
+		{"https://127.0.0.1", false},
+		{"https://10.0.0.1", false},
+		{"https://192.168.1.1:8080", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://0.0.0.0", false},
+		{"https://[::1]", false},
+		{"https://224.0.0.1", false},
+	}
+	Convey("TestValidatePublicURL", t, func() {
+		for _, c := range cases {
+			Convey(c.url, func() {
+				err := ValidatePublicURL(c.url, "http", "https")
+				So(err == nil, ShouldEqual, c.ok)
+			})
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package common
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// PaymentCurrency 某个币种使用的支付服务商，Rate 为该币种相对人民币价格的汇率
+type PaymentCurrency struct {
+	Provider string  `json:"provider"`
+	Rate     float64 `json:"rate"`
+}
+
+// DefaultPaymentCurrency 没有指定币种时按人民币收款
+const DefaultPaymentCurrency = "CNY"
+
+var PaymentCurrencies = map[string]PaymentCurrency{
+	"CNY": {Provider: "epay", Rate: 1},
+	"USD": {Provider: "stripe", Rate: 0.137},
+}
+
+func PaymentCurrencies2JSONString() string {
+	jsonBytes, err := json.Marshal(PaymentCurrencies)
+	if err != nil {
+		SysError("error marshalling payment currencies: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdatePaymentCurrenciesByJSONString(jsonStr string) error {
+	currencies := make(map[string]PaymentCurrency)
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &currencies); err != nil {
+			return err
+		}
+	}
+	PaymentCurrencies = currencies
+	return nil
+}
+
+func GetPaymentCurrency(currency string) (string, PaymentCurrency, bool) {
+	if currency == "" {
+		currency = DefaultPaymentCurrency
+	}
+	currency = strings.ToUpper(currency)
+	paymentCurrency, ok := PaymentCurrencies[currency]
+	return currency, paymentCurrency, ok
+}
@@ -0,0 +1,160 @@
+package common
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 按分钟统计的滑动窗口计数器，使用前后两个固定窗口按时间加权近似，
+// 开启 Redis 时多实例共享计数，供 RPM/TPM 限流使用
+
+const rateWindowSeconds = 60
+
+// RateWindowReset 返回当前计数窗口结束前的秒数
+func RateWindowReset() int64 {
+	return rateWindowSeconds - time.Now().Unix()%rateWindowSeconds
+}
+
+type windowCounter struct {
+	window  int64
+	current int64
+	prev    int64
+}
+
+var windowCounters = make(map[string]*windowCounter)
+var windowCountersLock sync.Mutex
+
+// RateWindowUsage 返回最近一分钟内的用量估计
+func RateWindowUsage(key string) int64 {
+	now := time.Now().Unix()
+	window := now / rateWindowSeconds
+	var current, prev int64
+	if RedisEnabled {
+		values, err := RDB.MGet(context.Background(), rateWindowRedisKey(key, window), rateWindowRedisKey(key, window-1)).Result()
+		if err != nil {
+			SysError("failed to get rate window usage: " + err.Error())
+			return 0
+		}
+		current = parseRedisInt(values[0])
+		prev = parseRedisInt(values[1])
+	} else {
+		windowCountersLock.Lock()
+		if counter, ok := windowCounters[key]; ok {
+			current, prev = counter.valuesAt(window)
+		}
+		windowCountersLock.Unlock()
+	}
+	elapsed := now % rateWindowSeconds
+	return current + prev*(rateWindowSeconds-elapsed)/rateWindowSeconds
+}
+
+func RateWindowAdd(key string, n int64) {
+	window := time.Now().Unix() / rateWindowSeconds
+	if RedisEnabled {
+		ctx := context.Background()
+		redisKey := rateWindowRedisKey(key, window)
+		pipe := RDB.TxPipeline()
+		pipe.IncrBy(ctx, redisKey, n)
+		pipe.Expire(ctx, redisKey, 2*rateWindowSeconds*time.Second)
+		if _, err := pipe.Exec(ctx); err != nil {
+			SysError("failed to update rate window usage: " + err.Error())
+		}
+		return
+	}
+	windowCountersLock.Lock()
+	defer windowCountersLock.Unlock()
+	counter, ok := windowCounters[key]
+	if !ok {
+		if len(windowCounters) > 10000 {
+			cleanWindowCounters(window)
+		}
+		counter = &windowCounter{window: window}
+		windowCounters[key] = counter
+	}
+	counter.current, counter.prev = counter.valuesAt(window)
+	counter.window = window
+	counter.current += n
+}
+
+// rateWindowTakeScript 计入用量后按两个窗口加权估计最近一分钟的用量，超过上限时撤销，
+// 返回 {是否通过, 用量}，通过时用量包含本次计入的部分
+const rateWindowTakeScript = `
+	local current = redis.call('INCRBY', KEYS[1], ARGV[1])
+	redis.call('EXPIRE', KEYS[1], ARGV[4])
+	local prev = tonumber(redis.call('GET', KEYS[2]) or '0')
+	local used = current + math.floor(prev * tonumber(ARGV[2]) / tonumber(ARGV[5]))
+	if used > tonumber(ARGV[3]) then
+		redis.call('DECRBY', KEYS[1], ARGV[1])
+		return {0, used - tonumber(ARGV[1])}
+	end
+	return {1, used}
+`
+
+// RateWindowTake 原子地检查并计入用量，计入 n 后超过 limit 时不计入并返回 false，
+// 返回的用量为最近一分钟内的用量估计，通过时包含本次计入的部分
+func RateWindowTake(key string, n int64, limit int64) (int64, bool) {
+	now := time.Now().Unix()
+	window := now / rateWindowSeconds
+	weight := rateWindowSeconds - now%rateWindowSeconds
+	if RedisEnabled {
+		keys := []string{rateWindowRedisKey(key, window), rateWindowRedisKey(key, window-1)}
+		result, err := RDB.Eval(context.Background(), rateWindowTakeScript, keys, n, weight, limit, 2*rateWindowSeconds, rateWindowSeconds).Int64Slice()
+		if err != nil {
+			SysError("failed to take rate window usage: " + err.Error())
+			return 0, true
+		}
+		return result[1], result[0] == 1
+	}
+	windowCountersLock.Lock()
+	defer windowCountersLock.Unlock()
+	counter, ok := windowCounters[key]
+	if !ok {
+		if len(windowCounters) > 10000 {
+			cleanWindowCounters(window)
+		}
+		counter = &windowCounter{window: window}
+		windowCounters[key] = counter
+	}
+	counter.current, counter.prev = counter.valuesAt(window)
+	counter.window = window
+	used := counter.current + counter.prev*weight/rateWindowSeconds
+	if used+n > limit {
+		return used, false
+	}
+	counter.current += n
+	return used + n, true
+}
+
+func (c *windowCounter) valuesAt(window int64) (int64, int64) {
+	switch window - c.window {
+	case 0:
+		return c.current, c.prev
+	case 1:
+		return 0, c.current
+	default:
+		return 0, 0
+	}
+}
+
+func cleanWindowCounters(window int64) {
+	for key, counter := range windowCounters {
+		if window-counter.window > 1 {
+			delete(windowCounters, key)
+		}
+	}
+}
+
+func rateWindowRedisKey(key string, window int64) string {
+	return "rateWindow:" + key + ":" + strconv.FormatInt(window, 10)
+}
+
+func parseRedisInt(value interface{}) int64 {
+	s, ok := value.(string)
+	if !ok {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
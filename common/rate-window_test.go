@@ -0,0 +1,54 @@
+package common
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateWindowTake(t *testing.T) {
+	RedisEnabled = false
+	Convey("RateWindowTake", t, func() {
+		Convey("rejects once the limit is reached without counting the rejected request", func() {
+			key := "test:take:limit"
+			for i := int64(1); i <= 3; i++ {
+				used, ok := RateWindowTake(key, 1, 3)
+				So(ok, ShouldBeTrue)
+				So(used, ShouldEqual, i)
+			}
+			used, ok := RateWindowTake(key, 1, 3)
+			So(ok, ShouldBeFalse)
+			So(used, ShouldEqual, 3)
+			So(RateWindowUsage(key), ShouldEqual, 3)
+		})
+		Convey("rolled back usage frees the slot", func() {
+			key := "test:take:rollback"
+			_, ok := RateWindowTake(key, 1, 1)
+			So(ok, ShouldBeTrue)
+			RateWindowAdd(key, -1)
+			_, ok = RateWindowTake(key, 1, 1)
+			So(ok, ShouldBeTrue)
+		})
+		Convey("concurrent takes never exceed the limit", func() {
+			key := "test:take:concurrent"
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			passed := 0
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, ok := RateWindowTake(key, 1, 10); ok {
+						mu.Lock()
+						passed++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			So(passed, ShouldEqual, 10)
+			So(RateWindowUsage(key), ShouldEqual, 10)
+		})
+	})
+}
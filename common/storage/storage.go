@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"one-api/common"
+	"sync"
+)
+
+// Storage 文件存储后端，name 为后端内部使用的相对路径
+type Storage interface {
+	Save(name string, reader io.Reader) (int64, error)
+	Open(name string) (io.ReadCloser, error)
+	Delete(name string) error
+}
+
+var StorageType = common.GetOrDefaultString("FILE_STORAGE_TYPE", "local")
+var LocalStoragePath = common.GetOrDefaultString("FILE_STORAGE_PATH", "./files")
+
+var (
+	backends   = map[string]func() (Storage, error){}
+	backendsMu sync.Mutex
+	instance   Storage
+	initErr    error
+	initOnce   sync.Once
+)
+
+func init() {
+	Register("local", func() (Storage, error) {
+		return NewLocalStorage(LocalStoragePath)
+	})
+}
+
+// Register 注册存储后端，需在首次调用 GetStorage 之前完成
+func Register(name string, factory func() (Storage, error)) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = factory
+}
+
+// GetStorage 返回 FILE_STORAGE_TYPE 指定的存储后端
+func GetStorage() (Storage, error) {
+	initOnce.Do(func() {
+		backendsMu.Lock()
+		factory, ok := backends[StorageType]
+		backendsMu.Unlock()
+		if !ok {
+			initErr = fmt.Errorf("unknown file storage type: %s", StorageType)
+			return
+		}
+		instance, initErr = factory()
+	})
+	return instance, initErr
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// VirtualModels 网关层的虚拟模型，请求虚拟模型时按顺序使用对应的真实模型，
+// 当前模型失败或没有可用渠道时切换到下一个，例如 {"smart": ["claude-sonnet", "gpt-4o"]}
+var VirtualModels = map[string][]string{}
+
+func VirtualModels2JSONString() string {
+	jsonBytes, err := json.Marshal(VirtualModels)
+	if err != nil {
+		SysError("error marshalling virtual models: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateVirtualModelsByJSONString(jsonStr string) error {
+	models := make(map[string][]string)
+	if jsonStr != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &models); err != nil {
+			return err
+		}
+	}
+	for name, chain := range models {
+		if len(chain) == 0 {
+			return fmt.Errorf("virtual model %q has no models", name)
+		}
+		for _, model := range chain {
+			if _, ok := models[model]; ok || model == "" {
+				return fmt.Errorf("invalid model %q in virtual model %q", model, name)
+			}
+		}
+	}
+	VirtualModels = models
+	return nil
+}
+
+func GetVirtualModelChain(name string) ([]string, bool) {
+	chain, ok := VirtualModels[name]
+	return chain, ok
+}
+
+// AvailableVirtualModels 返回至少有一个真实模型在 models 中的虚拟模型
+func AvailableVirtualModels(models []string) []string {
+	modelSet := make(map[string]bool, len(models))
+	for _, model := range models {
+		modelSet[model] = true
+	}
+	var available []string
+	for name, chain := range VirtualModels {
+		for _, model := range chain {
+			if modelSet[model] {
+				available = append(available, name)
+				break
+			}
+		}
+	}
+	return available
+}
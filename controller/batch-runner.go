@@ -0,0 +1,607 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/common/config"
+	"one-api/common/storage"
+	"one-api/middleware"
+	"one-api/model"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	batchMaxRequests   = 50000
+	batchMaxLineErrors = 100
+	batchMaxRetries    = 3
+	batchWatchInterval = 5 * time.Second
+)
+
+type batchRequestLine struct {
+	CustomId string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	Url      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+type batchResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestId  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type batchResultLine struct {
+	Id       string         `json:"id"`
+	CustomId string         `json:"custom_id"`
+	Response *batchResponse `json:"response"`
+	Error    *BatchError    `json:"error"`
+}
+
+var (
+	batchNotify     = make(chan struct{}, 1)
+	runningBatches  sync.Map // batch id -> struct{}
+	runningBatchNum int32
+
+	batchEngine     *gin.Engine
+	batchEngineOnce sync.Once
+)
+
+func notifyBatchRunner() {
+	select {
+	case batchNotify <- struct{}{}:
+	default:
+	}
+}
+
+// getBatchEngine 内部使用的 gin 引擎，批处理的每一行都走与线上请求相同的鉴权、分发和转发流程
+func getBatchEngine() *gin.Engine {
+	batchEngineOnce.Do(func() {
+		engine := gin.New()
+		engine.Use(middleware.RequestId(), func(c *gin.Context) {
+			c.Set("is_batch", true)
+			c.Next()
+		}, middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.GroupModelRateLimit(), middleware.Distribute())
+		for _, endpoint := range batchEndpoints {
+			engine.POST(endpoint, Relay)
+		}
+		batchEngine = engine
+	})
+	return batchEngine
+}
+
+// StartBatchRunner 仅在主节点运行，负责执行和收尾所有批处理任务
+func StartBatchRunner() {
+	for {
+		scheduleBatches()
+		select {
+		case <-batchNotify:
+		case <-time.After(10 * time.Second):
+		}
+	}
+}
+
+func scheduleBatches() {
+	// 先处理需要收尾的任务，再恢复中断的任务，最后启动新任务
+	statuses := []string{
+		model.BatchStatusCancelling,
+		model.BatchStatusFinalizing,
+		model.BatchStatusInProgress,
+		model.BatchStatusValidating,
+	}
+	for _, status := range statuses {
+		batches, err := model.GetBatchesByStatus(status, 100)
+		if err != nil {
+			common.SysError("failed to get batches: " + err.Error())
+			return
+		}
+		for _, batch := range batches {
+			if atomic.LoadInt32(&runningBatchNum) >= int32(common.BatchMaxRunning) {
+				return
+			}
+			if _, loaded := runningBatches.LoadOrStore(batch.Id, struct{}{}); loaded {
+				continue
+			}
+			atomic.AddInt32(&runningBatchNum, 1)
+			go func(batch *model.Batch) {
+				defer func() {
+					if err := recover(); err != nil {
+						common.SysError(fmt.Sprintf("batch %s panic: %v", batch.BatchId, err))
+					}
+					runningBatches.Delete(batch.Id)
+					atomic.AddInt32(&runningBatchNum, -1)
+					notifyBatchRunner()
+				}()
+				runner := &batchRunner{batch: batch, workDir: filepath.Join(common.BatchWorkPath, batch.BatchId)}
+				runner.run()
+			}(batch)
+		}
+	}
+}
+
+type batchRunner struct {
+	batch   *model.Batch
+	workDir string
+
+	mu        sync.Mutex
+	done      map[string]bool
+	completed int
+	failed    int
+	output    *os.File
+	errOutput *os.File
+}
+
+func (r *batchRunner) run() {
+	if r.batch.Status == model.BatchStatusValidating {
+		if !r.validate() {
+			return
+		}
+	}
+	if r.batch.Status == model.BatchStatusInProgress {
+		if err := r.execute(); err != nil {
+			common.SysError(fmt.Sprintf("batch %s execute failed: %s", r.batch.BatchId, err.Error()))
+			r.fail("server_error", err.Error())
+			return
+		}
+	}
+	if err := r.finalize(); err != nil {
+		common.SysError(fmt.Sprintf("batch %s finalize failed: %s", r.batch.BatchId, err.Error()))
+	}
+}
+
+func (r *batchRunner) reload() error {
+	batch, err := model.GetBatchById(r.batch.Id)
+	if err != nil {
+		return err
+	}
+	r.batch = batch
+	return nil
+}
+
+func (r *batchRunner) fail(code string, message string) {
+	r.failWithErrors([]BatchError{{Code: code, Message: message}})
+}
+
+func (r *batchRunner) failWithErrors(batchErrors []BatchError) {
+	data, _ := json.Marshal(batchErrors)
+	_, err := model.UpdateBatchStatus(r.batch.Id, []string{model.BatchStatusValidating, model.BatchStatusInProgress}, model.BatchStatusFailed, map[string]interface{}{
+		"errors":    string(data),
+		"failed_at": common.GetTimestamp(),
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("batch %s update status failed: %s", r.batch.BatchId, err.Error()))
+	}
+	_ = os.RemoveAll(r.workDir)
+}
+
+// readInput 逐行读取输入文件，lineNo 从 1 开始，空行会被跳过
+func (r *batchRunner) readInput(fn func(lineNo int, line []byte) bool) error {
+	file, err := model.GetUserFileByFileId(r.batch.UserId, r.batch.InputFileId)
+	if err != nil {
+		return err
+	}
+	store, err := storage.GetStorage()
+	if err != nil {
+		return err
+	}
+	reader, err := store.Open(file.StorageName)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	buf := bufio.NewReader(reader)
+	for lineNo := 1; ; lineNo++ {
+		line, err := buf.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && !fn(lineNo, line) {
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *batchRunner) parseLine(lineNo int, line []byte, seen map[string]bool) (*batchRequestLine, *BatchError) {
+	lineError := func(code string, message string) *BatchError {
+		return &BatchError{Code: code, Message: message, Line: &lineNo}
+	}
+	var request batchRequestLine
+	if err := json.Unmarshal(line, &request); err != nil {
+		return nil, lineError("invalid_json_line", "This line is not parseable as valid JSON.")
+	}
+	if request.CustomId == "" {
+		return nil, lineError("missing_required_parameter", "Missing required parameter: 'custom_id'.")
+	}
+	if seen != nil {
+		if seen[request.CustomId] {
+			return nil, lineError("duplicate_custom_id", fmt.Sprintf("The custom_id '%s' is duplicated.", request.CustomId))
+		}
+		seen[request.CustomId] = true
+	}
+	if request.Method != http.MethodPost {
+		return nil, lineError("invalid_method", "Only the POST method is supported.")
+	}
+	if request.Url != r.batch.Endpoint {
+		return nil, lineError("mismatched_endpoint", fmt.Sprintf("The url '%s' does not match the batch endpoint '%s'.", request.Url, r.batch.Endpoint))
+	}
+	var body struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(request.Body, &body); err != nil || body.Model == "" {
+		return nil, lineError("missing_model", "The body must be a JSON object with a 'model' field.")
+	}
+	return &request, nil
+}
+
+func (r *batchRunner) validate() bool {
+	seen := make(map[string]bool)
+	var lineErrors []BatchError
+	total := 0
+	err := r.readInput(func(lineNo int, line []byte) bool {
+		total++
+		if total > batchMaxRequests {
+			lineErrors = append(lineErrors, BatchError{Code: "too_many_requests", Message: fmt.Sprintf("The input file contains more than %d requests.", batchMaxRequests)})
+			return false
+		}
+		if _, lineErr := r.parseLine(lineNo, line, seen); lineErr != nil {
+			lineErrors = append(lineErrors, *lineErr)
+		}
+		return len(lineErrors) < batchMaxLineErrors
+	})
+	if err != nil {
+		r.fail("invalid_input_file", err.Error())
+		return false
+	}
+	if total == 0 {
+		lineErrors = append(lineErrors, BatchError{Code: "empty_file", Message: "The input file is empty."})
+	}
+	if len(lineErrors) > 0 {
+		r.failWithErrors(lineErrors)
+		return false
+	}
+	ok, err := model.UpdateBatchStatus(r.batch.Id, []string{model.BatchStatusValidating}, model.BatchStatusInProgress, map[string]interface{}{
+		"in_progress_at": common.GetTimestamp(),
+		"request_total":  total,
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("batch %s update status failed: %s", r.batch.BatchId, err.Error()))
+		return false
+	}
+	if !ok {
+		// 校验期间被取消
+		return false
+	}
+	return r.reload() == nil
+}
+
+// loadResults 读取上次中断前已写入的结果，丢弃写了一半的行
+func (r *batchRunner) loadResults(path string) (*os.File, int, error) {
+	count := 0
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, 0, err
+	}
+	var valid bytes.Buffer
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var result batchResultLine
+		if len(line) == 0 || json.Unmarshal(line, &result) != nil {
+			continue
+		}
+		r.done[result.CustomId] = true
+		valid.Write(line)
+		valid.WriteByte('\n')
+		count++
+	}
+	if err := os.WriteFile(path, valid.Bytes(), 0640); err != nil {
+		return nil, 0, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0640)
+	return file, count, err
+}
+
+func (r *batchRunner) openResults() (err error) {
+	if err = os.MkdirAll(r.workDir, 0750); err != nil {
+		return err
+	}
+	r.done = make(map[string]bool)
+	r.output, r.completed, err = r.loadResults(filepath.Join(r.workDir, "output.jsonl"))
+	if err != nil {
+		return err
+	}
+	r.errOutput, r.failed, err = r.loadResults(filepath.Join(r.workDir, "error.jsonl"))
+	return err
+}
+
+func (r *batchRunner) closeResults() {
+	if r.output != nil {
+		_ = r.output.Close()
+	}
+	if r.errOutput != nil {
+		_ = r.errOutput.Close()
+	}
+}
+
+func (r *batchRunner) writeResult(result *batchResultLine) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		common.SysError(fmt.Sprintf("batch %s marshal result failed: %s", r.batch.BatchId, err.Error()))
+		return
+	}
+	data = append(data, '\n')
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done[result.CustomId] {
+		return
+	}
+	success := result.Error == nil && result.Response != nil && result.Response.StatusCode/100 == 2
+	file := r.errOutput
+	if success {
+		file = r.output
+	}
+	if _, err := file.Write(data); err != nil {
+		common.SysError(fmt.Sprintf("batch %s write result failed: %s", r.batch.BatchId, err.Error()))
+		return
+	}
+	r.done[result.CustomId] = true
+	if success {
+		r.completed++
+	} else {
+		r.failed++
+	}
+}
+
+func (r *batchRunner) isDone(customId string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done[customId]
+}
+
+func (r *batchRunner) saveProgress() {
+	r.mu.Lock()
+	r.batch.RequestCompleted = r.completed
+	r.batch.RequestFailed = r.failed
+	r.mu.Unlock()
+	if err := r.batch.Update("request_completed", "request_failed"); err != nil {
+		common.SysError(fmt.Sprintf("batch %s save progress failed: %s", r.batch.BatchId, err.Error()))
+	}
+}
+
+// watch 定期保存进度，并在任务被取消时中止执行
+func (r *batchRunner) watch(ctx context.Context, cancel context.CancelFunc) {
+	ticker := time.NewTicker(batchWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.saveProgress()
+		batch, err := model.GetBatchById(r.batch.Id)
+		if err == nil && batch.Status == model.BatchStatusCancelling {
+			cancel()
+			return
+		}
+	}
+}
+
+func (r *batchRunner) execute() error {
+	token, err := model.GetTokenById(r.batch.TokenId)
+	if err != nil {
+		return fmt.Errorf("failed to get token: %w", err)
+	}
+	if err := r.openResults(); err != nil {
+		return err
+	}
+	defer r.closeResults()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Unix(r.batch.ExpiresAt, 0))
+	defer cancel()
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	go r.watch(watchCtx, cancel)
+
+	concurrency := config.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	err = r.readInput(func(lineNo int, line []byte) bool {
+		request, lineErr := r.parseLine(lineNo, line, nil)
+		if lineErr != nil || r.isDone(request.CustomId) {
+			return true
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return false
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if result := r.do(ctx, token.Key, request); result != nil {
+				r.writeResult(result)
+			}
+		}()
+		return true
+	})
+	wg.Wait()
+	stopWatch()
+	if err != nil {
+		return err
+	}
+
+	expired := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if expired {
+		// 超时未执行的请求写入错误文件
+		err = r.readInput(func(lineNo int, line []byte) bool {
+			request, lineErr := r.parseLine(lineNo, line, nil)
+			if lineErr == nil && !r.isDone(request.CustomId) {
+				r.writeResult(&batchResultLine{
+					Id:       "batch_req_" + common.GetRandomString(24),
+					CustomId: request.CustomId,
+					Error:    &BatchError{Code: "batch_expired", Message: "This request could not be executed before the completion window expired."},
+				})
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	r.saveProgress()
+
+	now := common.GetTimestamp()
+	fields := map[string]interface{}{"finalizing_at": now}
+	if expired {
+		fields["expired_at"] = now
+	}
+	if _, err := model.UpdateBatchStatus(r.batch.Id, []string{model.BatchStatusInProgress}, model.BatchStatusFinalizing, fields); err != nil {
+		return err
+	}
+	return r.reload()
+}
+
+// do 通过内部引擎执行一行请求，批处理被取消时返回 nil，该行不计入结果
+func (r *batchRunner) do(ctx context.Context, key string, request *batchRequestLine) *batchResultLine {
+	result := &batchResultLine{
+		Id:       "batch_req_" + common.GetRandomString(24),
+		CustomId: request.CustomId,
+	}
+	var body map[string]json.RawMessage
+	_ = json.Unmarshal(request.Body, &body)
+	// 批处理只返回完整响应
+	delete(body, "stream")
+	delete(body, "stream_options")
+	requestBody, _ := json.Marshal(body)
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, request.Method, request.Url, bytes.NewReader(requestBody))
+		if err != nil {
+			result.Error = &BatchError{Code: "invalid_request", Message: err.Error()}
+			return result
+		}
+		req.Header.Set("Authorization", "Bearer sk-"+key)
+		req.Header.Set("Content-Type", "application/json")
+		recorder := httptest.NewRecorder()
+		getBatchEngine().ServeHTTP(recorder, req)
+		if ctx.Err() != nil {
+			return nil
+		}
+		statusCode := recorder.Code
+		if (statusCode == http.StatusTooManyRequests || statusCode >= 500) && attempt < batchMaxRetries {
+			select {
+			case <-time.After(time.Duration(1<<attempt) * time.Second):
+				continue
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		responseBody := recorder.Body.Bytes()
+		if !json.Valid(responseBody) {
+			responseBody, _ = json.Marshal(string(responseBody))
+		}
+		result.Response = &batchResponse{
+			StatusCode: statusCode,
+			RequestId:  recorder.Header().Get(common.RequestIdKey),
+			Body:       responseBody,
+		}
+		return result
+	}
+}
+
+// saveResultFile 把结果文件保存为用户文件，文件为空时返回空 file_id
+func (r *batchRunner) saveResultFile(name string, suffix string) (string, error) {
+	path := filepath.Join(r.workDir, name)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && info.Size() == 0) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	store, err := storage.GetStorage()
+	if err != nil {
+		return "", err
+	}
+	file := &model.File{
+		FileId:    model.NewFileId(),
+		UserId:    r.batch.UserId,
+		TokenId:   r.batch.TokenId,
+		Filename:  fmt.Sprintf("%s_%s.jsonl", r.batch.BatchId, suffix),
+		Purpose:   model.FilePurposeBatchOutput,
+		Status:    model.FileStatusProcessed,
+		CreatedAt: common.GetTimestamp(),
+	}
+	file.StorageName = fmt.Sprintf("%d/%s", file.UserId, file.FileId)
+	file.Bytes, err = store.Save(file.StorageName, src)
+	if err != nil {
+		return "", err
+	}
+	if err := file.Insert(); err != nil {
+		_ = store.Delete(file.StorageName)
+		return "", err
+	}
+	return file.FileId, nil
+}
+
+func (r *batchRunner) finalize() error {
+	if r.batch.Status != model.BatchStatusFinalizing && r.batch.Status != model.BatchStatusCancelling {
+		return nil
+	}
+	var err error
+	fields := map[string]interface{}{}
+	if r.batch.OutputFileId == "" {
+		if r.batch.OutputFileId, err = r.saveResultFile("output.jsonl", "output"); err != nil {
+			return err
+		}
+		fields["output_file_id"] = r.batch.OutputFileId
+	}
+	if r.batch.ErrorFileId == "" {
+		if r.batch.ErrorFileId, err = r.saveResultFile("error.jsonl", "error"); err != nil {
+			return err
+		}
+		fields["error_file_id"] = r.batch.ErrorFileId
+	}
+	now := common.GetTimestamp()
+	status := model.BatchStatusCompleted
+	switch {
+	case r.batch.Status == model.BatchStatusCancelling:
+		status = model.BatchStatusCancelled
+		fields["cancelled_at"] = now
+	case r.batch.ExpiredAt > 0:
+		status = model.BatchStatusExpired
+	default:
+		fields["completed_at"] = now
+	}
+	if _, err := model.UpdateBatchStatus(r.batch.Id, []string{r.batch.Status}, status, fields); err != nil {
+		return err
+	}
+	common.SysLog(fmt.Sprintf("batch %s %s, completed %d, failed %d", r.batch.BatchId, status, r.batch.RequestCompleted, r.batch.RequestFailed))
+	return os.RemoveAll(r.workDir)
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"one-api/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestBatchRunner(t *testing.T, input string) *batchRunner {
+	file := createTestFile(1, input)
+	batch := &model.Batch{
+		BatchId:     model.NewBatchId(),
+		UserId:      1,
+		Endpoint:    "/v1/chat/completions",
+		InputFileId: file.FileId,
+		Status:      model.BatchStatusValidating,
+	}
+	if err := batch.Insert(); err != nil {
+		panic(err)
+	}
+	return &batchRunner{batch: batch, workDir: filepath.Join(t.TempDir(), batch.BatchId)}
+}
+
+func batchRequest(customId string, url string, body string) string {
+	return `{"custom_id":"` + customId + `","method":"POST","url":"` + url + `","body":` + body + "}\n"
+}
+
+func TestBatchRunnerValidate(t *testing.T) {
+	body := `{"model":"gpt-4o-mini","messages":[]}`
+	Convey("batchRunner.validate", t, func() {
+		Convey("valid input starts the batch", func() {
+			runner := newTestBatchRunner(t, batchRequest("a", "/v1/chat/completions", body)+"\n"+batchRequest("b", "/v1/chat/completions", body))
+			So(runner.validate(), ShouldBeTrue)
+			So(runner.batch.Status, ShouldEqual, model.BatchStatusInProgress)
+			So(runner.batch.RequestTotal, ShouldEqual, 2)
+		})
+		Convey("invalid lines fail the batch with their line numbers", func() {
+			input := "not json\n" +
+				batchRequest("", "/v1/chat/completions", body) +
+				batchRequest("a", "/v1/chat/completions", body) +
+				batchRequest("a", "/v1/chat/completions", body) +
+				batchRequest("b", "/v1/embeddings", body) +
+				batchRequest("c", "/v1/chat/completions", `{"messages":[]}`)
+			runner := newTestBatchRunner(t, input)
+			So(runner.validate(), ShouldBeFalse)
+			batch, _ := model.GetBatchById(runner.batch.Id)
+			So(batch.Status, ShouldEqual, model.BatchStatusFailed)
+			var batchErrors []BatchError
+			So(json.Unmarshal([]byte(batch.Errors), &batchErrors), ShouldBeNil)
+			codes := make([]string, 0, len(batchErrors))
+			lines := make([]int, 0, len(batchErrors))
+			for _, batchError := range batchErrors {
+				codes = append(codes, batchError.Code)
+				lines = append(lines, *batchError.Line)
+			}
+			So(codes, ShouldResemble, []string{"invalid_json_line", "missing_required_parameter", "duplicate_custom_id", "mismatched_endpoint", "missing_model"})
+			So(lines, ShouldResemble, []int{1, 2, 4, 5, 6})
+		})
+		Convey("an empty input file fails the batch", func() {
+			runner := newTestBatchRunner(t, "\n\n")
+			So(runner.validate(), ShouldBeFalse)
+			batch, _ := model.GetBatchById(runner.batch.Id)
+			So(batch.Status, ShouldEqual, model.BatchStatusFailed)
+			So(batch.Errors, ShouldContainSubstring, "empty_file")
+		})
+	})
+}
+
+func TestBatchRunnerResults(t *testing.T) {
+	Convey("batch results", t, func() {
+		runner := newTestBatchRunner(t, batchRequest("a", "/v1/chat/completions", `{"model":"gpt-4o-mini"}`))
+		So(os.MkdirAll(runner.workDir, 0750), ShouldBeNil)
+		// 上次中断时 b 的结果只写了一半
+		previous := `{"id":"batch_req_1","custom_id":"a","response":{"status_code":200,"request_id":"","body":{}},"error":null}` + "\n" + `{"id":"batch_req_2","cus`
+		So(os.WriteFile(filepath.Join(runner.workDir, "output.jsonl"), []byte(previous), 0640), ShouldBeNil)
+
+		So(runner.openResults(), ShouldBeNil)
+		So(runner.completed, ShouldEqual, 1)
+		So(runner.isDone("a"), ShouldBeTrue)
+		So(runner.isDone("b"), ShouldBeFalse)
+
+		runner.writeResult(&batchResultLine{Id: "batch_req_3", CustomId: "a", Response: &batchResponse{StatusCode: http.StatusOK, Body: json.RawMessage(`{}`)}})
+		runner.writeResult(&batchResultLine{Id: "batch_req_4", CustomId: "b", Response: &batchResponse{StatusCode: http.StatusOK, Body: json.RawMessage(`{}`)}})
+		runner.writeResult(&batchResultLine{Id: "batch_req_5", CustomId: "c", Response: &batchResponse{StatusCode: http.StatusBadRequest, Body: json.RawMessage(`{}`)}})
+		runner.writeResult(&batchResultLine{Id: "batch_req_6", CustomId: "d", Error: &BatchError{Code: "batch_expired"}})
+		runner.closeResults()
+		So(runner.completed, ShouldEqual, 2)
+		So(runner.failed, ShouldEqual, 2)
+
+		Convey("finalize saves both result files and completes the batch", func() {
+			_, err := model.UpdateBatchStatus(runner.batch.Id, []string{model.BatchStatusValidating}, model.BatchStatusFinalizing, nil)
+			So(err, ShouldBeNil)
+			So(runner.reload(), ShouldBeNil)
+			So(runner.finalize(), ShouldBeNil)
+			batch, _ := model.GetBatchById(runner.batch.Id)
+			So(batch.Status, ShouldEqual, model.BatchStatusCompleted)
+			output, err := model.GetUserFileByFileId(1, batch.OutputFileId)
+			So(err, ShouldBeNil)
+			So(output.Purpose, ShouldEqual, model.FilePurposeBatchOutput)
+			reader, err := testStorage.Open(output.StorageName)
+			So(err, ShouldBeNil)
+			data, _ := io.ReadAll(reader)
+			So(strings.Count(string(data), "\n"), ShouldEqual, 2)
+			So(string(data), ShouldNotContainSubstring, "batch_req_3")
+			_, err = model.GetUserFileByFileId(1, batch.ErrorFileId)
+			So(err, ShouldBeNil)
+			_, err = os.Stat(runner.workDir)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,277 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 批处理支持的接口，与 batch-runner 中的内部路由保持一致
+var batchEndpoints = []string{
+	"/v1/chat/completions",
+	"/v1/completions",
+	"/v1/embeddings",
+	"/v1/responses",
+	"/v1/messages",
+}
+
+const batchCompletionWindow = "24h"
+
+type BatchError struct {
+	Code    string  `json:"code"`
+	Message string  `json:"message"`
+	Param   *string `json:"param"`
+	Line    *int    `json:"line"`
+}
+
+type BatchErrors struct {
+	Object string       `json:"object"`
+	Data   []BatchError `json:"data"`
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type OpenAIBatch struct {
+	Id               string             `json:"id"`
+	Object           string             `json:"object"`
+	Endpoint         string             `json:"endpoint"`
+	Errors           *BatchErrors       `json:"errors"`
+	InputFileId      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           string             `json:"status"`
+	OutputFileId     *string            `json:"output_file_id"`
+	ErrorFileId      *string            `json:"error_file_id"`
+	CreatedAt        int64              `json:"created_at"`
+	InProgressAt     *int64             `json:"in_progress_at"`
+	ExpiresAt        *int64             `json:"expires_at"`
+	FinalizingAt     *int64             `json:"finalizing_at"`
+	CompletedAt      *int64             `json:"completed_at"`
+	FailedAt         *int64             `json:"failed_at"`
+	ExpiredAt        *int64             `json:"expired_at"`
+	CancellingAt     *int64             `json:"cancelling_at"`
+	CancelledAt      *int64             `json:"cancelled_at"`
+	RequestCounts    BatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string  `json:"metadata"`
+}
+
+type CreateBatchRequest struct {
+	InputFileId      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata"`
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func nullableTime(t int64) *int64 {
+	if t == 0 {
+		return nil
+	}
+	return &t
+}
+
+func toOpenAIBatch(batch *model.Batch) OpenAIBatch {
+	result := OpenAIBatch{
+		Id:               batch.BatchId,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     nullableString(batch.OutputFileId),
+		ErrorFileId:      nullableString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     nullableTime(batch.InProgressAt),
+		ExpiresAt:        nullableTime(batch.ExpiresAt),
+		FinalizingAt:     nullableTime(batch.FinalizingAt),
+		CompletedAt:      nullableTime(batch.CompletedAt),
+		FailedAt:         nullableTime(batch.FailedAt),
+		ExpiredAt:        nullableTime(batch.ExpiredAt),
+		CancellingAt:     nullableTime(batch.CancellingAt),
+		CancelledAt:      nullableTime(batch.CancelledAt),
+		RequestCounts: BatchRequestCounts{
+			Total:     batch.RequestTotal,
+			Completed: batch.RequestCompleted,
+			Failed:    batch.RequestFailed,
+		},
+	}
+	if batch.Errors != "" {
+		var data []BatchError
+		if err := json.Unmarshal([]byte(batch.Errors), &data); err == nil {
+			result.Errors = &BatchErrors{Object: "list", Data: data}
+		}
+	}
+	if batch.Metadata != "" {
+		_ = json.Unmarshal([]byte(batch.Metadata), &result.Metadata)
+	}
+	return result
+}
+
+func isBatchEndpoint(endpoint string) bool {
+	for _, e := range batchEndpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+func batchNotFound(c *gin.Context, batchId string) {
+	abortWithOpenAIError(c, http.StatusNotFound, "invalid_request_error", "batch_not_found", fmt.Sprintf("No batch found with id '%s'", batchId))
+}
+
+// getUserBatch 读取当前用户的批处理任务，找不到时直接写入错误响应
+func getUserBatch(c *gin.Context) *model.Batch {
+	batchId := c.Param("id")
+	batch, err := model.GetUserBatchByBatchId(c.GetInt("id"), batchId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			batchNotFound(c, batchId)
+		} else {
+			abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "query_batch_failed", err.Error())
+		}
+		return nil
+	}
+	return batch
+}
+
+func CreateBatch(c *gin.Context) {
+	userId := c.GetInt("id")
+	var req CreateBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "invalid_request", err.Error())
+		return
+	}
+	if !isBatchEndpoint(req.Endpoint) {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "invalid_endpoint", fmt.Sprintf("Unsupported endpoint: '%s'", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "invalid_completion_window", fmt.Sprintf("Unsupported completion_window: '%s'", req.CompletionWindow))
+		return
+	}
+	file, err := model.GetUserFileByFileId(userId, req.InputFileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || req.InputFileId == "" {
+			fileNotFound(c, req.InputFileId)
+		} else {
+			abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "query_file_failed", err.Error())
+		}
+		return
+	}
+	if file.Purpose != model.FilePurposeBatch {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "invalid_file_purpose", fmt.Sprintf("File %s must have purpose 'batch'", file.FileId))
+		return
+	}
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		BatchId:          model.NewBatchId(),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Endpoint:         req.Endpoint,
+		InputFileId:      file.FileId,
+		CompletionWindow: req.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		CreatedAt:        now,
+		ExpiresAt:        now + 24*60*60,
+	}
+	if len(req.Metadata) > 0 {
+		metadata, _ := json.Marshal(req.Metadata)
+		batch.Metadata = string(metadata)
+	}
+	if err := batch.Insert(); err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "create_batch_failed", err.Error())
+		return
+	}
+	notifyBatchRunner()
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch := getUserBatch(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, hasMore, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			batchNotFound(c, c.Query("after"))
+			return
+		}
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "query_batch_failed", err.Error())
+		return
+	}
+	data := make([]OpenAIBatch, 0, len(batches))
+	for _, batch := range batches {
+		data = append(data, toOpenAIBatch(batch))
+	}
+	var firstId, lastId *string
+	if len(data) > 0 {
+		firstId = &data[0].Id
+		lastId = &data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":   "list",
+		"data":     data,
+		"first_id": firstId,
+		"last_id":  lastId,
+		"has_more": hasMore,
+	})
+}
+
+func CancelBatch(c *gin.Context) {
+	batch := getUserBatch(c)
+	if batch == nil {
+		return
+	}
+	now := common.GetTimestamp()
+	// 尚未开始执行的任务直接取消，执行中的任务交给 batch runner 收尾
+	ok, err := model.UpdateBatchStatus(batch.Id, []string{model.BatchStatusValidating}, model.BatchStatusCancelled, map[string]interface{}{
+		"cancelling_at": now,
+		"cancelled_at":  now,
+	})
+	if err == nil && !ok {
+		ok, err = model.UpdateBatchStatus(batch.Id, []string{model.BatchStatusInProgress}, model.BatchStatusCancelling, map[string]interface{}{
+			"cancelling_at": now,
+		})
+	}
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "cancel_batch_failed", err.Error())
+		return
+	}
+	if !ok {
+		abortWithOpenAIError(c, http.StatusConflict, "invalid_request_error", "batch_not_cancellable", fmt.Sprintf("Cannot cancel a batch with status '%s'", batch.Status))
+		return
+	}
+	notifyBatchRunner()
+	batch, err = model.GetBatchById(batch.Id)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "query_batch_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
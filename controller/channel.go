@@ -111,6 +111,17 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+// checkChannelGroups 组织渠道的分组只能由该组织的渠道使用
+func checkChannelGroups(groups string, orgId int) error {
+	for _, group := range strings.Split(groups, ",") {
+		group = strings.TrimSpace(group)
+		if model.IsOrgChannelGroup(group) && (orgId == 0 || group != model.OrgChannelGroup(orgId)) {
+			return fmt.Errorf("分组 %s 为组织渠道保留的分组", group)
+		}
+	}
+	return nil
+}
+
 func AddChannel(c *gin.Context) {
 	channel := model.Channel{}
 	err := c.ShouldBindJSON(&channel)
@@ -121,8 +132,26 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	if !model.IsValidChannelMultiKeyMode(channel.GetMultiKeyMode()) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不支持的多密钥模式",
+		})
+		return
+	}
+	if err := checkChannelGroups(channel.Group, channel.OrgId); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 	channel.CreatedTime = common.GetTimestamp()
 	keys := strings.Split(channel.Key, "\n")
+	if channel.IsMultiKey() {
+		// 多密钥渠道的所有密钥保存在同一个渠道中
+		keys = []string{strings.Join(channel.GetKeys(), "\n")}
+	}
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
 		//if key == "" {
@@ -222,6 +251,29 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if !model.IsValidChannelMultiKeyMode(channel.GetMultiKeyMode()) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "不支持的多密钥模式",
+		})
+		return
+	}
+	if channel.Group != "" {
+		origin, err := model.GetChannelById(channel.Id, false)
+		if err == nil {
+			err = checkChannelGroups(channel.Group, origin.OrgId)
+		}
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+	if channel.IsMultiKey() && channel.Key != "" {
+		channel.Key = strings.Join(channel.GetKeys(), "\n")
+	}
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -348,3 +400,115 @@ func ResetChannelStats(c *gin.Context) {
 		"message": "",
 	})
 }
+
+// GetChannelLiveStats 返回本机内存中各渠道的实时统计，供渠道选择策略排查使用
+func GetChannelLiveStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetChannelStatsSnapshots(),
+	})
+}
+
+// GetChannelBreakers 返回各渠道、模型的熔断器状态
+func GetChannelBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetChannelBreakerSnapshots(),
+	})
+}
+
+// GetChannelQueues 返回各分组、模型的排队长度和等待时间统计
+func GetChannelQueues(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    model.GetChannelQueueSnapshots(),
+	})
+}
+
+type resetChannelBreakerRequest struct {
+	ChannelId int    `json:"channel_id"`
+	Model     string `json:"model"`
+}
+
+// ResetChannelBreaker 手动关闭熔断器，不指定模型时重置该渠道的所有模型
+func ResetChannelBreaker(c *gin.Context) {
+	var req resetChannelBreakerRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.ChannelId == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	model.ResetChannelBreaker(req.ChannelId, req.Model)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetChannelKeys 返回多密钥渠道中每个密钥的状态和用量
+func GetChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	keys, err := model.GetChannelKeyStatuses(channel)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    keys,
+	})
+}
+
+type updateChannelKeyRequest struct {
+	Id     int `json:"id"`
+	Status int `json:"status"`
+}
+
+// UpdateChannelKey 手动启用或禁用多密钥渠道中的单个密钥
+func UpdateChannelKey(c *gin.Context) {
+	channelId, err := strconv.Atoi(c.Param("id"))
+	var req updateChannelKeyRequest
+	if err != nil || c.ShouldBindJSON(&req) != nil || req.Id == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无效的参数",
+		})
+		return
+	}
+	err = model.UpdateChannelKeyStatus(channelId, req.Id, req.Status)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
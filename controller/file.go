@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/common/config"
+	"one-api/common/storage"
+	"one-api/model"
+	dbmodel "one-api/relay/model"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type OpenAIFile struct {
+	Id        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+	Status    string `json:"status"`
+}
+
+func toOpenAIFile(file *model.File) OpenAIFile {
+	return OpenAIFile{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}
+}
+
+func abortWithOpenAIError(c *gin.Context, statusCode int, errType string, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dbmodel.Error{
+			Message: message,
+			Type:    errType,
+			Code:    code,
+		},
+	})
+}
+
+func fileNotFound(c *gin.Context, fileId string) {
+	abortWithOpenAIError(c, http.StatusNotFound, "invalid_request_error", "file_not_found", fmt.Sprintf("No such File object: %s", fileId))
+}
+
+// getUserFile 读取当前用户的文件，找不到时直接写入错误响应
+func getUserFile(c *gin.Context) *model.File {
+	fileId := c.Param("id")
+	file, err := model.GetUserFileByFileId(c.GetInt("id"), fileId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileNotFound(c, fileId)
+		} else {
+			abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "query_file_failed", err.Error())
+		}
+		return nil
+	}
+	return file
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10000"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	asc := c.DefaultQuery("order", "desc") == "asc"
+	files, hasMore, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit, asc)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fileNotFound(c, c.Query("after"))
+			return
+		}
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "query_file_failed", err.Error())
+		return
+	}
+	data := make([]OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, toOpenAIFile(file))
+	}
+	var firstId, lastId string
+	if len(data) > 0 {
+		firstId = data[0].Id
+		lastId = data[len(data)-1].Id
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":   "list",
+		"data":     data,
+		"first_id": firstId,
+		"last_id":  lastId,
+		"has_more": hasMore,
+	})
+}
+
+func UploadFile(c *gin.Context) {
+	userId := c.GetInt("id")
+	purpose := c.PostForm("purpose")
+	if !model.IsUploadFilePurpose(purpose) {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "invalid_purpose", fmt.Sprintf("Invalid purpose: '%s'", purpose))
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "missing_file", "Missing required parameter: 'file'")
+		return
+	}
+	maxSize := int64(config.FileMaxSize) << 20
+	if maxSize > 0 && header.Size > maxSize {
+		abortWithOpenAIError(c, http.StatusRequestEntityTooLarge, "invalid_request_error", "file_too_large", fmt.Sprintf("File exceeds the maximum size of %d MB", config.FileMaxSize))
+		return
+	}
+	if config.FileStorageLimit > 0 {
+		used, err := model.GetUserFileBytes(userId)
+		if err != nil {
+			abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "query_file_failed", err.Error())
+			return
+		}
+		if used+header.Size > int64(config.FileStorageLimit)<<20 {
+			abortWithOpenAIError(c, http.StatusForbidden, "invalid_request_error", "storage_quota_exceeded", fmt.Sprintf("File storage limit of %d MB exceeded", config.FileStorageLimit))
+			return
+		}
+	}
+	store, err := storage.GetStorage()
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "storage_unavailable", err.Error())
+		return
+	}
+	src, err := header.Open()
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusBadRequest, "invalid_request_error", "invalid_file", err.Error())
+		return
+	}
+	defer src.Close()
+
+	file := &model.File{
+		FileId:    model.NewFileId(),
+		UserId:    userId,
+		TokenId:   c.GetInt("token_id"),
+		Filename:  filepath.Base(header.Filename),
+		Purpose:   purpose,
+		Status:    model.FileStatusProcessed,
+		CreatedAt: common.GetTimestamp(),
+	}
+	file.StorageName = fmt.Sprintf("%d/%s", userId, file.FileId)
+	file.Bytes, err = store.Save(file.StorageName, src)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "save_file_failed", err.Error())
+		return
+	}
+	if err := file.Insert(); err != nil {
+		_ = store.Delete(file.StorageName)
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "save_file_failed", err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+func RetrieveFile(c *gin.Context) {
+	file := getUserFile(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+func DeleteFile(c *gin.Context) {
+	file := getUserFile(c)
+	if file == nil {
+		return
+	}
+	store, err := storage.GetStorage()
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "storage_unavailable", err.Error())
+		return
+	}
+	// 先删除记录，删除文件内容失败时只留下无人引用的文件，不会留下指向已删除内容的记录
+	if err := file.Delete(); err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "delete_file_failed", err.Error())
+		return
+	}
+	if err := store.Delete(file.StorageName); err != nil {
+		common.SysError(fmt.Sprintf("failed to delete content of file %s: %s", file.FileId, err.Error()))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      file.FileId,
+		"object":  "file",
+		"deleted": true,
+	})
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file := getUserFile(c)
+	if file == nil {
+		return
+	}
+	store, err := storage.GetStorage()
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "storage_unavailable", err.Error())
+		return
+	}
+	reader, err := store.Open(file.StorageName)
+	if err != nil {
+		abortWithOpenAIError(c, http.StatusInternalServerError, "chat_api_error", "read_file_failed", err.Error())
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.Header("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		common.SysError("failed to write file content: " + err.Error())
+	}
+}
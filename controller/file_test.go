@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/model"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func createTestFile(userId int, content string) *model.File {
+	file := &model.File{
+		FileId:      model.NewFileId(),
+		UserId:      userId,
+		Filename:    "input.jsonl",
+		Purpose:     "batch",
+		Bytes:       int64(len(content)),
+		Status:      "processed",
+		StorageName: "test/" + model.NewFileId(),
+	}
+	if _, err := testStorage.Save(file.StorageName, strings.NewReader(content)); err != nil {
+		panic(err)
+	}
+	if err := file.Insert(); err != nil {
+		panic(err)
+	}
+	return file
+}
+
+func runDeleteFile(userId int, fileId string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/v1/files/"+fileId, nil)
+	c.Params = gin.Params{{Key: "id", Value: fileId}}
+	c.Set("id", userId)
+	DeleteFile(c)
+	return recorder
+}
+
+func TestDeleteFile(t *testing.T) {
+	Convey("DeleteFile", t, func() {
+		Convey("deletes the record and the content", func() {
+			file := createTestFile(1, "{}")
+			recorder := runDeleteFile(1, file.FileId)
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			So(recorder.Body.String(), ShouldContainSubstring, `"deleted":true`)
+			_, err := model.GetUserFileByFileId(1, file.FileId)
+			So(err, ShouldNotBeNil)
+			So(testStorage.has(file.StorageName), ShouldBeFalse)
+		})
+		Convey("a failed content delete leaves no record behind", func() {
+			file := createTestFile(1, "{}")
+			testStorage.failDelete = true
+			defer func() { testStorage.failDelete = false }()
+			recorder := runDeleteFile(1, file.FileId)
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			_, err := model.GetUserFileByFileId(1, file.FileId)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("other users' files are not found", func() {
+			file := createTestFile(1, "{}")
+			recorder := runDeleteFile(2, file.FileId)
+			So(recorder.Code, ShouldEqual, http.StatusNotFound)
+			So(testStorage.has(file.StorageName), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"one-api/common"
+	"one-api/common/storage"
+	"one-api/model"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestMain 使用内存中的 SQLite 数据库和内存文件存储运行 controller 包的测试
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		fmt.Println("failed to open test database: " + err.Error())
+		os.Exit(1)
+	}
+	model.DB = db
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	gin.SetMode(gin.TestMode)
+	err = db.AutoMigrate(&model.File{}, &model.Batch{})
+	if err != nil {
+		fmt.Println("failed to migrate test database: " + err.Error())
+		os.Exit(1)
+	}
+	storage.Register("test", func() (storage.Storage, error) {
+		return testStorage, nil
+	})
+	storage.StorageType = "test"
+	os.Exit(m.Run())
+}
+
+// memoryStorage 测试用的文件存储，failDelete 为 true 时删除失败
+type memoryStorage struct {
+	sync.Mutex
+	files      map[string]string
+	failDelete bool
+}
+
+var testStorage = &memoryStorage{files: map[string]string{}}
+
+func (s *memoryStorage) Save(name string, reader io.Reader) (int64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.files[name] = string(data)
+	return int64(len(data)), nil
+}
+
+func (s *memoryStorage) Open(name string) (io.ReadCloser, error) {
+	s.Lock()
+	defer s.Unlock()
+	data, ok := s.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return io.NopCloser(strings.NewReader(data)), nil
+}
+
+func (s *memoryStorage) Delete(name string) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.failDelete {
+		return errors.New("storage unavailable")
+	}
+	delete(s.files, name)
+	return nil
+}
+
+func (s *memoryStorage) has(name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.files[name]
+	return ok
+}
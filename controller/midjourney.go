@@ -375,7 +375,12 @@ func compensateForTaskFailure(ctx context.Context, task *model.Midjourney) {
 		ratio := modelRatio * groupRatio
 		quota := int(ratio * config.QuotaPerUnit)
 		if quota != 0 {
-			err := model.IncreaseUserQuota(task.UserId, quota)
+			if task.TokenId != 0 {
+				// 退还给支付费用的令牌，组织令牌的费用退回组织额度池
+				err = model.PostConsumeTokenQuota(task.TokenId, -quota)
+			} else {
+				err = model.CreditUserQuota(task.UserId, quota, model.LedgerTypeRefund, -1, "mj:"+task.MjId, "构图失败补偿")
+			}
 			if err != nil {
 				log.Println("fail to increase user quota")
 			}
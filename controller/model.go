@@ -122,6 +122,10 @@ func ListModels(c *gin.Context) {
 		userGroup := c.GetString("group")
 		availableModels, _ = model.CacheGetGroupModels(ctx, userGroup)
 	}
+	// 令牌限定了模型时只列出令牌允许的模型
+	if c.GetString("available_models") == "" {
+		availableModels = append(availableModels, common.AvailableVirtualModels(availableModels)...)
+	}
 	modelSet := make(map[string]bool)
 	for _, availableModel := range availableModels {
 		modelSet[availableModel] = true
@@ -38,7 +38,7 @@ func GetUserOptions(c *gin.Context) {
 	keys := []string{"TopUpLink", "YzfZfb", "YzfWx", "BillingByRequestEnabled", "ModelRatioEnabled",
 		"MiniQuota", "ProporTions", "TopupRatio",
 		"LogContentEnabled", "TopupAmount", "TopupRatioEnabled", "TopupAmountEnabled", "BlankReplyRetryEnabled",
-		"UserGroupEnabled"}
+		"UserGroupEnabled", "PaymentCurrencies"}
 
 	for _, key := range keys {
 		if value, exists := config.OptionMap[key]; exists {
@@ -0,0 +1,517 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/common/config"
+	"one-api/common/network"
+	"one-api/model"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getOrgMember 获取当前用户在路径中的组织的成员身份，并检查是否有 permission 权限，permission 为空时只检查是否为成员
+func getOrgMember(c *gin.Context, permission string) (*model.OrgMember, bool) {
+	orgId, _ := strconv.Atoi(c.Param("id"))
+	member, err := model.GetOrgMember(orgId, c.GetInt("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	if permission != "" && !member.Can(permission) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "无权进行此操作",
+		})
+		return nil, false
+	}
+	return member, true
+}
+
+func respondOrg(c *gin.Context, data interface{}, err error) {
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    data,
+	})
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	respondOrg(c, orgs, err)
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if len(req.Name) > 64 {
+		respondOrg(c, nil, fmt.Errorf("组织名称过长"))
+		return
+	}
+	org, err := model.CreateOrganization(req.Name, c.GetInt("id"))
+	respondOrg(c, org, err)
+}
+
+func GetOrganization(c *gin.Context) {
+	member, ok := getOrgMember(c, "")
+	if !ok {
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrgId)
+	if err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"organization": org,
+			"role":         member.Role,
+		},
+	})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionManageMembers)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if len(req.Name) > 64 {
+		respondOrg(c, nil, fmt.Errorf("组织名称过长"))
+		return
+	}
+	org, err := model.GetOrganizationById(member.OrgId)
+	if err == nil {
+		err = org.UpdateName(req.Name)
+	}
+	respondOrg(c, org, err)
+}
+
+func GetOrgMembers(c *gin.Context) {
+	member, ok := getOrgMember(c, "")
+	if !ok {
+		return
+	}
+	members, err := model.GetOrgMembers(member.OrgId)
+	respondOrg(c, members, err)
+}
+
+func UpdateOrgMember(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionManageMembers)
+	if !ok {
+		return
+	}
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	var req struct {
+		Role              string `json:"role"`
+		MonthlyQuotaLimit int    `json:"monthly_quota_limit"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	err := model.UpdateOrgMember(member.OrgId, userId, req.Role, req.MonthlyQuotaLimit)
+	respondOrg(c, nil, err)
+}
+
+// RemoveOrgMember 管理员移除成员，或成员自己退出组织
+func RemoveOrgMember(c *gin.Context) {
+	member, ok := getOrgMember(c, "")
+	if !ok {
+		return
+	}
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	if userId != member.UserId && !member.Can(model.OrgPermissionManageMembers) {
+		respondOrg(c, nil, fmt.Errorf("无权进行此操作"))
+		return
+	}
+	err := model.RemoveOrgMember(member.OrgId, userId)
+	respondOrg(c, nil, err)
+}
+
+func GetOrgInvitations(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionManageMembers)
+	if !ok {
+		return
+	}
+	invitations, err := model.GetOrgInvitations(member.OrgId)
+	respondOrg(c, invitations, err)
+}
+
+func CreateOrgInvitation(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionManageMembers)
+	if !ok {
+		return
+	}
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrgRoleDeveloper
+	}
+	invitation, err := model.CreateOrgInvitation(member.OrgId, member.UserId, req.Email, req.Role)
+	if err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if invitation.Email != "" {
+		org, _ := model.GetOrganizationById(member.OrgId)
+		content := fmt.Sprintf("<p>您受邀加入 %s 的组织「%s」。</p><p>邀请码：<strong>%s</strong>，请在 7 天内登录后使用邀请码加入组织。</p>",
+			config.SystemName, org.Name, invitation.Code)
+		go func() {
+			if err := common.SendEmail(fmt.Sprintf("%s 组织邀请", config.SystemName), invitation.Email, content); err != nil {
+				common.SysError("failed to send organization invitation email: " + err.Error())
+			}
+		}()
+	}
+	respondOrg(c, invitation, nil)
+}
+
+func RevokeOrgInvitation(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionManageMembers)
+	if !ok {
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("invitation_id"))
+	err := model.RevokeOrgInvitation(member.OrgId, id)
+	respondOrg(c, nil, err)
+}
+
+func AcceptOrgInvitation(c *gin.Context) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	invitation, err := model.AcceptOrgInvitation(strings.TrimSpace(req.Code), c.GetInt("id"))
+	if err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	respondOrg(c, gin.H{"org_id": invitation.OrgId, "role": invitation.Role}, nil)
+}
+
+// DepositOrgQuota 成员将自己的余额转入组织额度池
+func DepositOrgQuota(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionManageBilling)
+	if !ok {
+		return
+	}
+	var req struct {
+		Quota int `json:"quota"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	err := model.DepositOrgQuota(member.OrgId, member.UserId, req.Quota)
+	if err == nil {
+		model.RecordLog(member.UserId, model.LogTypeSystem, 0, fmt.Sprintf("转入组织 #%d 额度池 %s", member.OrgId, common.LogQuota(req.Quota)))
+	}
+	respondOrg(c, nil, err)
+}
+
+// GetOrgTokens 有令牌管理权限的成员可以看到所有成员的组织令牌，其他成员只能看到自己的
+func GetOrgTokens(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionUseTokens)
+	if !ok {
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId := member.UserId
+	if member.Can(model.OrgPermissionManageTokens) {
+		userId = 0
+	}
+	tokens, err := model.GetOrgTokens(member.OrgId, userId, p*config.ItemsPerPage, config.ItemsPerPage)
+	respondOrg(c, tokens, err)
+}
+
+func AddOrgToken(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionUseTokens)
+	if !ok {
+		return
+	}
+	token := model.Token{}
+	if err := c.ShouldBindJSON(&token); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if err := validateToken(c, token); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if token.Group != "" {
+		if _, exists := common.GroupUserRatio[token.Group]; !exists {
+			respondOrg(c, nil, fmt.Errorf("无效的用户组"))
+			return
+		}
+	}
+	cleanToken := model.Token{
+		UserId:            member.UserId,
+		OrgId:             member.OrgId,
+		Name:              token.Name,
+		Key:               common.GenerateKey(),
+		CreatedTime:       common.GetTimestamp(),
+		AccessedTime:      common.GetTimestamp(),
+		ExpiredTime:       token.ExpiredTime,
+		RemainQuota:       token.RemainQuota,
+		UnlimitedQuota:    token.UnlimitedQuota,
+		Group:             token.Group,
+		Models:            token.Models,
+		Subnet:            token.Subnet,
+		RPM:               token.RPM,
+		TPM:               token.TPM,
+		MaxConcurrency:    token.MaxConcurrency,
+		DailyQuotaLimit:   token.DailyQuotaLimit,
+		WeeklyQuotaLimit:  token.WeeklyQuotaLimit,
+		MonthlyQuotaLimit: token.MonthlyQuotaLimit,
+	}
+	err := cleanToken.Insert()
+	respondOrg(c, cleanToken, err)
+}
+
+func DeleteOrgToken(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionUseTokens)
+	if !ok {
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("token_id"))
+	token, err := model.GetOrgTokenById(member.OrgId, id)
+	if err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if token.UserId != member.UserId && !member.Can(model.OrgPermissionManageTokens) {
+		respondOrg(c, nil, fmt.Errorf("无权进行此操作"))
+		return
+	}
+	respondOrg(c, nil, token.Delete())
+}
+
+func GetOrgChannels(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionManageChannels)
+	if !ok {
+		return
+	}
+	channels, err := model.GetOrgChannels(member.OrgId)
+	respondOrg(c, channels, err)
+}
+
+// orgChannelTypes 组织渠道可以使用的渠道类型，只包含通过 API Key 访问的渠道
+var orgChannelTypes = map[int]bool{
+	common.ChannelTypeOpenAI:     true,
+	common.ChannelTypeCustom:     true,
+	common.ChannelTypeAnthropic:  true,
+	common.ChannelTypeOpenRouter: true,
+	common.ChannelTypeGemini:     true,
+	common.ChannelTypeMoonshot:   true,
+	common.ChannelTypeGroq:       true,
+	common.ChannelTypeMistral:    true,
+	common.ChannelTypeDeepSeek:   true,
+	common.ChannelTypeTogetherAI: true,
+	common.ChannelTypeXAI:        true,
+}
+
+// orgChannelColumns 组织可以修改的渠道字段
+var orgChannelColumns = []string{"type", "status", "name", "weight", "base_url", "models", "model_mapping", "priority", "proxy_url", "multi_key_mode"}
+
+// validateOrgChannel 检查组织渠道的类型和上游地址，上游地址不能指向内网
+func validateOrgChannel(channel *model.Channel) error {
+	if !config.OrgChannelEnabled {
+		return fmt.Errorf("管理员未开启组织渠道")
+	}
+	if !orgChannelTypes[channel.Type] {
+		return fmt.Errorf("组织渠道不支持该渠道类型")
+	}
+	if !model.IsValidChannelMultiKeyMode(channel.GetMultiKeyMode()) {
+		return fmt.Errorf("不支持的多密钥模式")
+	}
+	if channel.Status != common.ChannelStatusEnabled && channel.Status != common.ChannelStatusManuallyDisabled {
+		return fmt.Errorf("无效的渠道状态")
+	}
+	if baseURL := channel.GetBaseURL(); baseURL != "" {
+		if err := network.ValidatePublicURL(baseURL, "http", "https"); err != nil {
+			return fmt.Errorf("无效的渠道地址：%s", err.Error())
+		}
+	}
+	if channel.ProxyURL != nil && *channel.ProxyURL != "" {
+		if err := network.ValidatePublicURL(*channel.ProxyURL, "http", "https", "socks5"); err != nil {
+			return fmt.Errorf("无效的代理地址：%s", err.Error())
+		}
+	}
+	return nil
+}
+
+// bindOrgChannel 只取请求中组织可以修改的字段
+func bindOrgChannel(c *gin.Context) (*model.Channel, error) {
+	req := model.Channel{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, err
+	}
+	channel := &model.Channel{
+		Id:           req.Id,
+		Type:         req.Type,
+		Key:          req.Key,
+		Status:       req.Status,
+		Name:         req.Name,
+		Weight:       req.Weight,
+		BaseURL:      req.BaseURL,
+		Models:       req.Models,
+		ModelMapping: req.ModelMapping,
+		Priority:     req.Priority,
+		ProxyURL:     req.ProxyURL,
+		MultiKeyMode: req.MultiKeyMode,
+	}
+	if channel.Status == 0 {
+		channel.Status = common.ChannelStatusEnabled
+	}
+	if channel.IsMultiKey() && channel.Key != "" {
+		channel.Key = strings.Join(channel.GetKeys(), "\n")
+	}
+	return channel, nil
+}
+
+// AddOrgChannel 添加组织自己的渠道，分组固定为组织的分组，只有组织令牌可以使用
+func AddOrgChannel(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionManageChannels)
+	if !ok {
+		return
+	}
+	channel, err := bindOrgChannel(c)
+	if err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if err := validateOrgChannel(channel); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	channel.Id = 0
+	channel.OrgId = member.OrgId
+	channel.Group = model.OrgChannelGroup(member.OrgId)
+	channel.CreatedTime = common.GetTimestamp()
+	err = model.BatchInsertChannels([]model.Channel{*channel})
+	respondOrg(c, nil, err)
+}
+
+func UpdateOrgChannel(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionManageChannels)
+	if !ok {
+		return
+	}
+	channel, err := bindOrgChannel(c)
+	if err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if _, err := model.GetOrgChannel(member.OrgId, channel.Id); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if err := validateOrgChannel(channel); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	channel.OrgId = member.OrgId
+	channel.Group = model.OrgChannelGroup(member.OrgId)
+	columns := orgChannelColumns
+	// 没有填写密钥时保留原来的密钥
+	if channel.Key != "" {
+		columns = append([]string{"key"}, orgChannelColumns...)
+	}
+	err = model.UpdateOrgChannel(channel, columns)
+	channel.Key = ""
+	respondOrg(c, channel, err)
+}
+
+func DeleteOrgChannel(c *gin.Context) {
+	member, ok := getOrgMember(c, model.OrgPermissionManageChannels)
+	if !ok {
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("channel_id"))
+	channel, err := model.GetOrgChannel(member.OrgId, id)
+	if err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	respondOrg(c, nil, channel.Delete())
+}
+
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	orgs, err := model.GetAllOrganizations(p*config.ItemsPerPage, config.ItemsPerPage)
+	respondOrg(c, orgs, err)
+}
+
+// AdjustOrgQuota 管理员调整组织额度池，quota 为变化量
+func AdjustOrgQuota(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req struct {
+		Quota int `json:"quota"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	err := model.AdjustOrgQuota(id, req.Quota, c.GetInt("id"))
+	if err == nil {
+		model.RecordLog(c.GetInt("id"), model.LogTypeManage, 0, fmt.Sprintf("管理员调整组织 #%d 额度 %s", id, common.LogQuota(req.Quota)))
+	}
+	respondOrg(c, nil, err)
+}
+
+func UpdateOrganizationStatus(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req struct {
+		Status int `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondOrg(c, nil, err)
+		return
+	}
+	if req.Status != model.OrgStatusEnabled && req.Status != model.OrgStatusDisabled {
+		respondOrg(c, nil, fmt.Errorf("无效的状态"))
+		return
+	}
+	respondOrg(c, nil, model.UpdateOrganizationStatus(id, req.Status))
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common/config"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetQuotaLedgers(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	pageSize, _ := strconv.Atoi(c.Query("pageSize"))
+	if p < 0 {
+		p = 0
+	}
+	if pageSize <= 0 {
+		pageSize = config.ItemsPerPage
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	ledgers, total, err := model.GetQuotaLedgers(userId, c.Query("type"), p*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    ledgers,
+		"total":   total,
+	})
+}
+
+func GetQuotaLedgerBalance(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	balance, err := model.GetUserLedgerBalance(userId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    balance,
+	})
+}
+
+// ReconcileQuotaLedger 立即对账一次，返回余额与账本不一致的账户
+func ReconcileQuotaLedger(c *gin.Context) {
+	drifts, err := model.ReconcileQuotaLedger()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    drifts,
+	})
+}
@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/common/ctxkey"
+	"one-api/middleware"
+	"one-api/model"
+	"one-api/relay/constant"
+	dbmodel "one-api/relay/model"
+	"one-api/relay/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type hedgeResult struct {
+	c   *gin.Context
+	err *dbmodel.ErrorWithStatusCode
+}
+
+// getHedgeDelay 返回流式请求开启对冲时等待首个内容的时间，令牌的配置优先于模型的配置
+func getHedgeDelay(c *gin.Context, relayMode int) time.Duration {
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return 0
+	}
+	delay := c.GetInt("token_hedge_delay")
+	if delay <= 0 {
+		delay = common.GetModelHedgeDelay(c.GetString(ctxkey.OriginalModel))
+	}
+	if delay <= 0 || !isStreamRequest(c, relayMode) {
+		return 0
+	}
+	return time.Duration(delay) * time.Millisecond
+}
+
+func isStreamRequest(c *gin.Context, relayMode int) bool {
+	switch relayMode {
+	case constant.RelayModeGemini:
+		_, action := constant.GeminiModelAction(c.Request.URL.Path)
+		return action == "streamGenerateContent"
+	case constant.RelayModeChatCompletions, constant.RelayModeCompletions, constant.RelayModeMessages, constant.RelayResponses:
+		var request struct {
+			Stream bool `json:"stream"`
+		}
+		if err := common.UnmarshalBodyReusable(c, &request); err != nil {
+			return false
+		}
+		return request.Stream
+	}
+	return false
+}
+
+// relayWithHedge 主渠道超过 delay 仍未返回首个内容时，再向另一个渠道发送相同的请求，
+// 先返回首个内容的一方把输出写给客户端，另一方被中断且不计费
+func relayWithHedge(c *gin.Context, relayMode int, delay time.Duration) *dbmodel.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	arbiter := util.NewHedgeArbiter()
+	results := make(chan hedgeResult, 2)
+	primaryChannelId := c.GetInt("channel_id")
+	primary := newHedgeContext(c, arbiter)
+	// 排队时占用的并发名额已随上下文交给主请求，由它负责释放
+	middleware.TakeReservedChannelSlot(c, primaryChannelId)
+	go runHedgeAttempt(primary, relayMode, results)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case result := <-results:
+		return finishHedge(c, result)
+	case <-arbiter.Won():
+		return finishHedge(c, <-results)
+	case <-timer.C:
+	}
+
+	originalModel := c.GetString(ctxkey.OriginalModel)
+	channel, err := model.CacheGetRandomSatisfiedChannel(middleware.GetChannelGroup(c), originalModel, false, c.GetBool("is_tools"), c.GetBool("claude_original_request"), []int{primaryChannelId}, 0)
+	if err != nil || channel.Id == primaryChannelId {
+		if err == nil {
+			model.ReleaseChannelBreaker(channel.Id, originalModel)
+		}
+		common.Infof(ctx, "no channel available for hedging, waiting for channel #%d", primaryChannelId)
+		return finishHedge(c, <-results)
+	}
+	attemptsLog := fmt.Sprintf("对冲请求: 渠道「%d」%dms 内未返回首个内容，同时请求渠道「%d」", primaryChannelId, delay.Milliseconds(), channel.Id)
+	common.Infof(ctx, "%s", attemptsLog)
+	arbiter.SetAttemptsLog(attemptsLog)
+	secondary := newHedgeContext(c, arbiter)
+	middleware.SetupContextForSelectedChannel(secondary, channel, originalModel, c.GetString("attemptsLog"))
+	go runHedgeAttempt(secondary, relayMode, results)
+
+	// 胜出或成功的尝试即为最终结果，两个尝试都在首个内容前失败时返回主渠道的错误，交给外层重试
+	var primaryResult hedgeResult
+	for i := 0; i < 2; i++ {
+		result := <-results
+		if result.err == nil || arbiter.IsWinner(result.c) {
+			return finishHedge(c, result)
+		}
+		if result.c == primary {
+			primaryResult = result
+		}
+	}
+	return finishHedge(c, primaryResult)
+}
+
+// newHedgeContext 为每个尝试复制一份上下文和请求，避免并发的尝试互相修改
+func newHedgeContext(c *gin.Context, arbiter *util.HedgeArbiter) *gin.Context {
+	hc := c.Copy()
+	hc.Writer = c.Writer
+	requestBody, _ := common.GetRequestBody(c)
+	hc.Request = c.Request.Clone(c.Request.Context())
+	hc.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	hc.Set(util.HedgeArbiterKey, arbiter)
+	return hc
+}
+
+func runHedgeAttempt(hc *gin.Context, relayMode int, results chan<- hedgeResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysError(fmt.Sprintf("hedge attempt panic: %v", r))
+			results <- hedgeResult{c: hc, err: &dbmodel.ErrorWithStatusCode{
+				Error: dbmodel.Error{
+					Message: fmt.Sprintf("对冲请求异常: %v", r),
+					Type:    "chat_api_error",
+					Code:    "hedge_attempt_panic",
+				},
+				StatusCode: http.StatusInternalServerError,
+			}}
+		}
+	}()
+	results <- hedgeResult{c: hc, err: relay(hc, relayMode)}
+}
+
+// finishHedge 把最终采用的尝试的渠道等信息写回原上下文，供重试和错误日志使用
+func finishHedge(c *gin.Context, result hedgeResult) *dbmodel.ErrorWithStatusCode {
+	for key, value := range result.c.Keys {
+		if key != util.HedgeArbiterKey {
+			c.Set(key, value)
+		}
+	}
+	return result.err
+}
@@ -17,12 +17,59 @@ import (
 	"one-api/relay/util"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func relay(c *gin.Context, relayMode int) *dbmodel.ErrorWithStatusCode {
-	var err *dbmodel.ErrorWithStatusCode
+// firstWriteRecorder 记录第一次向客户端写出响应的时间，用作渠道的首字耗时
+type firstWriteRecorder struct {
+	gin.ResponseWriter
+	firstWriteTime time.Time
+}
+
+func (w *firstWriteRecorder) Write(data []byte) (int, error) {
+	if w.firstWriteTime.IsZero() {
+		w.firstWriteTime = time.Now()
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *firstWriteRecorder) WriteString(s string) (int, error) {
+	if w.firstWriteTime.IsZero() {
+		w.firstWriteTime = time.Now()
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func relay(c *gin.Context, relayMode int) (err *dbmodel.ErrorWithStatusCode) {
+	channelId := c.GetInt("channel_id")
+	// 选择渠道时已跳过并发已满的渠道，这里再原子地占用名额，失败时交给重试换一个渠道
+	maxConcurrency := c.GetInt("channel_max_concurrency")
+	if !middleware.TakeReservedChannelSlot(c, channelId) && !model.AcquireChannelSlot(channelId, maxConcurrency) {
+		model.ReleaseChannelBreaker(channelId, c.GetString(ctxkey.OriginalModel))
+		return &dbmodel.ErrorWithStatusCode{
+			Error: dbmodel.Error{
+				Message: fmt.Sprintf("渠道 #%d 并发请求数已达上限", channelId),
+				Type:    "chat_api_error",
+				Code:    "channel_saturated",
+			},
+			StatusCode: http.StatusTooManyRequests,
+		}
+	}
+	defer model.ReleaseChannelSlot(channelId, maxConcurrency)
+	startTime := time.Now()
+	recorder := &firstWriteRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	model.RecordChannelRequestStart(channelId)
+	defer func() {
+		c.Writer = recorder.ResponseWriter
+		var ttft time.Duration
+		if !recorder.firstWriteTime.IsZero() {
+			ttft = recorder.firstWriteTime.Sub(startTime)
+		}
+		recordChannelAttempt(channelId, c.GetString(ctxkey.OriginalModel), time.Since(startTime), ttft, err)
+	}()
 	switch relayMode {
 	case constant.RelayModeImagesGenerations,
 		constant.RelayModeEdits:
@@ -36,24 +83,48 @@ func relay(c *gin.Context, relayMode int) *dbmodel.ErrorWithStatusCode {
 		err = controller.RelayAudioHelper(c, relayMode)
 	case constant.RelayModeMessages:
 		err = controller.RelayClaude(c)
+	case constant.RelayModeGeminiCountTokens:
+		err = controller.RelayGeminiCountTokens(c)
 	default:
 		err = controller.RelayTextHelper(c)
 	}
 	return err
 }
 
+// recordChannelAttempt 记录一次尝试的耗时、成败和熔断结果。
+// 对冲请求中落败而被中断的尝试没有结果，不计入统计和熔断，只归还可能占用的半开试探名额
+func recordChannelAttempt(channelId int, modelName string, latency time.Duration, ttft time.Duration, err *dbmodel.ErrorWithStatusCode) {
+	if err != nil && err.Code == util.HedgeCancelledCode {
+		model.CancelChannelRequest(channelId)
+		model.ReleaseChannelBreaker(channelId, modelName)
+		return
+	}
+	model.RecordChannelRequestEnd(channelId, latency, ttft, err == nil)
+	if err == nil {
+		model.RecordChannelBreakerResult(channelId, modelName, model.ChannelFailureNone)
+	} else {
+		model.RecordChannelBreakerResult(channelId, modelName, util.ChannelFailureKind(&err.Error, err.StatusCode))
+	}
+}
+
 func Relay(c *gin.Context) {
 	ctx := c.Request.Context()
 	relayMode := constant.Path2RelayMode(c.Request.URL.Path)
-	bizErr := relay(c, relayMode)
+	var bizErr *dbmodel.ErrorWithStatusCode
+	if delay := getHedgeDelay(c, relayMode); delay > 0 {
+		bizErr = relayWithHedge(c, relayMode, delay)
+	} else {
+		bizErr = relay(c, relayMode)
+	}
 	if bizErr == nil {
+		middleware.PinStickyChannel(c)
 		return
 	}
 	channelId := c.GetInt("channel_id")
 	channelAutoBan := c.GetInt("auto_ban")
 	lastFailedChannelId := channelId
 	channelName := c.GetString("channel_name")
-	group := c.GetString("group")
+	group := middleware.GetChannelGroup(c)
 	originalModel := c.GetString(ctxkey.OriginalModel)
 	processChannelRelayError(c, channelId, channelAutoBan, channelName, bizErr)
 	requestId := c.GetString("X-Chatapi-Request-Id")
@@ -61,6 +132,9 @@ func Relay(c *gin.Context) {
 	if !shouldRetry(c, bizErr.StatusCode) {
 		common.Errorf(ctx, "relay error happen, status code is %d, won't retry in this case", bizErr.StatusCode)
 		retryTimes = 0
+	} else {
+		// 虚拟模型至少把每个真实模型都尝试一次
+		retryTimes = max(retryTimes, middleware.RemainingVirtualModels(c))
 	}
 	var attemptsLog []string
 	failedChannelIds := []int{channelId}
@@ -86,15 +160,29 @@ func Relay(c *gin.Context) {
 			fmt.Println("Failed to get one or more context values, using default false values")
 		}
 
+		// 虚拟模型失败后切换到下一个真实模型，之前失败的渠道对新模型仍然可用
+		if next, ok := middleware.NextVirtualModel(c); ok {
+			attemptsLog = append(attemptsLog, fmt.Sprintf("虚拟模型 %s: 模型 %s 请求失败，切换到模型 %s\n", c.GetString("virtual_model"), originalModel, next))
+			originalModel = next
+			failedChannelIds = nil
+			lastFailedChannelId = 0
+		}
 		channel, err := model.CacheGetRandomSatisfiedChannel(group, originalModel, i != retryTimes, isTools, isClaudeOriginalRequest, failedChannelIds, i)
+		// 渠道均已饱和时排队等待名额释放，此时之前失败的渠道恢复后也可以再次使用
+		queued := false
+		if err != nil && bizErr.StatusCode == http.StatusTooManyRequests && middleware.ShouldQueueForChannel(group, originalModel) {
+			channel, err = middleware.WaitForQueuedChannel(c, group, originalModel)
+			queued = err == nil
+		}
 		if err != nil {
-			common.Errorf(ctx, "CacheGetRandomSatisfiedChannel failed: %w", err)
+			common.Errorf(ctx, "CacheGetRandomSatisfiedChannel failed: %s", err.Error())
 			break
 		}
 
 		attemptsLog = append(attemptsLog, fmt.Sprintf("重试次数 #%d: 上次使用渠道「%d」, 错误信息: %v, 重试id:「%d」\n", retryTimes-i+1, lastFailedChannelId, bizErr, channel.Id))
 		common.Infof(ctx, "%s", attemptsLog)
-		if channel.Id == lastFailedChannelId {
+		if channel.Id == lastFailedChannelId && !queued {
+			model.ReleaseChannelBreaker(channel.Id, originalModel)
 			continue
 		}
 
@@ -104,6 +192,7 @@ func Relay(c *gin.Context) {
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 		bizErr = relay(c, relayMode)
 		if bizErr == nil {
+			middleware.PinStickyChannel(c)
 			return
 		}
 		channelId := c.GetInt("channel_id")
@@ -128,12 +217,42 @@ func Relay(c *gin.Context) {
 			bizErr.Error.Message,
 			c.ClientIP(),
 		)
+		if relayMode == constant.RelayModeGemini || relayMode == constant.RelayModeGeminiCountTokens {
+			c.JSON(bizErr.StatusCode, gin.H{
+				"error": gin.H{
+					"code":    bizErr.StatusCode,
+					"message": bizErr.Error.Message,
+					"status":  geminiErrorStatus(bizErr.StatusCode),
+				},
+			})
+			return
+		}
 		c.JSON(bizErr.StatusCode, gin.H{
 			"error": bizErr.Error,
 		})
 	}
 }
 
+// geminiErrorStatus 原生 Gemini 接口的错误使用 Google RPC 状态码
+func geminiErrorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	default:
+		return "INTERNAL"
+	}
+}
+
 func RelayMidjourney(c *gin.Context) {
 	relayMode := constant.MidjourneyRelayMode(c.Request.URL.Path)
 
@@ -174,8 +293,17 @@ func processChannelRelayError(ctx *gin.Context, channelId int, channelAutoBan in
 	common.Errorf(ctx, "relay error (channel #%d): %s", channelId, err.Message)
 	// https://platform.openai.com/docs/guides/error-codes/api-errors
 	if util.ShouldDisableChannel(&err.Error, err.StatusCode, channelAutoBan) {
+		// 多密钥渠道只禁用出错的密钥，所有密钥都不可用时才禁用整个渠道
+		if keyId := ctx.GetInt(ctxkey.ChannelKeyId); keyId != 0 {
+			remaining, keyErr := model.DisableChannelKey(channelId, keyId, err.Message)
+			if keyErr != nil {
+				common.SysError("failed to disable channel key: " + keyErr.Error())
+			} else if remaining > 0 {
+				common.SysLog(fmt.Sprintf("channel #%d key #%d disabled, %d keys remaining, reason: %s", channelId, keyId, remaining, err.Message))
+				return
+			}
+		}
 		disableChannel(channelId, channelName, err.Message)
-
 	}
 }
 
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"net/http"
+	"one-api/common/config"
+	"one-api/model"
+	dbmodel "one-api/relay/model"
+	"one-api/relay/util"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func channelStatsSnapshot(channelId int) model.ChannelStatsSnapshot {
+	for _, snapshot := range model.GetChannelStatsSnapshots() {
+		if snapshot.ChannelId == channelId {
+			return snapshot
+		}
+	}
+	return model.ChannelStatsSnapshot{}
+}
+
+func channelBreakerSnapshot(channelId int) model.ChannelBreakerSnapshot {
+	for _, snapshot := range model.GetChannelBreakerSnapshots() {
+		if snapshot.ChannelId == channelId {
+			return snapshot
+		}
+	}
+	return model.ChannelBreakerSnapshot{}
+}
+
+func TestRecordChannelAttempt(t *testing.T) {
+	config.ChannelBreakerEnabled = true
+	cases := []struct {
+		name            string
+		err             *dbmodel.ErrorWithStatusCode
+		requests        int64
+		failures        int64
+		breakerRequests int
+	}{
+		{"success", nil, 1, 0, 1},
+		{"upstream error", &dbmodel.ErrorWithStatusCode{StatusCode: http.StatusInternalServerError}, 1, 1, 1},
+		// 对冲中落败的尝试没有结果，不计入统计和熔断
+		{"hedge loser", &dbmodel.ErrorWithStatusCode{Error: dbmodel.Error{Code: util.HedgeCancelledCode}, StatusCode: http.StatusServiceUnavailable}, 0, 0, 0},
+	}
+	Convey("TestRecordChannelAttempt", t, func() {
+		for i, c := range cases {
+			Convey(c.name, func() {
+				channelId := 1000 + i
+				model.RecordChannelRequestStart(channelId)
+				recordChannelAttempt(channelId, "gpt-4o", time.Second, 100*time.Millisecond, c.err)
+				stats := channelStatsSnapshot(channelId)
+				So(stats.InFlight, ShouldEqual, 0)
+				So(stats.Requests, ShouldEqual, c.requests)
+				So(stats.Failures, ShouldEqual, c.failures)
+				So(channelBreakerSnapshot(channelId).Requests, ShouldEqual, c.breakerRequests)
+			})
+		}
+	})
+}
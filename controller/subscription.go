@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"one-api/common/config"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SubscriptionRequest struct {
+	PlanId        int    `json:"plan_id"`
+	Action        string `json:"action"`
+	PaymentMethod string `json:"payment_method"`
+	Currency      string `json:"currency"`
+}
+
+func GetPlans(c *gin.Context) {
+	plans, err := model.GetAllPlans(true)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+}
+
+func GetAllPlans(c *gin.Context) {
+	plans, err := model.GetAllPlans(false)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+}
+
+func AddPlan(c *gin.Context) {
+	plan := model.Plan{}
+	err := json.NewDecoder(c.Request.Body).Decode(&plan)
+	if err == nil {
+		plan.Id = 0
+		err = plan.Insert()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+func UpdatePlan(c *gin.Context) {
+	plan := model.Plan{}
+	err := json.NewDecoder(c.Request.Body).Decode(&plan)
+	if err == nil {
+		_, err = model.GetPlanById(plan.Id)
+	}
+	if err == nil {
+		err = plan.Update()
+	}
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+func DeletePlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	err := model.DeletePlanById(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetAllSubscriptions(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	subscriptions, err := model.GetUserSubscriptions(userId, p*config.ItemsPerPage, config.ItemsPerPage)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    subscriptions,
+	})
+}
+
+// GetSelfSubscription 当前订阅的状态，没有订阅时 data 为空
+func GetSelfSubscription(c *gin.Context) {
+	id := c.GetInt("id")
+	subscription, err := model.GetCurrentSubscription(id)
+	if err != nil || subscription == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": err == nil,
+			"message": errorMessage(err),
+			"data":    nil,
+		})
+		return
+	}
+	plan, err := model.GetPlanById(subscription.PlanId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	remainQuota, _ := model.GetSubscriptionRemainQuota(subscription.Id)
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"subscription": subscription,
+			"plan":         plan,
+			"remain_quota": remainQuota,
+			"renewable":    subscription.Status == model.SubscriptionStatusActive && subscription.PaidUntil <= subscription.PeriodEnd,
+		},
+	})
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// RequestSubscription 订阅、续订或升级套餐，返回支付参数
+func RequestSubscription(c *gin.Context) {
+	var req SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": "参数错误"})
+		return
+	}
+	id := c.GetInt("id")
+	if req.Action == model.PlanActionRenew {
+		current, _ := model.GetCurrentSubscription(id)
+		if current != nil {
+			req.PlanId = current.PlanId
+		}
+	}
+	money, err := model.QuoteSubscriptionOrder(id, req.PlanId, req.Action)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	topUp := &model.TopUp{
+		UserId:     id,
+		Money:      money,
+		PlanId:     req.PlanId,
+		PlanAction: req.Action,
+	}
+	requestPaymentForOrder(c, req.PaymentMethod, req.Currency, topUp)
+}
+
+func CancelSelfSubscription(c *gin.Context) {
+	id := c.GetInt("id")
+	err := model.CancelSubscription(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	model.RecordLog(id, model.LogTypeSystem, 0, "取消订阅，已付费的周期结束后不再续期")
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+var planActionNames = map[string]string{
+	model.PlanActionSubscribe: "订阅",
+	model.PlanActionRenew:     "续订",
+	model.PlanActionUpgrade:   "升级",
+}
+
+// logSubscriptionOrder 套餐订单支付成功并开通后记录日志
+func logSubscriptionOrder(topUp *model.TopUp) {
+	planName := ""
+	if plan, err := model.GetPlanById(topUp.PlanId); err == nil {
+		planName = plan.Name
+	}
+	model.RecordLog(topUp.UserId, model.LogTypeTopup, 0, fmt.Sprintf("%s套餐「%s」成功，支付金额：%.2f", planActionNames[topUp.PlanAction], planName, topUp.Money))
+}
@@ -122,10 +122,10 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
-	if len(token.Name) > 30 {
+	if err := validateToken(c, token); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "令牌名称过长",
+			"message": err.Error(),
 		})
 		return
 	}
@@ -150,18 +150,25 @@ func AddToken(c *gin.Context) {
 		}
 	}
 	cleanToken := model.Token{
-		UserId:         c.GetInt("id"),
-		Name:           token.Name,
-		Key:            common.GenerateKey(),
-		CreatedTime:    common.GetTimestamp(),
-		AccessedTime:   common.GetTimestamp(),
-		ExpiredTime:    token.ExpiredTime,
-		RemainQuota:    token.RemainQuota,
-		UnlimitedQuota: token.UnlimitedQuota,
-		Group:          token.Group,
-		BillingEnabled: token.BillingEnabled,
-		Models:         token.Models,
-		FixedContent:   token.FixedContent,
+		UserId:            c.GetInt("id"),
+		Name:              token.Name,
+		Key:               common.GenerateKey(),
+		CreatedTime:       common.GetTimestamp(),
+		AccessedTime:      common.GetTimestamp(),
+		ExpiredTime:       token.ExpiredTime,
+		RemainQuota:       token.RemainQuota,
+		UnlimitedQuota:    token.UnlimitedQuota,
+		Group:             token.Group,
+		BillingEnabled:    token.BillingEnabled,
+		Models:            token.Models,
+		FixedContent:      token.FixedContent,
+		RPM:               token.RPM,
+		TPM:               token.TPM,
+		MaxConcurrency:    token.MaxConcurrency,
+		DailyQuotaLimit:   token.DailyQuotaLimit,
+		WeeklyQuotaLimit:  token.WeeklyQuotaLimit,
+		MonthlyQuotaLimit: token.MonthlyQuotaLimit,
+		HedgeDelay:        token.HedgeDelay,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -209,10 +216,10 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
-	if len(token.Name) > 30 {
+	if err := validateToken(c, token); err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
-			"message": "令牌名称过长",
+			"message": err.Error(),
 		})
 		return
 	}
@@ -274,6 +281,13 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.Models = token.Models
 		cleanToken.FixedContent = token.FixedContent
 		cleanToken.Subnet = token.Subnet
+		cleanToken.RPM = token.RPM
+		cleanToken.TPM = token.TPM
+		cleanToken.MaxConcurrency = token.MaxConcurrency
+		cleanToken.DailyQuotaLimit = token.DailyQuotaLimit
+		cleanToken.WeeklyQuotaLimit = token.WeeklyQuotaLimit
+		cleanToken.MonthlyQuotaLimit = token.MonthlyQuotaLimit
+		cleanToken.HedgeDelay = token.HedgeDelay
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -360,5 +374,9 @@ func validateToken(c *gin.Context, token model.Token) error {
 			return fmt.Errorf("无效的网段：%s", err.Error())
 		}
 	}
+	if token.RPM < 0 || token.TPM < 0 || token.MaxConcurrency < 0 ||
+		token.DailyQuotaLimit < 0 || token.WeeklyQuotaLimit < 0 || token.MonthlyQuotaLimit < 0 || token.HedgeDelay < 0 {
+		return fmt.Errorf("令牌限制不能为负数")
+	}
 	return nil
 }
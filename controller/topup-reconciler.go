@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/common/config"
+	"one-api/model"
+	"one-api/payment"
+	"time"
+)
+
+const (
+	// 创建不久的订单可能还在支付中，回调也可能马上到达
+	topUpReconcileDelay = 5 * time.Minute
+	// 超过该时间仍未支付的订单直接关闭
+	topUpPendingTimeout = 72 * time.Hour
+	topUpReconcileBatch = 100
+)
+
+// reconcileTopUps 向支付服务商查询长时间未收到回调的订单并处理，查询失败的订单留到下一轮，不会被关闭
+func reconcileTopUps() {
+	now := time.Now()
+	lastId := 0
+	for {
+		topUps, err := model.GetStalePendingTopUps(now.Add(-topUpReconcileDelay).Unix(), lastId, topUpReconcileBatch)
+		if err != nil {
+			common.SysError("failed to fetch pending top-ups: " + err.Error())
+			return
+		}
+		for _, topUp := range topUps {
+			lastId = topUp.Id
+			reconcileTopUp(topUp, now)
+		}
+		if len(topUps) < topUpReconcileBatch {
+			return
+		}
+	}
+}
+
+func reconcileTopUp(topUp *model.TopUp, now time.Time) {
+	provider, err := payment.GetProvider(topUp.Provider)
+	var result *payment.OrderResult
+	if err == nil {
+		result, err = provider.QueryOrder(topUp)
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to query top-up %s: %s", topUp.TradeNo, err.Error()))
+		return
+	}
+	if err := settleTopUp(provider, topUp, result, model.TopUpEventSourceReconciler); err != nil {
+		common.SysError(fmt.Sprintf("failed to reconcile top-up %s: %s", topUp.TradeNo, err.Error()))
+		return
+	}
+	expired := now.Sub(time.Unix(topUp.CreateTime, 0)) > topUpPendingTimeout
+	if expired && topUp.Status == model.TopUpStatusPending && result.Status == payment.OrderStatusPending {
+		if _, err := model.CloseTopUp(topUp, model.TopUpEventSourceReconciler, "订单超时未支付"); err != nil {
+			common.SysError(fmt.Sprintf("failed to close top-up %s: %s", topUp.TradeNo, err.Error()))
+		}
+	}
+}
+
+// reconcileTopUpRefunds 向支付服务商查询长时间处于退款中的订单，按退款结果完成或撤销退款
+func reconcileTopUpRefunds() {
+	now := time.Now()
+	lastId := 0
+	for {
+		topUps, err := model.GetStaleRefundingTopUps(now.Add(-topUpReconcileDelay).Unix(), lastId, topUpReconcileBatch)
+		if err != nil {
+			common.SysError("failed to fetch refunding top-ups: " + err.Error())
+			return
+		}
+		for _, topUp := range topUps {
+			lastId = topUp.Id
+			reconcileTopUpRefund(topUp)
+		}
+		if len(topUps) < topUpReconcileBatch {
+			return
+		}
+	}
+}
+
+func reconcileTopUpRefund(topUp *model.TopUp) {
+	provider, err := payment.GetProvider(topUp.Provider)
+	status := ""
+	if err == nil {
+		status, err = provider.QueryRefund(topUp)
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to query refund of top-up %s: %s", topUp.TradeNo, err.Error()))
+		return
+	}
+	// 更新订单失败时已经记录日志，处理中的退款留到下一轮
+	_ = applyTopUpRefundStatus(topUp, topUp.PendingRefund(), status, "服务商没有退款记录", model.TopUpEventSourceReconciler, 0)
+}
+
+// StartTopUpReconciler 按 TopUpReconcileInterval 定期对账，间隔为 0 时暂停
+func StartTopUpReconciler() {
+	for {
+		interval := config.TopUpReconcileInterval
+		if interval <= 0 {
+			time.Sleep(time.Minute)
+			continue
+		}
+		time.Sleep(time.Duration(interval) * time.Minute)
+		reconcileTopUps()
+		reconcileTopUpRefunds()
+	}
+}
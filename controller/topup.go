@@ -1,20 +1,19 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"net/url"
 	"one-api/common"
 	"one-api/common/config"
 	"one-api/model"
+	"one-api/payment"
 	"strconv"
 	"time"
 
-	epay "one-api/epay"
-
 	"github.com/gin-gonic/gin"
-	"github.com/samber/lo"
 )
 
 type EpayRequest struct {
@@ -23,6 +22,7 @@ type EpayRequest struct {
 	TopUpCode     string `json:"top_up_code"`
 	TopupRatio    string `json:"topup_ratio"`
 	TopupAmount   string `json:"topup_amount"`
+	Currency      string `json:"currency"`
 }
 
 type AmountRequest struct {
@@ -32,20 +32,6 @@ type AmountRequest struct {
 	TopupAmount string `json:"topup_amount"`
 }
 
-func GetEpayClient() *epay.Client {
-	if config.PayAddress == "" || config.EpayId == "" || config.EpayKey == "" {
-		return nil
-	}
-	withUrl, err := epay.NewClientWithUrl(&epay.Config{
-		PartnerID: config.EpayId,
-		Key:       config.EpayKey,
-	}, config.PayAddress)
-	if err != nil {
-		return nil
-	}
-	return withUrl
-}
-
 func GetAmount(count float64, topupratio float64, topupamount float64, user model.User) float64 {
 	topupGroupRatio := common.GetTopupGroupRatio(user.Group)
 	if topupGroupRatio == 0 {
@@ -76,130 +62,160 @@ func RequestEpay(c *gin.Context) {
 	user, _ := model.GetUserById(id, false)
 	amount := GetAmount(float64(req.Amount), topupratio, topupamount, *user)
 
-	var payType epay.PurchaseType
-	if req.PaymentMethod == "zfb" {
-		payType = epay.Alipay
-	}
-	if req.PaymentMethod == "wx" {
-		req.PaymentMethod = "wxpay"
-		payType = epay.WechatPay
-	}
-
-	returnUrl, _ := url.Parse(config.ServerAddress + "/log")
-	notifyUrl, _ := url.Parse(config.ServerAddress + "/api/user/epay/notify")
-	tradeNo := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
-	payMoney := amount
-	client := GetEpayClient()
-	if client == nil {
-		c.JSON(200, gin.H{"message": "error", "data": "当前管理员未配置支付信息"})
-		return
-	}
-	uri, params, err := client.Purchase(&epay.PurchaseArgs{
-		Type:           payType,
-		ServiceTradeNo: "A" + tradeNo,
-		Name:           "B" + tradeNo,
-		Money:          strconv.FormatFloat(payMoney, 'f', 2, 64),
-		Device:         epay.PC,
-		NotifyUrl:      notifyUrl,
-		ReturnUrl:      returnUrl,
-	})
-
-	if err != nil {
-		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
-		return
-	}
 	topUp := &model.TopUp{
 		UserId:     id,
 		Amount:     req.Amount,
-		Money:      payMoney,
+		Money:      amount,
 		TopupRatio: req.TopupRatio,
-		TradeNo:    "A" + tradeNo,
-		CreateTime: time.Now().Unix(),
-		Status:     "pending",
 	}
+	requestPaymentForOrder(c, req.PaymentMethod, req.Currency, topUp)
+}
+
+// requestPaymentForOrder 按币种选择支付服务商，先创建待支付的订单再拉起支付，充值和套餐订单共用
+func requestPaymentForOrder(c *gin.Context, paymentMethod string, currency string, topUp *model.TopUp) {
+	provider, currency, rate, err := payment.GetProviderByCurrency(currency)
+	if err != nil {
+		c.JSON(200, gin.H{"message": "error", "data": err.Error()})
+		return
+	}
+	tradeNo := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	topUp.TradeNo = "A" + tradeNo
+	topUp.Money = math.Round(topUp.Money*rate*100) / 100
+	topUp.Currency = currency
+	topUp.Provider = provider.Name()
+	topUp.CreateTime = time.Now().Unix()
+	topUp.Status = model.TopUpStatusPending
 	err = topUp.Insert()
 	if err != nil {
+		common.SysError(fmt.Sprintf("failed to create top-up order: %s", err.Error()))
 		c.JSON(200, gin.H{"message": "error", "data": "创建订单失败"})
 		return
 	}
-	c.JSON(200, gin.H{"message": "success", "data": params, "url": uri})
+	checkout, err := provider.CreateOrder(topUp, paymentMethod)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to create %s order: %s", provider.Name(), err.Error()))
+		if _, closeErr := model.CloseTopUp(topUp, model.TopUpEventSourceCheckout, "拉起支付失败"); closeErr != nil {
+			common.SysError(fmt.Sprintf("failed to close top-up %s: %s", topUp.TradeNo, closeErr.Error()))
+		}
+		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
+		return
+	}
+	if topUp.ProviderOrderId != "" {
+		if err := topUp.UpdateProviderOrderId(); err != nil {
+			common.SysError(fmt.Sprintf("failed to save provider order id of top-up %s: %s", topUp.TradeNo, err.Error()))
+		}
+	}
+	c.JSON(200, gin.H{"message": "success", "data": checkout.Params, "url": checkout.Url})
 }
 
+// EpayNotify 兼容旧的易支付回调地址
 func EpayNotify(c *gin.Context) {
-	params := lo.Reduce(lo.Keys(c.Request.URL.Query()), func(r map[string]string, t string, i int) map[string]string {
-		r[t] = c.Request.URL.Query().Get(t)
-		return r
-	}, map[string]string{})
-	client := GetEpayClient()
-	if client == nil {
-		log.Println("易支付回调失败 未找到配置信息")
-		_, err := c.Writer.Write([]byte("fail"))
-		if err != nil {
-			log.Println("易支付回调写入失败")
-		}
+	paymentNotify(c, "epay")
+}
+
+func PaymentNotify(c *gin.Context) {
+	paymentNotify(c, c.Param("provider"))
+}
+
+func paymentNotify(c *gin.Context, name string) {
+	provider, err := payment.GetProvider(name)
+	if err != nil {
+		log.Printf("支付回调失败 %s: %s", name, err.Error())
+		c.String(http.StatusBadRequest, "fail")
 		notifyEmailForFail()    // 发送回调失败通知
 		notifyWxPusherForFail() // 发送回调失败通知
 		return
 	}
-	verifyInfo, err := client.Verify(params)
-	if err != nil || !verifyInfo.VerifyStatus {
-		log.Printf("易支付回调验证失败: %v", err)
-		_, writeErr := c.Writer.Write([]byte("fail"))
-		if writeErr != nil {
-			log.Println("易支付回调写入失败")
-		}
+	result, err := provider.VerifyWebhook(c.Request)
+	if err != nil {
+		log.Printf("%s 支付回调验证失败: %v", name, err)
+		provider.WriteWebhookResponse(c.Writer, false)
 		notifyEmailForFail()    // 发送验证失败通知
 		notifyWxPusherForFail() // 发送验证失败通知
 		return
 	}
+	if result.TradeNo == "" {
+		// 与订单无关的通知
+		provider.WriteWebhookResponse(c.Writer, true)
+		return
+	}
+	log.Printf("%s 支付回调: %+v", name, result)
+	topUp := model.GetTopUpByTradeNo(result.TradeNo)
+	if topUp == nil {
+		// 已验证签名的回调找不到订单，可能是用户已付款但订单没有保存，需要人工处理
+		common.SysError(fmt.Sprintf("%s webhook for unknown top-up %s: %+v", name, result.TradeNo, result))
+		provider.WriteWebhookResponse(c.Writer, false)
+		notifyEmailForFail()
+		notifyWxPusherForFail()
+		return
+	}
+	if err := settleTopUp(provider, topUp, result, model.TopUpEventSourceWebhook); err != nil {
+		log.Printf("%s 支付回调处理订单失败: %v, %s", name, topUp, err.Error())
+		provider.WriteWebhookResponse(c.Writer, false)
+		notifyEmailForFail()
+		notifyWxPusherForFail()
+		return
+	}
+	provider.WriteWebhookResponse(c.Writer, true)
+}
 
-	if verifyInfo.TradeStatus == epay.StatusTradeSuccess {
-		log.Println(verifyInfo)
-		topUp := model.GetTopUpByTradeNo(verifyInfo.ServiceTradeNo)
-		if topUp != nil && topUp.Status == "pending" {
-			topUp.Status = "success"
-			err := topUp.Update()
-			if err != nil {
-				log.Printf("易支付回调更新订单失败: %v", topUp)
-				return
-			}
-			//user, _ := model.GetUserById(topUp.UserId, false)
-			//user.Quota += topUp.Amount * 500000
-			multipliedQuota := float64(topUp.Amount) * config.QuotaPerUnit
-			err = model.IncreaseUserQuota(topUp.UserId, int(multipliedQuota))
-			if err != nil {
-				log.Printf("易支付回调更新用户失败: %v", topUp)
-				return
-			}
-			log.Printf("易支付回调更新用户成功 %v", topUp)
-
-			err = model.IncreaseRechargeQuota(topUp.UserId, topUp.TopupRatio, int(multipliedQuota))
-			if err != nil {
-				log.Printf("易支付回调更新用户失败: %v", topUp)
-				return
-			}
-			notifyEmail(topUp)
-			notifyWxPusher(topUp)
-			model.RecordLog(topUp.UserId, model.LogTypeTopup, int(multipliedQuota), fmt.Sprintf("在线充值成功，充值: %v，支付金额：%.2f", common.LogQuota(int(multipliedQuota)), topUp.Money))
-			model.VipInsert(topUp.UserId, int(multipliedQuota))
-			GroupEnable, _ := strconv.ParseBool(config.OptionMap["GroupEnable"])
-			if GroupEnable {
-				err = model.VipUserQuota(topUp.UserId)
-				if err != nil {
-					log.Printf("用户分组更新失败: %v", topUp)
-					return
-				}
-			}
+// settleTopUp 按服务商返回的状态处理订单，回调和对账可能重复处理同一订单，只有第一次生效。
+// 已关闭的订单收到支付时仍然发放，避免用户付款后没有到账
+func settleTopUp(provider payment.Provider, topUp *model.TopUp, result *payment.OrderResult, source string) error {
+	if topUp.Provider != provider.Name() {
+		return fmt.Errorf("order belongs to provider %s", topUp.Provider)
+	}
+	switch result.Status {
+	case payment.OrderStatusPaid:
+		if topUp.Status != model.TopUpStatusPending && topUp.Status != model.TopUpStatusClosed {
+			return nil
+		}
+		if result.Money > 0 && math.Abs(result.Money-topUp.Money) >= 0.01 {
+			return fmt.Errorf("paid money %.2f does not match the order", result.Money)
 		}
-		_, writeErr := c.Writer.Write([]byte("success")) // 确保发送 success 响应
-		if writeErr != nil {
-			log.Println("易支付回调响应成功写入失败")
+		reopened := topUp.Status == model.TopUpStatusClosed
+		completed, err := model.CompleteTopUp(topUp, result.ProviderOrderId, result.ProviderPaymentId, source)
+		if errors.Is(err, model.ErrPlanOrderNotApplicable) {
+			// 订单已改为失败，支付结果已经记录，通知管理员退款
+			common.SysError(fmt.Sprintf("paid plan order %s can not be applied and needs a refund: %s", topUp.TradeNo, err.Error()))
+			notifyEmailForFail()
+			notifyWxPusherForFail()
+			return nil
 		}
-	} else {
-		log.Printf("易支付异常回调: %v", verifyInfo)
-		_, writeErr := c.Writer.Write([]byte("fail"))
-		if writeErr != nil {
-			log.Println("易支付回调写入失败")
+		if err != nil || !completed {
+			return err
+		}
+		if reopened {
+			common.SysLog(fmt.Sprintf("top-up %s was paid after it had been closed", topUp.TradeNo))
+		}
+		fulfillTopUp(topUp)
+	case payment.OrderStatusClosed:
+		if topUp.Status != model.TopUpStatusPending {
+			return nil
+		}
+		_, err := model.CloseTopUp(topUp, source, "支付服务商已关闭订单")
+		return err
+	}
+	return nil
+}
+
+// fulfillTopUp 订单首次确认支付后发送通知，额度和套餐已经在确认支付时发放
+func fulfillTopUp(topUp *model.TopUp) {
+	if topUp.PlanId != 0 {
+		logSubscriptionOrder(topUp)
+		return
+	}
+	quota := topUp.TopUpQuota()
+	log.Printf("支付回调更新用户成功 %v", topUp)
+	notifyEmail(topUp)
+	notifyWxPusher(topUp)
+	model.RecordLog(topUp.UserId, model.LogTypeTopup, quota, fmt.Sprintf("在线充值成功，充值: %v，支付金额：%.2f %s", common.LogQuota(quota), topUp.Money, topUp.Currency))
+	model.VipInsert(topUp.UserId, quota)
+	GroupEnable, _ := strconv.ParseBool(config.OptionMap["GroupEnable"])
+	if GroupEnable {
+		err := model.VipUserQuota(topUp.UserId)
+		if err != nil {
+			log.Printf("用户分组更新失败: %v", topUp)
 		}
 	}
 }
@@ -360,6 +376,115 @@ func GetTopUp(c *gin.Context) {
 	return
 }
 
+type RefundTopUpRequest struct {
+	Reason string `json:"reason"`
+}
+
+// RefundTopUp 订单退款，先扣回充值的额度，额度已部分消费时按剩余比例退款
+func RefundTopUp(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var req RefundTopUpRequest
+	_ = c.ShouldBindJSON(&req)
+	if req.Reason == "" {
+		req.Reason = "管理员退款"
+	}
+	operatorId := c.GetInt("id")
+	topUp := model.GetTopUpById(id)
+	if topUp == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "订单不存在",
+		})
+		return
+	}
+	provider, err := payment.GetProvider(topUp.Provider)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	topUp, refund, err := model.ReserveTopUpRefund(id, operatorId, req.Reason)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	err = provider.Refund(topUp, refund.Money)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to refund top-up %s: %s", topUp.TradeNo, err.Error()))
+	}
+	err = resolveTopUpRefund(provider, topUp, refund, err, operatorId)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    refund,
+	})
+}
+
+var errTopUpRefundPending = errors.New("服务商退款处理中，订单保持退款中，稍后自动确认")
+
+// resolveTopUpRefund 按发起退款的结果完成或撤销退款，refundErr 为发起退款时的错误。
+// 出错时服务商可能已经退款，先查询退款状态，查询失败或退款处理中时订单保持退款中，由对账任务确认
+func resolveTopUpRefund(provider payment.Provider, topUp *model.TopUp, refund *model.TopUpRefund, refundErr error, operatorId int) error {
+	if refundErr == nil {
+		return applyTopUpRefundStatus(topUp, refund, payment.RefundStatusSucceeded, "", model.TopUpEventSourceAdmin, operatorId)
+	}
+	status, err := provider.QueryRefund(topUp)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to query refund of top-up %s: %s", topUp.TradeNo, err.Error()))
+		return fmt.Errorf("退款结果未知，订单保持退款中，稍后自动确认：%s", refundErr.Error())
+	}
+	return applyTopUpRefundStatus(topUp, refund, status, "退款失败："+refundErr.Error(), model.TopUpEventSourceAdmin, operatorId)
+}
+
+// applyTopUpRefundStatus 服务商已退款时完成退款，没有退款时撤销退款并返回 reason
+func applyTopUpRefundStatus(topUp *model.TopUp, refund *model.TopUpRefund, status string, reason string, source string, operatorId int) error {
+	switch status {
+	case payment.RefundStatusSucceeded:
+		if err := model.FinishTopUpRefund(topUp, refund, source, operatorId); err != nil {
+			common.SysError(fmt.Sprintf("failed to finish refund of top-up %s: %s", topUp.TradeNo, err.Error()))
+			return fmt.Errorf("服务商已退款，但更新订单失败，稍后自动确认：%s", err.Error())
+		}
+		model.RecordLog(topUp.UserId, model.LogTypeSystem, 0, fmt.Sprintf("充值订单 %s 退款 %.2f %s，扣回额度 %s", topUp.TradeNo, refund.Money, topUp.Currency, common.LogQuota(refund.Quota)))
+		return nil
+	case payment.RefundStatusPending:
+		return errTopUpRefundPending
+	}
+	if err := model.RollbackTopUpRefund(topUp, refund, source, operatorId, reason); err != nil {
+		common.SysError(fmt.Sprintf("failed to rollback refund of top-up %s: %s", topUp.TradeNo, err.Error()))
+		return fmt.Errorf("%s，撤销退款失败：%s", reason, err.Error())
+	}
+	return errors.New(reason)
+}
+
+func GetTopUpEvents(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	events, err := model.GetTopUpEvents(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    events,
+	})
+}
+
 func DeleteTopUp(c *gin.Context) {
 
 	err := model.DeleteTopUpsWithStatusPending()
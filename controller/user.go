@@ -481,6 +481,24 @@ func GetSelf(c *gin.Context) {
 	return
 }
 
+// GetSelfQuotaLots 当前用户未用完的额度批次，按扣除顺序排列
+func GetSelfQuotaLots(c *gin.Context) {
+	id := c.GetInt("id")
+	lots, err := model.GetUserQuotaLots(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    lots,
+	})
+}
+
 func GetUserModels(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
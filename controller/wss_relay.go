@@ -60,7 +60,7 @@ func WssRelay(c *gin.Context) {
 	// 2. 获取初始参数，添加错误检查
 	params := wssParams{
 		relayMode:     constant.Path2RelayMode(c.Request.URL.Path),
-		group:         c.GetString("group"),
+		group:         middleware.GetChannelGroup(c),
 		originalModel: c.GetString(ctxkey.OriginalModel),
 	}
 
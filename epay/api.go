@@ -0,0 +1,85 @@
+package epay
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	ApiUrl = "/api.php"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+type apiRes struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// QueryRes 订单查询结果，Status 为 1 表示已支付，2 表示已退款
+type QueryRes struct {
+	apiRes
+	// 易支付订单号
+	TradeNo string `json:"trade_no"`
+	// 商家订单号
+	ServiceTradeNo string `json:"out_trade_no"`
+	Type           string `json:"type"`
+	Money          string `json:"money"`
+	Status         int    `json:"status"`
+}
+
+func (c *Client) call(method string, params url.Values, res interface{}) error {
+	u, err := c.BaseUrl.Parse(ApiUrl)
+	if err != nil {
+		return err
+	}
+	params.Set("pid", c.Config.PartnerID)
+	params.Set("key", c.Config.Key)
+	var resp *http.Response
+	if method == http.MethodGet {
+		u.RawQuery = params.Encode()
+		resp, err = httpClient.Get(u.String())
+	} else {
+		resp, err = httpClient.Post(u.String()+"?act="+params.Get("act"), "application/x-www-form-urlencoded", strings.NewReader(params.Encode()))
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+const (
+	OrderStatusPaid     = 1
+	OrderStatusRefunded = 2
+)
+
+// Query 按商家订单号查询订单
+func (c *Client) Query(serviceTradeNo string) (*QueryRes, error) {
+	var res QueryRes
+	err := c.call(http.MethodGet, url.Values{"act": {"order"}, "out_trade_no": {serviceTradeNo}}, &res)
+	if err != nil {
+		return nil, err
+	}
+	if res.Code != 1 {
+		return nil, errors.New(res.Msg)
+	}
+	return &res, nil
+}
+
+// Refund 按易支付订单号退款，money 可以小于订单金额
+func (c *Client) Refund(tradeNo string, money string) error {
+	var res apiRes
+	err := c.call(http.MethodPost, url.Values{"act": {"refund"}, "trade_no": {tradeNo}, "money": {money}}, &res)
+	if err != nil {
+		return err
+	}
+	if res.Code != 1 {
+		return errors.New(res.Msg)
+	}
+	return nil
+}
@@ -15,6 +15,10 @@ type Service interface {
 	Purchase(args *PurchaseArgs) (string, map[string]string, error)
 	// Verify 验证回调参数是否符合签名
 	Verify(params map[string]string) (*VerifyRes, error)
+	// Query 查询订单状态
+	Query(serviceTradeNo string) (*QueryRes, error)
+	// Refund 订单退款
+	Refund(tradeNo string, money string) error
 }
 
 type Client struct {
@@ -84,6 +84,17 @@ func main() {
 	go model.UpdateQuotaData()
 	// 额度有效期
 	go model.UpdateUserQuotaData()
+	// 额度账本对账
+	if common.IsMasterNode {
+		if err := model.InitQuotaLedger(); err != nil {
+			common.FatalLog("failed to initialize quota ledger: " + err.Error())
+		}
+		go model.StartQuotaLedgerReconciler()
+		// 订阅周期
+		go model.StartSubscriptionScheduler()
+		// 充值订单对账
+		go controller.StartTopUpReconciler()
+	}
 	//定时更新GCP AccessTokens
 	go model.StartScheduledRefreshAccessTokens()
 	if os.Getenv("CHANNEL_UPDATE_FREQUENCY") != "" {
@@ -107,6 +118,10 @@ func main() {
 	go controller.UpdateMidjourneyTask()
 	// 启动额度提醒检查器
 	go controller.StartQuotaAlertChecker()
+	// 启动批处理执行器
+	if common.IsMasterNode {
+		go controller.StartBatchRunner()
+	}
 	//go controller.UpdateMidjourneyTaskBulk()
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		config.BatchUpdateEnabled = true
@@ -9,6 +9,7 @@ import (
 	"one-api/common"
 	"one-api/common/network"
 	"one-api/model"
+	"one-api/relay/constant"
 	relaymodel "one-api/relay/model"
 	"strings"
 
@@ -20,6 +21,7 @@ const (
 	headerAuthorization        = "Authorization"
 	headerSecWebsocketProtocol = "Sec-Websocket-Protocol"
 	headerXAPIKey              = "x-api-key"
+	headerXGoogAPIKey          = "x-goog-api-key"
 	headerMJAPISecret          = "mj-api-secret"
 	prefixOpenAIInsecureKey    = "openai-insecure-api-key."
 	keyMidjourneyProxy         = "midjourney-proxy"
@@ -136,6 +138,17 @@ func getModelForPath(path string) string {
 	return ""
 }
 
+func isGeminiPath(path string) bool {
+	return strings.HasPrefix(path, "/v1beta/models/")
+}
+
+// skipBodyParse 判断请求体是否无需解析模型（multipart 上传等）
+func skipBodyParse(path string) bool {
+	return strings.HasPrefix(path, "/v1/audio/transcriptions") ||
+		strings.HasPrefix(path, "/v1/files") ||
+		strings.HasPrefix(path, "/v1/batches")
+}
+
 func TokenAuth() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		isWebSocket := c.GetHeader("Upgrade") == "websocket"
@@ -153,6 +166,16 @@ func TokenAuth() func(c *gin.Context) {
 					}
 				}
 			}
+		case key == "" && isGeminiPath(c.Request.URL.Path):
+			// Google SDK 通过 x-goog-api-key 或 ?key= 传递密钥
+			headerValue := c.Request.Header.Get(headerXGoogAPIKey)
+			if headerValue == "" {
+				headerValue = c.Query("key")
+				query := c.Request.URL.Query()
+				query.Del("key")
+				c.Request.URL.RawQuery = query.Encode()
+			}
+			key, parts = processAuthHeader(headerValue)
 		case key == "":
 			headerKey := headerXAPIKey
 			if c.Request.Header.Get(headerMJAPISecret) != "" {
@@ -167,7 +190,7 @@ func TokenAuth() func(c *gin.Context) {
 			c.Set("claude_original_request", true)
 		}
 		modelRequest := ModelRequest{Model: getModelForPath(c.Request.URL.Path)}
-		if !strings.HasPrefix(c.Request.URL.Path, "/v1/audio/transcriptions") && c.Request.Method != http.MethodGet {
+		if !skipBodyParse(c.Request.URL.Path) && c.Request.Method != http.MethodGet {
 			if err := common.UnmarshalBodyReusable(c, &modelRequest); err != nil {
 				abortWithMessage(c, http.StatusBadRequest, "无效的请求: "+err.Error())
 				return
@@ -178,6 +201,9 @@ func TokenAuth() func(c *gin.Context) {
 				modelRequest.Model = c.Param("model")
 			}
 		}
+		if isGeminiPath(c.Request.URL.Path) {
+			modelRequest.Model, _ = constant.GeminiModelAction(c.Request.URL.Path)
+		}
 		if strings.HasSuffix(c.Request.URL.Path, "realtime") {
 			modelRequest.Model = c.Query("model")
 			if modelRequest.Model == "" {
@@ -234,8 +260,18 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		if token.OrgId != 0 {
+			if err := model.CheckOrgTokenAccess(token); err != nil {
+				abortWithMessage(c, http.StatusForbidden, err.Error())
+				return
+			}
+		} else if err := model.CheckSubscriptionAccess(token.UserId, modelRequest.Model); err != nil {
+			abortWithMessage(c, http.StatusForbidden, err.Error())
+			return
+		}
 		ctx := c.Request.Context()
 		c.Set("id", token.UserId)
+		c.Set("org_id", token.OrgId)
 		c.Set("token_id", token.Id)
 		c.Set("token_name", token.Name)
 		c.Set("billing_enabled", token.BillingEnabled)
@@ -278,6 +314,13 @@ func TokenAuth() func(c *gin.Context) {
 				return
 			}
 		}
+		if consumeQuota {
+			release, ok := checkTokenLimits(c, token)
+			if !ok {
+				return
+			}
+			defer release()
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"one-api/common/config"
+	"one-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 排队获得的渠道已经占用了并发名额，记录在上下文中由 relay 接管释放
+const channelSlotReservedKey = "channel_slot_reserved"
+
+// ShouldQueueForChannel 开启排队且分组下确实配置了渠道（只是暂时饱和）时才排队
+func ShouldQueueForChannel(group string, modelName string) bool {
+	return config.ChannelQueueEnabled && model.GroupModelHasChannels(group, modelName)
+}
+
+// WaitForQueuedChannel 排队等待分组下的渠道空闲，返回的渠道已占用并发名额
+func WaitForQueuedChannel(c *gin.Context, group string, modelName string) (*model.Channel, error) {
+	isTools := c.GetBool("is_tools")
+	isClaudeOriginalRequest := c.GetBool("claude_original_request")
+	channel, err := model.WaitForChannel(c.Request.Context(), group, modelName, func() (*model.Channel, error) {
+		return model.CacheGetRandomSatisfiedChannel(group, modelName, false, isTools, isClaudeOriginalRequest, nil, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.Set(channelSlotReservedKey, channel.Id)
+	return channel, nil
+}
+
+// TakeReservedChannelSlot 排队时已为该渠道占用并发名额时返回 true，名额转由调用方释放
+func TakeReservedChannelSlot(c *gin.Context, channelId int) bool {
+	if channelId == 0 || c.GetInt(channelSlotReservedKey) != channelId {
+		return false
+	}
+	c.Set(channelSlotReservedKey, 0)
+	return true
+}
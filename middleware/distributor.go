@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"one-api/common"
+	"one-api/common/config"
 	"one-api/common/ctxkey"
 	"one-api/model"
 	"strconv"
@@ -31,18 +33,58 @@ func Distribute() func(c *gin.Context) {
 				abortWithMessage(c, http.StatusBadRequest, err.Error())
 				return
 			}
+		} else if chain, ok := common.GetVirtualModelChain(modelName.(string)); ok {
+			channel, err = selectVirtualModelChannel(c, tokenGroup.(string), modelName.(string), chain)
 		} else {
-			channel, err = selectChannelForUser(c, tokenGroup.(string), modelName.(string))
-			if err != nil {
-				abortWithMessage(c, http.StatusServiceUnavailable, err.Error())
-				return
+			channel, err = selectChannel(c, tokenGroup.(string), modelName.(string), true)
+		}
+		if err != nil {
+			status := http.StatusServiceUnavailable
+			if errors.As(err, &virtualModelAccessError{}) {
+				status = http.StatusForbidden
+			} else if errors.As(err, &channelSaturatedError{}) {
+				status = http.StatusTooManyRequests
 			}
+			abortWithMessage(c, status, err.Error())
+			return
 		}
-		SetupContextForSelectedChannel(c, channel, modelName.(string), "")
+		// 没有经过 relay 的请求（如 Midjourney、WebSocket）在这里归还排队时占用的名额
+		defer func() {
+			if TakeReservedChannelSlot(c, channel.Id) {
+				model.ReleaseChannelSlot(channel.Id, channel.GetMaxConcurrency())
+			}
+		}()
+		SetupContextForSelectedChannel(c, channel, c.GetString("model"), "")
 		c.Next()
 	}
 }
 
+// channelSaturatedError 分组下的渠道均已饱和且排队超时
+type channelSaturatedError struct {
+	error
+}
+
+// selectChannel 组织令牌优先使用组织自己的渠道，组织没有可用渠道时使用令牌分组的渠道，
+// wait 为 true 时分组下的渠道均已饱和则排队等待
+func selectChannel(c *gin.Context, tokenGroup string, modelName string, wait bool) (*model.Channel, error) {
+	if orgId := c.GetInt("org_id"); orgId != 0 && config.OrgChannelEnabled {
+		orgGroup := model.OrgChannelGroup(orgId)
+		if channel, err := selectChannelForUser(c, orgGroup, modelName); err == nil {
+			c.Set(ctxkey.ChannelGroup, orgGroup)
+			return channel, nil
+		}
+	}
+	c.Set(ctxkey.ChannelGroup, "")
+	channel, err := selectChannelForUser(c, tokenGroup, modelName)
+	if err != nil && wait && ShouldQueueForChannel(tokenGroup, modelName) {
+		channel, err = WaitForQueuedChannel(c, tokenGroup, modelName)
+		if err != nil {
+			return nil, channelSaturatedError{fmt.Errorf("当前分组 %s 下模型 %s 的渠道均已饱和，%s", tokenGroup, modelName, err.Error())}
+		}
+	}
+	return channel, err
+}
+
 func getChannelById(channelId string, tokenGroup string, modelName string) (*model.Channel, error) {
 	id, err := strconv.Atoi(channelId)
 	if err != nil {
@@ -72,6 +114,14 @@ func getChannelById(channelId string, tokenGroup string, modelName string) (*mod
 	return channel, nil
 }
 
+// GetChannelGroup 重试时选择渠道使用的分组，与首次选中的渠道所在的分组一致
+func GetChannelGroup(c *gin.Context) string {
+	if group := c.GetString(ctxkey.ChannelGroup); group != "" {
+		return group
+	}
+	return c.GetString("group")
+}
+
 func selectChannelForUser(c *gin.Context, tokenGroup string, modelName string) (*model.Channel, error) {
 	value, _ := c.Get("is_tools")
 	isTools, ok := value.(bool)
@@ -79,6 +129,12 @@ func selectChannelForUser(c *gin.Context, tokenGroup string, modelName string) (
 		return nil, fmt.Errorf("is_tools value is not of type bool")
 	}
 	claudeoriginalrequest := c.GetBool("claude_original_request")
+	// 相同前缀的请求优先使用之前固定的渠道，渠道不可用时按正常策略选择
+	if key := getStickyRoutingKey(c, tokenGroup, modelName); key != "" {
+		if channel := model.CacheGetAffinityChannel(key, tokenGroup, modelName, isTools, claudeoriginalrequest); channel != nil {
+			return channel, nil
+		}
+	}
 	failedChannelIds := []int{}
 	channel, err := model.CacheGetRandomSatisfiedChannel(tokenGroup, modelName, false, isTools, claudeoriginalrequest, failedChannelIds, 0)
 	if err != nil {
@@ -106,7 +162,7 @@ func isGroupMatched(channelGroups string, tokenGroup string) bool {
 func isModelSupported(channelModels string, modelName string) bool {
 	models := strings.Split(channelModels, ",")
 	for _, m := range models {
-		if m == modelName {
+		if common.MatchModelName(m, modelName) {
 			return true
 		}
 	}
@@ -117,6 +173,8 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	c.Set("channel", channel.Type)
 	c.Set("channel_id", channel.Id)
 	c.Set("channel_name", channel.Name)
+	c.Set("channel_max_concurrency", channel.GetMaxConcurrency())
+	c.Set("channel_tpm_limit", channel.GetTPMLimit())
 	if channel.ProxyURL != nil {
 		c.Set("proxy_url", *channel.ProxyURL)
 	}
@@ -132,7 +190,9 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	c.Set("model_mapping", channel.GetModelMapping())
 	c.Set("status_code_mapping", channel.GetStatusCodeMapping())
 	c.Set("original_model", modelName)
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	key, keyId := channel.SelectKey()
+	c.Set(ctxkey.ChannelKeyId, keyId)
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	c.Set("base_url", channel.GetBaseURL())
 	var supportsCacheControl bool
 	if channel.SupportsCacheControl != nil {
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/common/config"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type groupModelLimitCheck struct {
+	limit int
+	key   string
+}
+
+// GroupModelRateLimit 按 GroupModelLimits 对分组内的模型以及分组内的每个用户限制 RPM/TPM，
+// 需要放在 TokenAuth 之后
+func GroupModelRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if !config.GroupModelLimitsEnabled {
+			c.Next()
+			return
+		}
+		group := c.GetString("group")
+		modelName := c.GetString("model")
+		limit, ok := common.GetGroupModelLimit(group, modelName)
+		if !ok {
+			c.Next()
+			return
+		}
+		scope, userScope := common.GroupModelLimitScopes(group, modelName, c.GetInt("id"))
+		reset := strconv.FormatInt(common.RateWindowReset(), 10)
+
+		// TPM 按已经消耗的 token 判断，请求完成后才计入实际用量
+		tokenChecks := []groupModelLimitCheck{{limit.TPM, "tpm:" + scope}, {limit.UserTPM, "tpm:" + userScope}}
+		tokenLimit, tokenRemaining, tokenOk := checkGroupModelLimit(tokenChecks)
+		if tokenLimit > 0 {
+			c.Header("x-ratelimit-limit-tokens", strconv.Itoa(tokenLimit))
+			c.Header("x-ratelimit-remaining-tokens", strconv.FormatInt(tokenRemaining, 10))
+			c.Header("x-ratelimit-reset-tokens", reset+"s")
+		}
+		// RPM 在检查的同时计入本次请求，并发的请求不会同时通过最后一个名额
+		requestChecks := []groupModelLimitCheck{{limit.RPM, "rpm:" + scope}, {limit.UserRPM, "rpm:" + userScope}}
+		requestLimit, requestRemaining, requestOk := takeGroupModelLimit(requestChecks)
+		if requestLimit > 0 {
+			c.Header("x-ratelimit-limit-requests", strconv.Itoa(requestLimit))
+			c.Header("x-ratelimit-remaining-requests", strconv.FormatInt(requestRemaining, 10))
+			c.Header("x-ratelimit-reset-requests", reset+"s")
+		}
+		if !requestOk {
+			abortWithRateLimit(c, "requests", fmt.Sprintf("分组 %s 下模型 %s 已达到每分钟请求数限制 %d，请稍后再试", group, modelName, requestLimit), reset)
+			return
+		}
+		if !tokenOk {
+			releaseGroupModelLimit(requestChecks)
+			abortWithRateLimit(c, "tokens", fmt.Sprintf("分组 %s 下模型 %s 已达到每分钟 token 数限制 %d，请稍后再试", group, modelName, tokenLimit), reset)
+			return
+		}
+		c.Next()
+	}
+}
+
+// takeGroupModelLimit 依次计入每个限制，返回剩余额度最少的限制及其剩余额度，
+// 某个限制已满时撤销已经计入的部分，返回该限制
+func takeGroupModelLimit(checks []groupModelLimitCheck) (int, int64, bool) {
+	tightestLimit := 0
+	var tightestRemaining int64
+	for i, check := range checks {
+		if check.limit <= 0 {
+			continue
+		}
+		used, ok := common.RateWindowTake(check.key, 1, int64(check.limit))
+		if !ok {
+			releaseGroupModelLimit(checks[:i])
+			return check.limit, 0, false
+		}
+		remaining := max(int64(check.limit)-used, 0)
+		if tightestLimit == 0 || remaining < tightestRemaining {
+			tightestLimit = check.limit
+			tightestRemaining = remaining
+		}
+	}
+	return tightestLimit, tightestRemaining, true
+}
+
+// releaseGroupModelLimit 撤销 takeGroupModelLimit 计入的请求数
+func releaseGroupModelLimit(checks []groupModelLimitCheck) {
+	for _, check := range checks {
+		if check.limit > 0 {
+			common.RateWindowAdd(check.key, -1)
+		}
+	}
+}
+
+// checkGroupModelLimit 返回剩余额度最少的限制及其剩余额度
+func checkGroupModelLimit(checks []groupModelLimitCheck) (int, int64, bool) {
+	tightestLimit := 0
+	var tightestRemaining int64
+	ok := true
+	for _, check := range checks {
+		if check.limit <= 0 {
+			continue
+		}
+		used := common.RateWindowUsage(check.key)
+		if used >= int64(check.limit) {
+			ok = false
+		}
+		remaining := int64(check.limit) - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		if tightestLimit == 0 || remaining < tightestRemaining {
+			tightestLimit = check.limit
+			tightestRemaining = remaining
+		}
+	}
+	return tightestLimit, tightestRemaining, ok
+}
+
+func abortWithRateLimit(c *gin.Context, limitType string, message string, retryAfter string) {
+	c.Header("Retry-After", retryAfter)
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": gin.H{
+			"message": common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			"type":    limitType,
+			"param":   nil,
+			"code":    "rate_limit_exceeded",
+		},
+	})
+	c.Abort()
+	common.LogError(c.Request.Context(), fmt.Sprintf("用户ID「%d」, 请求失败：%s", c.GetInt("id"), message))
+}
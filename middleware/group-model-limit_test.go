@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/common/config"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func runGroupModelRateLimit(group string, modelName string, userId int) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	c.Set("group", group)
+	c.Set("model", modelName)
+	c.Set("id", userId)
+	GroupModelRateLimit()(c)
+	return recorder
+}
+
+func TestGroupModelRateLimit(t *testing.T) {
+	config.GroupModelLimitsEnabled = true
+	defer func() {
+		config.GroupModelLimitsEnabled = false
+		common.GroupModelLimits = map[string]common.GroupModelLimit{}
+	}()
+
+	Convey("GroupModelRateLimit", t, func() {
+		Convey("rejects the request over the group RPM", func() {
+			common.GroupModelLimits = map[string]common.GroupModelLimit{"rpm:gpt-4o": {RPM: 2}}
+			So(runGroupModelRateLimit("rpm", "gpt-4o", 1).Code, ShouldEqual, http.StatusOK)
+			recorder := runGroupModelRateLimit("rpm", "gpt-4o", 2)
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			So(recorder.Header().Get("x-ratelimit-remaining-requests"), ShouldEqual, "0")
+			recorder = runGroupModelRateLimit("rpm", "gpt-4o", 3)
+			So(recorder.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(recorder.Header().Get("Retry-After"), ShouldNotBeEmpty)
+			So(common.RateWindowUsage("rpm:rpm:gpt-4o"), ShouldEqual, 2)
+		})
+		Convey("a user over the user RPM does not consume the group RPM", func() {
+			common.GroupModelLimits = map[string]common.GroupModelLimit{"user:gpt-4o": {RPM: 10, UserRPM: 1}}
+			So(runGroupModelRateLimit("user", "gpt-4o", 1).Code, ShouldEqual, http.StatusOK)
+			So(runGroupModelRateLimit("user", "gpt-4o", 1).Code, ShouldEqual, http.StatusTooManyRequests)
+			So(runGroupModelRateLimit("user", "gpt-4o", 2).Code, ShouldEqual, http.StatusOK)
+			So(common.RateWindowUsage("rpm:user:gpt-4o"), ShouldEqual, 2)
+		})
+		Convey("a request rejected by TPM does not consume RPM", func() {
+			common.GroupModelLimits = map[string]common.GroupModelLimit{"tpm:gpt-4o": {RPM: 10, TPM: 100}}
+			common.RateWindowAdd("tpm:tpm:gpt-4o", 100)
+			recorder := runGroupModelRateLimit("tpm", "gpt-4o", 1)
+			So(recorder.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(recorder.Header().Get("x-ratelimit-remaining-tokens"), ShouldEqual, "0")
+			So(common.RateWindowUsage("rpm:tpm:gpt-4o"), ShouldEqual, 0)
+		})
+		Convey("groups without limits pass through", func() {
+			common.GroupModelLimits = map[string]common.GroupModelLimit{"other": {RPM: 1}}
+			recorder := runGroupModelRateLimit("default", "gpt-4o", 1)
+			So(recorder.Code, ShouldEqual, http.StatusOK)
+			So(recorder.Header().Get("x-ratelimit-limit-requests"), ShouldBeEmpty)
+		})
+	})
+}
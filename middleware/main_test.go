@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestMain 使用内存中的 SQLite 数据库和内存缓存运行 middleware 包的测试
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		fmt.Println("failed to open test database: " + err.Error())
+		os.Exit(1)
+	}
+	model.DB = db
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	common.MemoryCacheEnabled = true
+	gin.SetMode(gin.TestMode)
+	err = db.AutoMigrate(&model.Channel{}, &model.Ability{}, &model.User{}, &model.Plan{}, &model.Subscription{})
+	if err != nil {
+		fmt.Println("failed to migrate test database: " + err.Error())
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// setupTestChannels 重建渠道和渠道缓存，channels 只需填写 Id、Group 和 Models
+func setupTestChannels(channels ...*model.Channel) {
+	for _, table := range []any{&model.Channel{}, &model.Ability{}} {
+		model.DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(table)
+	}
+	for _, channel := range channels {
+		channel.Type = common.ChannelTypeOpenAI
+		channel.Status = common.ChannelStatusEnabled
+		channel.Key = fmt.Sprintf("sk-test-%d", channel.Id)
+		if err := channel.Insert(); err != nil {
+			panic(err)
+		}
+	}
+	model.InitChannelCache()
+}
+
+func newTestContext(method string, path string, body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("is_tools", false)
+	return c
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"one-api/common"
+	"one-api/common/config"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StickySessionHeader 客户端可以通过该请求头指定会话，同一会话的请求固定到同一渠道
+const StickySessionHeader = "X-Chatapi-Session-Id"
+
+const stickyRoutingKey = "sticky_routing_key"
+
+// stickyPrefix 计算前缀哈希用到的请求字段，兼容 OpenAI 和 Claude 格式
+type stickyPrefix struct {
+	System   json.RawMessage `json:"system"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+}
+
+// getStickyRoutingKey 计算请求的亲和键并保存到上下文，客户端指定会话时按会话计算，
+// 否则对系统提示词和第一条非系统消息取哈希，多轮对话的后续请求以相同的内容开头，能落到同一渠道
+func getStickyRoutingKey(c *gin.Context, group string, modelName string) string {
+	if !config.StickyRoutingEnabled {
+		return ""
+	}
+	hash := sha256.New()
+	if session := c.GetHeader(StickySessionHeader); session != "" {
+		hash.Write([]byte("session:" + strconv.Itoa(c.GetInt("id")) + ":" + session))
+	} else {
+		requestBody, err := common.GetRequestBody(c)
+		if err != nil {
+			return ""
+		}
+		var prefix stickyPrefix
+		if err := json.Unmarshal(requestBody, &prefix); err != nil || (len(prefix.System) == 0 && len(prefix.Messages) == 0) {
+			return ""
+		}
+		hash.Write(prefix.System)
+		for _, message := range prefix.Messages {
+			hash.Write([]byte(message.Role))
+			hash.Write(message.Content)
+			if message.Role != "system" && message.Role != "developer" {
+				break
+			}
+		}
+	}
+	key := group + ":" + modelName + ":" + hex.EncodeToString(hash.Sum(nil))
+	c.Set(stickyRoutingKey, key)
+	return key
+}
+
+// PinStickyChannel 请求成功后把亲和键固定到实际完成请求的渠道，原渠道不可用而切换渠道时随之更新
+func PinStickyChannel(c *gin.Context) {
+	if key := c.GetString(stickyRoutingKey); key != "" {
+		model.SetChannelAffinity(key, c.GetInt("channel_id"))
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"one-api/common"
+	"one-api/common/config"
+	"one-api/model"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func stickyKeyOf(userId int, session string, body string) string {
+	ctx := newTestContext(http.MethodPost, "/v1/chat/completions", body)
+	ctx.Set("id", userId)
+	if session != "" {
+		ctx.Request.Header.Set(StickySessionHeader, session)
+	}
+	return getStickyRoutingKey(ctx, "default", "gpt-4o")
+}
+
+func TestGetStickyRoutingKey(t *testing.T) {
+	first := `{"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`
+	followUp := `{"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"},{"role":"user","content":"more"}]}`
+	otherSystem := `{"messages":[{"role":"system","content":"be verbose"},{"role":"user","content":"hi"}]}`
+	claude := `{"system":"be brief","messages":[{"role":"user","content":"hi"}]}`
+
+	Convey("getStickyRoutingKey", t, func() {
+		config.StickyRoutingEnabled = true
+		defer func() { config.StickyRoutingEnabled = false }()
+
+		Convey("follow-up turns keep the key of the conversation", func() {
+			So(stickyKeyOf(1, "", first), ShouldNotBeEmpty)
+			So(stickyKeyOf(1, "", followUp), ShouldEqual, stickyKeyOf(1, "", first))
+		})
+		Convey("a different prefix gets a different key", func() {
+			So(stickyKeyOf(1, "", otherSystem), ShouldNotEqual, stickyKeyOf(1, "", first))
+			So(stickyKeyOf(1, "", claude), ShouldNotEqual, stickyKeyOf(1, "", first))
+		})
+		Convey("sessions override the prefix and are scoped by user", func() {
+			So(stickyKeyOf(1, "s1", first), ShouldEqual, stickyKeyOf(1, "s1", otherSystem))
+			So(stickyKeyOf(1, "s1", first), ShouldNotEqual, stickyKeyOf(2, "s1", first))
+		})
+		Convey("requests without messages are not pinned", func() {
+			So(stickyKeyOf(1, "", `{"input":"hi"}`), ShouldBeEmpty)
+		})
+		Convey("disabled", func() {
+			config.StickyRoutingEnabled = false
+			So(stickyKeyOf(1, "", first), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestPinStickyChannel(t *testing.T) {
+	setupTestChannels(
+		&model.Channel{Id: 1, Group: "default", Models: "gpt-4o"},
+		&model.Channel{Id: 2, Group: "default", Models: "gpt-4o-mini"},
+	)
+	Convey("PinStickyChannel", t, func() {
+		config.StickyRoutingEnabled = true
+		defer func() { config.StickyRoutingEnabled = false }()
+		ctx := newTestContext(http.MethodPost, "/v1/chat/completions", `{"messages":[{"role":"user","content":"pin"}]}`)
+		key := getStickyRoutingKey(ctx, "default", "gpt-4o")
+
+		Convey("routes later requests to the pinned channel", func() {
+			ctx.Set("channel_id", 1)
+			PinStickyChannel(ctx)
+			channel := model.CacheGetAffinityChannel(key, "default", "gpt-4o", false, false)
+			So(channel, ShouldNotBeNil)
+			So(channel.Id, ShouldEqual, 1)
+			model.ReleaseChannelBreaker(channel.Id, "gpt-4o")
+		})
+		Convey("ignores a pinned channel that no longer serves the model", func() {
+			ctx.Set("channel_id", 2)
+			PinStickyChannel(ctx)
+			So(model.CacheGetAffinityChannel(key, "default", "gpt-4o", false, false), ShouldBeNil)
+		})
+		Convey("ignores a pinned channel that was disabled", func() {
+			ctx.Set("channel_id", 1)
+			PinStickyChannel(ctx)
+			model.UpdateChannelStatusById(1, common.ChannelStatusManuallyDisabled)
+			model.InitChannelCache()
+			defer func() {
+				model.UpdateChannelStatusById(1, common.ChannelStatusEnabled)
+				model.InitChannelCache()
+			}()
+			So(model.CacheGetAffinityChannel(key, "default", "gpt-4o", false, false), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkTokenLimits 检查令牌的 RPM/TPM、并发数和周期消费上限，
+// 通过时返回用于释放并发名额的函数，未通过时已中止请求
+func checkTokenLimits(c *gin.Context, token *model.Token) (func(), bool) {
+	if err := token.CheckSpendLimit(0); err != nil {
+		abortWithMessage(c, http.StatusForbidden, err.Error())
+		return nil, false
+	}
+	c.Set("token_spend_limited", token.HasSpendLimit())
+	c.Set("token_tpm", token.TPM)
+	c.Set("token_hedge_delay", token.HedgeDelay)
+	reset := strconv.FormatInt(common.RateWindowReset(), 10)
+	if token.TPM > 0 {
+		used := common.RateWindowUsage(model.TokenTPMKey(token.Id))
+		if used >= int64(token.TPM) {
+			abortWithRateLimit(c, "tokens", fmt.Sprintf("该令牌已达到每分钟 token 数限制 %d，请稍后再试", token.TPM), reset)
+			return nil, false
+		}
+	}
+	// RPM 在检查的同时计入本次请求，并发的请求不会同时通过最后一个名额
+	if token.RPM > 0 {
+		if _, ok := common.RateWindowTake(model.TokenRPMKey(token.Id), 1, int64(token.RPM)); !ok {
+			abortWithRateLimit(c, "requests", fmt.Sprintf("该令牌已达到每分钟请求数限制 %d，请稍后再试", token.RPM), reset)
+			return nil, false
+		}
+	}
+	if token.MaxConcurrency > 0 {
+		if !model.AcquireTokenConcurrency(token.Id, token.MaxConcurrency) {
+			if token.RPM > 0 {
+				common.RateWindowAdd(model.TokenRPMKey(token.Id), -1)
+			}
+			abortWithRateLimit(c, "requests", fmt.Sprintf("该令牌的并发请求数已达上限 %d，请稍后再试", token.MaxConcurrency), "1")
+			return nil, false
+		}
+		return func() {
+			model.ReleaseTokenConcurrency(token.Id)
+		}, true
+	}
+	return func() {}, true
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/common"
+	"one-api/model"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func runCheckTokenLimits(token *model.Token) (*httptest.ResponseRecorder, func(), bool) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	release, ok := checkTokenLimits(c, token)
+	return recorder, release, ok
+}
+
+func TestCheckTokenLimits(t *testing.T) {
+	Convey("checkTokenLimits", t, func() {
+		Convey("rejects the request over the token RPM", func() {
+			token := &model.Token{Id: 1001, RPM: 2}
+			for i := 0; i < 2; i++ {
+				_, release, ok := runCheckTokenLimits(token)
+				So(ok, ShouldBeTrue)
+				release()
+			}
+			recorder, _, ok := runCheckTokenLimits(token)
+			So(ok, ShouldBeFalse)
+			So(recorder.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(common.RateWindowUsage(model.TokenRPMKey(token.Id)), ShouldEqual, 2)
+		})
+		Convey("rejects the request over the token TPM", func() {
+			token := &model.Token{Id: 1002, TPM: 100}
+			common.RateWindowAdd(model.TokenTPMKey(token.Id), 100)
+			recorder, _, ok := runCheckTokenLimits(token)
+			So(ok, ShouldBeFalse)
+			So(recorder.Code, ShouldEqual, http.StatusTooManyRequests)
+		})
+		Convey("a request rejected by the concurrency cap does not consume RPM", func() {
+			token := &model.Token{Id: 1003, RPM: 10, MaxConcurrency: 1}
+			_, release, ok := runCheckTokenLimits(token)
+			So(ok, ShouldBeTrue)
+			recorder, _, ok := runCheckTokenLimits(token)
+			So(ok, ShouldBeFalse)
+			So(recorder.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(common.RateWindowUsage(model.TokenRPMKey(token.Id)), ShouldEqual, 1)
+			release()
+			_, release, ok = runCheckTokenLimits(token)
+			So(ok, ShouldBeTrue)
+			release()
+		})
+	})
+}
@@ -22,7 +22,7 @@ func abortWithMessage(c *gin.Context, statusCode int, message string) {
 func isModelInList(modelName string, models string) bool {
 	modelList := strings.Split(models, ",")
 	for _, model := range modelList {
-		if modelName == model {
+		if common.MatchModelName(model, modelName) {
 			return true
 		}
 	}
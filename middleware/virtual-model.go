@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"one-api/common"
+	"one-api/common/ctxkey"
+	"one-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	virtualModelKey      = "virtual_model"
+	virtualModelChainKey = "virtual_model_chain"
+	virtualModelIndexKey = "virtual_model_index"
+)
+
+// virtualModelAccessError 令牌或套餐不允许使用虚拟模型对应的任何真实模型
+type virtualModelAccessError struct {
+	error
+}
+
+// selectVirtualModelChannel 按顺序为虚拟模型对应的真实模型选择渠道，选中后把请求改写为该模型。
+// 每个模型与普通请求一样先选组织渠道再选分组渠道，所有模型的渠道均已饱和时在第一个可以排队的模型上排队
+func selectVirtualModelChannel(c *gin.Context, group string, virtualModel string, chain []string) (*model.Channel, error) {
+	c.Set(virtualModelKey, virtualModel)
+	c.Set(virtualModelChainKey, chain)
+	var accessErr error
+	allowed := false
+	queueIndex := -1
+	for i, modelName := range chain {
+		if err := checkVirtualModelTarget(c, modelName); err != nil {
+			accessErr = err
+			continue
+		}
+		allowed = true
+		channel, err := selectChannel(c, group, modelName, false)
+		if err == nil {
+			return channel, useVirtualModelTarget(c, i)
+		}
+		if queueIndex < 0 && ShouldQueueForChannel(group, modelName) {
+			queueIndex = i
+		}
+	}
+	if queueIndex >= 0 {
+		channel, err := selectChannel(c, group, chain[queueIndex], true)
+		if err != nil {
+			return nil, err
+		}
+		if err := useVirtualModelTarget(c, queueIndex); err != nil {
+			if TakeReservedChannelSlot(c, channel.Id) {
+				model.ReleaseChannelSlot(channel.Id, channel.GetMaxConcurrency())
+			}
+			return nil, err
+		}
+		return channel, nil
+	}
+	if !allowed && accessErr != nil {
+		return nil, virtualModelAccessError{accessErr}
+	}
+	return nil, fmt.Errorf("当前分组 %s 下虚拟模型 %s 对应的模型均无可用渠道", group, virtualModel)
+}
+
+// NextVirtualModel 请求失败后切换到虚拟模型的下一个真实模型，已经是最后一个时返回 false
+func NextVirtualModel(c *gin.Context) (string, bool) {
+	next := c.GetInt(virtualModelIndexKey) + 1
+	chain := c.GetStringSlice(virtualModelChainKey)
+	for next < len(chain) && checkVirtualModelTarget(c, chain[next]) != nil {
+		next++
+	}
+	if next >= len(chain) {
+		return "", false
+	}
+	if err := useVirtualModelTarget(c, next); err != nil {
+		common.LogError(c.Request.Context(), "switch virtual model failed: "+err.Error())
+		return "", false
+	}
+	return chain[next], true
+}
+
+// RemainingVirtualModels 返回虚拟模型还可以切换的真实模型数量
+func RemainingVirtualModels(c *gin.Context) int {
+	chain := c.GetStringSlice(virtualModelChainKey)
+	if len(chain) == 0 {
+		return 0
+	}
+	return len(chain) - 1 - c.GetInt(virtualModelIndexKey)
+}
+
+// checkVirtualModelTarget 令牌的可用模型和套餐包含的模型同样限制虚拟模型对应的真实模型
+func checkVirtualModelTarget(c *gin.Context, modelName string) error {
+	if availableModels := c.GetString(ctxkey.AvailableModels); availableModels != "" && !isModelInList(modelName, availableModels) {
+		return fmt.Errorf("该令牌无权使用模型：%s", modelName)
+	}
+	if c.GetInt("org_id") != 0 {
+		return nil
+	}
+	return model.CheckSubscriptionAccess(c.GetInt("id"), modelName)
+}
+
+// useVirtualModelTarget 把请求的模型改写为真实模型，之后的计费、日志都按真实模型处理。
+// 原生 Gemini 接口的模型在路径中，relay 从上下文读取，不改写请求体
+func useVirtualModelTarget(c *gin.Context, index int) error {
+	target := c.GetStringSlice(virtualModelChainKey)[index]
+	c.Set(virtualModelIndexKey, index)
+	c.Set("model", target)
+	c.Set(ctxkey.OriginalModel, target)
+	c.Header("X-Chatapi-Model", target)
+	if isGeminiPath(c.Request.URL.Path) {
+		return nil
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(requestBody, &request); err != nil {
+		return fmt.Errorf("虚拟模型只支持 JSON 格式的请求")
+	}
+	request["model"], _ = json.Marshal(target)
+	requestBody, err = json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	c.Set(common.KeyRequestBody, requestBody)
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	return nil
+}
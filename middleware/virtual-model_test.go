@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"one-api/common"
+	"one-api/common/config"
+	"one-api/common/ctxkey"
+	"one-api/model"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSelectVirtualModelChannel(t *testing.T) {
+	setupTestChannels(
+		&model.Channel{Id: 1, Group: "default", Models: "model-b"},
+		&model.Channel{Id: 2, Group: "default", Models: "model-c"},
+		&model.Channel{Id: 3, Group: model.OrgChannelGroup(7), Models: "model-c"},
+	)
+	chain := []string{"model-a", "model-b", "model-c"}
+	cases := []struct {
+		name            string
+		orgId           int
+		availableModels string
+		channelId       int
+		target          string
+		channelGroup    string
+		forbidden       bool
+	}{
+		{"skips models without channels", 0, "", 1, "model-b", "", false},
+		{"skips models the token can not use", 0, "model-a,model-c", 2, "model-c", "", false},
+		{"org channels first for each model", 7, "model-c", 3, "model-c", model.OrgChannelGroup(7), false},
+		{"no model allowed", 0, "model-d", 0, "", "", true},
+	}
+	Convey("TestSelectVirtualModelChannel", t, func() {
+		config.OrgChannelEnabled = true
+		for _, c := range cases {
+			Convey(c.name, func() {
+				ctx := newTestContext(http.MethodPost, "/v1/chat/completions", `{"model":"smart","messages":[]}`)
+				ctx.Set("org_id", c.orgId)
+				ctx.Set(ctxkey.AvailableModels, c.availableModels)
+				channel, err := selectVirtualModelChannel(ctx, "default", "smart", chain)
+				if c.forbidden {
+					So(errors.As(err, &virtualModelAccessError{}), ShouldBeTrue)
+					return
+				}
+				So(err, ShouldBeNil)
+				So(channel.Id, ShouldEqual, c.channelId)
+				So(ctx.GetString("model"), ShouldEqual, c.target)
+				So(ctx.GetString(ctxkey.ChannelGroup), ShouldEqual, c.channelGroup)
+				body, _ := common.GetRequestBody(ctx)
+				So(string(body), ShouldContainSubstring, `"model":"`+c.target+`"`)
+			})
+		}
+	})
+}
+
+func TestVirtualModelGeminiPath(t *testing.T) {
+	setupTestChannels(&model.Channel{Id: 1, Group: "default", Models: "model-b"})
+	Convey("TestVirtualModelGeminiPath", t, func() {
+		// 原生 Gemini 请求的模型在路径中，请求体保持不变
+		body := `{"contents":[]}`
+		ctx := newTestContext(http.MethodPost, "/v1beta/models/smart:generateContent", body)
+		channel, err := selectVirtualModelChannel(ctx, "default", "smart", []string{"model-a", "model-b"})
+		So(err, ShouldBeNil)
+		So(channel.Id, ShouldEqual, 1)
+		So(ctx.GetString(ctxkey.OriginalModel), ShouldEqual, "model-b")
+		requestBody, _ := common.GetRequestBody(ctx)
+		So(string(requestBody), ShouldEqual, body)
+	})
+}
+
+func TestNextVirtualModel(t *testing.T) {
+	setupTestChannels(&model.Channel{Id: 1, Group: "default", Models: "model-a"})
+	Convey("TestNextVirtualModel", t, func() {
+		ctx := newTestContext(http.MethodPost, "/v1/chat/completions", `{"model":"smart"}`)
+		ctx.Set(ctxkey.AvailableModels, "model-a,model-c")
+		_, err := selectVirtualModelChannel(ctx, "default", "smart", []string{"model-a", "model-b", "model-c"})
+		So(err, ShouldBeNil)
+		So(RemainingVirtualModels(ctx), ShouldEqual, 2)
+		// 令牌不能使用的模型直接跳过
+		next, ok := NextVirtualModel(ctx)
+		So(ok, ShouldBeTrue)
+		So(next, ShouldEqual, "model-c")
+		So(RemainingVirtualModels(ctx), ShouldEqual, 0)
+		_, ok = NextVirtualModel(ctx)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestVirtualModelQueue(t *testing.T) {
+	maxConcurrency := 1
+	setupTestChannels(&model.Channel{Id: 1, Group: "default", Models: "model-b", MaxConcurrency: &maxConcurrency})
+	Convey("TestVirtualModelQueue", t, func() {
+		config.ChannelQueueEnabled = true
+		config.ChannelQueueMaxWait = 1
+		So(model.AcquireChannelSlot(1, maxConcurrency), ShouldBeTrue)
+		ctx := newTestContext(http.MethodPost, "/v1/chat/completions", `{"model":"smart"}`)
+
+		Convey("saturated models wait in the queue", func() {
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				model.ReleaseChannelSlot(1, maxConcurrency)
+			}()
+			channel, err := selectVirtualModelChannel(ctx, "default", "smart", []string{"model-a", "model-b"})
+			So(err, ShouldBeNil)
+			So(channel.Id, ShouldEqual, 1)
+			So(ctx.GetString("model"), ShouldEqual, "model-b")
+			So(TakeReservedChannelSlot(ctx, 1), ShouldBeTrue)
+			model.ReleaseChannelSlot(1, maxConcurrency)
+		})
+		Convey("queue timeout is reported as saturation", func() {
+			_, err := selectVirtualModelChannel(ctx, "default", "smart", []string{"model-a", "model-b"})
+			So(errors.As(err, &channelSaturatedError{}), ShouldBeTrue)
+			model.ReleaseChannelSlot(1, maxConcurrency)
+		})
+		Reset(func() {
+			config.ChannelQueueEnabled = false
+		})
+	})
+}
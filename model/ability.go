@@ -7,6 +7,7 @@ import (
 	"log"
 	"one-api/common"
 	"one-api/common/config"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -48,6 +49,8 @@ func GetGroupModels(group string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 渠道模型列表中的通配符、正则不是可以请求的模型
+	models = slices.DeleteFunc(models, common.IsModelPattern)
 	sort.Strings(models)
 	return models, err
 }
@@ -256,6 +259,13 @@ func GetRandomSatisfiedChannel(group string, model string, excluded map[int]stru
 		return nil, err
 	}
 
+	if common.GetChannelStrategy(group, model) != common.ChannelStrategyWeightedRandom {
+		if channel, err := selectAbilityChannel(abilities, group, model); err == nil {
+			return channel, nil
+		}
+		return getChannelFromNextPriority(group, model)
+	}
+
 	channel := Channel{}
 	for len(abilities) > 0 {
 		selectedIdx, err := getRandomWeightedIndex(abilities)
@@ -276,7 +286,12 @@ func GetRandomSatisfiedChannel(group string, model string, excluded map[int]stru
 		}
 
 		channel = *channelPtr
+		if channelSaturated(&channel) || !acquireChannelBreaker(channel.Id, model) {
+			abilities = removeAbility(abilities, selectedIdx)
+			continue
+		}
 		if isRateLimited(channel, selectedAbility.ChannelId, model) {
+			ReleaseChannelBreaker(channel.Id, model)
 			abilities = removeAbility(abilities, selectedIdx)
 			continue
 		}
@@ -287,6 +302,47 @@ func GetRandomSatisfiedChannel(group string, model string, excluded map[int]stru
 	return getChannelFromNextPriority(group, model)
 }
 
+// selectAbilityChannel 在最高优先级的 abilities 中按配置的策略选择渠道
+func selectAbilityChannel(abilities []Ability, group string, model string) (*Channel, error) {
+	abilityPriority := func(ability Ability) int64 {
+		if ability.Priority == nil {
+			return 0
+		}
+		return *ability.Priority
+	}
+	var channels []*Channel
+	var maxPriority int64
+	for i, ability := range abilities {
+		if i == 0 || abilityPriority(ability) > maxPriority {
+			maxPriority = abilityPriority(ability)
+		}
+	}
+	for _, ability := range abilities {
+		if abilityPriority(ability) != maxPriority {
+			continue
+		}
+		if !channelBreakerAvailable(ability.ChannelId, model) {
+			continue
+		}
+		channel, err := GetChannelById(ability.ChannelId, true)
+		if err != nil || channelSaturated(channel) {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	if len(channels) == 0 {
+		return nil, errors.New("no channels found for group and model")
+	}
+	channel, err := getChannelSelector(group, model).Select(channels, group, model)
+	if err != nil {
+		return nil, err
+	}
+	if !acquireChannelBreaker(channel.Id, model) {
+		return nil, errors.New("channel circuit breaker is half-open")
+	}
+	return channel, nil
+}
+
 func getAbilitiesByPriority(group string, model string, ignoreFirstPriority bool, isTools bool, claudeoriginalrequest bool, excluded map[int]struct{}) ([]Ability, error) {
 	var abilities []Ability
 	groupCol := "`group`"
@@ -296,9 +352,10 @@ func getAbilitiesByPriority(group string, model string, ignoreFirstPriority bool
 		trueVal = "true"
 	}
 
-	channelQuery := DB.Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
+	models := abilityModels(group, model)
+	channelQuery := DB.Where(groupCol+" = ? and model IN (?) and enabled = "+trueVal, group, models)
 	if !ignoreFirstPriority {
-		maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model = ? and enabled = "+trueVal, group, model)
+		maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(groupCol+" = ? and model IN (?) and enabled = "+trueVal, group, models)
 		channelQuery = channelQuery.Where("priority = (?)", maxPrioritySubQuery)
 	}
 	conditions := []string{}
@@ -325,7 +382,39 @@ func getAbilitiesByPriority(group string, model string, ignoreFirstPriority bool
 	if err != nil {
 		return nil, err
 	}
-	return abilities, nil
+	return uniqueAbilities(abilities), nil
+}
+
+// abilityModels 返回分组下能匹配该模型的能力模型名，包括模型本身以及匹配它的通配符、正则
+func abilityModels(group string, model string) []string {
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	var patterns []string
+	DB.Model(&Ability{}).Distinct("model").
+		Where(groupCol+" = ? and (model LIKE ? or model LIKE ? or model LIKE ?)", group, "%*%", "%?%", "re:%").
+		Pluck("model", &patterns)
+	models := []string{model}
+	for _, pattern := range common.NewModelPatternSet(patterns) {
+		if pattern.Raw != model && pattern.Match(model) {
+			models = append(models, pattern.Raw)
+		}
+	}
+	return models
+}
+
+// uniqueAbilities 渠道同时通过模型名和模式匹配时只保留一条
+func uniqueAbilities(abilities []Ability) []Ability {
+	seen := make(map[int]bool)
+	unique := abilities[:0]
+	for _, ability := range abilities {
+		if !seen[ability.ChannelId] {
+			seen[ability.ChannelId] = true
+			unique = append(unique, ability)
+		}
+	}
+	return unique
 }
 
 func getRandomWeightedIndex(abilities []Ability) (int, error) {
@@ -382,10 +471,11 @@ func getNextPriorityAbilities(group string, model string) ([]Ability, error) {
 	}
 
 	// 首先获取当前最高优先级
+	models := abilityModels(group, model)
 	var maxPriority int
 	err := DB.Table("abilities").
 		Select("COALESCE(MAX(priority), 0) as max_priority"). // 假定最低优先级为 0
-		Where(groupCol+" = ? AND model = ? AND enabled = "+trueVal, group, model).
+		Where(groupCol+" = ? AND model IN (?) AND enabled = "+trueVal, group, models).
 		Pluck("max_priority", &maxPriority).Error
 
 	if err != nil {
@@ -395,17 +485,17 @@ func getNextPriorityAbilities(group string, model string) ([]Ability, error) {
 	// 使用得到的最高优先级来查询次高优先级的渠道列表
 	// 我们从那些其 priority 小于当前最高优先级的记录中选择最大值
 	nextMaxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").
-		Where(groupCol+" = ? AND model = ? AND enabled = "+trueVal+" AND priority < ?", group, model, maxPriority)
+		Where(groupCol+" = ? AND model IN (?) AND enabled = "+trueVal+" AND priority < ?", group, models, maxPriority)
 
 	// 根据次高优先级查询能力列表
-	err = DB.Where(groupCol+" = ? AND model = ? AND enabled = "+trueVal+" AND priority = (?)", group, model, nextMaxPrioritySubQuery).
+	err = DB.Where(groupCol+" = ? AND model IN (?) AND enabled = "+trueVal+" AND priority = (?)", group, models, nextMaxPrioritySubQuery).
 		Order("weight DESC").
 		Find(&abilities).Error
 
 	if err != nil {
 		return nil, err
 	}
-	return abilities, nil
+	return uniqueAbilities(abilities), nil
 }
 
 func (channel *Channel) AddAbilities() error {
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+type Batch struct {
+	Id               int    `json:"id"`
+	BatchId          string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status           string `json:"status" gorm:"type:varchar(32);index"`
+	Errors           string `json:"errors" gorm:"type:text"`   // JSON 数组，校验失败时的错误列表
+	Metadata         string `json:"metadata" gorm:"type:text"` // JSON 对象
+	RequestTotal     int    `json:"request_total"`
+	RequestCompleted int    `json:"request_completed"`
+	RequestFailed    int    `json:"request_failed"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+func NewBatchId() string {
+	return "batch_" + common.GetRandomString(24)
+}
+
+func (batch *Batch) Insert() error {
+	return DB.Create(batch).Error
+}
+
+// Update 按字段更新，不覆盖状态，状态变更请使用 UpdateBatchStatus
+func (batch *Batch) Update(fields ...string) error {
+	if batch.Id == 0 {
+		return errors.New("id 为空！")
+	}
+	return DB.Model(batch).Select(fields).Updates(batch).Error
+}
+
+func GetBatchById(id int) (*Batch, error) {
+	batch := Batch{}
+	err := DB.First(&batch, "id = ?", id).Error
+	return &batch, err
+}
+
+func GetUserBatchByBatchId(userId int, batchId string) (*Batch, error) {
+	if batchId == "" {
+		return nil, errors.New("batch_id 为空！")
+	}
+	batch := Batch{}
+	err := DB.Where("user_id = ? AND batch_id = ?", userId, batchId).First(&batch).Error
+	return &batch, err
+}
+
+func GetUserBatches(userId int, after string, limit int) (batches []*Batch, hasMore bool, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if after != "" {
+		cursor, err := GetUserBatchByBatchId(userId, after)
+		if err != nil {
+			return nil, false, err
+		}
+		tx = tx.Where("id < ?", cursor.Id)
+	}
+	err = tx.Order("id desc").Limit(limit + 1).Find(&batches).Error
+	if err != nil {
+		return nil, false, err
+	}
+	if len(batches) > limit {
+		batches = batches[:limit]
+		hasMore = true
+	}
+	return batches, hasMore, nil
+}
+
+func GetBatchesByStatus(status string, limit int) (batches []*Batch, err error) {
+	err = DB.Where("status = ?", status).Order("id asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// UpdateBatchStatus 仅当当前状态属于 from 时才更新，返回是否更新成功，用于多节点/并发下的状态流转
+func UpdateBatchStatus(id int, from []string, to string, fields map[string]interface{}) (bool, error) {
+	updates := map[string]interface{}{"status": to}
+	for k, v := range fields {
+		updates[k] = v
+	}
+	result := DB.Model(&Batch{}).Where("id = ? AND status IN ?", id, from).Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
@@ -175,6 +175,7 @@ func CacheIsUserEnabled(userId int) (bool, error) {
 }
 
 var group2model2channels map[string]map[string][]*Channel
+var group2modelPatterns map[string][]channelModelPattern
 var channelsIDM map[int]*Channel
 var channelSyncLock sync.RWMutex
 
@@ -220,13 +221,63 @@ func InitChannelCache() {
 		}
 	}
 
+	newGroup2modelPatterns := make(map[string][]channelModelPattern)
+	for group, model2channels := range newGroup2model2channels {
+		models := make([]string, 0, len(model2channels))
+		for model := range model2channels {
+			models = append(models, model)
+		}
+		for _, pattern := range common.NewModelPatternSet(models) {
+			newGroup2modelPatterns[group] = append(newGroup2modelPatterns[group], channelModelPattern{
+				pattern:  pattern,
+				channels: model2channels[pattern.Raw],
+			})
+		}
+	}
+
 	channelSyncLock.Lock()
 	group2model2channels = newGroup2model2channels
+	group2modelPatterns = newGroup2modelPatterns
 	channelsIDM = newChannelsIDM
 	channelSyncLock.Unlock()
+	resetChannelKeyPools()
 	common.SysLog("channels synced from database")
 }
 
+// channelModelPattern 渠道模型列表中的通配符、正则，缓存时预先编译
+type channelModelPattern struct {
+	pattern  *common.ModelPattern
+	channels []*Channel
+}
+
+// getGroupModelChannels 返回分组下支持该模型的渠道，包括模型列表中的模式能匹配该模型的渠道
+func getGroupModelChannels(group string, model string) []*Channel {
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	channels := group2model2channels[group][model]
+	patterns := group2modelPatterns[group]
+	if len(patterns) == 0 {
+		return channels
+	}
+	merged := make([]*Channel, 0, len(channels))
+	seen := make(map[int]bool)
+	add := func(channels []*Channel) {
+		for _, channel := range channels {
+			if !seen[channel.Id] {
+				seen[channel.Id] = true
+				merged = append(merged, channel)
+			}
+		}
+	}
+	add(channels)
+	for _, pattern := range patterns {
+		if pattern.pattern.Match(model) {
+			add(pattern.channels)
+		}
+	}
+	return merged
+}
+
 func SyncChannelCache(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
@@ -268,10 +319,7 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 		return GetRandomSatisfiedChannel(group, model, excludedMap, ignoreFirstPriority, isTools, claudeoriginalrequest, i)
 	}
 
-	// 使用更细粒度的锁
-	channelSyncLock.RLock()
-	allChannels := group2model2channels[group][model]
-	channelSyncLock.RUnlock()
+	allChannels := getGroupModelChannels(group, model)
 
 	if len(allChannels) == 0 {
 		return nil, errors.New("no channels found for group and model")
@@ -283,7 +331,7 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 		allChannels = filterByTools(allChannels, claudeoriginalrequest)
 	}
 
-	return selectChannel(allChannels, excludedMap, ignoreFirstPriority, i, model)
+	return selectChannel(allChannels, excludedMap, ignoreFirstPriority, i, group, model)
 }
 
 // 封装排序逻辑
@@ -297,7 +345,7 @@ func sortChannels(channels []*Channel) {
 }
 
 // selectChannel 根据给定条件选择合适的频道
-func selectChannel(channels []*Channel, excluded map[int]struct{}, ignoreFirstPriority bool, i int, model string) (*Channel, error) {
+func selectChannel(channels []*Channel, excluded map[int]struct{}, ignoreFirstPriority bool, i int, group string, model string) (*Channel, error) {
 	if len(channels) == 0 {
 		return nil, errors.New("频道列表为空")
 	}
@@ -308,7 +356,7 @@ func selectChannel(channels []*Channel, excluded map[int]struct{}, ignoreFirstPr
 	}
 
 	for {
-		filteredChannels, totalWeight := filterAndWeightChannels(channels, currentPriority, excluded)
+		filteredChannels, _ := filterAndWeightChannels(channels, currentPriority, excluded, model)
 		if len(filteredChannels) == 0 {
 			if nextPriority, exists := getNextLowerPriority(channels, currentPriority); exists {
 				currentPriority = nextPriority
@@ -317,8 +365,13 @@ func selectChannel(channels []*Channel, excluded map[int]struct{}, ignoreFirstPr
 			return nil, errors.New("没有可用的更低优先级频道")
 		}
 
-		if selectedChannel, err := trySelectChannel(filteredChannels, totalWeight, model); err == nil {
-			return selectedChannel, nil
+		if selectedChannel, err := getChannelSelector(group, model).Select(filteredChannels, group, model); err == nil {
+			if acquireChannelBreaker(selectedChannel.Id, model) {
+				return selectedChannel, nil
+			}
+			// 半开状态的试探名额已被其它请求占用，排除后重新选择
+			excluded[selectedChannel.Id] = struct{}{}
+			continue
 		}
 
 		if nextPriority, exists := getNextLowerPriority(channels, currentPriority); exists {
@@ -341,16 +394,12 @@ func resolveInitialPriority(channels []*Channel, ignoreFirstPriority bool, i int
 	return channels[0].GetPriority(), nil
 }
 
-func trySelectChannel(channels []*Channel, totalWeight int, model string) (*Channel, error) {
-	return weightedRandomSelection(channels, totalWeight, model)
-}
-
-// filterAndWeightChannels 过滤出同一优先级的频道，并计算总权重
-func filterAndWeightChannels(channels []*Channel, priority int64, excluded map[int]struct{}) ([]*Channel, int) {
+// filterAndWeightChannels 过滤出同一优先级、未熔断且未达到并发和 TPM 上限的频道，并计算总权重
+func filterAndWeightChannels(channels []*Channel, priority int64, excluded map[int]struct{}, model string) ([]*Channel, int) {
 	var priorityChannels []*Channel
 	totalWeight := 0
 	for _, ch := range channels {
-		if ch.GetPriority() == priority && !contains(excluded, ch.Id) {
+		if ch.GetPriority() == priority && !contains(excluded, ch.Id) && channelBreakerAvailable(ch.Id, model) && !channelSaturated(ch) {
 			priorityChannels = append(priorityChannels, ch)
 			totalWeight += ch.GetWeight()
 		}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"one-api/common"
+	"one-api/common/config"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缓存亲和路由：相同提示词前缀的请求在有效期内固定发往同一渠道，使上游的提示词缓存能够命中，
+// 开启 Redis 时多实例共享
+
+type channelAffinity struct {
+	channelId int
+	expireAt  time.Time
+}
+
+var channelAffinities = make(map[string]channelAffinity)
+var channelAffinitiesLock sync.Mutex
+var channelAffinitiesSweptAt time.Time
+
+func channelAffinityRedisKey(key string) string {
+	return "channel_affinity:" + key
+}
+
+func getChannelAffinity(key string) int {
+	if common.RedisEnabled {
+		value, err := common.RedisGet(channelAffinityRedisKey(key))
+		if err != nil {
+			return 0
+		}
+		channelId, _ := strconv.Atoi(value)
+		return channelId
+	}
+	channelAffinitiesLock.Lock()
+	defer channelAffinitiesLock.Unlock()
+	affinity, ok := channelAffinities[key]
+	if !ok {
+		return 0
+	}
+	if time.Now().After(affinity.expireAt) {
+		delete(channelAffinities, key)
+		return 0
+	}
+	return affinity.channelId
+}
+
+// SetChannelAffinity 请求成功后把前缀固定到完成请求的渠道，每次成功都会刷新有效期
+func SetChannelAffinity(key string, channelId int) {
+	ttl := time.Duration(config.StickyRoutingTTL) * time.Second
+	if key == "" || channelId == 0 || ttl <= 0 {
+		return
+	}
+	if common.RedisEnabled {
+		err := common.RedisSet(channelAffinityRedisKey(key), strconv.Itoa(channelId), ttl)
+		if err != nil {
+			common.SysError("failed to set channel affinity: " + err.Error())
+		}
+		return
+	}
+	now := time.Now()
+	channelAffinitiesLock.Lock()
+	defer channelAffinitiesLock.Unlock()
+	channelAffinities[key] = channelAffinity{channelId: channelId, expireAt: now.Add(ttl)}
+	// 每个有效期清理一次过期的记录
+	if now.Sub(channelAffinitiesSweptAt) > ttl {
+		channelAffinitiesSweptAt = now
+		for k, affinity := range channelAffinities {
+			if now.After(affinity.expireAt) {
+				delete(channelAffinities, k)
+			}
+		}
+	}
+}
+
+// CacheGetAffinityChannel 返回前缀固定的渠道，渠道已禁用、不再支持该模型、熔断或饱和时返回 nil，
+// 由调用方按正常的策略选择渠道
+func CacheGetAffinityChannel(key string, group string, model string, isTools bool, claudeoriginalrequest bool) *Channel {
+	channelId := getChannelAffinity(key)
+	if channelId == 0 {
+		return nil
+	}
+	channel, err := CacheGetChannel(channelId)
+	if err != nil || channel.Status != common.ChannelStatusEnabled || !channelServes(channel, group, model) {
+		return nil
+	}
+	if (isTools || claudeoriginalrequest) && len(filterByTools([]*Channel{channel}, claudeoriginalrequest)) == 0 {
+		return nil
+	}
+	if channelSaturated(channel) || isRedisLimited(*channel, channel.Id, model) || !acquireChannelBreaker(channel.Id, model) {
+		return nil
+	}
+	return channel
+}
+
+func channelServes(channel *Channel, group string, model string) bool {
+	groupMatched := false
+	for _, g := range strings.Split(channel.Group, ",") {
+		if g == group {
+			groupMatched = true
+			break
+		}
+	}
+	if !groupMatched {
+		return false
+	}
+	for _, m := range strings.Split(channel.Models, ",") {
+		if common.MatchModelName(m, model) {
+			return true
+		}
+	}
+	return false
+}
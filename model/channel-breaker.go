@@ -0,0 +1,290 @@
+package model
+
+import (
+	"one-api/common/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 渠道错误的分类，由 relay 层根据状态码和错误信息判断
+const (
+	ChannelFailureNone      = iota // 成功或客户端错误，不计入失败
+	ChannelFailureServer           // 5xx、网络错误等，计入滚动窗口的错误率
+	ChannelFailureRateLimit        // 429，立即短暂熔断
+	ChannelFailureAuth             // 鉴权失败、余额不足等，立即按最长冷却时间熔断
+)
+
+const (
+	BreakerStateClosed   = "closed"
+	BreakerStateOpen     = "open"
+	BreakerStateHalfOpen = "half_open"
+)
+
+const (
+	breakerBuckets           = 10
+	breakerRateLimitCooldown = 10 * time.Second
+	// 半开状态的试探请求超过该时间仍未返回结果时，允许发出新的试探请求
+	breakerProbeTimeout = 2 * time.Minute
+)
+
+type breakerBucket struct {
+	start    int64
+	requests int
+	failures int
+}
+
+type channelBreaker struct {
+	mu          sync.Mutex
+	state       string
+	buckets     [breakerBuckets]breakerBucket
+	openUntil   time.Time
+	opens       int // 连续熔断次数，用于计算指数退避
+	probing     bool
+	probeAt     time.Time
+	lastFailure int
+}
+
+type channelBreakerKey struct {
+	channelId int
+	model     string
+}
+
+type ChannelBreakerSnapshot struct {
+	ChannelId   int     `json:"channel_id"`
+	Model       string  `json:"model"`
+	State       string  `json:"state"`
+	Requests    int     `json:"requests"`
+	Failures    int     `json:"failures"`
+	ErrorRate   float64 `json:"error_rate"`
+	OpenUntil   int64   `json:"open_until"`
+	Opens       int     `json:"opens"`
+	LastFailure int     `json:"last_failure"`
+}
+
+var channelBreakers sync.Map
+
+func getChannelBreaker(channelId int, model string) *channelBreaker {
+	key := channelBreakerKey{channelId: channelId, model: model}
+	if breaker, ok := channelBreakers.Load(key); ok {
+		return breaker.(*channelBreaker)
+	}
+	breaker, _ := channelBreakers.LoadOrStore(key, &channelBreaker{state: BreakerStateClosed})
+	return breaker.(*channelBreaker)
+}
+
+func peekChannelBreaker(channelId int, model string) *channelBreaker {
+	breaker, ok := channelBreakers.Load(channelBreakerKey{channelId: channelId, model: model})
+	if !ok {
+		return nil
+	}
+	return breaker.(*channelBreaker)
+}
+
+func breakerBucketSeconds() int64 {
+	seconds := int64(config.ChannelBreakerWindow) / breakerBuckets
+	if seconds <= 0 {
+		return 1
+	}
+	return seconds
+}
+
+func (b *channelBreaker) currentBucket(now time.Time) *breakerBucket {
+	size := breakerBucketSeconds()
+	start := now.Unix() / size * size
+	bucket := &b.buckets[(start/size)%breakerBuckets]
+	if bucket.start != start {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+func (b *channelBreaker) windowCounts(now time.Time) (requests int, failures int) {
+	size := breakerBucketSeconds()
+	oldest := now.Unix() - size*breakerBuckets
+	for _, bucket := range b.buckets {
+		if bucket.start > oldest {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return
+}
+
+// available 判断渠道是否可以接收请求，不改变熔断器状态
+func (b *channelBreaker) available(now time.Time) bool {
+	switch b.state {
+	case BreakerStateOpen:
+		return !now.Before(b.openUntil)
+	case BreakerStateHalfOpen:
+		return !b.probing || now.Sub(b.probeAt) > breakerProbeTimeout
+	}
+	return true
+}
+
+func (b *channelBreaker) trip(failure int, now time.Time) {
+	b.opens++
+	var cooldown time.Duration
+	switch failure {
+	case ChannelFailureAuth:
+		cooldown = time.Duration(config.ChannelBreakerMaxCooldown) * time.Second
+	case ChannelFailureRateLimit:
+		cooldown = breakerRateLimitCooldown << min(b.opens-1, 16)
+	default:
+		cooldown = time.Duration(config.ChannelBreakerCooldown) * time.Second << min(b.opens-1, 16)
+	}
+	if maxCooldown := time.Duration(config.ChannelBreakerMaxCooldown) * time.Second; cooldown > maxCooldown {
+		cooldown = maxCooldown
+	}
+	b.state = BreakerStateOpen
+	b.openUntil = now.Add(cooldown)
+	b.probing = false
+	b.buckets = [breakerBuckets]breakerBucket{}
+}
+
+// breakerModel 熔断器按模型统计，gizmo 模型统一计入同一个熔断器
+func breakerModel(model string) string {
+	if strings.HasPrefix(model, "gpt-4-gizmo") {
+		return "gpt-4-gizmo-*"
+	}
+	return model
+}
+
+func channelBreakerAvailable(channelId int, model string) bool {
+	if !config.ChannelBreakerEnabled {
+		return true
+	}
+	breaker := peekChannelBreaker(channelId, breakerModel(model))
+	if breaker == nil {
+		return true
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.available(time.Now())
+}
+
+// acquireChannelBreaker 在渠道被选中时调用，冷却结束的渠道转为半开状态，并占用唯一的试探请求名额
+func acquireChannelBreaker(channelId int, model string) bool {
+	if !config.ChannelBreakerEnabled {
+		return true
+	}
+	breaker := peekChannelBreaker(channelId, breakerModel(model))
+	if breaker == nil {
+		return true
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	now := time.Now()
+	if !breaker.available(now) {
+		return false
+	}
+	if breaker.state != BreakerStateClosed {
+		breaker.state = BreakerStateHalfOpen
+		breaker.probing = true
+		breaker.probeAt = now
+	}
+	return true
+}
+
+// ReleaseChannelBreaker 选中的渠道最终没有发出请求时调用，归还半开状态下占用的试探请求名额
+func ReleaseChannelBreaker(channelId int, model string) {
+	breaker := peekChannelBreaker(channelId, breakerModel(model))
+	if breaker == nil {
+		return
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	if breaker.state == BreakerStateHalfOpen {
+		breaker.probing = false
+	}
+}
+
+// RecordChannelBreakerResult 记录一次真实请求的结果，半开状态下的试探请求成功则恢复，失败则以更长的冷却时间再次熔断
+func RecordChannelBreakerResult(channelId int, model string, failure int) {
+	if !config.ChannelBreakerEnabled || channelId == 0 {
+		return
+	}
+	breaker := getChannelBreaker(channelId, breakerModel(model))
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	now := time.Now()
+	if failure != ChannelFailureNone {
+		breaker.lastFailure = failure
+	}
+	switch breaker.state {
+	case BreakerStateOpen:
+		return
+	case BreakerStateHalfOpen:
+		if failure == ChannelFailureNone {
+			breaker.state = BreakerStateClosed
+			breaker.opens = 0
+			breaker.probing = false
+			breaker.buckets = [breakerBuckets]breakerBucket{}
+		} else {
+			breaker.trip(failure, now)
+		}
+		return
+	}
+	bucket := breaker.currentBucket(now)
+	bucket.requests++
+	switch failure {
+	case ChannelFailureNone:
+		return
+	case ChannelFailureRateLimit, ChannelFailureAuth:
+		breaker.trip(failure, now)
+		return
+	}
+	bucket.failures++
+	requests, failures := breaker.windowCounts(now)
+	if requests >= config.ChannelBreakerMinRequests && float64(failures)/float64(requests) >= config.ChannelBreakerErrorRate {
+		breaker.trip(failure, now)
+	}
+}
+
+func GetChannelBreakerSnapshots() []ChannelBreakerSnapshot {
+	now := time.Now()
+	snapshots := make([]ChannelBreakerSnapshot, 0)
+	channelBreakers.Range(func(key, value any) bool {
+		k := key.(channelBreakerKey)
+		breaker := value.(*channelBreaker)
+		breaker.mu.Lock()
+		requests, failures := breaker.windowCounts(now)
+		snapshot := ChannelBreakerSnapshot{
+			ChannelId:   k.channelId,
+			Model:       k.model,
+			State:       breaker.state,
+			Requests:    requests,
+			Failures:    failures,
+			Opens:       breaker.opens,
+			LastFailure: breaker.lastFailure,
+		}
+		if breaker.state == BreakerStateOpen {
+			snapshot.OpenUntil = breaker.openUntil.Unix()
+		}
+		breaker.mu.Unlock()
+		if requests > 0 {
+			snapshot.ErrorRate = float64(failures) / float64(requests)
+		}
+		snapshots = append(snapshots, snapshot)
+		return true
+	})
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].ChannelId == snapshots[j].ChannelId {
+			return snapshots[i].Model < snapshots[j].Model
+		}
+		return snapshots[i].ChannelId < snapshots[j].ChannelId
+	})
+	return snapshots
+}
+
+// ResetChannelBreaker 手动关闭熔断器，model 为空时重置该渠道的所有模型
+func ResetChannelBreaker(channelId int, model string) {
+	channelBreakers.Range(func(key, value any) bool {
+		k := key.(channelBreakerKey)
+		if k.channelId == channelId && (model == "" || k.model == model) {
+			channelBreakers.Delete(key)
+		}
+		return true
+	})
+}
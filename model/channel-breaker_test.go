@@ -0,0 +1,102 @@
+package model
+
+import (
+	"one-api/common/config"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// expireBreakerCooldown 让熔断器的冷却时间立即结束
+func expireBreakerCooldown(channelId int, model string) {
+	breaker := peekChannelBreaker(channelId, breakerModel(model))
+	breaker.mu.Lock()
+	breaker.openUntil = time.Now().Add(-time.Second)
+	breaker.mu.Unlock()
+}
+
+func breakerState(channelId int, model string) string {
+	breaker := peekChannelBreaker(channelId, breakerModel(model))
+	if breaker == nil {
+		return BreakerStateClosed
+	}
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.state
+}
+
+func TestChannelBreakerTrip(t *testing.T) {
+	config.ChannelBreakerEnabled = true
+	config.ChannelBreakerMinRequests = 4
+	config.ChannelBreakerErrorRate = 0.5
+	cases := []struct {
+		name     string
+		failures []int
+		state    string
+	}{
+		{"successes stay closed", []int{ChannelFailureNone, ChannelFailureNone, ChannelFailureNone, ChannelFailureNone}, BreakerStateClosed},
+		{"too few requests", []int{ChannelFailureServer, ChannelFailureServer, ChannelFailureServer}, BreakerStateClosed},
+		{"error rate below threshold", []int{ChannelFailureNone, ChannelFailureNone, ChannelFailureNone, ChannelFailureServer}, BreakerStateClosed},
+		{"error rate reaches threshold", []int{ChannelFailureNone, ChannelFailureNone, ChannelFailureServer, ChannelFailureServer}, BreakerStateOpen},
+		{"rate limit trips immediately", []int{ChannelFailureRateLimit}, BreakerStateOpen},
+		{"auth failure trips immediately", []int{ChannelFailureAuth}, BreakerStateOpen},
+	}
+	Convey("TestChannelBreakerTrip", t, func() {
+		for i, c := range cases {
+			Convey(c.name, func() {
+				channelId := 100 + i
+				ResetChannelBreaker(channelId, "")
+				for _, failure := range c.failures {
+					RecordChannelBreakerResult(channelId, "gpt-4o", failure)
+				}
+				So(breakerState(channelId, "gpt-4o"), ShouldEqual, c.state)
+				So(channelBreakerAvailable(channelId, "gpt-4o"), ShouldEqual, c.state == BreakerStateClosed)
+			})
+		}
+	})
+}
+
+func TestChannelBreakerHalfOpen(t *testing.T) {
+	config.ChannelBreakerEnabled = true
+	const channelId = 200
+	Convey("TestChannelBreakerHalfOpen", t, func() {
+		ResetChannelBreaker(channelId, "")
+		RecordChannelBreakerResult(channelId, "gpt-4o", ChannelFailureRateLimit)
+		So(acquireChannelBreaker(channelId, "gpt-4o"), ShouldBeFalse)
+		expireBreakerCooldown(channelId, "gpt-4o")
+
+		// 冷却结束后只放行一个试探请求
+		So(acquireChannelBreaker(channelId, "gpt-4o"), ShouldBeTrue)
+		So(breakerState(channelId, "gpt-4o"), ShouldEqual, BreakerStateHalfOpen)
+		So(acquireChannelBreaker(channelId, "gpt-4o"), ShouldBeFalse)
+
+		Convey("released probe can be taken again", func() {
+			ReleaseChannelBreaker(channelId, "gpt-4o")
+			So(breakerState(channelId, "gpt-4o"), ShouldEqual, BreakerStateHalfOpen)
+			So(acquireChannelBreaker(channelId, "gpt-4o"), ShouldBeTrue)
+		})
+		Convey("successful probe closes the breaker", func() {
+			RecordChannelBreakerResult(channelId, "gpt-4o", ChannelFailureNone)
+			So(breakerState(channelId, "gpt-4o"), ShouldEqual, BreakerStateClosed)
+			So(acquireChannelBreaker(channelId, "gpt-4o"), ShouldBeTrue)
+		})
+		Convey("failed probe opens the breaker again", func() {
+			RecordChannelBreakerResult(channelId, "gpt-4o", ChannelFailureServer)
+			So(breakerState(channelId, "gpt-4o"), ShouldEqual, BreakerStateOpen)
+			So(acquireChannelBreaker(channelId, "gpt-4o"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestChannelBreakerGizmoModels(t *testing.T) {
+	config.ChannelBreakerEnabled = true
+	const channelId = 300
+	Convey("TestChannelBreakerGizmoModels", t, func() {
+		ResetChannelBreaker(channelId, "")
+		RecordChannelBreakerResult(channelId, "gpt-4-gizmo-g-abc", ChannelFailureAuth)
+		So(channelBreakerAvailable(channelId, "gpt-4-gizmo-g-xyz"), ShouldBeFalse)
+		So(acquireChannelBreaker(channelId, "gpt-4-gizmo-g-xyz"), ShouldBeFalse)
+		So(channelBreakerAvailable(channelId, "gpt-4o"), ShouldBeTrue)
+	})
+}
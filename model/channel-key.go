@@ -0,0 +1,320 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"one-api/common"
+	"one-api/common/config"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// 多密钥渠道的密钥选择方式，为空表示普通的单密钥渠道
+const (
+	ChannelMultiKeyRoundRobin = "round_robin"
+	ChannelMultiKeyRandom     = "random"
+)
+
+// ChannelKey 记录多密钥渠道中单个密钥的状态和用量，只保存密钥的哈希
+type ChannelKey struct {
+	Id             int    `json:"id"`
+	ChannelId      int    `json:"channel_id" gorm:"uniqueIndex:idx_channel_key_hash"`
+	KeyHash        string `json:"-" gorm:"type:varchar(64);uniqueIndex:idx_channel_key_hash"`
+	Status         int    `json:"status" gorm:"default:1"`
+	DisabledReason string `json:"disabled_reason" gorm:"type:varchar(1024);default:''"`
+	DisabledTime   int64  `json:"disabled_time" gorm:"bigint"`
+	UsedQuota      int64  `json:"used_quota" gorm:"bigint;default:0"`
+	UsedCount      int    `json:"used_count" gorm:"default:0"`
+}
+
+// ChannelKeyStatus 渠道接口中展示的密钥状态，密钥经过脱敏
+type ChannelKeyStatus struct {
+	ChannelKey
+	Index int    `json:"index"`
+	Key   string `json:"key"`
+}
+
+type channelKeyPool struct {
+	mu      sync.Mutex
+	keyHash string // 整个密钥列表的哈希，渠道密钥被修改后重新加载
+	keys    []string
+	rows    []*ChannelKey
+	next    int
+}
+
+var channelKeyPools sync.Map // channelId -> *channelKeyPool
+
+func IsValidChannelMultiKeyMode(mode string) bool {
+	return mode == "" || mode == ChannelMultiKeyRoundRobin || mode == ChannelMultiKeyRandom
+}
+
+func (channel *Channel) GetMultiKeyMode() string {
+	if channel.MultiKeyMode == nil {
+		return ""
+	}
+	return *channel.MultiKeyMode
+}
+
+func (channel *Channel) IsMultiKey() bool {
+	return channel.GetMultiKeyMode() != ""
+}
+
+// GetKeys 返回渠道的密钥列表，多密钥渠道的密钥按行分隔
+func (channel *Channel) GetKeys() []string {
+	if !channel.IsMultiKey() {
+		return []string{channel.Key}
+	}
+	return splitChannelKeys(channel.Key)
+}
+
+func splitChannelKeys(key string) []string {
+	var keys []string
+	for _, k := range strings.Split(key, "\n") {
+		k = strings.TrimSpace(k)
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func hashChannelKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func maskChannelKey(key string) string {
+	if len(key) <= 12 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:6] + "****" + key[len(key)-4:]
+}
+
+// SelectKey 为本次请求选择密钥，返回密钥及其 ChannelKey 编号，普通渠道的编号为 0
+func (channel *Channel) SelectKey() (string, int) {
+	if !channel.IsMultiKey() {
+		return channel.Key, 0
+	}
+	pool, err := getChannelKeyPool(channel)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to load keys of channel #%d: %s", channel.Id, err.Error()))
+		keys := channel.GetKeys()
+		if len(keys) == 0 {
+			return "", 0
+		}
+		return keys[rand.Intn(len(keys))], 0
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	var enabled []int
+	for i, row := range pool.rows {
+		if row.Status == common.ChannelStatusEnabled {
+			enabled = append(enabled, i)
+		}
+	}
+	if len(enabled) == 0 {
+		// 所有密钥都已禁用时渠道也会被禁用，这里仍返回一个密钥避免请求直接失败
+		if len(pool.keys) == 0 {
+			return "", 0
+		}
+		return pool.keys[0], pool.rows[0].Id
+	}
+	var idx int
+	if channel.GetMultiKeyMode() == ChannelMultiKeyRoundRobin {
+		idx = enabled[pool.next%len(enabled)]
+		pool.next++
+	} else {
+		idx = enabled[rand.Intn(len(enabled))]
+	}
+	return pool.keys[idx], pool.rows[idx].Id
+}
+
+func getChannelKeyPool(channel *Channel) (*channelKeyPool, error) {
+	keyHash := hashChannelKey(channel.Key)
+	if v, ok := channelKeyPools.Load(channel.Id); ok {
+		pool := v.(*channelKeyPool)
+		if pool.keyHash == keyHash {
+			return pool, nil
+		}
+	}
+	keys := channel.GetKeys()
+	rows, err := syncChannelKeys(channel.Id, keys)
+	if err != nil {
+		return nil, err
+	}
+	pool := &channelKeyPool{keyHash: keyHash, keys: keys, rows: rows}
+	channelKeyPools.Store(channel.Id, pool)
+	return pool, nil
+}
+
+// syncChannelKeys 为新增的密钥创建记录，删除已经移除的密钥，按密钥顺序返回记录
+func syncChannelKeys(channelId int, keys []string) ([]*ChannelKey, error) {
+	var existing []*ChannelKey
+	err := DB.Where("channel_id = ?", channelId).Find(&existing).Error
+	if err != nil {
+		return nil, err
+	}
+	hash2row := make(map[string]*ChannelKey, len(existing))
+	for _, row := range existing {
+		hash2row[row.KeyHash] = row
+	}
+	rows := make([]*ChannelKey, 0, len(keys))
+	used := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		hash := hashChannelKey(key)
+		row, ok := hash2row[hash]
+		if !ok {
+			row = &ChannelKey{ChannelId: channelId, KeyHash: hash, Status: common.ChannelStatusEnabled}
+			err = DB.Create(row).Error
+			if err != nil {
+				return nil, err
+			}
+			hash2row[hash] = row
+		}
+		used[hash] = true
+		rows = append(rows, row)
+	}
+	var stale []int
+	for hash, row := range hash2row {
+		if !used[hash] {
+			stale = append(stale, row.Id)
+		}
+	}
+	if len(stale) > 0 {
+		err = DB.Where("id in (?)", stale).Delete(&ChannelKey{}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// DisableChannelKey 自动禁用多密钥渠道中的单个密钥，返回剩余可用的密钥数量
+func DisableChannelKey(channelId int, keyId int, reason string) (int, error) {
+	if len(reason) > 1024 {
+		reason = reason[:1024]
+	}
+	err := DB.Model(&ChannelKey{}).Where("id = ? and channel_id = ?", keyId, channelId).Updates(map[string]interface{}{
+		"status":          common.ChannelStatusAutoDisabled,
+		"disabled_reason": reason,
+		"disabled_time":   common.GetTimestamp(),
+	}).Error
+	if err != nil {
+		return 0, err
+	}
+	remaining := 0
+	if v, ok := channelKeyPools.Load(channelId); ok {
+		pool := v.(*channelKeyPool)
+		pool.mu.Lock()
+		for _, row := range pool.rows {
+			if row.Id == keyId {
+				row.Status = common.ChannelStatusAutoDisabled
+				row.DisabledReason = reason
+			}
+			if row.Status == common.ChannelStatusEnabled {
+				remaining++
+			}
+		}
+		pool.mu.Unlock()
+		return remaining, nil
+	}
+	var count int64
+	err = DB.Model(&ChannelKey{}).Where("channel_id = ? and status = ?", channelId, common.ChannelStatusEnabled).Count(&count).Error
+	return int(count), err
+}
+
+// UpdateChannelKeyStatus 手动启用或禁用单个密钥
+func UpdateChannelKeyStatus(channelId int, keyId int, status int) error {
+	if status != common.ChannelStatusEnabled && status != common.ChannelStatusManuallyDisabled {
+		return errors.New("无效的密钥状态")
+	}
+	result := DB.Model(&ChannelKey{}).Where("id = ? and channel_id = ?", keyId, channelId).Updates(map[string]interface{}{
+		"status":          status,
+		"disabled_reason": "",
+		"disabled_time":   0,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("密钥不存在")
+	}
+	channelKeyPools.Delete(channelId)
+	return nil
+}
+
+// enableAutoDisabledChannelKeys 渠道重新启用时恢复被自动禁用的密钥
+func enableAutoDisabledChannelKeys(channelId int) {
+	err := DB.Model(&ChannelKey{}).Where("channel_id = ? and status = ?", channelId, common.ChannelStatusAutoDisabled).Updates(map[string]interface{}{
+		"status":          common.ChannelStatusEnabled,
+		"disabled_reason": "",
+		"disabled_time":   0,
+	}).Error
+	if err != nil {
+		common.SysError("failed to enable channel keys: " + err.Error())
+	}
+	channelKeyPools.Delete(channelId)
+}
+
+// GetChannelKeyStatuses 返回多密钥渠道每个密钥的状态和用量
+func GetChannelKeyStatuses(channel *Channel) ([]ChannelKeyStatus, error) {
+	if !channel.IsMultiKey() {
+		return []ChannelKeyStatus{}, nil
+	}
+	keys := channel.GetKeys()
+	rows, err := syncChannelKeys(channel.Id, keys)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]ChannelKeyStatus, 0, len(rows))
+	for i, row := range rows {
+		statuses = append(statuses, ChannelKeyStatus{
+			ChannelKey: *row,
+			Index:      i,
+			Key:        maskChannelKey(keys[i]),
+		})
+	}
+	return statuses, nil
+}
+
+func UpdateChannelKeyUsedQuota(keyId int, quota int) {
+	if keyId == 0 {
+		return
+	}
+	if config.BatchUpdateEnabled {
+		addNewRecord(BatchUpdateTypeChannelKeyUsedQuota, keyId, quota)
+		return
+	}
+	updateChannelKeyUsedQuota(keyId, quota)
+}
+
+func updateChannelKeyUsedQuota(keyId int, quota int) {
+	err := DB.Model(&ChannelKey{}).Where("id = ?", keyId).
+		Updates(map[string]interface{}{
+			"used_quota": gorm.Expr("used_quota + ?", quota),
+			"used_count": gorm.Expr("used_count + 1"),
+		}).Error
+	if err != nil {
+		common.SysError("failed to update channel key used quota: " + err.Error())
+	}
+}
+
+func deleteChannelKeys(tx *gorm.DB, channelIds ...int) error {
+	for _, id := range channelIds {
+		channelKeyPools.Delete(id)
+	}
+	return tx.Where("channel_id in (?)", channelIds).Delete(&ChannelKey{}).Error
+}
+
+// resetChannelKeyPools 渠道缓存同步时丢弃内存中的密钥状态，使其他实例的禁用结果生效
+func resetChannelKeyPools() {
+	channelKeyPools.Range(func(key, _ any) bool {
+		channelKeyPools.Delete(key)
+		return true
+	})
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannelSelectKey(t *testing.T) {
+	Convey("SelectKey", t, func() {
+		resetTestDB()
+		resetChannelKeyPools()
+		mode := ChannelMultiKeyRoundRobin
+		channel := &Channel{Id: 9301, Key: "sk-a\n sk-b \n\nsk-c", MultiKeyMode: &mode}
+
+		Convey("single key channels use the key as is", func() {
+			key, keyId := (&Channel{Id: 9302, Key: "sk-single"}).SelectKey()
+			So(key, ShouldEqual, "sk-single")
+			So(keyId, ShouldEqual, 0)
+		})
+		Convey("round robin rotates through the keys", func() {
+			var keys []string
+			for i := 0; i < 4; i++ {
+				key, keyId := channel.SelectKey()
+				So(keyId, ShouldNotEqual, 0)
+				keys = append(keys, key)
+			}
+			So(keys, ShouldResemble, []string{"sk-a", "sk-b", "sk-c", "sk-a"})
+		})
+		Convey("disabled keys are skipped", func() {
+			_, keyId := channel.SelectKey()
+			remaining, err := DisableChannelKey(channel.Id, keyId, "invalid api key")
+			So(err, ShouldBeNil)
+			So(remaining, ShouldEqual, 2)
+			for i := 0; i < 4; i++ {
+				key, _ := channel.SelectKey()
+				So(key, ShouldNotEqual, "sk-a")
+			}
+			Convey("and come back once the channel is enabled again", func() {
+				enableAutoDisabledChannelKeys(channel.Id)
+				statuses, err := GetChannelKeyStatuses(channel)
+				So(err, ShouldBeNil)
+				So(statuses, ShouldHaveLength, 3)
+				for _, status := range statuses {
+					So(status.Status, ShouldEqual, common.ChannelStatusEnabled)
+				}
+			})
+		})
+		Convey("editing the key list drops removed keys", func() {
+			channel.SelectKey()
+			channel.Key = "sk-b\nsk-d"
+			statuses, err := GetChannelKeyStatuses(channel)
+			So(err, ShouldBeNil)
+			So(statuses, ShouldHaveLength, 2)
+			var count int64
+			DB.Model(&ChannelKey{}).Where("channel_id = ?", channel.Id).Count(&count)
+			So(count, ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"one-api/common"
+	"strconv"
+)
+
+func (channel *Channel) GetMaxConcurrency() int {
+	if channel.MaxConcurrency == nil {
+		return 0
+	}
+	return *channel.MaxConcurrency
+}
+
+func (channel *Channel) GetTPMLimit() int {
+	if channel.TPMLimit == nil {
+		return 0
+	}
+	return *channel.TPMLimit
+}
+
+func channelInFlightKey(channelId int) string {
+	return "channel:" + strconv.Itoa(channelId)
+}
+
+func ChannelTPMKey(channelId int) string {
+	return "channel:tpm:" + strconv.Itoa(channelId)
+}
+
+// channelSaturated 判断渠道的并发数或本分钟的 token 用量是否已达到上限，选择渠道时跳过
+func channelSaturated(channel *Channel) bool {
+	if limit := channel.GetMaxConcurrency(); limit > 0 && inFlightCount(channelInFlightKey(channel.Id)) >= limit {
+		return true
+	}
+	if limit := channel.GetTPMLimit(); limit > 0 && common.RateWindowUsage(ChannelTPMKey(channel.Id)) >= int64(limit) {
+		return true
+	}
+	return false
+}
+
+// AcquireChannelSlot 请求开始前占用渠道的并发名额，流式请求在流结束后才释放
+func AcquireChannelSlot(channelId int, maxConcurrency int) bool {
+	if maxConcurrency <= 0 {
+		return true
+	}
+	return acquireInFlight(channelInFlightKey(channelId), maxConcurrency)
+}
+
+func ReleaseChannelSlot(channelId int, maxConcurrency int) {
+	if maxConcurrency <= 0 {
+		return
+	}
+	releaseInFlight(channelInFlightKey(channelId))
+	NotifyChannelQueue()
+}
+
+// RecordChannelTokens 把请求实际消耗的 token 计入渠道的 TPM 窗口
+func RecordChannelTokens(channelId int, tpmLimit int, tokens int) {
+	if tpmLimit <= 0 || tokens <= 0 {
+		return
+	}
+	common.RateWindowAdd(ChannelTPMKey(channelId), int64(tokens))
+}
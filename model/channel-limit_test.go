@@ -0,0 +1,40 @@
+package model
+
+import (
+	"one-api/common"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannelSaturated(t *testing.T) {
+	Convey("channelSaturated", t, func() {
+		Convey("channels without limits are never saturated", func() {
+			channel := &Channel{Id: 9101}
+			So(AcquireChannelSlot(channel.Id, channel.GetMaxConcurrency()), ShouldBeTrue)
+			So(channelSaturated(channel), ShouldBeFalse)
+		})
+		Convey("saturated while all concurrency slots are taken", func() {
+			maxConcurrency := 2
+			channel := &Channel{Id: 9102, MaxConcurrency: &maxConcurrency}
+			So(AcquireChannelSlot(channel.Id, 2), ShouldBeTrue)
+			So(channelSaturated(channel), ShouldBeFalse)
+			So(AcquireChannelSlot(channel.Id, 2), ShouldBeTrue)
+			So(channelSaturated(channel), ShouldBeTrue)
+			So(AcquireChannelSlot(channel.Id, 2), ShouldBeFalse)
+			ReleaseChannelSlot(channel.Id, 2)
+			So(channelSaturated(channel), ShouldBeFalse)
+			ReleaseChannelSlot(channel.Id, 2)
+		})
+		Convey("saturated once the TPM window is used up", func() {
+			channelId := 9103
+			used := common.RateWindowUsage(ChannelTPMKey(channelId))
+			tpmLimit := int(used) + 1000
+			channel := &Channel{Id: channelId, TPMLimit: &tpmLimit}
+			RecordChannelTokens(channel.Id, tpmLimit, 600)
+			So(channelSaturated(channel), ShouldBeFalse)
+			RecordChannelTokens(channel.Id, tpmLimit, 400)
+			So(channelSaturated(channel), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,235 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/common/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分组下暂时没有可用渠道时，请求在本实例内排队等待，渠道释放并发名额后按分组优先级依次尝试选择渠道
+
+// 没有收到渠道空闲通知时也定期尝试，覆盖 TPM 窗口滑动、熔断冷却结束等情况
+const channelQueuePollInterval = 200 * time.Millisecond
+
+type channelQueueWaiter struct {
+	key      string
+	model    string
+	priority int
+	seq      uint64
+	try      func() (*Channel, error)
+	channel  *Channel
+	done     chan struct{}
+}
+
+type channelQueueStats struct {
+	depth     int
+	admitted  int64
+	timeouts  int64
+	rejected  int64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+type ChannelQueueSnapshot struct {
+	Group     string  `json:"group"`
+	Model     string  `json:"model"`
+	Depth     int     `json:"depth"`
+	Admitted  int64   `json:"admitted"`
+	Timeouts  int64   `json:"timeouts"`
+	Rejected  int64   `json:"rejected"`
+	AvgWaitMs float64 `json:"avg_wait_ms"`
+	MaxWaitMs int64   `json:"max_wait_ms"`
+}
+
+var channelQueue = struct {
+	sync.Mutex
+	waiters []*channelQueueWaiter
+	seq     uint64
+	stats   map[string]*channelQueueStats
+}{stats: make(map[string]*channelQueueStats)}
+
+var channelQueueSignal = make(chan struct{}, 1)
+var channelQueueOnce sync.Once
+
+// WaitForChannel 将请求加入分组、模型的等待队列，直到 try 选出渠道、等待超时或请求被取消，
+// 返回的渠道已经占用了并发名额，调用方需要在请求结束后调用 ReleaseChannelSlot
+func WaitForChannel(ctx context.Context, group string, model string, try func() (*Channel, error)) (*Channel, error) {
+	key := group + ":" + model
+	start := time.Now()
+	channelQueue.Lock()
+	stats := getChannelQueueStats(key)
+	if stats.depth >= config.ChannelQueueMaxSize {
+		stats.rejected++
+		channelQueue.Unlock()
+		return nil, errors.New("排队请求数已达上限")
+	}
+	channelQueue.seq++
+	waiter := &channelQueueWaiter{
+		key:      key,
+		model:    model,
+		priority: common.GetGroupQueuePriority(group),
+		seq:      channelQueue.seq,
+		try:      try,
+		done:     make(chan struct{}),
+	}
+	channelQueue.waiters = append(channelQueue.waiters, waiter)
+	stats.depth++
+	depth := stats.depth
+	channelQueue.Unlock()
+
+	channelQueueOnce.Do(func() {
+		go runChannelQueueDispatcher()
+	})
+	NotifyChannelQueue()
+	common.LogInfo(ctx, fmt.Sprintf("分组 %s 下模型 %s 暂无可用渠道，进入排队，当前队列长度 %d", group, model, depth))
+
+	timer := time.NewTimer(time.Duration(config.ChannelQueueMaxWait) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-waiter.done:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	channelQueue.Lock()
+	defer channelQueue.Unlock()
+	waited := time.Since(start)
+	if waiter.channel == nil {
+		removeChannelQueueWaiter(waiter)
+		stats.timeouts++
+		common.LogWarn(ctx, fmt.Sprintf("分组 %s 下模型 %s 排队 %dms 后超时", group, model, waited.Milliseconds()))
+		return nil, errors.New("排队等待渠道超时")
+	}
+	stats.admitted++
+	stats.totalWait += waited
+	stats.maxWait = max(stats.maxWait, waited)
+	common.LogInfo(ctx, fmt.Sprintf("分组 %s 下模型 %s 排队 %dms 后获得渠道 #%d", group, model, waited.Milliseconds(), waiter.channel.Id))
+	return waiter.channel, nil
+}
+
+// GroupModelHasChannels 分组下存在启用的渠道时才排队，未配置渠道的模型直接返回错误
+func GroupModelHasChannels(group string, model string) bool {
+	if common.MemoryCacheEnabled {
+		return len(getGroupModelChannels(group, model)) > 0
+	}
+	groupCol := "`group`"
+	if common.UsingPostgreSQL {
+		groupCol = `"group"`
+	}
+	var count int64
+	err := DB.Model(&Ability{}).Where(groupCol+" = ? and model IN (?) and enabled = ?", group, abilityModels(group, model), true).Count(&count).Error
+	return err == nil && count > 0
+}
+
+// NotifyChannelQueue 渠道释放并发名额或请求结束时调用，唤醒排队中的请求
+func NotifyChannelQueue() {
+	select {
+	case channelQueueSignal <- struct{}{}:
+	default:
+	}
+}
+
+func runChannelQueueDispatcher() {
+	ticker := time.NewTicker(channelQueuePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-channelQueueSignal:
+		case <-ticker.C:
+		}
+		dispatchChannelQueue()
+	}
+}
+
+// dispatchChannelQueue 按分组优先级从高到低、同优先级先到先得的顺序为排队请求选择渠道。
+// 选择渠道会访问数据库和 Redis，只在复制等待列表和交付名额时持有队列锁
+func dispatchChannelQueue() {
+	channelQueue.Lock()
+	waiters := append([]*channelQueueWaiter(nil), channelQueue.waiters...)
+	channelQueue.Unlock()
+	sort.SliceStable(waiters, func(i, j int) bool {
+		a, b := waiters[i], waiters[j]
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.seq < b.seq
+	})
+	for _, waiter := range waiters {
+		channel, err := waiter.try()
+		if err != nil || channel == nil {
+			continue
+		}
+		if !AcquireChannelSlot(channel.Id, channel.GetMaxConcurrency()) {
+			ReleaseChannelBreaker(channel.Id, waiter.model)
+			continue
+		}
+		channelQueue.Lock()
+		admitted := removeChannelQueueWaiter(waiter)
+		if admitted {
+			waiter.channel = channel
+			close(waiter.done)
+		}
+		channelQueue.Unlock()
+		// 选择渠道期间请求已经超时或取消，归还占用的名额
+		if !admitted {
+			ReleaseChannelSlot(channel.Id, channel.GetMaxConcurrency())
+			ReleaseChannelBreaker(channel.Id, waiter.model)
+		}
+	}
+}
+
+func removeChannelQueueWaiter(waiter *channelQueueWaiter) bool {
+	for i, w := range channelQueue.waiters {
+		if w == waiter {
+			channelQueue.waiters = append(channelQueue.waiters[:i], channelQueue.waiters[i+1:]...)
+			getChannelQueueStats(waiter.key).depth--
+			return true
+		}
+	}
+	return false
+}
+
+func getChannelQueueStats(key string) *channelQueueStats {
+	stats, ok := channelQueue.stats[key]
+	if !ok {
+		stats = &channelQueueStats{}
+		channelQueue.stats[key] = stats
+	}
+	return stats
+}
+
+// GetChannelQueueSnapshots 返回各分组、模型的排队长度和等待时间统计
+func GetChannelQueueSnapshots() []ChannelQueueSnapshot {
+	channelQueue.Lock()
+	defer channelQueue.Unlock()
+	snapshots := make([]ChannelQueueSnapshot, 0, len(channelQueue.stats))
+	for key, stats := range channelQueue.stats {
+		group, model, _ := strings.Cut(key, ":")
+		snapshot := ChannelQueueSnapshot{
+			Group:     group,
+			Model:     model,
+			Depth:     stats.depth,
+			Admitted:  stats.admitted,
+			Timeouts:  stats.timeouts,
+			Rejected:  stats.rejected,
+			MaxWaitMs: stats.maxWait.Milliseconds(),
+		}
+		if stats.admitted > 0 {
+			snapshot.AvgWaitMs = float64(stats.totalWait.Milliseconds()) / float64(stats.admitted)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		if snapshots[i].Group != snapshots[j].Group {
+			return snapshots[i].Group < snapshots[j].Group
+		}
+		return snapshots[i].Model < snapshots[j].Model
+	})
+	return snapshots
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"context"
+	"one-api/common"
+	"one-api/common/config"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func channelQueueSnapshot(group string, model string) ChannelQueueSnapshot {
+	for _, snapshot := range GetChannelQueueSnapshots() {
+		if snapshot.Group == group && snapshot.Model == model {
+			return snapshot
+		}
+	}
+	return ChannelQueueSnapshot{}
+}
+
+func waitForQueueDepth(group string, model string, depth int) {
+	for i := 0; i < 100 && channelQueueSnapshot(group, model).Depth != depth; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWaitForChannel(t *testing.T) {
+	maxSize, maxWait := config.ChannelQueueMaxSize, config.ChannelQueueMaxWait
+	defer func() {
+		config.ChannelQueueMaxSize, config.ChannelQueueMaxWait = maxSize, maxWait
+		common.GroupQueuePriority = map[string]int{}
+	}()
+	config.ChannelQueueMaxSize = 10
+	config.ChannelQueueMaxWait = 2
+
+	Convey("WaitForChannel", t, func() {
+		channelQueue.Lock()
+		channelQueue.stats = make(map[string]*channelQueueStats)
+		channelQueue.Unlock()
+		Convey("admits the request once a slot is free", func() {
+			maxConcurrency := 1
+			channel := &Channel{Id: 9001, MaxConcurrency: &maxConcurrency}
+			So(AcquireChannelSlot(channel.Id, 1), ShouldBeTrue)
+			result := make(chan *Channel)
+			go func() {
+				admitted, _ := WaitForChannel(context.Background(), "free", "gpt-4o", func() (*Channel, error) {
+					return channel, nil
+				})
+				result <- admitted
+			}()
+			waitForQueueDepth("free", "gpt-4o", 1)
+			ReleaseChannelSlot(channel.Id, 1)
+			So((<-result).Id, ShouldEqual, channel.Id)
+			// 交付给排队请求的渠道已经占用了名额
+			So(AcquireChannelSlot(channel.Id, 1), ShouldBeFalse)
+			ReleaseChannelSlot(channel.Id, 1)
+			So(channelQueueSnapshot("free", "gpt-4o").Admitted, ShouldEqual, 1)
+		})
+		Convey("higher priority groups are admitted first", func() {
+			common.GroupQueuePriority = map[string]int{"high": 10}
+			maxConcurrency := 1
+			channel := &Channel{Id: 9002, MaxConcurrency: &maxConcurrency}
+			So(AcquireChannelSlot(channel.Id, 1), ShouldBeTrue)
+			admitted := make(chan string, 2)
+			for _, group := range []string{"low", "high"} {
+				go func() {
+					if _, err := WaitForChannel(context.Background(), group, "gpt-4o", func() (*Channel, error) {
+						return channel, nil
+					}); err == nil {
+						admitted <- group
+					}
+				}()
+				waitForQueueDepth(group, "gpt-4o", 1)
+			}
+			ReleaseChannelSlot(channel.Id, 1)
+			So(<-admitted, ShouldEqual, "high")
+			ReleaseChannelSlot(channel.Id, 1)
+			So(<-admitted, ShouldEqual, "low")
+			ReleaseChannelSlot(channel.Id, 1)
+		})
+		Convey("times out when no channel frees up", func() {
+			config.ChannelQueueMaxWait = 1
+			channel, err := WaitForChannel(context.Background(), "timeout", "gpt-4o", func() (*Channel, error) {
+				return nil, nil
+			})
+			So(channel, ShouldBeNil)
+			So(err, ShouldNotBeNil)
+			snapshot := channelQueueSnapshot("timeout", "gpt-4o")
+			So(snapshot.Timeouts, ShouldEqual, 1)
+			So(snapshot.Depth, ShouldEqual, 0)
+		})
+		Convey("stops waiting when the request is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := WaitForChannel(ctx, "cancel", "gpt-4o", func() (*Channel, error) {
+				return nil, nil
+			})
+			So(err, ShouldNotBeNil)
+			So(channelQueueSnapshot("cancel", "gpt-4o").Depth, ShouldEqual, 0)
+		})
+		Convey("rejects requests over the queue size", func() {
+			config.ChannelQueueMaxSize = 0
+			_, err := WaitForChannel(context.Background(), "full", "gpt-4o", func() (*Channel, error) {
+				return nil, nil
+			})
+			So(err, ShouldNotBeNil)
+			So(channelQueueSnapshot("full", "gpt-4o").Rejected, ShouldEqual, 1)
+		})
+	})
+}
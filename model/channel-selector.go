@@ -0,0 +1,143 @@
+package model
+
+import (
+	"errors"
+	"math/rand"
+	"one-api/common"
+	"sync"
+	"sync/atomic"
+)
+
+// ChannelSelector 在同一优先级的候选渠道中选出一个渠道
+type ChannelSelector interface {
+	Select(channels []*Channel, group string, model string) (*Channel, error)
+}
+
+var channelSelectors = map[string]ChannelSelector{
+	common.ChannelStrategyWeightedRandom: weightedRandomSelector{},
+	common.ChannelStrategyRoundRobin:     &roundRobinSelector{},
+	common.ChannelStrategyLeastInFlight:  leastInFlightSelector{},
+	common.ChannelStrategyLowestLatency:  lowestLatencySelector{},
+	common.ChannelStrategyLowestTTFT:     lowestLatencySelector{ttft: true},
+	common.ChannelStrategyLowestCost:     lowestCostSelector{},
+}
+
+func getChannelSelector(group string, model string) ChannelSelector {
+	if selector, ok := channelSelectors[common.GetChannelStrategy(group, model)]; ok {
+		return selector
+	}
+	return channelSelectors[common.ChannelStrategyWeightedRandom]
+}
+
+// availableChannels 过滤掉被渠道频率限制的渠道
+func availableChannels(channels []*Channel, model string) ([]*Channel, error) {
+	validChannels := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if !isRedisLimited(*channel, channel.Id, model) {
+			validChannels = append(validChannels, channel)
+		}
+	}
+	if len(validChannels) == 0 {
+		return nil, errors.New("所有通道都被频率限制")
+	}
+	return validChannels, nil
+}
+
+// selectMinimum 选出 score 最小的渠道，分数相同时按权重随机
+func selectMinimum(channels []*Channel, model string, score func(channel *Channel) float64) (*Channel, error) {
+	validChannels, err := availableChannels(channels, model)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []*Channel
+	minScore := 0.0
+	for _, channel := range validChannels {
+		s := score(channel)
+		if len(candidates) == 0 || s < minScore {
+			candidates = []*Channel{channel}
+			minScore = s
+		} else if s == minScore {
+			candidates = append(candidates, channel)
+		}
+	}
+	return pickWeighted(candidates), nil
+}
+
+func pickWeighted(channels []*Channel) *Channel {
+	totalWeight := 0
+	for _, channel := range channels {
+		totalWeight += channel.GetWeight()
+	}
+	if totalWeight == 0 {
+		return channels[rand.Intn(len(channels))]
+	}
+	randomWeight := rand.Intn(totalWeight)
+	for _, channel := range channels {
+		randomWeight -= channel.GetWeight()
+		if randomWeight < 0 {
+			return channel
+		}
+	}
+	return channels[len(channels)-1]
+}
+
+type weightedRandomSelector struct{}
+
+func (weightedRandomSelector) Select(channels []*Channel, group string, model string) (*Channel, error) {
+	totalWeight := 0
+	for _, channel := range channels {
+		totalWeight += channel.GetWeight()
+	}
+	return weightedRandomSelection(channels, totalWeight, model)
+}
+
+// roundRobinSelector 按分组和模型分别轮询，计数器保存在本机内存中
+type roundRobinSelector struct {
+	counters sync.Map
+}
+
+func (s *roundRobinSelector) Select(channels []*Channel, group string, model string) (*Channel, error) {
+	validChannels, err := availableChannels(channels, model)
+	if err != nil {
+		return nil, err
+	}
+	counter, _ := s.counters.LoadOrStore(group+":"+model, new(uint64))
+	next := atomic.AddUint64(counter.(*uint64), 1)
+	return validChannels[(next-1)%uint64(len(validChannels))], nil
+}
+
+type leastInFlightSelector struct{}
+
+func (leastInFlightSelector) Select(channels []*Channel, group string, model string) (*Channel, error) {
+	return selectMinimum(channels, model, func(channel *Channel) float64 {
+		return float64(channelInFlight(channel.Id))
+	})
+}
+
+// 按延迟选择时有一小部分请求随机分配，使变慢后恢复的渠道有机会刷新统计
+const latencyExploreRate = 0.05
+
+type lowestLatencySelector struct {
+	ttft bool
+}
+
+func (s lowestLatencySelector) Select(channels []*Channel, group string, model string) (*Channel, error) {
+	if rand.Float64() < latencyExploreRate {
+		validChannels, err := availableChannels(channels, model)
+		if err != nil {
+			return nil, err
+		}
+		return pickWeighted(validChannels), nil
+	}
+	return selectMinimum(channels, model, func(channel *Channel) float64 {
+		return channelLatency(channel.Id, s.ttft)
+	})
+}
+
+type lowestCostSelector struct{}
+
+func (lowestCostSelector) Select(channels []*Channel, group string, model string) (*Channel, error) {
+	return selectMinimum(channels, model, func(channel *Channel) float64 {
+		return channel.GetCostRatio()
+	})
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestSelectorChannels(ids ...int) []*Channel {
+	channels := make([]*Channel, 0, len(ids))
+	for _, id := range ids {
+		weight := uint(1)
+		channels = append(channels, &Channel{Id: id, Weight: &weight})
+	}
+	return channels
+}
+
+func selectChannelIds(selector ChannelSelector, channels []*Channel, n int) []int {
+	ids := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		channel, err := selector.Select(channels, "default", "gpt-4o")
+		if err != nil {
+			panic(err)
+		}
+		ids = append(ids, channel.Id)
+	}
+	return ids
+}
+
+func TestChannelSelectors(t *testing.T) {
+	Convey("channel selectors", t, func() {
+		Convey("round robin cycles through the channels", func() {
+			channels := newTestSelectorChannels(9201, 9202, 9203)
+			So(selectChannelIds(&roundRobinSelector{}, channels, 6), ShouldResemble, []int{9201, 9202, 9203, 9201, 9202, 9203})
+		})
+		Convey("least in-flight picks the idlest channel", func() {
+			channels := newTestSelectorChannels(9211, 9212)
+			RecordChannelRequestStart(9211)
+			defer CancelChannelRequest(9211)
+			So(selectChannelIds(leastInFlightSelector{}, channels, 5), ShouldResemble, []int{9212, 9212, 9212, 9212, 9212})
+		})
+		Convey("lowest cost picks the cheapest channel", func() {
+			channels := newTestSelectorChannels(9221, 9222)
+			cheap, expensive := 0.5, 2.0
+			channels[0].CostRatio = &expensive
+			channels[1].CostRatio = &cheap
+			So(selectChannelIds(lowestCostSelector{}, channels, 5), ShouldResemble, []int{9222, 9222, 9222, 9222, 9222})
+		})
+		Convey("lowest latency mostly picks the fastest channel", func() {
+			channels := newTestSelectorChannels(9231, 9232)
+			for _, channelId := range []int{9231, 9232} {
+				RecordChannelRequestStart(channelId)
+			}
+			RecordChannelRequestEnd(9231, 3*time.Second, time.Second, true)
+			RecordChannelRequestEnd(9232, time.Second, 2*time.Second, true)
+			fastest := 0
+			for _, id := range selectChannelIds(lowestLatencySelector{}, channels, 100) {
+				if id == 9232 {
+					fastest++
+				}
+			}
+			So(fastest, ShouldBeGreaterThan, 80)
+			fastest = 0
+			for _, id := range selectChannelIds(lowestLatencySelector{ttft: true}, channels, 100) {
+				if id == 9231 {
+					fastest++
+				}
+			}
+			So(fastest, ShouldBeGreaterThan, 80)
+		})
+	})
+}
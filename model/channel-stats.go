@@ -0,0 +1,144 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 延迟的指数加权移动平均系数，越大越偏向最近的请求
+const channelStatsEWMAAlpha = 0.2
+
+// channelStats 渠道的实时统计，仅保存在本机内存中
+type channelStats struct {
+	inFlight int64
+
+	mu          sync.Mutex
+	latencyEWMA float64 // 毫秒
+	ttftEWMA    float64 // 毫秒
+	requests    int64
+	failures    int64
+
+	promptTokens int64
+	cachedTokens int64
+	cacheHits    int64 // 命中上游提示词缓存的请求数
+}
+
+type ChannelStatsSnapshot struct {
+	ChannelId int     `json:"channel_id"`
+	InFlight  int64   `json:"in_flight"`
+	LatencyMs float64 `json:"latency_ms"`
+	TTFTMs    float64 `json:"ttft_ms"`
+	Requests  int64   `json:"requests"`
+	Failures  int64   `json:"failures"`
+
+	PromptTokens int64   `json:"prompt_tokens"`
+	CachedTokens int64   `json:"cached_tokens"`
+	CacheHits    int64   `json:"cache_hits"`
+	CacheHitRate float64 `json:"cache_hit_rate"` // 缓存命中的 token 占输入 token 的比例
+}
+
+var channelStatsMap sync.Map
+
+func getChannelStats(channelId int) *channelStats {
+	if stats, ok := channelStatsMap.Load(channelId); ok {
+		return stats.(*channelStats)
+	}
+	stats, _ := channelStatsMap.LoadOrStore(channelId, &channelStats{})
+	return stats.(*channelStats)
+}
+
+func ewma(current float64, sample float64) float64 {
+	if current == 0 {
+		return sample
+	}
+	return channelStatsEWMAAlpha*sample + (1-channelStatsEWMAAlpha)*current
+}
+
+// RecordChannelRequestStart 请求发往渠道前调用，与 RecordChannelRequestEnd 或 CancelChannelRequest 成对使用
+func RecordChannelRequestStart(channelId int) {
+	atomic.AddInt64(&getChannelStats(channelId).inFlight, 1)
+}
+
+// CancelChannelRequest 结束一次被主动中断的请求，不计入请求数和耗时
+func CancelChannelRequest(channelId int) {
+	atomic.AddInt64(&getChannelStats(channelId).inFlight, -1)
+}
+
+// RecordChannelRequestEnd 记录一次请求的总耗时和首字耗时，失败的请求按当前均值的两倍计入，
+// 避免快速失败的渠道因延迟低被优先选中
+func RecordChannelRequestEnd(channelId int, latency time.Duration, ttft time.Duration, success bool) {
+	stats := getChannelStats(channelId)
+	atomic.AddInt64(&stats.inFlight, -1)
+	latencyMs := float64(latency.Milliseconds())
+	ttftMs := float64(ttft.Milliseconds())
+	if ttft <= 0 {
+		ttftMs = latencyMs
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.requests++
+	if !success {
+		stats.failures++
+		latencyMs = max(latencyMs, stats.latencyEWMA*2)
+		ttftMs = max(ttftMs, stats.ttftEWMA*2)
+	}
+	stats.latencyEWMA = ewma(stats.latencyEWMA, latencyMs)
+	stats.ttftEWMA = ewma(stats.ttftEWMA, ttftMs)
+}
+
+// RecordChannelCacheUsage 记录渠道的输入 token 和其中命中上游提示词缓存的 token
+func RecordChannelCacheUsage(channelId int, promptTokens int, cachedTokens int) {
+	if channelId == 0 || promptTokens <= 0 {
+		return
+	}
+	stats := getChannelStats(channelId)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.promptTokens += int64(promptTokens)
+	stats.cachedTokens += int64(cachedTokens)
+	if cachedTokens > 0 {
+		stats.cacheHits++
+	}
+}
+
+func channelInFlight(channelId int) int64 {
+	return atomic.LoadInt64(&getChannelStats(channelId).inFlight)
+}
+
+// channelLatency 返回渠道的延迟均值，没有数据时返回 0，使新渠道优先获得流量以积累统计
+func channelLatency(channelId int, ttft bool) float64 {
+	stats := getChannelStats(channelId)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if ttft {
+		return stats.ttftEWMA
+	}
+	return stats.latencyEWMA
+}
+
+func GetChannelStatsSnapshots() []ChannelStatsSnapshot {
+	snapshots := make([]ChannelStatsSnapshot, 0)
+	channelStatsMap.Range(func(key, value any) bool {
+		stats := value.(*channelStats)
+		stats.mu.Lock()
+		snapshot := ChannelStatsSnapshot{
+			ChannelId:    key.(int),
+			InFlight:     atomic.LoadInt64(&stats.inFlight),
+			LatencyMs:    stats.latencyEWMA,
+			TTFTMs:       stats.ttftEWMA,
+			Requests:     stats.requests,
+			Failures:     stats.failures,
+			PromptTokens: stats.promptTokens,
+			CachedTokens: stats.cachedTokens,
+			CacheHits:    stats.cacheHits,
+		}
+		if stats.promptTokens > 0 {
+			snapshot.CacheHitRate = float64(stats.cachedTokens) / float64(stats.promptTokens)
+		}
+		stats.mu.Unlock()
+		snapshots = append(snapshots, snapshot)
+		return true
+	})
+	return snapshots
+}
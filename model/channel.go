@@ -31,6 +31,7 @@ type Channel struct {
 	Models                string  `json:"models"`
 	Tags                  string  `json:"tags" gorm:"type:varchar(255)"`
 	Group                 string  `json:"group" gorm:"type:varchar(255);default:'default'"`
+	OrgId                 int     `json:"org_id" gorm:"index;default:0"` // 组织渠道只有该组织的令牌可以使用
 	UsedQuota             int64   `json:"used_quota" gorm:"bigint;default:0"`
 	UsedCount             int     `json:"used_count" gorm:"default:0"`
 	ModelMapping          *string `json:"model_mapping" gorm:"type:varchar(1024);default:''"`
@@ -49,6 +50,13 @@ type Channel struct {
 	ProxyURL              *string `json:"proxy_url"`
 	GcpAccount            *string `json:"gcp_account" gorm:"type:varchar(4096);default:''"`
 	SupportsCacheControl  *bool   `json:"supports_cache_control"  gorm:"default:false"`
+	// 渠道的相对成本，供 lowest_cost 选择策略使用
+	CostRatio *float64 `json:"cost_ratio" gorm:"default:1"`
+	// 多密钥模式，开启后 Key 中按行保存多个密钥，由渠道自行轮换
+	MultiKeyMode *string `json:"multi_key_mode" gorm:"type:varchar(32);default:''"`
+	// 渠道的最大并发请求数和每分钟 token 数，0 表示不限制
+	MaxConcurrency *int `json:"max_concurrency" gorm:"default:0"`
+	TPMLimit       *int `json:"tpm_limit" gorm:"default:0"`
 }
 type ChannelConfig struct {
 	Region       string `json:"region,omitempty"`
@@ -64,6 +72,8 @@ type ChannelConfig struct {
 	ClientSecret string `json:"client_secret,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 	GeminiModel  string `json:"gemini_model,omitempty"`
+	// 非 Claude 渠道默认把 /v1/messages 转换为 ChatCompletions，上游本身兼容 Claude 格式时可开启透传
+	ClaudePassthrough bool `json:"claude_passthrough,omitempty"`
 }
 
 func GetAllChannels(startIdx int, num int, selectAll bool, idSort bool) ([]*Channel, error) {
@@ -202,6 +212,11 @@ func BatchDeleteChannels(ids []int) error {
 		tx.Rollback()
 		return err
 	}
+	err = deleteChannelKeys(tx, ids...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 	// 提交事务
 	tx.Commit()
 	return err
@@ -221,6 +236,13 @@ func (channel *Channel) GetWeight() int {
 	return int(*channel.Weight)
 }
 
+func (channel *Channel) GetCostRatio() float64 {
+	if channel.CostRatio == nil {
+		return 1
+	}
+	return *channel.CostRatio
+}
+
 func (channel *Channel) GetBaseURL() string {
 	if channel.BaseURL == nil {
 		return ""
@@ -355,7 +377,10 @@ func (channel *Channel) Delete() error {
 		return err
 	}
 	err = channel.DeleteAbilities()
-	return err
+	if err != nil {
+		return err
+	}
+	return deleteChannelKeys(DB, channel.Id)
 }
 
 func UpdateChannelStatusById(id int, status int) {
@@ -367,6 +392,10 @@ func UpdateChannelStatusById(id int, status int) {
 	if err != nil {
 		common.SysError("failed to update channel status: " + err.Error())
 	}
+	if status == common.ChannelStatusEnabled {
+		ResetChannelBreaker(id, "")
+		enableAutoDisabledChannelKeys(id)
+	}
 }
 
 func UpdateChannelUsedQuota(id int, quota int) {
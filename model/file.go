@@ -0,0 +1,114 @@
+package model
+
+import (
+	"errors"
+	"one-api/common"
+)
+
+const (
+	FilePurposeAssistants = "assistants"
+	FilePurposeBatch      = "batch"
+	FilePurposeVision     = "vision"
+	FilePurposeUserData   = "user_data"
+	// 以下用途仅由系统生成，用户不能直接上传
+	FilePurposeBatchOutput = "batch_output"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+	FileStatusError     = "error"
+)
+
+var UploadFilePurposes = []string{
+	FilePurposeAssistants,
+	FilePurposeBatch,
+	FilePurposeVision,
+	FilePurposeUserData,
+}
+
+type File struct {
+	Id          int    `json:"id"`
+	FileId      string `json:"file_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TokenId     int    `json:"token_id" gorm:"index"`
+	Filename    string `json:"filename" gorm:"type:varchar(255)"`
+	Purpose     string `json:"purpose" gorm:"type:varchar(32);index"`
+	Bytes       int64  `json:"bytes" gorm:"bigint"`
+	Status      string `json:"status" gorm:"type:varchar(32)"`
+	StorageName string `json:"-" gorm:"type:varchar(255)"` // 存储后端中的相对路径
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func IsUploadFilePurpose(purpose string) bool {
+	for _, p := range UploadFilePurposes {
+		if p == purpose {
+			return true
+		}
+	}
+	return false
+}
+
+func NewFileId() string {
+	return "file-" + common.GetRandomString(24)
+}
+
+func (file *File) Insert() error {
+	return DB.Create(file).Error
+}
+
+func (file *File) Delete() error {
+	if file.Id == 0 {
+		return errors.New("id 为空！")
+	}
+	return DB.Delete(file).Error
+}
+
+func GetUserFileByFileId(userId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file_id 为空！")
+	}
+	file := File{}
+	err := DB.Where("user_id = ? AND file_id = ?", userId, fileId).First(&file).Error
+	return &file, err
+}
+
+// GetUserFiles 按 OpenAI 的游标分页方式列出文件，after 为上一页最后一个 file_id
+func GetUserFiles(userId int, purpose string, after string, limit int, asc bool) (files []*File, hasMore bool, err error) {
+	tx := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		tx = tx.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		cursor, err := GetUserFileByFileId(userId, after)
+		if err != nil {
+			return nil, false, err
+		}
+		if asc {
+			tx = tx.Where("id > ?", cursor.Id)
+		} else {
+			tx = tx.Where("id < ?", cursor.Id)
+		}
+	}
+	if asc {
+		tx = tx.Order("id asc")
+	} else {
+		tx = tx.Order("id desc")
+	}
+	err = tx.Limit(limit + 1).Find(&files).Error
+	if err != nil {
+		return nil, false, err
+	}
+	if len(files) > limit {
+		files = files[:limit]
+		hasMore = true
+	}
+	return files, hasMore, nil
+}
+
+// GetUserFileBytes 统计用户已占用的存储空间
+func GetUserFileBytes(userId int) (int64, error) {
+	var total int64
+	err := DB.Model(&File{}).Where("user_id = ?", userId).Select("COALESCE(SUM(bytes), 0)").Scan(&total).Error
+	return total, err
+}
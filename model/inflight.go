@@ -0,0 +1,86 @@
+package model
+
+import (
+	"context"
+	"one-api/common"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 进行中请求数的计数，开启 Redis 时多实例共享，供令牌和渠道的并发限制使用
+
+// Redis 中的计数超过该时间未更新时自动过期，避免实例异常退出后名额无法释放
+const inFlightExpiration = 10 * time.Minute
+
+var inFlightCounts = make(map[string]int)
+var inFlightLock sync.Mutex
+
+// acquireInFlight 占用一个并发名额，已达到 limit 时返回 false
+func acquireInFlight(key string, limit int) bool {
+	if common.RedisEnabled {
+		ctx := context.Background()
+		redisKey := "inFlight:" + key
+		count, err := common.RDB.Incr(ctx, redisKey).Result()
+		if err != nil {
+			common.SysError("failed to acquire in-flight slot: " + err.Error())
+			return true
+		}
+		common.RDB.Expire(ctx, redisKey, inFlightExpiration)
+		if count > int64(limit) {
+			common.RDB.Decr(ctx, redisKey)
+			return false
+		}
+		return true
+	}
+	inFlightLock.Lock()
+	defer inFlightLock.Unlock()
+	if inFlightCounts[key] >= limit {
+		return false
+	}
+	inFlightCounts[key]++
+	return true
+}
+
+// releaseInFlightScript 计数大于 0 时才减少，计数过期后结束的请求不会把计数减为负数
+const releaseInFlightScript = `
+	local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+	if current <= 0 then
+		redis.call('DEL', KEYS[1])
+		return 0
+	end
+	current = redis.call('DECR', KEYS[1])
+	redis.call('EXPIRE', KEYS[1], ARGV[1])
+	return current
+`
+
+func releaseInFlight(key string) {
+	if common.RedisEnabled {
+		err := common.RDB.Eval(context.Background(), releaseInFlightScript, []string{"inFlight:" + key}, int(inFlightExpiration.Seconds())).Err()
+		if err != nil {
+			common.SysError("failed to release in-flight slot: " + err.Error())
+		}
+		return
+	}
+	inFlightLock.Lock()
+	defer inFlightLock.Unlock()
+	if inFlightCounts[key] <= 1 {
+		delete(inFlightCounts, key)
+		return
+	}
+	inFlightCounts[key]--
+}
+
+func inFlightCount(key string) int {
+	if common.RedisEnabled {
+		value, err := common.RDB.Get(context.Background(), "inFlight:"+key).Result()
+		if err != nil {
+			return 0
+		}
+		count, _ := strconv.Atoi(value)
+		return max(count, 0)
+	}
+	inFlightLock.Lock()
+	defer inFlightLock.Unlock()
+	return inFlightCounts[key]
+}
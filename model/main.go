@@ -34,6 +34,15 @@ func createRootAccountIfNeed() error {
 			Quota:       100000000,
 		}
 		DB.Create(&rootUser)
+		// 初始额度由账本的期初余额记录，这里只补对应的批次
+		DB.Create(&RechargeRecord{
+			UserID:         uint(rootUser.Id),
+			Amount:         rootUser.Quota,
+			OriginalAmount: rootUser.Quota,
+			StartDate:      time.Now().Unix(),
+			EndDate:        -1,
+			Source:         QuotaLotSourceLegacy,
+		})
 	}
 	return nil
 }
@@ -140,10 +149,17 @@ func InitDB() (err error) {
 		if err != nil {
 			return err
 		}
+		needLotMigration := !db.Migrator().HasColumn(&RechargeRecord{}, "source")
 		err = db.AutoMigrate(&RechargeRecord{})
 		if err != nil {
 			return err
 		}
+		if needLotMigration {
+			err = migrateQuotaLots(db)
+			if err != nil {
+				return err
+			}
+		}
 		err = db.AutoMigrate(&WithdrawalOrder{})
 		if err != nil {
 			return err
@@ -156,6 +172,46 @@ func InitDB() (err error) {
 		if err != nil {
 			return err
 		}
+		err = db.AutoMigrate(&File{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&Batch{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&ChannelKey{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&QuotaLedger{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&Plan{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&Subscription{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&TopUpEvent{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&Organization{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&OrgMember{})
+		if err != nil {
+			return err
+		}
+		err = db.AutoMigrate(&OrgInvitation{})
+		if err != nil {
+			return err
+		}
 		common.SysLog("database migrated")
 		err = createRootAccountIfNeed()
 		return err
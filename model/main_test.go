@@ -0,0 +1,51 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"os"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestMain 使用内存中的 SQLite 数据库运行 model 包的测试
+func TestMain(m *testing.M) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		fmt.Println("failed to open test database: " + err.Error())
+		os.Exit(1)
+	}
+	DB = db
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	err = db.AutoMigrate(&User{}, &Token{}, &RechargeRecord{}, &QuotaLedger{}, &TopUp{}, &TopUpEvent{},
+		&Plan{}, &Subscription{}, &Organization{}, &OrgMember{}, &ChannelKey{})
+	if err != nil {
+		fmt.Println("failed to migrate test database: " + err.Error())
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// resetTestDB 清空测试用到的表
+func resetTestDB() {
+	for _, table := range []any{&User{}, &Token{}, &RechargeRecord{}, &QuotaLedger{}, &TopUp{}, &TopUpEvent{},
+		&Plan{}, &Subscription{}, &Organization{}, &OrgMember{}, &ChannelKey{}} {
+		DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(table)
+	}
+}
+
+func createTestUser(id int, quota int) {
+	DB.Create(&User{
+		Id:          id,
+		Username:    fmt.Sprintf("user%d", id),
+		Quota:       quota,
+		AccessToken: fmt.Sprintf("access-token-%d", id),
+		AffCode:     fmt.Sprintf("aff%d", id),
+	})
+}
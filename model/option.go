@@ -35,6 +35,27 @@ func InitOptionMap() {
 	config.OptionMap["TurnstileCheckEnabled"] = strconv.FormatBool(config.TurnstileCheckEnabled)
 	config.OptionMap["RegisterEnabled"] = strconv.FormatBool(config.RegisterEnabled)
 	config.OptionMap["AutomaticDisableChannelEnabled"] = strconv.FormatBool(config.AutomaticDisableChannelEnabled)
+	config.OptionMap["ChannelBreakerEnabled"] = strconv.FormatBool(config.ChannelBreakerEnabled)
+	config.OptionMap["ChannelBreakerWindow"] = strconv.Itoa(config.ChannelBreakerWindow)
+	config.OptionMap["ChannelBreakerMinRequests"] = strconv.Itoa(config.ChannelBreakerMinRequests)
+	config.OptionMap["ChannelBreakerErrorRate"] = strconv.FormatFloat(config.ChannelBreakerErrorRate, 'f', -1, 64)
+	config.OptionMap["ChannelBreakerCooldown"] = strconv.Itoa(config.ChannelBreakerCooldown)
+	config.OptionMap["ChannelBreakerMaxCooldown"] = strconv.Itoa(config.ChannelBreakerMaxCooldown)
+	config.OptionMap["ChannelQueueEnabled"] = strconv.FormatBool(config.ChannelQueueEnabled)
+	config.OptionMap["ChannelQueueMaxSize"] = strconv.Itoa(config.ChannelQueueMaxSize)
+	config.OptionMap["ChannelQueueMaxWait"] = strconv.Itoa(config.ChannelQueueMaxWait)
+	config.OptionMap["StreamFirstTokenTimeout"] = strconv.Itoa(config.StreamFirstTokenTimeout)
+	config.OptionMap["StreamIdleTimeout"] = strconv.Itoa(config.StreamIdleTimeout)
+	config.OptionMap["StickyRoutingEnabled"] = strconv.FormatBool(config.StickyRoutingEnabled)
+	config.OptionMap["OrgChannelEnabled"] = strconv.FormatBool(config.OrgChannelEnabled)
+	config.OptionMap["StickyRoutingTTL"] = strconv.Itoa(config.StickyRoutingTTL)
+	config.OptionMap["LedgerReconcileInterval"] = strconv.Itoa(config.LedgerReconcileInterval)
+	config.OptionMap["TopUpReconcileInterval"] = strconv.Itoa(config.TopUpReconcileInterval)
+	config.OptionMap["PromoQuotaValidDays"] = strconv.Itoa(config.PromoQuotaValidDays)
+	config.OptionMap["QuotaExpiryNotifyDays"] = strconv.Itoa(config.QuotaExpiryNotifyDays)
+	config.OptionMap["ModelHedgeDelay"] = common.ModelHedgeDelay2JSONString()
+	config.OptionMap["VirtualModels"] = common.VirtualModels2JSONString()
+	config.OptionMap["GroupQueuePriority"] = common.GroupQueuePriority2JSONString()
 	config.OptionMap["LogConsumeEnabled"] = strconv.FormatBool(config.LogConsumeEnabled)
 	config.OptionMap["DisplayInCurrencyEnabled"] = strconv.FormatBool(config.DisplayInCurrencyEnabled)
 	config.OptionMap["DisplayTokenStatEnabled"] = strconv.FormatBool(config.DisplayTokenStatEnabled)
@@ -54,7 +75,7 @@ func InitOptionMap() {
 	config.OptionMap["Notice"] = ""
 	config.OptionMap["About"] = ""
 	config.OptionMap["Faqs"] = ""
-	config.OptionMap["GroupModelLimits"] = ""
+	config.OptionMap["GroupModelLimits"] = common.GroupModelLimits2JSONString()
 	config.OptionMap["Models"] = ""
 	config.OptionMap["PerUseData"] = ""
 	config.OptionMap["PricingData"] = ""
@@ -67,6 +88,9 @@ func InitOptionMap() {
 	config.OptionMap["PayAddress"] = ""
 	config.OptionMap["EpayId"] = ""
 	config.OptionMap["EpayKey"] = ""
+	config.OptionMap["StripeApiSecret"] = ""
+	config.OptionMap["StripeWebhookSecret"] = ""
+	config.OptionMap["PaymentCurrencies"] = common.PaymentCurrencies2JSONString()
 	config.OptionMap["Price"] = strconv.FormatFloat(config.Price, 'f', -1, 64)
 	config.OptionMap["TopupGroupRatio"] = common.TopupGroupRatio2JSONString()
 	config.OptionMap["TopupRatio"] = common.TopupRatioJSONString()
@@ -89,6 +113,14 @@ func InitOptionMap() {
 	config.OptionMap["ModelPrice"] = common.ModelRatio2JSONString()
 	config.OptionMap["GroupRatio"] = common.GroupRatio2JSONString()
 	config.OptionMap["CompletionRatio"] = common.CompletionRatio2JSONString()
+	config.OptionMap["CacheRatio"] = common.CacheRatio2JSONString()
+	config.OptionMap["CacheCreationRatio"] = common.CacheCreationRatio2JSONString()
+	config.OptionMap["ReasoningRatio"] = common.ReasoningRatio2JSONString()
+	config.OptionMap["ImageInputRatio"] = common.ImageInputRatio2JSONString()
+	config.OptionMap["AudioRatio"] = common.AudioRatio2JSONString()
+	config.OptionMap["AudioCompletionRatio"] = common.AudioCompletionRatio2JSONString()
+	config.OptionMap["ModelContextTiers"] = common.ModelContextTiers2JSONString()
+	config.OptionMap["ChannelStrategy"] = common.ChannelStrategy2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
@@ -113,6 +145,10 @@ func InitOptionMap() {
 	config.OptionMap["ProporTions"] = strconv.Itoa(config.ProporTions)
 	config.OptionMap["RedempTionCount"] = strconv.Itoa(config.RedempTionCount)
 	config.OptionMap["OutProxyUrl"] = ""
+	config.OptionMap["FileMaxSize"] = strconv.Itoa(config.FileMaxSize)
+	config.OptionMap["FileStorageLimit"] = strconv.Itoa(config.FileStorageLimit)
+	config.OptionMap["BatchConcurrency"] = strconv.Itoa(config.BatchConcurrency)
+	config.OptionMap["BatchDiscountRatio"] = strconv.FormatFloat(config.BatchDiscountRatio, 'f', -1, 64)
 	config.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
 }
@@ -192,6 +228,14 @@ func updateOptionMap(key string, value string) (err error) {
 			config.EmailDomainRestrictionEnabled = boolValue
 		case "AutomaticDisableChannelEnabled":
 			config.AutomaticDisableChannelEnabled = boolValue
+		case "ChannelBreakerEnabled":
+			config.ChannelBreakerEnabled = boolValue
+		case "ChannelQueueEnabled":
+			config.ChannelQueueEnabled = boolValue
+		case "StickyRoutingEnabled":
+			config.StickyRoutingEnabled = boolValue
+		case "OrgChannelEnabled":
+			config.OrgChannelEnabled = boolValue
 		case "LogConsumeEnabled":
 			config.LogConsumeEnabled = boolValue
 		case "DisplayInCurrencyEnabled":
@@ -255,6 +299,12 @@ func updateOptionMap(key string, value string) (err error) {
 		config.EpayId = value
 	case "EpayKey":
 		config.EpayKey = value
+	case "StripeApiSecret":
+		config.StripeApiSecret = value
+	case "StripeWebhookSecret":
+		config.StripeWebhookSecret = value
+	case "PaymentCurrencies":
+		err = common.UpdatePaymentCurrenciesByJSONString(value)
 	case "Price":
 		config.Price, _ = strconv.ParseFloat(value, 64)
 	case "MiniQuota":
@@ -305,6 +355,48 @@ func updateOptionMap(key string, value string) (err error) {
 		config.ProporTions, _ = strconv.Atoi(value)
 	case "RedempTionCount":
 		config.RedempTionCount, _ = strconv.Atoi(value)
+	case "FileMaxSize":
+		config.FileMaxSize, _ = strconv.Atoi(value)
+	case "FileStorageLimit":
+		config.FileStorageLimit, _ = strconv.Atoi(value)
+	case "BatchConcurrency":
+		config.BatchConcurrency, _ = strconv.Atoi(value)
+	case "BatchDiscountRatio":
+		config.BatchDiscountRatio, _ = strconv.ParseFloat(value, 64)
+	case "ChannelBreakerWindow":
+		config.ChannelBreakerWindow, _ = strconv.Atoi(value)
+	case "ChannelBreakerMinRequests":
+		config.ChannelBreakerMinRequests, _ = strconv.Atoi(value)
+	case "ChannelBreakerErrorRate":
+		config.ChannelBreakerErrorRate, _ = strconv.ParseFloat(value, 64)
+	case "ChannelBreakerCooldown":
+		config.ChannelBreakerCooldown, _ = strconv.Atoi(value)
+	case "ChannelBreakerMaxCooldown":
+		config.ChannelBreakerMaxCooldown, _ = strconv.Atoi(value)
+	case "ChannelQueueMaxSize":
+		config.ChannelQueueMaxSize, _ = strconv.Atoi(value)
+	case "ChannelQueueMaxWait":
+		config.ChannelQueueMaxWait, _ = strconv.Atoi(value)
+	case "StreamFirstTokenTimeout":
+		config.StreamFirstTokenTimeout, _ = strconv.Atoi(value)
+	case "StreamIdleTimeout":
+		config.StreamIdleTimeout, _ = strconv.Atoi(value)
+	case "StickyRoutingTTL":
+		config.StickyRoutingTTL, _ = strconv.Atoi(value)
+	case "LedgerReconcileInterval":
+		config.LedgerReconcileInterval, _ = strconv.Atoi(value)
+	case "TopUpReconcileInterval":
+		config.TopUpReconcileInterval, _ = strconv.Atoi(value)
+	case "PromoQuotaValidDays":
+		config.PromoQuotaValidDays, _ = strconv.Atoi(value)
+	case "QuotaExpiryNotifyDays":
+		config.QuotaExpiryNotifyDays, _ = strconv.Atoi(value)
+	case "GroupQueuePriority":
+		err = common.UpdateGroupQueuePriorityByJSONString(value)
+	case "ModelHedgeDelay":
+		err = common.UpdateModelHedgeDelayByJSONString(value)
+	case "VirtualModels":
+		err = common.UpdateVirtualModelsByJSONString(value)
 	case "ModelRatio":
 		err = common.UpdateModelRatioByJSONString(value)
 	case "ModelPrice":
@@ -313,6 +405,24 @@ func updateOptionMap(key string, value string) (err error) {
 		err = common.UpdateGroupRatioByJSONString(value)
 	case "CompletionRatio":
 		err = common.UpdateCompletionRatioByJSONString(value)
+	case "CacheRatio":
+		err = common.UpdateCacheRatioByJSONString(value)
+	case "CacheCreationRatio":
+		err = common.UpdateCacheCreationRatioByJSONString(value)
+	case "ReasoningRatio":
+		err = common.UpdateReasoningRatioByJSONString(value)
+	case "ImageInputRatio":
+		err = common.UpdateImageInputRatioByJSONString(value)
+	case "AudioRatio":
+		err = common.UpdateAudioRatioByJSONString(value)
+	case "AudioCompletionRatio":
+		err = common.UpdateAudioCompletionRatioByJSONString(value)
+	case "ModelContextTiers":
+		err = common.UpdateModelContextTiersByJSONString(value)
+	case "ChannelStrategy":
+		err = common.UpdateChannelStrategyByJSONString(value)
+	case "GroupModelLimits":
+		err = common.UpdateGroupModelLimitsByJSONString(value)
 	case "GroupUserRatio":
 		err = common.UpdateGroupUserRatioByJSONString(value)
 	case "TopUpLink":
@@ -0,0 +1,547 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 组织：成员共用组织的额度池，组织的令牌和渠道只有成员可见。
+// 组织令牌的 UserId 为创建令牌的成员，请求的费用从组织额度池扣除，并计入该成员的本月用量；
+// 组织渠道的分组固定为 OrgChannelGroup，只有组织令牌的请求会选到
+
+const (
+	OrgRoleOwner     = "owner"
+	OrgRoleAdmin     = "admin"
+	OrgRoleDeveloper = "developer"
+	OrgRoleBilling   = "billing"
+)
+
+const (
+	OrgStatusEnabled  = 1
+	OrgStatusDisabled = 2
+)
+
+const (
+	OrgInvitationStatusPending  = "pending"
+	OrgInvitationStatusAccepted = "accepted"
+	OrgInvitationStatusRevoked  = "revoked"
+)
+
+// 组织内的权限
+const (
+	OrgPermissionManageMembers  = "manage_members"
+	OrgPermissionManageChannels = "manage_channels"
+	OrgPermissionManageTokens   = "manage_tokens" // 管理所有成员的组织令牌
+	OrgPermissionUseTokens      = "use_tokens"    // 创建和使用自己的组织令牌
+	OrgPermissionManageBilling  = "manage_billing"
+)
+
+var orgRolePermissions = map[string][]string{
+	OrgRoleOwner:     {OrgPermissionManageMembers, OrgPermissionManageChannels, OrgPermissionManageTokens, OrgPermissionUseTokens, OrgPermissionManageBilling},
+	OrgRoleAdmin:     {OrgPermissionManageMembers, OrgPermissionManageChannels, OrgPermissionManageTokens, OrgPermissionUseTokens, OrgPermissionManageBilling},
+	OrgRoleDeveloper: {OrgPermissionUseTokens},
+	OrgRoleBilling:   {OrgPermissionManageBilling},
+}
+
+// 组织邀请的有效期
+const orgInvitationValidity = 7 * 24 * time.Hour
+
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);index"`
+	OwnerId     int    `json:"owner_id" gorm:"index"`
+	Quota       int    `json:"quota" gorm:"default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"default:0"`
+	Status      int    `json:"status" gorm:"default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+}
+
+type OrgMember struct {
+	Id     int    `json:"id"`
+	OrgId  int    `json:"org_id" gorm:"uniqueIndex:idx_org_member"`
+	UserId int    `json:"user_id" gorm:"uniqueIndex:idx_org_member;index"`
+	Role   string `json:"role" gorm:"type:varchar(16)"`
+	// 成员每月可以消费组织额度的上限，0 表示不限制
+	MonthlyQuotaLimit int    `json:"monthly_quota_limit" gorm:"default:0"`
+	MonthlyUsedQuota  int    `json:"monthly_used_quota" gorm:"default:0"`
+	UsedQuota         int    `json:"used_quota" gorm:"default:0"`
+	QuotaPeriodTime   int64  `json:"quota_period_time" gorm:"bigint;default:0"` // 本月用量最后更新的时间
+	CreatedTime       int64  `json:"created_time" gorm:"bigint"`
+	Username          string `json:"username" gorm:"-:all"`
+}
+
+type OrgInvitation struct {
+	Id             int    `json:"id"`
+	OrgId          int    `json:"org_id" gorm:"index"`
+	Code           string `json:"code" gorm:"type:varchar(32);uniqueIndex"`
+	Email          string `json:"email" gorm:"type:varchar(255)"` // 为空时任何人都可以使用邀请码加入
+	Role           string `json:"role" gorm:"type:varchar(16)"`
+	InviterId      int    `json:"inviter_id"`
+	Status         string `json:"status" gorm:"type:varchar(16)"`
+	AcceptedUserId int    `json:"accepted_user_id" gorm:"default:0"`
+	ExpiredTime    int64  `json:"expired_time" gorm:"bigint"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+}
+
+// OrgChannelGroup 组织渠道使用的分组
+func OrgChannelGroup(orgId int) string {
+	return fmt.Sprintf("org_%d", orgId)
+}
+
+// IsOrgChannelGroup 判断分组是否为组织渠道的分组
+func IsOrgChannelGroup(group string) bool {
+	return strings.HasPrefix(group, "org_")
+}
+
+func IsValidOrgRole(role string) bool {
+	_, ok := orgRolePermissions[role]
+	return ok
+}
+
+func (member *OrgMember) Can(permission string) bool {
+	for _, p := range orgRolePermissions[member.Role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateOrganization 创建组织，创建者成为所有者
+func CreateOrganization(name string, ownerId int) (*Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("组织名称不能为空")
+	}
+	now := common.GetTimestamp()
+	org := &Organization{Name: name, OwnerId: ownerId, Status: OrgStatusEnabled, CreatedTime: now}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrgMember{OrgId: org.Id, UserId: ownerId, Role: OrgRoleOwner, CreatedTime: now}).Error
+	})
+	return org, err
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	var org Organization
+	err := DB.First(&org, "id = ?", id).Error
+	return &org, err
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, err error) {
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, err
+}
+
+// UserOrganization 用户所在的组织和用户在组织中的角色
+type UserOrganization struct {
+	Organization
+	Role string `json:"role"`
+}
+
+func GetUserOrganizations(userId int) (orgs []*UserOrganization, err error) {
+	err = DB.Table("organizations").Select("organizations.*, org_members.role").
+		Joins("JOIN org_members ON org_members.org_id = organizations.id").
+		Where("org_members.user_id = ?", userId).Order("organizations.id desc").Scan(&orgs).Error
+	return orgs, err
+}
+
+func (org *Organization) UpdateName(name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("组织名称不能为空")
+	}
+	org.Name = name
+	return DB.Model(org).Update("name", name).Error
+}
+
+func UpdateOrganizationStatus(id int, status int) error {
+	return DB.Model(&Organization{}).Where("id = ?", id).Update("status", status).Error
+}
+
+// GetOrgMember 获取用户在启用的组织中的成员身份
+func GetOrgMember(orgId int, userId int) (*OrgMember, error) {
+	var member OrgMember
+	err := DB.Table("org_members").Select("org_members.*").
+		Joins("JOIN organizations ON organizations.id = org_members.org_id").
+		Where("org_members.org_id = ? AND org_members.user_id = ? AND organizations.status = ?", orgId, userId, OrgStatusEnabled).
+		Take(&member).Error
+	if err != nil {
+		return nil, errors.New("不是该组织的成员或组织已被禁用")
+	}
+	return &member, nil
+}
+
+func GetOrgMembers(orgId int) (members []*OrgMember, err error) {
+	err = DB.Where("org_id = ?", orgId).Order("id asc").Find(&members).Error
+	if err != nil || len(members) == 0 {
+		return members, err
+	}
+	userIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserId)
+	}
+	var users []User
+	err = DB.Select("id", "username").Where("id IN ?", userIds).Find(&users).Error
+	if err != nil {
+		return members, err
+	}
+	usernames := make(map[int]string, len(users))
+	for _, user := range users {
+		usernames[user.Id] = user.Username
+	}
+	now := time.Now()
+	for _, member := range members {
+		member.Username = usernames[member.UserId]
+		member.MonthlyUsedQuota = member.monthlyUsedQuota(now)
+	}
+	return members, nil
+}
+
+// UpdateOrgMember 修改成员的角色和每月消费上限，所有者的角色不能修改
+func UpdateOrgMember(orgId int, userId int, role string, monthlyQuotaLimit int) error {
+	if !IsValidOrgRole(role) || role == OrgRoleOwner {
+		return errors.New("无效的角色")
+	}
+	if monthlyQuotaLimit < 0 {
+		return errors.New("消费上限不能为负数")
+	}
+	member, err := GetOrgMember(orgId, userId)
+	if err != nil {
+		return err
+	}
+	if member.Role == OrgRoleOwner {
+		role = OrgRoleOwner
+	}
+	return DB.Model(&OrgMember{}).Where("id = ?", member.Id).
+		Updates(map[string]interface{}{"role": role, "monthly_quota_limit": monthlyQuotaLimit}).Error
+}
+
+// RemoveOrgMember 移除成员，同时禁用该成员创建的组织令牌
+func RemoveOrgMember(orgId int, userId int) error {
+	member, err := GetOrgMember(orgId, userId)
+	if err != nil {
+		return err
+	}
+	if member.Role == OrgRoleOwner {
+		return errors.New("不能移除组织的所有者")
+	}
+	var tokens []Token
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("org_id = ? AND user_id = ?", orgId, userId).Find(&tokens).Error; err != nil {
+			return err
+		}
+		err := tx.Model(&Token{}).Where("org_id = ? AND user_id = ?", orgId, userId).Update("status", common.TokenStatusDisabled).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&OrgMember{}, member.Id).Error
+	})
+	if err == nil && common.RedisEnabled {
+		for _, token := range tokens {
+			_ = common.RedisDel(fmt.Sprintf("token:%s", token.Key))
+		}
+	}
+	return err
+}
+
+// CreateOrgInvitation 生成邀请码，email 不为空时只有该邮箱的用户可以接受
+func CreateOrgInvitation(orgId int, inviterId int, email string, role string) (*OrgInvitation, error) {
+	if !IsValidOrgRole(role) || role == OrgRoleOwner {
+		return nil, errors.New("无效的角色")
+	}
+	now := time.Now()
+	invitation := &OrgInvitation{
+		OrgId:       orgId,
+		Code:        common.GetUUID(),
+		Email:       strings.TrimSpace(email),
+		Role:        role,
+		InviterId:   inviterId,
+		Status:      OrgInvitationStatusPending,
+		ExpiredTime: now.Add(orgInvitationValidity).Unix(),
+		CreatedTime: now.Unix(),
+	}
+	return invitation, DB.Create(invitation).Error
+}
+
+func GetOrgInvitations(orgId int) (invitations []*OrgInvitation, err error) {
+	err = DB.Where("org_id = ?", orgId).Order("id desc").Find(&invitations).Error
+	return invitations, err
+}
+
+func RevokeOrgInvitation(orgId int, id int) error {
+	result := DB.Model(&OrgInvitation{}).Where("id = ? AND org_id = ? AND status = ?", id, orgId, OrgInvitationStatusPending).
+		Update("status", OrgInvitationStatusRevoked)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("邀请不存在或已经处理")
+	}
+	return nil
+}
+
+// AcceptOrgInvitation 使用邀请码加入组织
+func AcceptOrgInvitation(code string, userId int) (*OrgInvitation, error) {
+	var invitation OrgInvitation
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", code).First(&invitation).Error
+		if err != nil {
+			return errors.New("无效的邀请码")
+		}
+		if invitation.Status != OrgInvitationStatusPending || invitation.ExpiredTime < common.GetTimestamp() {
+			return errors.New("邀请码已失效")
+		}
+		if invitation.Email != "" {
+			email, err := GetUserEmail(userId)
+			if err != nil || !strings.EqualFold(email, invitation.Email) {
+				return errors.New("该邀请只能由受邀邮箱的用户接受")
+			}
+		}
+		var count int64
+		tx.Model(&OrgMember{}).Where("org_id = ? AND user_id = ?", invitation.OrgId, userId).Count(&count)
+		if count > 0 {
+			return errors.New("已经是该组织的成员")
+		}
+		err = tx.Create(&OrgMember{OrgId: invitation.OrgId, UserId: userId, Role: invitation.Role, CreatedTime: common.GetTimestamp()}).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&OrgInvitation{}).Where("id = ? AND status = ?", invitation.Id, OrgInvitationStatusPending).
+			Updates(map[string]interface{}{"status": OrgInvitationStatusAccepted, "accepted_user_id": userId})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("邀请码已失效")
+		}
+		invitation.Status = OrgInvitationStatusAccepted
+		invitation.AcceptedUserId = userId
+		return nil
+	})
+	return &invitation, err
+}
+
+// DepositOrgQuota 成员把自己的余额转入组织额度池
+func DepositOrgQuota(orgId int, userId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("转入额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "quota").Where("id = ?", userId).First(&user).Error; err != nil {
+			return err
+		}
+		if user.Quota < quota {
+			return errors.New("余额不足")
+		}
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("余额不足")
+		}
+		if _, err := debitQuotaLots(tx, userId, quota); err != nil {
+			return err
+		}
+		if err := tx.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", quota)).Error; err != nil {
+			return err
+		}
+		return recordLedger(tx, LedgerTypeOrgTransfer, userId, fmt.Sprintf("org:%d", orgId), "转入组织额度池",
+			userLegs(userId, LedgerAccountOrg, orgId, -quota)...)
+	})
+	if err == nil && common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_quota:%d", userId))
+	}
+	return err
+}
+
+// AdjustOrgQuota 管理员调整组织额度池
+func AdjustOrgQuota(orgId int, delta int, operatorId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Organization{}).Where("id = ?", orgId).Update("quota", gorm.Expr("quota + ?", delta))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("组织不存在")
+		}
+		return recordLedger(tx, LedgerTypeAdjust, operatorId, fmt.Sprintf("org:%d", orgId), "修改组织额度",
+			ledgerLeg{account: LedgerAccountOrg, accountId: orgId, amount: delta},
+			ledgerLeg{account: LedgerAccountIssuance, amount: -delta})
+	})
+}
+
+// monthlyUsedQuota 本月的用量，上次更新早于本月时视为已重置
+func (member *OrgMember) monthlyUsedQuota(now time.Time) int {
+	_, _, monthStart := tokenPeriodStarts(now)
+	if member.QuotaPeriodTime >= monthStart {
+		return member.MonthlyUsedQuota
+	}
+	return 0
+}
+
+// updateOrgMemberUsedQuota 累加成员的用量，跨月时先清零本月用量，
+// 是否跨月在同一条 UPDATE 中判断，并发更新不会互相覆盖
+func updateOrgMemberUsedQuota(orgId int, userId int, quota int) error {
+	now := time.Now()
+	_, _, monthStart := tokenPeriodStarts(now)
+	// gorm 按列名排序生成 SET，monthly_used_quota 在 quota_period_time 之前赋值，
+	// MySQL 按顺序赋值时 CASE 读到的仍是更新前的 quota_period_time
+	result := DB.Model(&OrgMember{}).Where("org_id = ? AND user_id = ?", orgId, userId).Updates(map[string]interface{}{
+		"monthly_used_quota": gorm.Expr("CASE WHEN quota_period_time >= ? THEN monthly_used_quota + ? ELSE ? END", monthStart, quota, max(quota, 0)),
+		"quota_period_time":  now.Unix(),
+		"used_quota":         gorm.Expr("used_quota + ?", quota),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// changeOrgQuota 从组织额度池扣除 quota，quota 为负数时退还
+func changeOrgQuota(orgId int, userId int, quota int) error {
+	err := DB.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+		"quota":      gorm.Expr("quota - ?", quota),
+		"used_quota": gorm.Expr("used_quota + ?", quota),
+	}).Error
+	if err != nil {
+		return err
+	}
+	return updateOrgMemberUsedQuota(orgId, userId, quota)
+}
+
+// getOrgPayerQuota 成员可以使用的组织额度，取额度池余额与成员本月剩余消费上限中的较小值
+func getOrgPayerQuota(orgId int, userId int) (int, error) {
+	var org Organization
+	if err := DB.Select("id", "quota", "status").First(&org, "id = ?", orgId).Error; err != nil {
+		return 0, err
+	}
+	if org.Status != OrgStatusEnabled {
+		return 0, errors.New("组织已被禁用")
+	}
+	var member OrgMember
+	if err := DB.Where("org_id = ? AND user_id = ?", orgId, userId).First(&member).Error; err != nil {
+		return 0, errors.New("不是该组织的成员")
+	}
+	quota := org.Quota
+	if member.MonthlyQuotaLimit > 0 {
+		quota = min(quota, member.MonthlyQuotaLimit-member.monthlyUsedQuota(time.Now()))
+	}
+	return quota, nil
+}
+
+// GetPayerQuota 请求可以使用的额度，组织令牌使用组织的额度池
+func GetPayerQuota(userId int, orgId int) (int, error) {
+	if orgId == 0 {
+		return GetUserQuota(userId)
+	}
+	return getOrgPayerQuota(orgId, userId)
+}
+
+// CacheGetPayerQuota 同 GetPayerQuota，个人额度优先读取缓存
+func CacheGetPayerQuota(ctx context.Context, userId int, orgId int) (int, error) {
+	if orgId == 0 {
+		return CacheGetUserQuota(ctx, userId)
+	}
+	return getOrgPayerQuota(orgId, userId)
+}
+
+// CacheDecreasePayerQuota 扣减缓存的个人额度，组织额度没有缓存
+func CacheDecreasePayerQuota(ctx context.Context, userId int, orgId int, quota int) error {
+	if orgId != 0 {
+		return nil
+	}
+	return CacheDecreaseUserQuota(ctx, userId, quota)
+}
+
+// payerAccount 请求费用在账本中的账户
+func (token *Token) payerAccount() (string, int) {
+	if token.OrgId != 0 {
+		return LedgerAccountOrg, token.OrgId
+	}
+	return LedgerAccountUser, token.UserId
+}
+
+// changePayerQuota 从令牌对应的余额扣除 quota，quota 为负数时退还
+func changePayerQuota(token *Token, quota int) error {
+	if token.OrgId != 0 {
+		return changeOrgQuota(token.OrgId, token.UserId, quota)
+	}
+	if quota > 0 {
+		return DecreaseUserQuota(token.UserId, quota)
+	}
+	return IncreaseUserQuota(token.UserId, -quota)
+}
+
+// CheckOrgTokenAccess 组织令牌只有在组织启用且创建者仍是成员时可用
+func CheckOrgTokenAccess(token *Token) error {
+	if token.OrgId == 0 {
+		return nil
+	}
+	member, err := GetOrgMember(token.OrgId, token.UserId)
+	if err != nil {
+		return err
+	}
+	if !member.Can(OrgPermissionUseTokens) {
+		return errors.New("当前角色不能使用组织令牌")
+	}
+	return nil
+}
+
+func GetOrgTokens(orgId int, userId int, startIdx int, num int) (tokens []*Token, err error) {
+	tx := DB.Where("org_id = ?", orgId)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	return tokens, err
+}
+
+func GetOrgChannels(orgId int) (channels []*Channel, err error) {
+	err = DB.Omit("key").Where("org_id = ?", orgId).Order("id desc").Find(&channels).Error
+	return channels, err
+}
+
+func GetOrgChannel(orgId int, id int) (*Channel, error) {
+	var channel Channel
+	err := DB.Where("id = ? AND org_id = ?", id, orgId).First(&channel).Error
+	if err != nil {
+		return nil, errors.New("渠道不存在")
+	}
+	return &channel, nil
+}
+
+// UpdateOrgChannel 只更新 columns 中的字段，组织渠道不能修改分组等其他字段
+func UpdateOrgChannel(channel *Channel, columns []string) error {
+	err := DB.Model(&Channel{}).Where("id = ? AND org_id = ?", channel.Id, channel.OrgId).Select(columns).Updates(channel).Error
+	if err != nil {
+		return err
+	}
+	if err := DB.First(channel, "id = ?", channel.Id).Error; err != nil {
+		return err
+	}
+	return channel.UpdateAbilities()
+}
+
+func GetOrgTokenById(orgId int, id int) (*Token, error) {
+	var token Token
+	err := DB.Where("id = ? AND org_id = ?", id, orgId).First(&token).Error
+	if err != nil {
+		return nil, errors.New("令牌不存在")
+	}
+	return &token, nil
+}
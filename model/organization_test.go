@@ -0,0 +1,43 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestUpdateOrgMemberUsedQuota(t *testing.T) {
+	_, _, monthStart := tokenPeriodStarts(time.Now())
+	cases := []struct {
+		name            string
+		periodTime      int64
+		monthlyUsed     int
+		quota           int
+		expectedMonthly int
+	}{
+		{"same month accumulates", monthStart + 1, 100, 50, 150},
+		{"same month refund subtracts", monthStart + 1, 100, -30, 70},
+		{"previous month resets", monthStart - 1, 100, 50, 50},
+		{"refund after reset does not go negative", monthStart - 1, 100, -30, 0},
+	}
+	Convey("updateOrgMemberUsedQuota", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				resetTestDB()
+				DB.Create(&OrgMember{OrgId: 1, UserId: 1, MonthlyUsedQuota: c.monthlyUsed, UsedQuota: 500, QuotaPeriodTime: c.periodTime})
+				So(updateOrgMemberUsedQuota(1, 1, c.quota), ShouldBeNil)
+				var member OrgMember
+				DB.Where("org_id = ? AND user_id = ?", 1, 1).First(&member)
+				So(member.MonthlyUsedQuota, ShouldEqual, c.expectedMonthly)
+				So(member.UsedQuota, ShouldEqual, 500+c.quota)
+				So(member.QuotaPeriodTime, ShouldBeGreaterThanOrEqualTo, monthStart)
+			})
+		}
+		Convey("missing member", func() {
+			resetTestDB()
+			So(updateOrgMemberUsedQuota(1, 1, 10), ShouldEqual, gorm.ErrRecordNotFound)
+		})
+	})
+}
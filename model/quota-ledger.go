@@ -0,0 +1,455 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/common/config"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 额度账本：每次额度变动记为一笔复式记账的交易，交易由若干条分录组成，同一笔交易的分录金额合计为 0。
+// 用户余额等于 user 账户的分录合计，令牌剩余额度等于 token 账户的分录合计，
+// 分录写入后不再修改，对账任务据此检查 User.Quota、Token.RemainQuota 和 Redis 缓存是否偏离
+
+const (
+	LedgerTypeOpening      = "opening"      // 启用账本时的期初余额
+	LedgerTypeHold         = "hold"         // 预扣费
+	LedgerTypeConsume      = "consume"      // 实际消费，同时结清预扣费
+	LedgerTypeRefund       = "refund"       // 退还预扣费或失败任务的费用
+	LedgerTypeTopUp        = "topup"        // 在线充值
+	LedgerTypeTopUpRefund  = "topup_refund" // 充值订单退款扣回额度
+	LedgerTypeRedemption   = "redemption"   // 兑换码
+	LedgerTypeAdjust       = "adjust"       // 管理员调整用户额度或令牌额度
+	LedgerTypeAffiliate    = "affiliate"    // 邀请奖励
+	LedgerTypeGift         = "gift"         // 新用户赠送
+	LedgerTypeExpire       = "expire"       // 充值额度过期
+	LedgerTypeSubscription = "subscription" // 订阅套餐每个周期发放的额度
+	LedgerTypeOrgTransfer  = "org_transfer" // 成员转入组织额度池
+)
+
+const (
+	LedgerAccountUser       = "user"        // 用户余额，account_id 为用户 id
+	LedgerAccountToken      = "token"       // 令牌剩余额度，account_id 为令牌 id
+	LedgerAccountHold       = "hold"        // 用户被预扣、尚未结算的额度，account_id 为用户 id
+	LedgerAccountRevenue    = "revenue"     // 已消费的额度
+	LedgerAccountIssuance   = "issuance"    // 充值、兑换、赠送和管理员调整发放的额度
+	LedgerAccountAffiliate  = "affiliate"   // 邀请奖励转入的额度，account_id 为用户 id
+	LedgerAccountTokenGrant = "token_grant" // 分配给令牌的额度
+	LedgerAccountOrg        = "org"         // 组织额度池，account_id 为组织 id
+)
+
+type QuotaLedger struct {
+	Id            int    `json:"id"`
+	TransactionId string `json:"transaction_id" gorm:"type:varchar(64);index"`
+	Type          string `json:"type" gorm:"type:varchar(32);index"`
+	Account       string `json:"account" gorm:"type:varchar(32);index:idx_ledger_account,priority:1"`
+	AccountId     int    `json:"account_id" gorm:"index:idx_ledger_account,priority:2"`
+	Amount        int    `json:"amount"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	Reference     string `json:"reference" gorm:"type:varchar(128);index"`
+	Remark        string `json:"remark"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+type ledgerLeg struct {
+	account   string
+	accountId int
+	amount    int
+}
+
+// userLegs 用户与对方账户之间的一笔转账，amount 为用户余额的变化量
+func userLegs(userId int, counterAccount string, counterId int, amount int) []ledgerLeg {
+	return []ledgerLeg{
+		{account: LedgerAccountUser, accountId: userId, amount: amount},
+		{account: counterAccount, accountId: counterId, amount: -amount},
+	}
+}
+
+// tokenLegs 令牌剩余额度的变化，无限额度的令牌不扣减剩余额度，调用方自行判断
+func tokenLegs(tokenId int, amount int) []ledgerLeg {
+	return []ledgerLeg{
+		{account: LedgerAccountToken, accountId: tokenId, amount: amount},
+		{account: LedgerAccountTokenGrant, amount: -amount},
+	}
+}
+
+// settleLegs 结算请求费用：结清 held 的预扣费，再从付费账户扣除差额 delta，退还预扣费时 delta 为 -held
+func settleLegs(token *Token, held int, delta int) []ledgerLeg {
+	payer, payerId := token.payerAccount()
+	legs := []ledgerLeg{
+		{account: LedgerAccountHold, accountId: token.UserId, amount: -held},
+		{account: payer, accountId: payerId, amount: -delta},
+		{account: LedgerAccountRevenue, amount: held + delta},
+	}
+	if !token.UnlimitedQuota {
+		legs = append(legs, tokenLegs(token.Id, -delta)...)
+	}
+	return legs
+}
+
+// recordLedger 写入一笔交易，tx 为空时使用 DB
+func recordLedger(tx *gorm.DB, entryType string, userId int, reference string, remark string, legs ...ledgerLeg) error {
+	sum := 0
+	entries := make([]QuotaLedger, 0, len(legs))
+	transactionId := common.GetUUID()
+	now := common.GetTimestamp()
+	for _, leg := range legs {
+		if leg.amount == 0 {
+			continue
+		}
+		sum += leg.amount
+		entries = append(entries, QuotaLedger{
+			TransactionId: transactionId,
+			Type:          entryType,
+			Account:       leg.account,
+			AccountId:     leg.accountId,
+			Amount:        leg.amount,
+			UserId:        userId,
+			Reference:     reference,
+			Remark:        remark,
+			CreatedAt:     now,
+		})
+	}
+	if sum != 0 {
+		return fmt.Errorf("unbalanced ledger transaction %s: %d", entryType, sum)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if tx == nil {
+		tx = DB
+	}
+	return tx.Create(&entries).Error
+}
+
+// logLedger 额度已经变动后补记账本，写入失败只记录错误，由对账任务发现偏差
+func logLedger(entryType string, userId int, reference string, remark string, legs ...ledgerLeg) {
+	if err := recordLedger(nil, entryType, userId, reference, remark, legs...); err != nil {
+		common.SysError(fmt.Sprintf("failed to record %s ledger for user %d: %s", entryType, userId, err.Error()))
+	}
+}
+
+var ledgerCounterAccounts = map[string]string{
+	LedgerTypeTopUp:        LedgerAccountIssuance,
+	LedgerTypeTopUpRefund:  LedgerAccountIssuance,
+	LedgerTypeRedemption:   LedgerAccountIssuance,
+	LedgerTypeAdjust:       LedgerAccountIssuance,
+	LedgerTypeGift:         LedgerAccountIssuance,
+	LedgerTypeExpire:       LedgerAccountIssuance,
+	LedgerTypeSubscription: LedgerAccountIssuance,
+	LedgerTypeAffiliate:    LedgerAccountAffiliate,
+	LedgerTypeOrgTransfer:  LedgerAccountOrg,
+	LedgerTypeRefund:       LedgerAccountRevenue,
+	LedgerTypeConsume:      LedgerAccountRevenue,
+}
+
+func GetQuotaLedgers(userId int, entryType string, startIdx int, num int) (ledgers []*QuotaLedger, total int64, err error) {
+	tx := DB.Model(&QuotaLedger{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if entryType != "" {
+		tx = tx.Where("type = ?", entryType)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&ledgers).Error
+	return ledgers, total, err
+}
+
+// GetLedgerBalances 按账户汇总分录，返回 account_id 到余额的映射
+func GetLedgerBalances(account string, accountIds ...int) (map[int]int, error) {
+	var rows []struct {
+		AccountId int
+		Balance   int
+	}
+	tx := DB.Model(&QuotaLedger{}).Select("account_id, sum(amount) as balance").Where("account = ?", account)
+	if len(accountIds) > 0 {
+		tx = tx.Where("account_id IN (?)", accountIds)
+	}
+	err := tx.Group("account_id").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[int]int, len(rows))
+	for _, row := range rows {
+		balances[row.AccountId] = row.Balance
+	}
+	return balances, nil
+}
+
+type LedgerTokenBalance struct {
+	Id            int    `json:"id"`
+	Name          string `json:"name"`
+	LedgerBalance int    `json:"ledger_balance"`
+	RemainQuota   int    `json:"remain_quota"`
+}
+
+// LedgerUserBalance 由账本汇总的用户余额、预扣中的额度和各令牌剩余额度，与当前记录的值对照
+type LedgerUserBalance struct {
+	UserId        int                  `json:"user_id"`
+	LedgerBalance int                  `json:"ledger_balance"`
+	Quota         int                  `json:"quota"`
+	Hold          int                  `json:"hold"`
+	Tokens        []LedgerTokenBalance `json:"tokens"`
+}
+
+func GetUserLedgerBalance(userId int) (*LedgerUserBalance, error) {
+	quota, err := GetUserQuota(userId)
+	if err != nil {
+		return nil, err
+	}
+	userBalances, err := GetLedgerBalances(LedgerAccountUser, userId)
+	if err != nil {
+		return nil, err
+	}
+	holdBalances, err := GetLedgerBalances(LedgerAccountHold, userId)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []Token
+	err = DB.Select("id", "name", "remain_quota").Where("user_id = ?", userId).Find(&tokens).Error
+	if err != nil {
+		return nil, err
+	}
+	balance := &LedgerUserBalance{
+		UserId:        userId,
+		LedgerBalance: userBalances[userId],
+		Quota:         quota,
+		Hold:          holdBalances[userId],
+		Tokens:        make([]LedgerTokenBalance, 0, len(tokens)),
+	}
+	if len(tokens) == 0 {
+		return balance, nil
+	}
+	tokenIds := make([]int, 0, len(tokens))
+	for _, token := range tokens {
+		tokenIds = append(tokenIds, token.Id)
+	}
+	tokenBalances, err := GetLedgerBalances(LedgerAccountToken, tokenIds...)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		balance.Tokens = append(balance.Tokens, LedgerTokenBalance{
+			Id:            token.Id,
+			Name:          token.Name,
+			LedgerBalance: tokenBalances[token.Id],
+			RemainQuota:   token.RemainQuota,
+		})
+	}
+	return balance, nil
+}
+
+// InitQuotaLedger 账本为空时把现有的用户余额和令牌剩余额度记为期初余额
+func InitQuotaLedger() error {
+	var count int64
+	if err := DB.Model(&QuotaLedger{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	common.SysLog("initializing quota ledger with opening balances")
+	transactionId := common.GetUUID()
+	now := common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("INSERT INTO quota_ledgers (transaction_id, type, account, account_id, amount, user_id, reference, remark, created_at) "+
+			"SELECT ?, ?, ?, id, quota, id, '', '', ? FROM users WHERE quota <> 0",
+			transactionId, LedgerTypeOpening, LedgerAccountUser, now).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Exec("INSERT INTO quota_ledgers (transaction_id, type, account, account_id, amount, user_id, reference, remark, created_at) "+
+			"SELECT ?, ?, ?, id, remain_quota, user_id, '', '', ? FROM tokens WHERE remain_quota <> 0",
+			transactionId, LedgerTypeOpening, LedgerAccountToken, now).Error
+		if err != nil {
+			return err
+		}
+		var userTotal, tokenTotal int64
+		if err := tx.Raw("SELECT coalesce(sum(quota), 0) FROM users").Scan(&userTotal).Error; err != nil {
+			return err
+		}
+		if err := tx.Raw("SELECT coalesce(sum(remain_quota), 0) FROM tokens").Scan(&tokenTotal).Error; err != nil {
+			return err
+		}
+		counters := []QuotaLedger{
+			{TransactionId: transactionId, Type: LedgerTypeOpening, Account: LedgerAccountIssuance, Amount: -int(userTotal), CreatedAt: now},
+			{TransactionId: transactionId, Type: LedgerTypeOpening, Account: LedgerAccountTokenGrant, Amount: -int(tokenTotal), CreatedAt: now},
+		}
+		return tx.Create(&counters).Error
+	})
+}
+
+const (
+	LedgerDriftSourceDatabase = "database"
+	LedgerDriftSourceRedis    = "redis"
+)
+
+// LedgerDrift 账本余额与实际余额不一致的账户
+type LedgerDrift struct {
+	Account   string `json:"account"`
+	AccountId int    `json:"account_id"`
+	Source    string `json:"source"`
+	Expected  int    `json:"expected"`
+	Actual    int    `json:"actual"`
+}
+
+// pendingBatchQuota 开启批量更新时尚未写入数据库的额度变化，账本已经记录，对账时需要计入
+func pendingBatchQuota(type_ int, id int) int {
+	if !config.BatchUpdateEnabled {
+		return 0
+	}
+	batchUpdateLocks[type_].Lock()
+	defer batchUpdateLocks[type_].Unlock()
+	return batchUpdateStores[type_][id]
+}
+
+// ReconcileQuotaLedger 比较账本与 User.Quota、Token.RemainQuota、Organization.Quota，
+// 并比较 Redis 中缓存的用户额度与 User.Quota，只报告不一致的账户，不修改余额和缓存
+func ReconcileQuotaLedger() ([]LedgerDrift, error) {
+	drifts := make([]LedgerDrift, 0)
+	var users []User
+	err := DB.Unscoped().Select("id", "quota").FindInBatches(&users, 1000, func(tx *gorm.DB, batch int) error {
+		ids := make([]int, 0, len(users))
+		for _, user := range users {
+			ids = append(ids, user.Id)
+		}
+		balances, err := GetLedgerBalances(LedgerAccountUser, ids...)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			expected := balances[user.Id]
+			actual := user.Quota + pendingBatchQuota(BatchUpdateTypeUserQuota, user.Id)
+			if actual != expected {
+				drifts = append(drifts, LedgerDrift{Account: LedgerAccountUser, AccountId: user.Id, Source: LedgerDriftSourceDatabase, Expected: expected, Actual: actual})
+			}
+			if !common.RedisEnabled {
+				continue
+			}
+			key := fmt.Sprintf("user_quota:%d", user.Id)
+			cached, err := common.RedisGet(key)
+			if err != nil {
+				continue
+			}
+			// 缓存与数据库同步更新，请求进行中短暂的差异是正常的，只报告不删除缓存
+			cachedQuota, _ := strconv.Atoi(cached)
+			if cachedQuota != actual {
+				drifts = append(drifts, LedgerDrift{Account: LedgerAccountUser, AccountId: user.Id, Source: LedgerDriftSourceRedis, Expected: actual, Actual: cachedQuota})
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return drifts, err
+	}
+	var tokens []Token
+	err = DB.Select("id", "remain_quota").FindInBatches(&tokens, 1000, func(tx *gorm.DB, batch int) error {
+		ids := make([]int, 0, len(tokens))
+		for _, token := range tokens {
+			ids = append(ids, token.Id)
+		}
+		balances, err := GetLedgerBalances(LedgerAccountToken, ids...)
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			expected := balances[token.Id]
+			actual := token.RemainQuota + pendingBatchQuota(BatchUpdateTypeTokenQuota, token.Id)
+			if actual != expected {
+				drifts = append(drifts, LedgerDrift{Account: LedgerAccountToken, AccountId: token.Id, Source: LedgerDriftSourceDatabase, Expected: expected, Actual: actual})
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return drifts, err
+	}
+	var orgs []Organization
+	err = DB.Select("id", "quota").FindInBatches(&orgs, 1000, func(tx *gorm.DB, batch int) error {
+		ids := make([]int, 0, len(orgs))
+		for _, org := range orgs {
+			ids = append(ids, org.Id)
+		}
+		balances, err := GetLedgerBalances(LedgerAccountOrg, ids...)
+		if err != nil {
+			return err
+		}
+		for _, org := range orgs {
+			expected := balances[org.Id]
+			if org.Quota != expected {
+				drifts = append(drifts, LedgerDrift{Account: LedgerAccountOrg, AccountId: org.Id, Source: LedgerDriftSourceDatabase, Expected: expected, Actual: org.Quota})
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return drifts, err
+	}
+	// 额度变动与账本分录不在同一事务中写入，请求进行中时会短暂不一致，数据库的偏差稍后重新读取一次再确认
+	confirmed := make([]LedgerDrift, 0, len(drifts))
+	slept := false
+	for _, drift := range drifts {
+		if drift.Source == LedgerDriftSourceDatabase {
+			if !slept {
+				time.Sleep(time.Second)
+				slept = true
+			}
+			if !confirmLedgerDrift(&drift) {
+				continue
+			}
+		}
+		confirmed = append(confirmed, drift)
+	}
+	return confirmed, nil
+}
+
+func confirmLedgerDrift(drift *LedgerDrift) bool {
+	balances, err := GetLedgerBalances(drift.Account, drift.AccountId)
+	if err != nil {
+		return true
+	}
+	actual := 0
+	switch drift.Account {
+	case LedgerAccountUser:
+		err = DB.Unscoped().Model(&User{}).Where("id = ?", drift.AccountId).Select("quota").Scan(&actual).Error
+		actual += pendingBatchQuota(BatchUpdateTypeUserQuota, drift.AccountId)
+	case LedgerAccountOrg:
+		err = DB.Model(&Organization{}).Where("id = ?", drift.AccountId).Select("quota").Scan(&actual).Error
+	default:
+		err = DB.Model(&Token{}).Where("id = ?", drift.AccountId).Select("remain_quota").Scan(&actual).Error
+		actual += pendingBatchQuota(BatchUpdateTypeTokenQuota, drift.AccountId)
+	}
+	if err != nil {
+		return true
+	}
+	drift.Expected = balances[drift.AccountId]
+	drift.Actual = actual
+	return drift.Expected != drift.Actual
+}
+
+// StartQuotaLedgerReconciler 按 LedgerReconcileInterval 定期对账，间隔为 0 时暂停
+func StartQuotaLedgerReconciler() {
+	for {
+		interval := config.LedgerReconcileInterval
+		if interval <= 0 {
+			time.Sleep(time.Minute)
+			continue
+		}
+		time.Sleep(time.Duration(interval) * time.Minute)
+		drifts, err := ReconcileQuotaLedger()
+		if err != nil {
+			common.SysError("failed to reconcile quota ledger: " + err.Error())
+			continue
+		}
+		for _, drift := range drifts {
+			common.SysError(fmt.Sprintf("quota ledger drift: %s #%d (%s) ledger %d, actual %d", drift.Account, drift.AccountId, drift.Source, drift.Expected, drift.Actual))
+		}
+		common.SysLog(fmt.Sprintf("quota ledger reconciled, %d drifts found", len(drifts)))
+	}
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func sumLegs(legs []ledgerLeg) int {
+	sum := 0
+	for _, leg := range legs {
+		sum += leg.amount
+	}
+	return sum
+}
+
+func findLeg(legs []ledgerLeg, account string) (ledgerLeg, bool) {
+	for _, leg := range legs {
+		if leg.account == account {
+			return leg, true
+		}
+	}
+	return ledgerLeg{}, false
+}
+
+func TestSettleLegs(t *testing.T) {
+	cases := []struct {
+		name      string
+		token     Token
+		held      int
+		delta     int
+		payer     string
+		payerId   int
+		tokenLegs bool
+	}{
+		{"settle more than held", Token{Id: 1, UserId: 2}, 100, 20, LedgerAccountUser, 2, true},
+		{"settle less than held", Token{Id: 1, UserId: 2}, 100, -30, LedgerAccountUser, 2, true},
+		{"return pre-consumed quota", Token{Id: 1, UserId: 2}, 100, -100, LedgerAccountUser, 2, true},
+		{"unlimited token", Token{Id: 1, UserId: 2, UnlimitedQuota: true}, 0, 50, LedgerAccountUser, 2, false},
+		{"org token", Token{Id: 1, UserId: 2, OrgId: 3}, 100, 20, LedgerAccountOrg, 3, true},
+	}
+	Convey("TestSettleLegs", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				legs := settleLegs(&c.token, c.held, c.delta)
+				So(sumLegs(legs), ShouldEqual, 0)
+				payer, ok := findLeg(legs, c.payer)
+				So(ok, ShouldBeTrue)
+				So(payer.accountId, ShouldEqual, c.payerId)
+				So(payer.amount, ShouldEqual, -c.delta)
+				revenue, _ := findLeg(legs, LedgerAccountRevenue)
+				So(revenue.amount, ShouldEqual, c.held+c.delta)
+				_, hasTokenLeg := findLeg(legs, LedgerAccountToken)
+				So(hasTokenLeg, ShouldEqual, c.tokenLegs)
+			})
+		}
+	})
+}
+
+func TestRecordLedger(t *testing.T) {
+	resetTestDB()
+	Convey("TestRecordLedger", t, func() {
+		So(recordLedger(nil, LedgerTypeAdjust, 1, "", "", ledgerLeg{account: LedgerAccountUser, accountId: 1, amount: 10}), ShouldNotBeNil)
+		So(recordLedger(nil, LedgerTypeAdjust, 1, "", "", userLegs(1, LedgerAccountIssuance, 0, 0)...), ShouldBeNil)
+		So(recordLedger(nil, LedgerTypeAdjust, 1, "", "", userLegs(1, LedgerAccountIssuance, 0, 10)...), ShouldBeNil)
+		var count int64
+		DB.Model(&QuotaLedger{}).Count(&count)
+		So(count, ShouldEqual, 2)
+		var total int
+		DB.Model(&QuotaLedger{}).Select("coalesce(sum(amount), 0)").Scan(&total)
+		So(total, ShouldEqual, 0)
+	})
+}
+
+func TestReconcileQuotaLedger(t *testing.T) {
+	cases := []struct {
+		name        string
+		quota       int
+		ledger      int
+		remain      int
+		tokenLedger int
+		drifts      int
+	}{
+		{"balanced", 100, 100, 50, 50, 0},
+		{"user quota drifted", 90, 100, 50, 50, 1},
+		{"token quota drifted", 100, 100, 40, 50, 1},
+		{"both drifted", 80, 100, 40, 50, 2},
+	}
+	Convey("TestReconcileQuotaLedger", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				resetTestDB()
+				createTestUser(1, c.quota)
+				DB.Create(&Token{Id: 1, UserId: 1, Key: "key1", RemainQuota: c.remain})
+				So(recordLedger(nil, LedgerTypeTopUp, 1, "", "", userLegs(1, LedgerAccountIssuance, 0, c.ledger)...), ShouldBeNil)
+				So(recordLedger(nil, LedgerTypeAdjust, 1, "", "", tokenLegs(1, c.tokenLedger)...), ShouldBeNil)
+				drifts, err := ReconcileQuotaLedger()
+				So(err, ShouldBeNil)
+				So(len(drifts), ShouldEqual, c.drifts)
+			})
+		}
+	})
+}
@@ -0,0 +1,391 @@
+package model
+
+import (
+	"fmt"
+	"one-api/common"
+	"one-api/common/config"
+	"one-api/common/logger"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 额度批次：每次充值、兑换、赠送和邀请奖励都记为一条 RechargeRecord，各自有过期时间。
+// 请求结算时按过期时间从早到晚扣除批次，永不过期的批次最后扣除；预扣费只冻结 User.Quota，不扣除批次；
+// 退款按相反的顺序退回批次。
+// 赠送和邀请奖励属于赠送额度，按 PromoQuotaValidDays 过期；付费额度除非购买时选择了有效期，否则不过期
+
+// QuotaLotSourceLegacy 启用额度批次前没有充值记录覆盖的余额
+const QuotaLotSourceLegacy = "legacy"
+
+var promotionalLotSources = map[string]bool{
+	LedgerTypeGift:      true,
+	LedgerTypeAffiliate: true,
+}
+
+// PromoQuotaExpireAt 赠送额度的过期时间，有效期为 0 时不过期
+func PromoQuotaExpireAt() int64 {
+	if config.PromoQuotaValidDays <= 0 {
+		return -1
+	}
+	return time.Now().Unix() + int64(config.PromoQuotaValidDays)*24*60*60
+}
+
+// QuotaExpireAtByDays 按天数计算过期时间，days 为空或 -1 时不过期
+func QuotaExpireAtByDays(days string) (int64, error) {
+	if days == "" || days == "-1" {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(days)
+	if err != nil {
+		return 0, err
+	}
+	return time.Now().Unix() + int64(n)*24*60*60, nil
+}
+
+// creditQuotaLot 增加用户余额并新建批次，同时记入账本，lot 需要填写 UserID、Amount、EndDate 和 Source
+func creditQuotaLot(tx *gorm.DB, lot *RechargeRecord, remark string) error {
+	if lot.Amount <= 0 {
+		return nil
+	}
+	counter, ok := ledgerCounterAccounts[lot.Source]
+	if !ok {
+		return fmt.Errorf("unknown quota lot source: %s", lot.Source)
+	}
+	if lot.StartDate == 0 {
+		lot.StartDate = time.Now().Unix()
+	}
+	lot.OriginalAmount = lot.Amount
+	lot.Promotional = promotionalLotSources[lot.Source]
+	userId := int(lot.UserID)
+	err := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", lot.Amount)).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(lot).Error; err != nil {
+		return err
+	}
+	return recordLedger(tx, lot.Source, userId, lot.Reference, remark, userLegs(userId, counter, 0, lot.Amount)...)
+}
+
+// CreditUserQuota 增加用户余额，source 为账本类型，expireAt 为 -1 时不过期
+func CreditUserQuota(userId int, amount int, source string, expireAt int64, reference string, remark string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return creditQuotaLot(tx, &RechargeRecord{
+			UserID:    uint(userId),
+			Amount:    amount,
+			EndDate:   expireAt,
+			Source:    source,
+			Reference: reference,
+		}, remark)
+	})
+	if err == nil && common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_quota:%d", userId))
+	}
+	return err
+}
+
+// debitLot 从批次扣除最多 amount 的额度，返回实际扣除的额度。
+// 扣除时校验批次余额，并发扣除同一批次时按数据库中的最新余额重试，不会覆盖其他事务的扣除
+func debitLot(tx *gorm.DB, lot *RechargeRecord, amount int) (int, error) {
+	for {
+		used := min(lot.Amount, amount)
+		if used <= 0 {
+			return 0, nil
+		}
+		result := tx.Model(&RechargeRecord{}).Where("id = ? AND amount >= ?", lot.ID, used).Update("amount", gorm.Expr("amount - ?", used))
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected > 0 {
+			lot.Amount -= used
+			return used, nil
+		}
+		if err := tx.Model(&RechargeRecord{}).Where("id = ?", lot.ID).Select("amount").Scan(&lot.Amount).Error; err != nil {
+			return 0, err
+		}
+	}
+}
+
+// debitQuotaLots 按过期时间从早到晚扣除批次，批次不足时返回未能扣除的部分
+func debitQuotaLots(tx *gorm.DB, userId int, amount int) (int, error) {
+	var lots []RechargeRecord
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND amount > 0", userId).
+		Order("CASE WHEN end_date = -1 THEN 1 ELSE 0 END, end_date ASC, id ASC").
+		Find(&lots).Error
+	if err != nil {
+		return amount, err
+	}
+	for i := range lots {
+		if amount <= 0 {
+			break
+		}
+		used, err := debitLot(tx, &lots[i], amount)
+		if err != nil {
+			return amount, err
+		}
+		amount -= used
+	}
+	return amount, nil
+}
+
+// ConsumeQuotaLots 请求结算时扣除实际费用对应的批次
+func ConsumeQuotaLots(userId int, amount int) {
+	if amount <= 0 {
+		return
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		remaining, err := debitQuotaLots(tx, userId, amount)
+		if err == nil && remaining > 0 {
+			common.SysError(fmt.Sprintf("quota lots of user %d are insufficient, %d not covered", userId, remaining))
+		}
+		return err
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to consume quota lots of user %d: %s", userId, err.Error()))
+	}
+}
+
+// restoreQuotaLots 按扣除的相反顺序把额度退回已扣除过的批次，批次保持原来的过期时间，
+// 退回到已过期的批次时由下一次过期处理扣除。返回没有批次可以退回的部分
+func restoreQuotaLots(tx *gorm.DB, userId int, amount int) (int, error) {
+	var lots []RechargeRecord
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND amount < original_amount", userId).
+		Order("CASE WHEN end_date = -1 THEN 0 ELSE 1 END, end_date DESC, id DESC").
+		Find(&lots).Error
+	if err != nil {
+		return amount, err
+	}
+	for _, lot := range lots {
+		if amount <= 0 {
+			break
+		}
+		restored := min(lot.OriginalAmount-lot.Amount, amount)
+		result := tx.Model(&RechargeRecord{}).Where("id = ? AND amount + ? <= original_amount", lot.ID, restored).
+			Update("amount", gorm.Expr("amount + ?", restored))
+		if result.Error != nil {
+			return amount, result.Error
+		}
+		if result.RowsAffected > 0 {
+			amount -= restored
+		}
+	}
+	return amount, nil
+}
+
+// refundQuotaLot 退还已结算的费用，余额已经增加，额度退回扣除过的批次，退不回的部分补一个不过期的批次
+func refundQuotaLot(userId int, amount int) {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		remaining, err := restoreQuotaLots(tx, userId, amount)
+		if err != nil || remaining <= 0 {
+			return err
+		}
+		return tx.Create(&RechargeRecord{
+			UserID:         uint(userId),
+			Amount:         remaining,
+			OriginalAmount: remaining,
+			StartDate:      time.Now().Unix(),
+			EndDate:        -1,
+			Source:         LedgerTypeRefund,
+		}).Error
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to refund quota lots of user %d: %s", userId, err.Error()))
+	}
+}
+
+// adjustUserQuota 管理员修改余额，增加时新建不过期的批次，减少时按顺序扣除批次
+func adjustUserQuota(userId int, delta int) error {
+	if delta > 0 {
+		return CreditUserQuota(userId, delta, LedgerTypeAdjust, -1, "", "修改用户额度")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", delta)).Error
+		if err != nil {
+			return err
+		}
+		if _, err := debitQuotaLots(tx, userId, -delta); err != nil {
+			return err
+		}
+		return recordLedger(tx, LedgerTypeAdjust, userId, "", "修改用户额度", userLegs(userId, LedgerAccountIssuance, 0, delta)...)
+	})
+}
+
+func GetUserQuotaLots(userId int) (lots []*RechargeRecord, err error) {
+	err = DB.Where("user_id = ? AND amount > 0", userId).
+		Order("CASE WHEN end_date = -1 THEN 1 ELSE 0 END, end_date ASC, id ASC").Find(&lots).Error
+	return lots, err
+}
+
+// migrateQuotaLots 启用额度批次时为已有的充值记录补充来源，没有被充值记录覆盖的余额记为一个不过期的批次
+func migrateQuotaLots(db *gorm.DB) error {
+	common.SysLog("migrating recharge records to quota lots")
+	now := time.Now().Unix()
+	err := db.Model(&RechargeRecord{}).Where("source = '' OR source IS NULL").
+		Updates(map[string]interface{}{"source": QuotaLotSourceLegacy, "original_amount": gorm.Expr("amount")}).Error
+	if err != nil {
+		return err
+	}
+	var rows []struct {
+		Id      int
+		Quota   int
+		Covered int
+	}
+	err = db.Raw("SELECT users.id AS id, users.quota AS quota, coalesce(sum(recharge_records.amount), 0) AS covered FROM users " +
+		"LEFT JOIN recharge_records ON recharge_records.user_id = users.id AND recharge_records.amount > 0 " +
+		"GROUP BY users.id, users.quota").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	lots := make([]RechargeRecord, 0)
+	for _, row := range rows {
+		if row.Quota > row.Covered {
+			amount := row.Quota - row.Covered
+			lots = append(lots, RechargeRecord{
+				UserID:         uint(row.Id),
+				Amount:         amount,
+				OriginalAmount: amount,
+				StartDate:      now,
+				EndDate:        -1,
+				Source:         QuotaLotSourceLegacy,
+			})
+		}
+	}
+	if len(lots) == 0 {
+		return nil
+	}
+	return db.CreateInBatches(lots, 500).Error
+}
+
+// expireRechargeRecord 将批次剩余的额度从用户余额中扣除。
+// 预扣费只冻结余额不扣除批次，过期的额度不超过用户当前的余额，超出的部分是进行中请求冻结的额度，
+// 留在批次上由请求结算时扣除，请求失败退还后由下一次过期处理扣除。
+// 扣除时校验读取到的批次余额，期间被请求结算扣除过时重新读取，避免按过期的余额扣除
+func expireRechargeRecord(tx *gorm.DB, record *RechargeRecord) error {
+	var expired int
+	for {
+		if record.Amount <= 0 {
+			return nil
+		}
+		var quota int
+		err := tx.Model(&User{}).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", record.UserID).Select("quota").Scan(&quota).Error
+		if err != nil {
+			return err
+		}
+		expired = min(record.Amount, max(quota, 0))
+		if expired <= 0 {
+			return nil
+		}
+		result := tx.Model(&RechargeRecord{}).Where("id = ? AND amount = ?", record.ID, record.Amount).Update("amount", gorm.Expr("amount - ?", expired))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			break
+		}
+		if err := tx.Model(&RechargeRecord{}).Where("id = ?", record.ID).Select("amount").Scan(&record.Amount).Error; err != nil {
+			return err
+		}
+	}
+	err := tx.Model(&User{}).Where("id = ?", record.UserID).
+		Update("quota", gorm.Expr("quota - ?", expired)).Error
+	if err != nil {
+		return err
+	}
+	userId := int(record.UserID)
+	err = recordLedger(tx, LedgerTypeExpire, userId, fmt.Sprintf("recharge:%d", record.ID), "充值额度过期", userLegs(userId, LedgerAccountIssuance, 0, -expired)...)
+	record.Amount -= expired
+	return err
+}
+
+// notifyExpiringQuotaLots 批次过期前 QuotaExpiryNotifyDays 天发邮件提醒，每个批次只提醒一次
+func notifyExpiringQuotaLots() {
+	if config.QuotaExpiryNotifyDays <= 0 {
+		return
+	}
+	now := time.Now().Unix()
+	deadline := now + int64(config.QuotaExpiryNotifyDays)*24*60*60
+	var lots []RechargeRecord
+	err := DB.Where("end_date > ? AND end_date <= ? AND amount > 0 AND notified_at = 0", now, deadline).Find(&lots).Error
+	if err != nil {
+		common.SysError("failed to fetch expiring quota lots: " + err.Error())
+		return
+	}
+	type expiring struct {
+		amount   int
+		earliest int64
+		ids      []uint
+	}
+	users := make(map[uint]*expiring)
+	for _, lot := range lots {
+		item, ok := users[lot.UserID]
+		if !ok {
+			item = &expiring{earliest: lot.EndDate}
+			users[lot.UserID] = item
+		}
+		item.amount += lot.Amount
+		item.earliest = min(item.earliest, lot.EndDate)
+		item.ids = append(item.ids, lot.ID)
+	}
+	for userId, item := range users {
+		email, err := GetUserEmail(int(userId))
+		if err == nil && email != "" {
+			subject := "您的额度即将过期"
+			content := fmt.Sprintf("您有 %s 额度将于 %s 起陆续过期，请及时使用。", common.LogQuota(item.amount), time.Unix(item.earliest, 0).Format("2006-01-02 15:04"))
+			if err := common.SendEmail(subject, email, content); err != nil {
+				logger.SysError("failed to send quota expiry email: " + err.Error())
+			}
+		}
+		err = DB.Model(&RechargeRecord{}).Where("id IN ?", item.ids).Update("notified_at", now).Error
+		if err != nil {
+			common.SysError("failed to mark quota lots notified: " + err.Error())
+		}
+	}
+}
+
+// expireQuotaLots 扣除所有已过期批次的剩余额度
+func expireQuotaLots() error {
+	currentTime := time.Now().Unix()
+	var count int64
+	DB.Model(&RechargeRecord{}).Where("end_date <= ? AND end_date != -1 AND amount > 0", currentTime).Count(&count)
+	if count == 0 {
+		return nil
+	}
+	var userIds []uint
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var expiredRecords []RechargeRecord
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("end_date <= ? AND end_date != -1 AND amount > 0", currentTime).Find(&expiredRecords).Error
+		if err != nil {
+			return err
+		}
+		for i := range expiredRecords {
+			if err := expireRechargeRecord(tx, &expiredRecords[i]); err != nil {
+				return err
+			}
+			userIds = append(userIds, expiredRecords[i].UserID)
+		}
+		return nil
+	})
+	if err == nil && common.RedisEnabled {
+		for _, userId := range userIds {
+			_ = common.RedisDel(fmt.Sprintf("user_quota:%d", userId))
+		}
+	}
+	return err
+}
+
+// UpdateUserQuotaData 每小时处理过期的额度批次并发送过期提醒
+func UpdateUserQuotaData() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		common.SysLog("正在更新用户余额日期...")
+		notifyExpiringQuotaLots()
+		if err := expireQuotaLots(); err != nil {
+			common.SysLog(fmt.Sprintf("更新用户余额失败：%s", err))
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func TestDebitQuotaLots(t *testing.T) {
+	// 批次按过期时间从早到晚扣除，永不过期的批次最后扣除
+	lots := []RechargeRecord{
+		{ID: 1, UserID: 1, Amount: 100, EndDate: -1},
+		{ID: 2, UserID: 1, Amount: 100, EndDate: 2000},
+		{ID: 3, UserID: 1, Amount: 100, EndDate: 1000},
+	}
+	cases := []struct {
+		name    string
+		amount  int
+		left    int
+		amounts []int
+	}{
+		{"earliest lot first", 50, 0, []int{100, 100, 50}},
+		{"spans lots", 150, 0, []int{100, 50, 0}},
+		{"never expiring lot last", 250, 0, []int{50, 0, 0}},
+		{"not enough lots", 350, 50, []int{0, 0, 0}},
+	}
+	Convey("TestDebitQuotaLots", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				resetTestDB()
+				DB.Create(&lots)
+				var left int
+				err := DB.Transaction(func(tx *gorm.DB) (err error) {
+					left, err = debitQuotaLots(tx, 1, c.amount)
+					return err
+				})
+				So(err, ShouldBeNil)
+				So(left, ShouldEqual, c.left)
+				var records []RechargeRecord
+				DB.Order("id").Find(&records)
+				for i, record := range records {
+					So(record.Amount, ShouldEqual, c.amounts[i])
+				}
+			})
+		}
+	})
+}
+
+func TestDebitLotStaleAmount(t *testing.T) {
+	Convey("TestDebitLotStaleAmount", t, func() {
+		resetTestDB()
+		DB.Create(&RechargeRecord{ID: 1, UserID: 1, Amount: 30, EndDate: -1})
+		// 读取后其他请求已经扣除了部分额度，按数据库中的余额扣除
+		stale := RechargeRecord{ID: 1, UserID: 1, Amount: 100}
+		used, err := debitLot(DB, &stale, 50)
+		So(err, ShouldBeNil)
+		So(used, ShouldEqual, 30)
+		var record RechargeRecord
+		DB.First(&record, 1)
+		So(record.Amount, ShouldEqual, 0)
+	})
+}
+
+func TestExpireRechargeRecord(t *testing.T) {
+	cases := []struct {
+		name     string
+		quota    int
+		lot      int
+		stale    int
+		userLeft int
+		lotLeft  int
+	}{
+		{"whole lot expires", 300, 150, 150, 150, 0},
+		{"stale amount re-read", 300, 150, 200, 150, 0},
+		// 用户余额中有 60 被进行中的请求冻结，只过期未冻结的部分
+		{"capped by held quota", 40, 100, 100, 0, 60},
+		{"nothing available", 0, 100, 100, 0, 100},
+	}
+	Convey("TestExpireRechargeRecord", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				resetTestDB()
+				createTestUser(1, c.quota)
+				DB.Create(&RechargeRecord{ID: 1, UserID: 1, Amount: c.lot, OriginalAmount: c.lot, EndDate: 1000})
+				stale := RechargeRecord{ID: 1, UserID: 1, Amount: c.stale, EndDate: 1000}
+				err := DB.Transaction(func(tx *gorm.DB) error {
+					return expireRechargeRecord(tx, &stale)
+				})
+				So(err, ShouldBeNil)
+				So(stale.Amount, ShouldEqual, c.lotLeft)
+				var user User
+				DB.First(&user, 1)
+				So(user.Quota, ShouldEqual, c.userLeft)
+				var record RechargeRecord
+				DB.First(&record, 1)
+				So(record.Amount, ShouldEqual, c.lotLeft)
+				balances, err := GetLedgerBalances(LedgerAccountUser, 1)
+				So(err, ShouldBeNil)
+				So(balances[1], ShouldEqual, c.userLeft-c.quota)
+			})
+		}
+	})
+}
+
+func TestRefundQuotaLot(t *testing.T) {
+	cases := []struct {
+		name    string
+		amount  int
+		amounts []int
+	}{
+		{"restores the lot consumed last", 30, []int{100, 50, 0}},
+		{"spans lots in reverse order", 80, []int{100, 100, 0}},
+		{"refills expired lots last", 120, []int{100, 100, 40}},
+		{"uncovered part becomes a new lot", 250, []int{100, 100, 100, 70}},
+	}
+	Convey("TestRefundQuotaLot", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				resetTestDB()
+				DB.Create(&[]RechargeRecord{
+					{ID: 1, UserID: 1, Amount: 100, OriginalAmount: 100, EndDate: -1},
+					{ID: 2, UserID: 1, Amount: 20, OriginalAmount: 100, EndDate: 2000},
+					{ID: 3, UserID: 1, Amount: 0, OriginalAmount: 100, EndDate: 1000},
+				})
+				refundQuotaLot(1, c.amount)
+				var records []RechargeRecord
+				DB.Order("id").Find(&records)
+				So(len(records), ShouldEqual, len(c.amounts))
+				for i, record := range records {
+					So(record.Amount, ShouldEqual, c.amounts[i])
+				}
+				// 退回的额度保持原批次的过期时间
+				So(records[1].EndDate, ShouldEqual, 2000)
+				if len(records) > 3 {
+					So(records[3].EndDate, ShouldEqual, -1)
+					So(records[3].Source, ShouldEqual, LedgerTypeRefund)
+				}
+			})
+		}
+	})
+}
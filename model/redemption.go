@@ -6,7 +6,6 @@ import (
 	"one-api/common"
 	"one-api/common/config"
 	"strconv"
-	"time"
 
 	"gorm.io/gorm"
 )
@@ -59,7 +58,10 @@ func Redeem(key string, userId int) (quota int, err error) {
 	if common.UsingPostgreSQL {
 		keyCol = `"key"`
 	}
-	RedempTionCount := strconv.Itoa(config.RedempTionCount)
+	expireAt, err := QuotaExpireAtByDays(strconv.Itoa(config.RedempTionCount))
+	if err != nil {
+		return 0, err
+	}
 
 	err = DB.Transaction(func(tx *gorm.DB) error {
 		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(keyCol+" = ?", key).First(redemption).Error
@@ -70,13 +72,14 @@ func Redeem(key string, userId int) (quota int, err error) {
 			return errors.New("该兑换码已被使用")
 		}
 
-		// 更新用户的总配额
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
-		if err != nil {
-			return err
-		}
-
-		err = redemptionIncreaseRechargeQuota(tx, userId, RedempTionCount, redemption.Quota)
+		// 增加用户余额并记为一个额度批次
+		err = creditQuotaLot(tx, &RechargeRecord{
+			UserID:    uint(userId),
+			Amount:    redemption.Quota,
+			EndDate:   expireAt,
+			Source:    LedgerTypeRedemption,
+			Reference: fmt.Sprintf("redemption:%d", redemption.Id),
+		}, "")
 		if err != nil {
 			return err
 		}
@@ -138,34 +141,3 @@ func DeleteRedemptionById(id int) (err error) {
 	}
 	return redemption.Delete()
 }
-
-func redemptionIncreaseRechargeQuota(tx *gorm.DB, id int, topupratio string, quota int) (err error) {
-	var endQuotaAt int64
-
-	// 如果topupratio不为空且不是"-1"，计算结束时间戳；如果是"-1"，则设置无限期。
-	if topupratio != "" && topupratio != "-1" {
-		days, convErr := strconv.Atoi(topupratio)
-		if convErr != nil {
-			return convErr
-		}
-		currentTime := time.Now().Unix()
-		endQuotaAt = currentTime + int64(days*24*60*60)
-	} else if topupratio == "-1" {
-		endQuotaAt = -1 // 表示无限期
-	}
-
-	// 启动一个事务处理增加配额和插入充值记录
-	if topupratio != "" {
-		record := &RechargeRecord{
-			UserID:    uint(id),
-			Amount:    quota,
-			StartDate: time.Now().Unix(), // 使用当前时间作为StartDate
-			EndDate:   endQuotaAt,        // 根据topupratio设置EndDate
-		}
-		if err := tx.Create(&record).Error; err != nil {
-			return err
-		}
-	}
-
-	return err
-}
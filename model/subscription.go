@@ -0,0 +1,557 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"one-api/common"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 订阅套餐：用户按周期付费，每个周期发放套餐内额度，周期结束时未用完的套餐额度作废；
+// 订阅期间用户切换到套餐指定的分组，只能使用套餐包含的模型
+
+const (
+	PlanStatusEnabled  = 1
+	PlanStatusDisabled = 2
+)
+
+const (
+	PlanPeriodWeek  = "week"
+	PlanPeriodMonth = "month"
+	PlanPeriodYear  = "year"
+)
+
+const (
+	PlanOverageBalance = "balance" // 套餐额度用完后继续扣除余额
+	PlanOverageBlock   = "block"   // 套餐额度用完后拒绝请求
+)
+
+const (
+	SubscriptionStatusActive   = "active"
+	SubscriptionStatusCanceled = "canceled" // 已取消，已付费的周期结束后不再续期
+	SubscriptionStatusExpired  = "expired"
+)
+
+const (
+	PlanActionSubscribe = "subscribe"
+	PlanActionRenew     = "renew"
+	PlanActionUpgrade   = "upgrade"
+)
+
+type Plan struct {
+	Id            int     `json:"id"`
+	Name          string  `json:"name" gorm:"index"`
+	Description   string  `json:"description"`
+	Price         float64 `json:"price"`
+	Period        string  `json:"period" gorm:"type:varchar(16);default:'month'"`
+	IncludedQuota int     `json:"included_quota"`
+	Group         string  `json:"group" gorm:"type:varchar(32)"`
+	Models        string  `json:"models"`
+	OverageMode   string  `json:"overage_mode" gorm:"type:varchar(16);default:'balance'"`
+	Status        int     `json:"status" gorm:"default:1"`
+	CreatedTime   int64   `json:"created_time" gorm:"bigint"`
+}
+
+type Subscription struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	PlanId        int    `json:"plan_id" gorm:"index"`
+	Status        string `json:"status" gorm:"type:varchar(16);index"`
+	PeriodStart   int64  `json:"period_start" gorm:"bigint"`
+	PeriodEnd     int64  `json:"period_end" gorm:"bigint;index"`
+	PaidUntil     int64  `json:"paid_until" gorm:"bigint"`
+	PreviousGroup string `json:"previous_group" gorm:"type:varchar(32)"`
+	CreatedTime   int64  `json:"created_time" gorm:"bigint"`
+	CanceledTime  int64  `json:"canceled_time" gorm:"bigint"`
+	// 当前周期和已续订的下一周期对应的订单号，退款时使用
+	PeriodTradeNo string `json:"period_trade_no" gorm:"type:varchar(64)"`
+	RenewTradeNo  string `json:"renew_trade_no" gorm:"type:varchar(64)"`
+}
+
+var currentSubscriptionStatuses = []string{SubscriptionStatusActive, SubscriptionStatusCanceled}
+
+func GetAllPlans(enabledOnly bool) (plans []*Plan, err error) {
+	tx := DB.Order("price asc")
+	if enabledOnly {
+		tx = tx.Where("status = ?", PlanStatusEnabled)
+	}
+	err = tx.Find(&plans).Error
+	return plans, err
+}
+
+func GetPlanById(id int) (*Plan, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	plan := Plan{}
+	err := DB.First(&plan, "id = ?", id).Error
+	return &plan, err
+}
+
+func (plan *Plan) validate() error {
+	if plan.Name == "" {
+		return errors.New("套餐名称不能为空")
+	}
+	if plan.Price <= 0 {
+		return errors.New("套餐价格必须大于 0")
+	}
+	switch plan.Period {
+	case PlanPeriodWeek, PlanPeriodMonth, PlanPeriodYear:
+	default:
+		return fmt.Errorf("无效的计费周期：%s", plan.Period)
+	}
+	switch plan.OverageMode {
+	case PlanOverageBalance, PlanOverageBlock:
+	default:
+		return fmt.Errorf("无效的超额规则：%s", plan.OverageMode)
+	}
+	if plan.IncludedQuota < 0 {
+		return errors.New("套餐额度不能为负数")
+	}
+	return nil
+}
+
+func (plan *Plan) Insert() error {
+	if err := plan.validate(); err != nil {
+		return err
+	}
+	plan.CreatedTime = common.GetTimestamp()
+	return DB.Create(plan).Error
+}
+
+func (plan *Plan) Update() error {
+	if err := plan.validate(); err != nil {
+		return err
+	}
+	return DB.Model(plan).Select("name", "description", "price", "period", "included_quota", "group", "models", "overage_mode", "status").Updates(plan).Error
+}
+
+// DeletePlanById 仍有订阅的套餐只能禁用，不能删除
+func DeletePlanById(id int) error {
+	var count int64
+	err := DB.Model(&Subscription{}).Where("plan_id = ? AND status IN ?", id, currentSubscriptionStatuses).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该套餐仍有用户订阅，请先禁用")
+	}
+	return DB.Delete(&Plan{}, "id = ?", id).Error
+}
+
+func addPlanPeriod(start int64, period string) int64 {
+	t := time.Unix(start, 0)
+	switch period {
+	case PlanPeriodWeek:
+		t = t.AddDate(0, 0, 7)
+	case PlanPeriodYear:
+		t = t.AddDate(1, 0, 0)
+	default:
+		t = t.AddDate(0, 1, 0)
+	}
+	return t.Unix()
+}
+
+// GetCurrentSubscription 返回用户当前生效的订阅，没有时返回 nil
+func GetCurrentSubscription(userId int) (*Subscription, error) {
+	var subscriptions []Subscription
+	err := DB.Where("user_id = ? AND status IN ?", userId, currentSubscriptionStatuses).Order("id desc").Limit(1).Find(&subscriptions).Error
+	if err != nil || len(subscriptions) == 0 {
+		return nil, err
+	}
+	return &subscriptions[0], nil
+}
+
+func GetUserSubscriptions(userId int, startIdx int, num int) (subscriptions []*Subscription, err error) {
+	tx := DB.Order("id desc")
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	err = tx.Limit(num).Offset(startIdx).Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// GetSubscriptionRemainQuota 当前周期剩余的套餐额度
+func GetSubscriptionRemainQuota(subscriptionId int) (quota int, err error) {
+	err = DB.Model(&RechargeRecord{}).Select("coalesce(sum(amount), 0)").Where("subscription_id = ?", subscriptionId).Scan(&quota).Error
+	return quota, err
+}
+
+// QuoteSubscriptionOrder 计算下单金额，升级时按已付费时间的剩余比例抵扣原套餐的费用
+func QuoteSubscriptionOrder(userId int, planId int, action string) (money float64, err error) {
+	current, err := GetCurrentSubscription(userId)
+	if err != nil {
+		return 0, err
+	}
+	var pending int64
+	err = DB.Model(&TopUp{}).Where("user_id = ? AND plan_id <> 0 AND status = ? AND create_time > ?",
+		userId, TopUpStatusPending, time.Now().Add(-PlanOrderPayWindow).Unix()).Count(&pending).Error
+	if err != nil {
+		return 0, err
+	}
+	if pending > 0 {
+		return 0, errors.New("有尚未完成支付的套餐订单，请完成支付或稍后再试")
+	}
+	switch action {
+	case PlanActionSubscribe:
+		if current != nil {
+			return 0, errors.New("已有生效中的订阅，请续订或升级")
+		}
+		plan, err := getEnabledPlan(planId)
+		if err != nil {
+			return 0, err
+		}
+		return plan.Price, nil
+	case PlanActionRenew:
+		if current == nil {
+			return 0, errors.New("没有生效中的订阅")
+		}
+		if current.Status == SubscriptionStatusCanceled {
+			return 0, errors.New("订阅已取消，无法续订")
+		}
+		if current.PaidUntil > current.PeriodEnd {
+			return 0, errors.New("下一周期已经续订")
+		}
+		plan, err := getEnabledPlan(current.PlanId)
+		if err != nil {
+			return 0, err
+		}
+		return plan.Price, nil
+	case PlanActionUpgrade:
+		if current == nil {
+			return 0, errors.New("没有生效中的订阅")
+		}
+		plan, err := getEnabledPlan(planId)
+		if err != nil {
+			return 0, err
+		}
+		currentPlan, err := GetPlanById(current.PlanId)
+		if err != nil {
+			return 0, err
+		}
+		if plan.Price <= currentPlan.Price {
+			return 0, errors.New("只能升级到价格更高的套餐")
+		}
+		credit := 0.0
+		if length := current.PeriodEnd - current.PeriodStart; length > 0 {
+			remaining := max(current.PaidUntil-time.Now().Unix(), 0)
+			credit = currentPlan.Price * float64(remaining) / float64(length)
+		}
+		return math.Max(math.Round((plan.Price-credit)*100)/100, 0.01), nil
+	}
+	return 0, fmt.Errorf("无效的操作：%s", action)
+}
+
+func getEnabledPlan(planId int) (*Plan, error) {
+	plan, err := GetPlanById(planId)
+	if err != nil {
+		return nil, errors.New("套餐不存在")
+	}
+	if plan.Status != PlanStatusEnabled {
+		return nil, errors.New("套餐已下架")
+	}
+	return plan, nil
+}
+
+// ErrPlanOrderNotApplicable 已支付的套餐订单无法开通，如重复订阅、套餐已删除或续订时套餐已变化，订单改为失败等待退款
+var ErrPlanOrderNotApplicable = errors.New("plan order can not be applied")
+
+// PlanOrderPayWindow 套餐订单的支付时限，期间不能再创建套餐订单，避免重复支付
+const PlanOrderPayWindow = time.Hour
+
+// applySubscriptionOrder 套餐订单支付成功后开通、续订或升级订阅，与订单状态的变化在同一事务中执行
+func applySubscriptionOrder(tx *gorm.DB, topUp *TopUp) error {
+	var plan Plan
+	if err := tx.First(&plan, "id = ?", topUp.PlanId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: plan %d not found", ErrPlanOrderNotApplicable, topUp.PlanId)
+		}
+		return err
+	}
+	now := common.GetTimestamp()
+	var current *Subscription
+	var subscriptions []Subscription
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND status IN ?", topUp.UserId, currentSubscriptionStatuses).
+		Order("id desc").Limit(1).Find(&subscriptions).Error
+	if err != nil {
+		return err
+	}
+	if len(subscriptions) > 0 {
+		current = &subscriptions[0]
+	}
+	switch topUp.PlanAction {
+	case PlanActionSubscribe:
+		if current != nil {
+			return fmt.Errorf("%w: user already has an active subscription", ErrPlanOrderNotApplicable)
+		}
+		group, err := getUserGroupTx(tx, topUp.UserId)
+		if err != nil {
+			return err
+		}
+		subscription := &Subscription{
+			UserId:        topUp.UserId,
+			PlanId:        plan.Id,
+			Status:        SubscriptionStatusActive,
+			PeriodStart:   now,
+			PeriodEnd:     addPlanPeriod(now, plan.Period),
+			PreviousGroup: group,
+			CreatedTime:   now,
+			PeriodTradeNo: topUp.TradeNo,
+		}
+		subscription.PaidUntil = subscription.PeriodEnd
+		if err := tx.Create(subscription).Error; err != nil {
+			return err
+		}
+		return startSubscriptionPeriod(tx, subscription, &plan)
+	case PlanActionRenew:
+		if current == nil || current.PlanId != plan.Id {
+			return fmt.Errorf("%w: no matching subscription to renew", ErrPlanOrderNotApplicable)
+		}
+		current.PaidUntil = addPlanPeriod(current.PaidUntil, plan.Period)
+		current.RenewTradeNo = topUp.TradeNo
+		return tx.Model(current).Updates(map[string]interface{}{"paid_until": current.PaidUntil, "renew_trade_no": current.RenewTradeNo}).Error
+	case PlanActionUpgrade:
+		if current == nil {
+			return fmt.Errorf("%w: no subscription to upgrade", ErrPlanOrderNotApplicable)
+		}
+		if err := expireSubscriptionQuota(tx, current.Id); err != nil {
+			return err
+		}
+		current.PlanId = plan.Id
+		current.Status = SubscriptionStatusActive
+		current.PeriodStart = now
+		current.PeriodEnd = addPlanPeriod(now, plan.Period)
+		current.PaidUntil = current.PeriodEnd
+		current.CanceledTime = 0
+		current.PeriodTradeNo = topUp.TradeNo
+		current.RenewTradeNo = ""
+		if err := tx.Save(current).Error; err != nil {
+			return err
+		}
+		return startSubscriptionPeriod(tx, current, &plan)
+	}
+	return fmt.Errorf("%w: unknown plan action %s", ErrPlanOrderNotApplicable, topUp.PlanAction)
+}
+
+// CancelSubscription 取消后不能再续订，已付费的周期结束时订阅失效
+func CancelSubscription(userId int) error {
+	current, err := GetCurrentSubscription(userId)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Status != SubscriptionStatusActive {
+		return errors.New("没有可取消的订阅")
+	}
+	err = DB.Model(current).Updates(map[string]interface{}{
+		"status":        SubscriptionStatusCanceled,
+		"canceled_time": common.GetTimestamp(),
+	}).Error
+	if err == nil {
+		invalidateSubscriptionCache(userId)
+	}
+	return err
+}
+
+func getUserGroupTx(tx *gorm.DB, userId int) (group string, err error) {
+	err = tx.Model(&User{}).Where("id = ?", userId).Select(quoteColumn("group")).Find(&group).Error
+	return group, err
+}
+
+// startSubscriptionPeriod 发放本周期的套餐额度，额度在周期结束时过期，并切换到套餐的分组
+func startSubscriptionPeriod(tx *gorm.DB, subscription *Subscription, plan *Plan) error {
+	if plan.Group != "" {
+		if err := tx.Model(&User{}).Where("id = ?", subscription.UserId).Update("group", plan.Group).Error; err != nil {
+			return err
+		}
+	}
+	if plan.IncludedQuota <= 0 {
+		return nil
+	}
+	reference := subscription.PeriodTradeNo
+	if reference == "" {
+		reference = fmt.Sprintf("subscription:%d", subscription.Id)
+	}
+	return creditQuotaLot(tx, &RechargeRecord{
+		UserID:         uint(subscription.UserId),
+		Amount:         plan.IncludedQuota,
+		StartDate:      subscription.PeriodStart,
+		EndDate:        subscription.PeriodEnd,
+		SubscriptionId: subscription.Id,
+		Source:         LedgerTypeSubscription,
+		Reference:      reference,
+	}, plan.Name)
+}
+
+// expireSubscriptionQuota 作废订阅当前周期未用完的套餐额度
+func expireSubscriptionQuota(tx *gorm.DB, subscriptionId int) error {
+	var records []RechargeRecord
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("subscription_id = ? AND amount > 0", subscriptionId).Find(&records).Error
+	if err != nil {
+		return err
+	}
+	for i := range records {
+		if err := expireRechargeRecord(tx, &records[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advanceSubscription 周期结束时进入已付费的下一周期，没有付费时结束订阅并恢复原来的分组
+func advanceSubscription(subscription *Subscription) error {
+	plan, err := GetPlanById(subscription.PlanId)
+	if err != nil {
+		return err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := expireSubscriptionQuota(tx, subscription.Id); err != nil {
+			return err
+		}
+		if subscription.PaidUntil > subscription.PeriodEnd {
+			subscription.PeriodStart = subscription.PeriodEnd
+			subscription.PeriodEnd = min(addPlanPeriod(subscription.PeriodStart, plan.Period), subscription.PaidUntil)
+			subscription.PeriodTradeNo = subscription.RenewTradeNo
+			subscription.RenewTradeNo = ""
+			if err := tx.Save(subscription).Error; err != nil {
+				return err
+			}
+			return startSubscriptionPeriod(tx, subscription, plan)
+		}
+		return endSubscription(tx, subscription, plan)
+	})
+	if err == nil {
+		invalidateSubscriptionCache(subscription.UserId)
+	}
+	return err
+}
+
+// endSubscription 结束订阅并恢复原来的分组，调用方负责作废未用完的套餐额度
+func endSubscription(tx *gorm.DB, subscription *Subscription, plan *Plan) error {
+	subscription.Status = SubscriptionStatusExpired
+	if err := tx.Save(subscription).Error; err != nil {
+		return err
+	}
+	if plan.Group == "" || subscription.PreviousGroup == "" {
+		return nil
+	}
+	// 期间管理员调整过分组时保留调整后的分组
+	return tx.Model(&User{}).Where("id = ? AND "+quoteColumn("group")+" = ?", subscription.UserId, plan.Group).
+		Update("group", subscription.PreviousGroup).Error
+}
+
+func quoteColumn(name string) string {
+	if common.UsingPostgreSQL {
+		return `"` + name + `"`
+	}
+	return "`" + name + "`"
+}
+
+// StartSubscriptionScheduler 每分钟处理到期的订阅周期
+func StartSubscriptionScheduler() {
+	for {
+		time.Sleep(time.Minute)
+		var subscriptions []*Subscription
+		err := DB.Where("status IN ? AND period_end <= ?", currentSubscriptionStatuses, common.GetTimestamp()).Find(&subscriptions).Error
+		if err != nil {
+			common.SysError("failed to fetch due subscriptions: " + err.Error())
+			continue
+		}
+		for _, subscription := range subscriptions {
+			if err := advanceSubscription(subscription); err != nil {
+				common.SysError(fmt.Sprintf("failed to advance subscription %d: %s", subscription.Id, err.Error()))
+			}
+		}
+	}
+}
+
+// UserSubscriptionInfo 请求鉴权时使用的订阅信息
+type UserSubscriptionInfo struct {
+	SubscriptionId int    `json:"subscription_id"`
+	PlanName       string `json:"plan_name"`
+	Models         string `json:"models"`
+	OverageMode    string `json:"overage_mode"`
+}
+
+func getUserSubscriptionInfo(userId int) (*UserSubscriptionInfo, error) {
+	info := &UserSubscriptionInfo{}
+	subscription, err := GetCurrentSubscription(userId)
+	if err != nil || subscription == nil {
+		return info, err
+	}
+	plan, err := GetPlanById(subscription.PlanId)
+	if err != nil {
+		return info, err
+	}
+	info.SubscriptionId = subscription.Id
+	info.PlanName = plan.Name
+	info.Models = plan.Models
+	info.OverageMode = plan.OverageMode
+	return info, nil
+}
+
+func CacheGetUserSubscriptionInfo(userId int) (*UserSubscriptionInfo, error) {
+	if !common.RedisEnabled {
+		return getUserSubscriptionInfo(userId)
+	}
+	key := fmt.Sprintf("user_subscription:%d", userId)
+	if cached, err := common.RedisGet(key); err == nil {
+		info := &UserSubscriptionInfo{}
+		if json.Unmarshal([]byte(cached), info) == nil {
+			return info, nil
+		}
+	}
+	info, err := getUserSubscriptionInfo(userId)
+	if err != nil {
+		return info, err
+	}
+	data, _ := json.Marshal(info)
+	err = common.RedisSet(key, string(data), time.Duration(UserId2GroupCacheSeconds)*time.Second)
+	if err != nil {
+		common.SysError("Redis set user subscription error: " + err.Error())
+	}
+	return info, nil
+}
+
+func invalidateSubscriptionCache(userId int) {
+	if common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_subscription:%d", userId))
+		_ = common.RedisDel(fmt.Sprintf("user_group:%d", userId))
+		_ = common.RedisDel(fmt.Sprintf("user_quota:%d", userId))
+	}
+}
+
+// CheckSubscriptionAccess 订阅期间只能使用套餐包含的模型，超额规则为 block 时套餐额度用完后拒绝请求
+func CheckSubscriptionAccess(userId int, modelName string) error {
+	info, err := CacheGetUserSubscriptionInfo(userId)
+	if err != nil || info.SubscriptionId == 0 {
+		return err
+	}
+	if info.Models != "" && modelName != "" {
+		allowed := false
+		for _, pattern := range strings.Split(info.Models, ",") {
+			if common.MatchModelName(strings.TrimSpace(pattern), modelName) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("当前套餐「%s」不包含模型：%s", info.PlanName, modelName)
+		}
+	}
+	if info.OverageMode == PlanOverageBlock {
+		remain, err := GetSubscriptionRemainQuota(info.SubscriptionId)
+		if err != nil {
+			return err
+		}
+		if remain <= 0 {
+			return fmt.Errorf("当前套餐「%s」本周期的额度已用完", info.PlanName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gorm.io/gorm"
+)
+
+func createTestPlan(id int, price float64, includedQuota int, overageMode string) *Plan {
+	plan := &Plan{
+		Id:            id,
+		Name:          "plan",
+		Price:         price,
+		Period:        PlanPeriodMonth,
+		IncludedQuota: includedQuota,
+		Group:         "vip",
+		Models:        "gpt-4o*",
+		OverageMode:   overageMode,
+		Status:        PlanStatusEnabled,
+	}
+	if err := plan.Insert(); err != nil {
+		panic(err)
+	}
+	return plan
+}
+
+func applyTestPlanOrder(userId int, planId int, action string, tradeNo string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return applySubscriptionOrder(tx, &TopUp{UserId: userId, PlanId: planId, PlanAction: action, TradeNo: tradeNo})
+	})
+}
+
+func getTestUser(id int) User {
+	var user User
+	DB.First(&user, id)
+	return user
+}
+
+func TestApplySubscriptionOrder(t *testing.T) {
+	Convey("applySubscriptionOrder", t, func() {
+		resetTestDB()
+		createTestUser(1, 0)
+		DB.Model(&User{}).Where("id = ?", 1).Update("group", "default")
+		createTestPlan(1, 10, 1000, PlanOverageBalance)
+
+		Convey("subscribe credits the included quota and switches the group", func() {
+			So(applyTestPlanOrder(1, 1, PlanActionSubscribe, "order-1"), ShouldBeNil)
+			subscription, err := GetCurrentSubscription(1)
+			So(err, ShouldBeNil)
+			So(subscription.PreviousGroup, ShouldEqual, "default")
+			So(subscription.PaidUntil, ShouldEqual, subscription.PeriodEnd)
+			user := getTestUser(1)
+			So(user.Quota, ShouldEqual, 1000)
+			So(user.Group, ShouldEqual, "vip")
+			remain, err := GetSubscriptionRemainQuota(subscription.Id)
+			So(err, ShouldBeNil)
+			So(remain, ShouldEqual, 1000)
+
+			Convey("a second subscribe is not applicable", func() {
+				err := applyTestPlanOrder(1, 1, PlanActionSubscribe, "order-2")
+				So(errors.Is(err, ErrPlanOrderNotApplicable), ShouldBeTrue)
+			})
+			Convey("renew extends the paid period without crediting quota", func() {
+				So(applyTestPlanOrder(1, 1, PlanActionRenew, "order-2"), ShouldBeNil)
+				renewed, _ := GetCurrentSubscription(1)
+				So(renewed.PaidUntil, ShouldEqual, addPlanPeriod(subscription.PeriodEnd, PlanPeriodMonth))
+				So(renewed.RenewTradeNo, ShouldEqual, "order-2")
+				So(getTestUser(1).Quota, ShouldEqual, 1000)
+			})
+			Convey("upgrade expires the old quota and credits the new plan", func() {
+				createTestPlan(2, 20, 3000, PlanOverageBalance)
+				So(applyTestPlanOrder(1, 2, PlanActionUpgrade, "order-2"), ShouldBeNil)
+				upgraded, _ := GetCurrentSubscription(1)
+				So(upgraded.Id, ShouldEqual, subscription.Id)
+				So(upgraded.PlanId, ShouldEqual, 2)
+				So(getTestUser(1).Quota, ShouldEqual, 3000)
+			})
+		})
+		Convey("renew without a subscription is not applicable", func() {
+			err := applyTestPlanOrder(1, 1, PlanActionRenew, "order-1")
+			So(errors.Is(err, ErrPlanOrderNotApplicable), ShouldBeTrue)
+		})
+	})
+}
+
+func TestAdvanceSubscription(t *testing.T) {
+	Convey("advanceSubscription", t, func() {
+		resetTestDB()
+		createTestUser(1, 0)
+		DB.Model(&User{}).Where("id = ?", 1).Update("group", "default")
+		createTestPlan(1, 10, 1000, PlanOverageBalance)
+		So(applyTestPlanOrder(1, 1, PlanActionSubscribe, "order-1"), ShouldBeNil)
+		// 用掉部分套餐额度
+		DB.Model(&RechargeRecord{}).Where("user_id = ?", 1).Update("amount", 600)
+		DB.Model(&User{}).Where("id = ?", 1).Update("quota", 600)
+
+		Convey("an unpaid period ends the subscription and restores the group", func() {
+			subscription, _ := GetCurrentSubscription(1)
+			So(advanceSubscription(subscription), ShouldBeNil)
+			current, _ := GetCurrentSubscription(1)
+			So(current, ShouldBeNil)
+			user := getTestUser(1)
+			So(user.Quota, ShouldEqual, 0)
+			So(user.Group, ShouldEqual, "default")
+		})
+		Convey("a renewed period credits fresh quota", func() {
+			So(applyTestPlanOrder(1, 1, PlanActionRenew, "order-2"), ShouldBeNil)
+			subscription, _ := GetCurrentSubscription(1)
+			periodEnd := subscription.PeriodEnd
+			So(advanceSubscription(subscription), ShouldBeNil)
+			current, _ := GetCurrentSubscription(1)
+			So(current.PeriodStart, ShouldEqual, periodEnd)
+			So(current.PeriodTradeNo, ShouldEqual, "order-2")
+			So(getTestUser(1).Quota, ShouldEqual, 1000)
+			remain, _ := GetSubscriptionRemainQuota(current.Id)
+			So(remain, ShouldEqual, 1000)
+		})
+	})
+}
+
+func TestQuoteSubscriptionOrder(t *testing.T) {
+	Convey("QuoteSubscriptionOrder", t, func() {
+		resetTestDB()
+		createTestUser(1, 0)
+		createTestPlan(1, 10, 1000, PlanOverageBalance)
+		createTestPlan(2, 30, 3000, PlanOverageBalance)
+
+		Convey("subscribe charges the plan price", func() {
+			money, err := QuoteSubscriptionOrder(1, 1, PlanActionSubscribe)
+			So(err, ShouldBeNil)
+			So(money, ShouldEqual, 10)
+		})
+		Convey("upgrade credits the unused part of the paid period", func() {
+			now := time.Now().Unix()
+			DB.Create(&Subscription{UserId: 1, PlanId: 1, Status: SubscriptionStatusActive,
+				PeriodStart: now - 500000, PeriodEnd: now + 500000, PaidUntil: now + 500000})
+			money, err := QuoteSubscriptionOrder(1, 2, PlanActionUpgrade)
+			So(err, ShouldBeNil)
+			So(money, ShouldAlmostEqual, 25, 0.01)
+			_, err = QuoteSubscriptionOrder(1, 1, PlanActionSubscribe)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("an unpaid plan order blocks a new one", func() {
+			DB.Create(&TopUp{UserId: 1, PlanId: 1, Status: TopUpStatusPending, CreateTime: time.Now().Unix(), TradeNo: "pending"})
+			_, err := QuoteSubscriptionOrder(1, 1, PlanActionSubscribe)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestCheckSubscriptionAccess(t *testing.T) {
+	Convey("CheckSubscriptionAccess", t, func() {
+		resetTestDB()
+		createTestUser(1, 0)
+		createTestPlan(1, 10, 1000, PlanOverageBlock)
+		So(applyTestPlanOrder(1, 1, PlanActionSubscribe, "order-1"), ShouldBeNil)
+
+		So(CheckSubscriptionAccess(1, "gpt-4o-mini"), ShouldBeNil)
+		So(CheckSubscriptionAccess(1, "claude-3-haiku"), ShouldNotBeNil)
+		DB.Model(&RechargeRecord{}).Where("user_id = ?", 1).Update("amount", 0)
+		So(CheckSubscriptionAccess(1, "gpt-4o-mini"), ShouldNotBeNil)
+		So(CheckSubscriptionAccess(2, "claude-3-haiku"), ShouldBeNil)
+	})
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TokenRPMKey(tokenId int) string {
+	return "token:rpm:" + strconv.Itoa(tokenId)
+}
+
+func TokenTPMKey(tokenId int) string {
+	return "token:tpm:" + strconv.Itoa(tokenId)
+}
+
+func (token *Token) HasSpendLimit() bool {
+	return token.DailyQuotaLimit > 0 || token.WeeklyQuotaLimit > 0 || token.MonthlyQuotaLimit > 0
+}
+
+// tokenPeriodStarts 返回当前日、周（周一开始）、月的起始时间
+func tokenPeriodStarts(now time.Time) (int64, int64, int64) {
+	year, month, day := now.Date()
+	dayStart := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	weekday := (int(now.Weekday()) + 6) % 7
+	weekStart := dayStart.AddDate(0, 0, -weekday)
+	monthStart := time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+	return dayStart.Unix(), weekStart.Unix(), monthStart.Unix()
+}
+
+// periodUsedQuota 返回当前周期内的消费额度，上次更新早于周期开始时视为已重置
+func (token *Token) periodUsedQuota(now time.Time) (daily int, weekly int, monthly int) {
+	dayStart, weekStart, monthStart := tokenPeriodStarts(now)
+	if token.QuotaPeriodTime >= dayStart {
+		daily = token.DailyUsedQuota
+	}
+	if token.QuotaPeriodTime >= weekStart {
+		weekly = token.WeeklyUsedQuota
+	}
+	if token.QuotaPeriodTime >= monthStart {
+		monthly = token.MonthlyUsedQuota
+	}
+	return
+}
+
+// CheckSpendLimit 检查再消费 quota 后是否超过令牌的日、周、月消费上限
+func (token *Token) CheckSpendLimit(quota int) error {
+	if !token.HasSpendLimit() {
+		return nil
+	}
+	daily, weekly, monthly := token.periodUsedQuota(time.Now())
+	if exceedsSpendLimit(daily, quota, token.DailyQuotaLimit) {
+		return errors.New("该令牌今日消费额度已达上限")
+	}
+	if exceedsSpendLimit(weekly, quota, token.WeeklyQuotaLimit) {
+		return errors.New("该令牌本周消费额度已达上限")
+	}
+	if exceedsSpendLimit(monthly, quota, token.MonthlyQuotaLimit) {
+		return errors.New("该令牌本月消费额度已达上限")
+	}
+	return nil
+}
+
+func exceedsSpendLimit(used int, quota int, limit int) bool {
+	return limit > 0 && (used >= limit || used+quota > limit)
+}
+
+// CheckTokenSpendLimit 从数据库读取最新的周期用量后检查消费上限
+func CheckTokenSpendLimit(tokenId int, quota int) error {
+	token, err := GetTokenById(tokenId)
+	if err != nil {
+		return err
+	}
+	return token.CheckSpendLimit(quota)
+}
+
+// updateTokenPeriodQuota 累加令牌在当前日、周、月的消费额度，跨周期时先清零
+func updateTokenPeriodQuota(token *Token, quota int) error {
+	if !token.HasSpendLimit() || quota == 0 {
+		return nil
+	}
+	now := time.Now()
+	dayStart, weekStart, monthStart := tokenPeriodStarts(now)
+	daily, weekly, monthly := token.periodUsedQuota(now)
+	updates := map[string]interface{}{
+		"quota_period_time": now.Unix(),
+	}
+	if token.QuotaPeriodTime >= dayStart {
+		updates["daily_used_quota"] = gorm.Expr("daily_used_quota + ?", quota)
+	} else {
+		updates["daily_used_quota"] = max(daily+quota, 0)
+	}
+	if token.QuotaPeriodTime >= weekStart {
+		updates["weekly_used_quota"] = gorm.Expr("weekly_used_quota + ?", quota)
+	} else {
+		updates["weekly_used_quota"] = max(weekly+quota, 0)
+	}
+	if token.QuotaPeriodTime >= monthStart {
+		updates["monthly_used_quota"] = gorm.Expr("monthly_used_quota + ?", quota)
+	} else {
+		updates["monthly_used_quota"] = max(monthly+quota, 0)
+	}
+	return DB.Model(&Token{}).Where("id = ?", token.Id).Updates(updates).Error
+}
+
+// AcquireTokenConcurrency 占用令牌的一个并发名额，超过上限时返回 false
+func AcquireTokenConcurrency(tokenId int, maxConcurrency int) bool {
+	return acquireInFlight("token:"+strconv.Itoa(tokenId), maxConcurrency)
+}
+
+func ReleaseTokenConcurrency(tokenId int) {
+	releaseInFlight("token:" + strconv.Itoa(tokenId))
+}
@@ -15,6 +15,7 @@ import (
 type Token struct {
 	Id             int     `json:"id"`
 	UserId         int     `json:"user_id"`
+	OrgId          int     `json:"org_id" gorm:"index;default:0"` // 组织令牌从组织的额度池扣费，UserId 为创建令牌的成员
 	Key            string  `json:"key" gorm:"type:char(255);uniqueIndex"`
 	Status         int     `json:"status" gorm:"default:1"`
 	Name           string  `json:"name" gorm:"index" `
@@ -30,12 +31,24 @@ type Token struct {
 	FixedContent   string  `json:"fixed_content" gorm:"type:varchar(1000);"`
 	Subnet         *string `json:"subnet" gorm:"default:''"` // allowed subnet
 	Version        int64   `json:"version" gorm:"default:0"`
+	// 以下限制为 0 时表示不限制
+	RPM               int   `json:"rpm" gorm:"default:0"`
+	TPM               int   `json:"tpm" gorm:"default:0"`
+	MaxConcurrency    int   `json:"max_concurrency" gorm:"default:0"`
+	DailyQuotaLimit   int   `json:"daily_quota_limit" gorm:"default:0"`
+	WeeklyQuotaLimit  int   `json:"weekly_quota_limit" gorm:"default:0"`
+	MonthlyQuotaLimit int   `json:"monthly_quota_limit" gorm:"default:0"`
+	DailyUsedQuota    int   `json:"daily_used_quota" gorm:"default:0"`
+	WeeklyUsedQuota   int   `json:"weekly_used_quota" gorm:"default:0"`
+	MonthlyUsedQuota  int   `json:"monthly_used_quota" gorm:"default:0"`
+	QuotaPeriodTime   int64 `json:"quota_period_time" gorm:"bigint;default:0"` // 周期用量最后更新的时间
+	HedgeDelay        int   `json:"hedge_delay" gorm:"default:0"`              // 对冲请求的等待时间，单位毫秒，0 时使用模型的配置
 }
 
 func GetAllUserTokens(userId int, startIdx int, num int) ([]*Token, error) {
 	var tokens []*Token
 	var err error
-	err = DB.Where("user_id = ?", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	err = DB.Where("user_id = ? AND org_id = 0", userId).Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
 	return tokens, err
 }
 
@@ -126,13 +139,25 @@ func GetTokenById(id int) (*Token, error) {
 func (token *Token) Insert() error {
 	var err error
 	err = DB.Create(token).Error
+	if err == nil {
+		logLedger(LedgerTypeAdjust, token.UserId, "", "创建令牌", tokenLegs(token.Id, token.RemainQuota)...)
+	}
 	return err
 }
 
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (token *Token) Update() error {
 	var err error
-	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "group", "billing_enabled", "models", "fixed_content", "subnet").Updates(token).Error
+	var oldRemainQuota int
+	err = DB.Model(&Token{}).Where("id = ?", token.Id).Select("remain_quota").Scan(&oldRemainQuota).Error
+	if err != nil {
+		return err
+	}
+	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "group", "billing_enabled", "models", "fixed_content", "subnet",
+		"rpm", "tpm", "max_concurrency", "daily_quota_limit", "weekly_quota_limit", "monthly_quota_limit", "hedge_delay").Updates(token).Error
+	if err == nil && token.RemainQuota != oldRemainQuota {
+		logLedger(LedgerTypeAdjust, token.UserId, "", "修改令牌剩余额度", tokenLegs(token.Id, token.RemainQuota-oldRemainQuota)...)
+	}
 	return err
 }
 
@@ -238,16 +263,60 @@ func decreaseTokenQuota(id int, quota int) error {
 	return errors.New("failed to update token quota after max retries")
 }
 
+// PostConsumeTokenQuota 扣除没有预扣费的请求的费用，quota 为负数时退还
 func PostConsumeTokenQuota(tokenId int, quota int) (err error) {
-	token, err := GetTokenById(tokenId)
-	if quota > 0 {
-		err = DecreaseUserQuota(token.UserId, quota)
-	} else {
-		err = IncreaseUserQuota(token.UserId, -quota)
+	token, err := postConsumeTokenQuota(tokenId, quota)
+	if err != nil {
+		return err
+	}
+	entryType := LedgerTypeConsume
+	if quota < 0 {
+		entryType = LedgerTypeRefund
+	}
+	// 组织额度池不分批次
+	if token.OrgId == 0 {
+		if quota < 0 {
+			refundQuotaLot(token.UserId, -quota)
+		} else {
+			ConsumeQuotaLots(token.UserId, quota)
+		}
+	}
+	logLedger(entryType, token.UserId, "", "", settleLegs(token, 0, quota)...)
+	return nil
+}
+
+// SettleTokenQuota 结算预扣费的请求，quotaDelta 为实际费用与预扣费的差额
+func SettleTokenQuota(tokenId int, preConsumedQuota int, quotaDelta int) (err error) {
+	token, err := postConsumeTokenQuota(tokenId, quotaDelta)
+	if err != nil {
+		return err
+	}
+	if token.OrgId == 0 {
+		ConsumeQuotaLots(token.UserId, preConsumedQuota+quotaDelta)
 	}
+	logLedger(LedgerTypeConsume, token.UserId, "", "", settleLegs(token, preConsumedQuota, quotaDelta)...)
+	return nil
+}
+
+// ReturnPreConsumedTokenQuota 请求失败时退还预扣费
+func ReturnPreConsumedTokenQuota(tokenId int, preConsumedQuota int) (err error) {
+	token, err := postConsumeTokenQuota(tokenId, -preConsumedQuota)
 	if err != nil {
 		return err
 	}
+	logLedger(LedgerTypeRefund, token.UserId, "", "", settleLegs(token, preConsumedQuota, -preConsumedQuota)...)
+	return nil
+}
+
+func postConsumeTokenQuota(tokenId int, quota int) (token *Token, err error) {
+	token, err = GetTokenById(tokenId)
+	if err != nil {
+		return nil, err
+	}
+	err = changePayerQuota(token, quota)
+	if err != nil {
+		return nil, err
+	}
 	if !token.UnlimitedQuota {
 		if quota > 0 {
 			err = DecreaseTokenQuota(tokenId, quota)
@@ -255,10 +324,10 @@ func PostConsumeTokenQuota(tokenId int, quota int) (err error) {
 			err = IncreaseTokenQuota(tokenId, -quota)
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
-	return nil
+	return token, updateTokenPeriodQuota(token, quota)
 }
 
 func PreConsumeTokenQuota(tokenId int, quota int) (err error) {
@@ -272,16 +341,22 @@ func PreConsumeTokenQuota(tokenId int, quota int) (err error) {
 	if !token.UnlimitedQuota && token.RemainQuota < quota {
 		return errors.New("令牌额度不足")
 	}
-	userQuota, err := GetUserQuota(token.UserId)
+	if err = token.CheckSpendLimit(quota); err != nil {
+		return err
+	}
+	userQuota, err := GetPayerQuota(token.UserId, token.OrgId)
 	if err != nil {
 		return err
 	}
 	if userQuota < quota {
+		if token.OrgId != 0 {
+			return errors.New("组织额度不足或已超出成员的每月消费上限")
+		}
 		return errors.New("用户额度不足")
 	}
 	quotaTooLow := userQuota >= config.QuotaRemindThreshold && userQuota-quota < config.QuotaRemindThreshold
 	noMoreQuota := userQuota-quota <= 0
-	if quotaTooLow || noMoreQuota {
+	if token.OrgId == 0 && (quotaTooLow || noMoreQuota) {
 		go func() {
 			email, err := GetUserEmail(token.UserId)
 			if err != nil {
@@ -307,6 +382,22 @@ func PreConsumeTokenQuota(tokenId int, quota int) (err error) {
 			return err
 		}
 	}
-	err = DecreaseUserQuota(token.UserId, quota)
-	return err
+	err = updateTokenPeriodQuota(token, quota)
+	if err != nil {
+		return err
+	}
+	err = changePayerQuota(token, quota)
+	if err != nil {
+		return err
+	}
+	payer, payerId := token.payerAccount()
+	legs := []ledgerLeg{
+		{account: payer, accountId: payerId, amount: -quota},
+		{account: LedgerAccountHold, accountId: token.UserId, amount: quota},
+	}
+	if !token.UnlimitedQuota {
+		legs = append(legs, tokenLegs(tokenId, -quota)...)
+	}
+	logLedger(LedgerTypeHold, token.UserId, "", "", legs...)
+	return nil
 }
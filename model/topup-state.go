@@ -0,0 +1,437 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"one-api/common"
+	"one-api/common/config"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 充值订单的状态只能按以下路径变化，每次变化都记入 TopUpEvent：
+// pending -> success | closed | failed，关闭后收到支付时 closed -> success | failed，success | failed -> refunding -> refunded | partially_refunded，服务商确认没有退款时恢复退款前的状态，
+// 退款结果未知时保持 refunding，由对账任务向服务商查询后完成或撤销。
+// failed 为已支付但套餐无法开通的订单，需要管理员退款
+const (
+	TopUpStatusPending           = "pending"
+	TopUpStatusSuccess           = "success"
+	TopUpStatusClosed            = "closed"
+	TopUpStatusFailed            = "failed"
+	TopUpStatusRefunding         = "refunding"
+	TopUpStatusRefunded          = "refunded"
+	TopUpStatusPartiallyRefunded = "partially_refunded"
+)
+
+// 状态变化的来源
+const (
+	TopUpEventSourceWebhook    = "webhook"
+	TopUpEventSourceReconciler = "reconciler"
+	TopUpEventSourceAdmin      = "admin"
+	TopUpEventSourceCheckout   = "checkout" // 拉起支付
+)
+
+// TopUpEvent 充值订单的状态变化记录
+type TopUpEvent struct {
+	Id         int    `json:"id"`
+	TopUpId    int    `json:"top_up_id" gorm:"index"`
+	TradeNo    string `json:"trade_no" gorm:"type:varchar(64)"`
+	FromStatus string `json:"from_status" gorm:"type:varchar(32)"`
+	ToStatus   string `json:"to_status" gorm:"type:varchar(32)"`
+	Source     string `json:"source" gorm:"type:varchar(16)"`
+	OperatorId int    `json:"operator_id" gorm:"default:0"`
+	Remark     string `json:"remark"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint"`
+}
+
+// TopUpRefund 一次退款扣回的额度和退还的金额，FromStatus 为退款前的订单状态，退款失败时恢复
+type TopUpRefund struct {
+	Quota      int     `json:"quota"`
+	Money      float64 `json:"money"`
+	FromStatus string  `json:"-"`
+}
+
+// transitTopUp 仅当订单处于 from 状态时改为 to，返回是否发生了变化，用于保证回调和对账重复处理同一订单时只生效一次
+func transitTopUp(tx *gorm.DB, topUp *TopUp, from string, to string, source string, operatorId int, remark string, fields map[string]interface{}) (bool, error) {
+	updates := map[string]interface{}{"status": to}
+	for k, v := range fields {
+		updates[k] = v
+	}
+	result := tx.Model(&TopUp{}).Where("id = ? AND status = ?", topUp.Id, from).Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	topUp.Status = to
+	err := tx.Create(&TopUpEvent{
+		TopUpId:    topUp.Id,
+		TradeNo:    topUp.TradeNo,
+		FromStatus: from,
+		ToStatus:   to,
+		Source:     source,
+		OperatorId: operatorId,
+		Remark:     remark,
+		CreatedAt:  time.Now().Unix(),
+	}).Error
+	return err == nil, err
+}
+
+// TopUpQuota 充值订单发放的额度
+func (topUp *TopUp) TopUpQuota() int {
+	return int(float64(topUp.Amount) * config.QuotaPerUnit)
+}
+
+// CompleteTopUp 将待支付或已关闭的订单标记为已支付并发放额度或开通套餐，订单已经处理过时返回 false。
+// 套餐无法开通时订单改为 failed，返回的错误包含 ErrPlanOrderNotApplicable
+func CompleteTopUp(topUp *TopUp, providerOrderId string, providerPaymentId string, source string) (bool, error) {
+	from := topUp.Status
+	if from != TopUpStatusPending && from != TopUpStatusClosed {
+		return false, nil
+	}
+	remark := ""
+	if from == TopUpStatusClosed {
+		remark = "订单关闭后收到支付"
+	}
+	fields := map[string]interface{}{}
+	if providerOrderId != "" {
+		fields["provider_order_id"] = providerOrderId
+		topUp.ProviderOrderId = providerOrderId
+	}
+	if providerPaymentId != "" {
+		fields["provider_payment_id"] = providerPaymentId
+		topUp.ProviderPaymentId = providerPaymentId
+	}
+	completed := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		ok, err := transitTopUp(tx, topUp, from, TopUpStatusSuccess, source, 0, remark, fields)
+		if err != nil || !ok {
+			return err
+		}
+		completed = true
+		if topUp.PlanId != 0 {
+			return applySubscriptionOrder(tx, topUp)
+		}
+		expireAt, err := QuotaExpireAtByDays(topUp.TopupRatio)
+		if err != nil {
+			return err
+		}
+		return creditQuotaLot(tx, &RechargeRecord{
+			UserID:    uint(topUp.UserId),
+			Amount:    topUp.TopUpQuota(),
+			EndDate:   expireAt,
+			Source:    LedgerTypeTopUp,
+			Reference: topUp.TradeNo,
+		}, "在线充值")
+	})
+	if err != nil {
+		topUp.Status = from
+		if errors.Is(err, ErrPlanOrderNotApplicable) {
+			if _, failErr := transitTopUp(DB, topUp, from, TopUpStatusFailed, source, 0, err.Error(), fields); failErr != nil {
+				return false, failErr
+			}
+		}
+		return false, err
+	}
+	if completed && topUp.PlanId != 0 {
+		invalidateSubscriptionCache(topUp.UserId)
+	} else if completed && common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_quota:%d", topUp.UserId))
+	}
+	return completed, nil
+}
+
+// CloseTopUp 关闭未支付的订单
+func CloseTopUp(topUp *TopUp, source string, remark string) (bool, error) {
+	return transitTopUp(DB, topUp, TopUpStatusPending, TopUpStatusClosed, source, 0, remark, nil)
+}
+
+// GetStaleRefundingTopUps 获取开始退款的时间早于 before 且 id 大于 afterId 的退款中订单
+func GetStaleRefundingTopUps(before int64, afterId int, limit int) (topUps []*TopUp, err error) {
+	err = DB.Where("status = ? AND refund_time < ? AND id > ?", TopUpStatusRefunding, before, afterId).Order("id asc").Limit(limit).Find(&topUps).Error
+	return topUps, err
+}
+
+// PendingRefund 退款中的订单正在进行的退款
+func (topUp *TopUp) PendingRefund() *TopUpRefund {
+	return &TopUpRefund{Quota: topUp.RefundingQuota, Money: topUp.RefundingMoney, FromStatus: topUp.RefundFromStatus}
+}
+
+// GetStalePendingTopUps 获取创建时间早于 before 且 id 大于 afterId 的待支付订单
+func GetStalePendingTopUps(before int64, afterId int, limit int) (topUps []*TopUp, err error) {
+	err = DB.Where("status = ? AND create_time < ? AND id > ?", TopUpStatusPending, before, afterId).Order("id asc").Limit(limit).Find(&topUps).Error
+	return topUps, err
+}
+
+// lotSource 订单发放的额度批次的来源
+func (topUp *TopUp) lotSource() string {
+	if topUp.PlanId != 0 {
+		return LedgerTypeSubscription
+	}
+	return LedgerTypeTopUp
+}
+
+func lockTopUpLots(tx *gorm.DB, topUp *TopUp) (lots []RechargeRecord, err error) {
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND source = ? AND reference = ?", topUp.UserId, topUp.lotSource(), topUp.TradeNo).Find(&lots).Error
+	return lots, err
+}
+
+// prorate 按比例计算退款金额，舍去不足一分的部分
+func prorate(money float64, part int64, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Floor(money*float64(part)/float64(total)*100+1e-6) / 100
+}
+
+// reservePlanOrderRefund 计算套餐订单可以退款的金额：已续订但未开始的周期全额退款，
+// 当前周期按剩余的套餐额度比例退款，套餐不含额度时按剩余时间比例退款
+func reservePlanOrderRefund(tx *gorm.DB, topUp *TopUp, refund *TopUpRefund, userQuota int) ([]RechargeRecord, error) {
+	var subscriptions []Subscription
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND status IN ?", topUp.UserId, currentSubscriptionStatuses).
+		Order("id desc").Limit(1).Find(&subscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(subscriptions) > 0 && subscriptions[0].RenewTradeNo == topUp.TradeNo {
+		refund.Money = topUp.Money
+		return nil, nil
+	}
+	if len(subscriptions) == 0 || subscriptions[0].PeriodTradeNo != topUp.TradeNo {
+		return nil, errors.New("订单对应的套餐周期已经结束，没有可以退款的金额")
+	}
+	subscription := subscriptions[0]
+	if subscription.PaidUntil > subscription.PeriodEnd {
+		return nil, fmt.Errorf("请先退款已续订的下一周期订单 %s", subscription.RenewTradeNo)
+	}
+	lots, err := lockTopUpLots(tx, topUp)
+	if err != nil {
+		return nil, err
+	}
+	credited, remaining := 0, 0
+	for _, lot := range lots {
+		credited += lot.OriginalAmount
+		remaining += lot.Amount
+	}
+	if credited == 0 {
+		left := max(subscription.PeriodEnd-time.Now().Unix(), 0)
+		refund.Money = prorate(topUp.Money, left, subscription.PeriodEnd-subscription.PeriodStart)
+		return nil, nil
+	}
+	refund.Quota = min(remaining, max(userQuota, 0))
+	refund.Money = prorate(topUp.Money, int64(refund.Quota), int64(credited))
+	return lots, nil
+}
+
+// ReserveTopUpRefund 退款前先扣回订单发放的额度并将订单改为退款中。
+// 额度已经部分消费时只扣回剩余的部分，并按比例计算退款金额；套餐无法开通的失败订单全额退款
+func ReserveTopUpRefund(topUpId int, operatorId int, reason string) (*TopUp, *TopUpRefund, error) {
+	topUp := GetTopUpById(topUpId)
+	if topUp == nil {
+		return nil, nil, errors.New("订单不存在")
+	}
+	if topUp.Status != TopUpStatusSuccess && topUp.Status != TopUpStatusFailed {
+		return nil, nil, errors.New("只有已支付的订单可以退款")
+	}
+	refund := &TopUpRefund{FromStatus: topUp.Status}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", topUp.UserId).First(&user).Error; err != nil {
+			return err
+		}
+		var lots []RechargeRecord
+		var err error
+		switch {
+		case topUp.Status == TopUpStatusFailed:
+			refund.Money = topUp.Money
+		case topUp.PlanId != 0:
+			lots, err = reservePlanOrderRefund(tx, topUp, refund, user.Quota)
+		default:
+			lots, err = lockTopUpLots(tx, topUp)
+			credited := topUp.TopUpQuota()
+			remaining := 0
+			for _, lot := range lots {
+				remaining += lot.Amount
+			}
+			// 预扣费冻结的额度不能扣回
+			refund.Quota = min(remaining, credited, max(user.Quota, 0))
+			refund.Money = prorate(topUp.Money, int64(refund.Quota), int64(credited))
+		}
+		if err != nil {
+			return err
+		}
+		if refund.Money <= 0 {
+			return errors.New("订单充值的额度已经用完或已过期，没有可以退款的金额")
+		}
+		remark := fmt.Sprintf("%s，扣回额度 %d，退款金额 %.2f", reason, refund.Quota, refund.Money)
+		fields := map[string]interface{}{
+			"refunding_money":    refund.Money,
+			"refunding_quota":    refund.Quota,
+			"refund_from_status": refund.FromStatus,
+			"refund_time":        time.Now().Unix(),
+		}
+		ok, err := transitTopUp(tx, topUp, refund.FromStatus, TopUpStatusRefunding, TopUpEventSourceAdmin, operatorId, remark, fields)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("订单状态已经变化，请刷新后重试")
+		}
+		topUp.RefundingMoney, topUp.RefundingQuota, topUp.RefundFromStatus = refund.Money, refund.Quota, refund.FromStatus
+		topUp.RefundTime = fields["refund_time"].(int64)
+		if refund.Quota == 0 {
+			return nil
+		}
+		left := refund.Quota
+		for i := range lots {
+			if left <= 0 {
+				break
+			}
+			used, err := debitLot(tx, &lots[i], left)
+			if err != nil {
+				return err
+			}
+			left -= used
+		}
+		if left > 0 {
+			return errors.New("订单的额度已经变化，请重试")
+		}
+		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota - ?", refund.Quota)).Error
+		if err != nil {
+			return err
+		}
+		return recordLedger(tx, LedgerTypeTopUpRefund, topUp.UserId, topUp.TradeNo, reason, userLegs(topUp.UserId, LedgerAccountIssuance, 0, -refund.Quota)...)
+	})
+	if err != nil {
+		topUp.Status = refund.FromStatus
+		return nil, nil, err
+	}
+	if common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_quota:%d", topUp.UserId))
+	}
+	return topUp, refund, nil
+}
+
+// finishPlanOrderRefund 套餐订单退款成功后取消已续订的周期，或者结束订单对应的当前周期
+func finishPlanOrderRefund(tx *gorm.DB, topUp *TopUp) error {
+	var subscriptions []Subscription
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ? AND status IN ?", topUp.UserId, currentSubscriptionStatuses).
+		Order("id desc").Limit(1).Find(&subscriptions).Error
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+	subscription := &subscriptions[0]
+	switch topUp.TradeNo {
+	case subscription.RenewTradeNo:
+		return tx.Model(subscription).Updates(map[string]interface{}{"paid_until": subscription.PeriodEnd, "renew_trade_no": ""}).Error
+	case subscription.PeriodTradeNo:
+		var plan Plan
+		if err := tx.First(&plan, "id = ?", subscription.PlanId).Error; err != nil {
+			return err
+		}
+		if err := expireSubscriptionQuota(tx, subscription.Id); err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		subscription.PeriodEnd = now
+		subscription.PaidUntil = now
+		return endSubscription(tx, subscription, &plan)
+	}
+	return nil
+}
+
+// refundDoneFields 退款结束时清除退款中的信息
+func refundDoneFields() map[string]interface{} {
+	return map[string]interface{}{"refunding_money": 0, "refunding_quota": 0, "refund_from_status": ""}
+}
+
+// FinishTopUpRefund 服务商退款成功，source 为确认退款结果的来源
+func FinishTopUpRefund(topUp *TopUp, refund *TopUpRefund, source string, operatorId int) error {
+	status := TopUpStatusRefunded
+	if refund.Money < topUp.Money {
+		status = TopUpStatusPartiallyRefunded
+	}
+	fields := refundDoneFields()
+	fields["refunded_money"] = refund.Money
+	fields["refunded_quota"] = refund.Quota
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		ok, err := transitTopUp(tx, topUp, TopUpStatusRefunding, status, source, operatorId, "", fields)
+		if err == nil && !ok {
+			err = errors.New("订单不在退款中")
+		}
+		if err != nil || topUp.PlanId == 0 || refund.FromStatus != TopUpStatusSuccess {
+			return err
+		}
+		return finishPlanOrderRefund(tx, topUp)
+	})
+	if err != nil {
+		topUp.Status = TopUpStatusRefunding
+		return err
+	}
+	if topUp.PlanId != 0 {
+		invalidateSubscriptionCache(topUp.UserId)
+	}
+	topUp.RefundedMoney = refund.Money
+	topUp.RefundedQuota = refund.Quota
+	topUp.RefundingMoney, topUp.RefundingQuota, topUp.RefundFromStatus = 0, 0, ""
+	return nil
+}
+
+// RollbackTopUpRefund 服务商确认没有退款，退还扣回的额度并恢复订单状态
+func RollbackTopUpRefund(topUp *TopUp, refund *TopUpRefund, source string, operatorId int, reason string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		ok, err := transitTopUp(tx, topUp, TopUpStatusRefunding, refund.FromStatus, source, operatorId, reason, refundDoneFields())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("订单不在退款中")
+		}
+		if refund.Quota == 0 {
+			return nil
+		}
+		// 额度退回原来的批次，保留原来的过期时间
+		lots, err := lockTopUpLots(tx, topUp)
+		if err != nil {
+			return err
+		}
+		left := refund.Quota
+		for i := range lots {
+			restored := min(lots[i].OriginalAmount-lots[i].Amount, left)
+			if restored <= 0 {
+				continue
+			}
+			if err := tx.Model(&RechargeRecord{}).Where("id = ?", lots[i].ID).Update("amount", gorm.Expr("amount + ?", restored)).Error; err != nil {
+				return err
+			}
+			left -= restored
+		}
+		if left > 0 {
+			return fmt.Errorf("quota lots of top-up %s can not hold %d", topUp.TradeNo, left)
+		}
+		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", refund.Quota)).Error
+		if err != nil {
+			return err
+		}
+		return recordLedger(tx, LedgerTypeTopUpRefund, topUp.UserId, topUp.TradeNo, "退款失败退还额度", userLegs(topUp.UserId, LedgerAccountIssuance, 0, refund.Quota)...)
+	})
+	if err != nil {
+		topUp.Status = TopUpStatusRefunding
+		return err
+	}
+	topUp.RefundingMoney, topUp.RefundingQuota, topUp.RefundFromStatus = 0, 0, ""
+	if common.RedisEnabled {
+		_ = common.RedisDel(fmt.Sprintf("user_quota:%d", topUp.UserId))
+	}
+	return nil
+}
+
+func GetTopUpEvents(topUpId int) (events []*TopUpEvent, err error) {
+	err = DB.Where("top_up_id = ?", topUpId).Order("id asc").Find(&events).Error
+	return events, err
+}
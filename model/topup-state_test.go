@@ -0,0 +1,151 @@
+package model
+
+import (
+	"one-api/common/config"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProrate(t *testing.T) {
+	cases := []struct {
+		money  float64
+		part   int64
+		total  int64
+		expect float64
+	}{
+		{10, 50, 100, 5},
+		{10, 1, 3, 3.33},
+		{9.99, 2, 3, 6.66},
+		{10, 100, 100, 10},
+		{10, 0, 100, 0},
+		{10, 50, 0, 0},
+	}
+	Convey("TestProrate", t, func() {
+		for _, c := range cases {
+			So(prorate(c.money, c.part, c.total), ShouldEqual, c.expect)
+		}
+	})
+}
+
+func TestReserveTopUpRefund(t *testing.T) {
+	credited := int(config.QuotaPerUnit)
+	cases := []struct {
+		name      string
+		status    string
+		userQuota int
+		lotAmount int
+		quota     int
+		money     float64
+		fails     bool
+	}{
+		{"unused order", TopUpStatusSuccess, credited, credited, credited, 10, false},
+		{"half consumed", TopUpStatusSuccess, credited, credited / 2, credited / 2, 5, false},
+		{"quota frozen by pre-consumption", TopUpStatusSuccess, credited / 4, credited / 2, credited / 4, 2.5, false},
+		{"fully consumed", TopUpStatusSuccess, credited, 0, 0, 0, true},
+		{"failed plan order", TopUpStatusFailed, 0, 0, 0, 10, false},
+		{"pending order", TopUpStatusPending, credited, credited, 0, 0, true},
+	}
+	Convey("TestReserveTopUpRefund", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				resetTestDB()
+				createTestUser(1, c.userQuota)
+				DB.Create(&TopUp{Id: 1, UserId: 1, Amount: 1, Money: 10, TradeNo: "T1", Status: c.status})
+				DB.Create(&RechargeRecord{UserID: 1, Amount: c.lotAmount, OriginalAmount: credited, EndDate: -1, Source: LedgerTypeTopUp, Reference: "T1"})
+				topUp, refund, err := ReserveTopUpRefund(1, 0, "test")
+				if c.fails {
+					So(err, ShouldNotBeNil)
+					So(GetTopUpById(1).Status, ShouldEqual, c.status)
+					return
+				}
+				So(err, ShouldBeNil)
+				So(topUp.Status, ShouldEqual, TopUpStatusRefunding)
+				So(refund.FromStatus, ShouldEqual, c.status)
+				So(refund.Quota, ShouldEqual, c.quota)
+				So(refund.Money, ShouldEqual, c.money)
+				user, _ := GetUserById(1, false)
+				So(user.Quota, ShouldEqual, c.userQuota-c.quota)
+				var lot RechargeRecord
+				DB.First(&lot)
+				So(lot.Amount, ShouldEqual, c.lotAmount-c.quota)
+			})
+		}
+	})
+}
+
+func TestReservePlanOrderRefund(t *testing.T) {
+	now := time.Now().Unix()
+	Convey("TestReservePlanOrderRefund", t, func() {
+		resetTestDB()
+		createTestUser(1, 0)
+		DB.Create(&Subscription{UserId: 1, PlanId: 1, Status: SubscriptionStatusActive, PeriodStart: now - 100, PeriodEnd: now + 100,
+			PaidUntil: now + 300, PeriodTradeNo: "T1", RenewTradeNo: "T2"})
+		DB.Create(&TopUp{Id: 1, UserId: 1, Money: 10, TradeNo: "T1", Status: TopUpStatusSuccess, PlanId: 1})
+		DB.Create(&TopUp{Id: 2, UserId: 1, Money: 10, TradeNo: "T2", Status: TopUpStatusSuccess, PlanId: 1})
+		Convey("current period is blocked by a prepaid renewal", func() {
+			_, _, err := ReserveTopUpRefund(1, 0, "test")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("renewal not yet started is fully refunded", func() {
+			_, refund, err := ReserveTopUpRefund(2, 0, "test")
+			So(err, ShouldBeNil)
+			So(refund.Quota, ShouldEqual, 0)
+			So(refund.Money, ShouldEqual, 10)
+		})
+	})
+}
+
+func TestResolveTopUpRefund(t *testing.T) {
+	credited := int(config.QuotaPerUnit)
+	Convey("TestResolveTopUpRefund", t, func() {
+		resetTestDB()
+		createTestUser(1, credited)
+		DB.Create(&TopUp{Id: 1, UserId: 1, Amount: 1, Money: 10, TradeNo: "T1", Status: TopUpStatusSuccess})
+		DB.Create(&RechargeRecord{UserID: 1, Amount: credited, OriginalAmount: credited, EndDate: -1, Source: LedgerTypeTopUp, Reference: "T1"})
+		_, _, err := ReserveTopUpRefund(1, 0, "test")
+		So(err, ShouldBeNil)
+
+		// 退款中的订单保存了正在进行的退款，对账任务可以据此完成或撤销
+		topUps, err := GetStaleRefundingTopUps(time.Now().Unix()+1, 0, 10)
+		So(err, ShouldBeNil)
+		So(len(topUps), ShouldEqual, 1)
+		topUp := topUps[0]
+		refund := topUp.PendingRefund()
+		So(refund.Quota, ShouldEqual, credited)
+		So(refund.Money, ShouldEqual, 10)
+		So(refund.FromStatus, ShouldEqual, TopUpStatusSuccess)
+		topUps, _ = GetStaleRefundingTopUps(topUp.RefundTime, 0, 10)
+		So(len(topUps), ShouldEqual, 0)
+
+		Convey("finish", func() {
+			So(FinishTopUpRefund(topUp, refund, TopUpEventSourceReconciler, 0), ShouldBeNil)
+			saved := GetTopUpById(1)
+			So(saved.Status, ShouldEqual, TopUpStatusRefunded)
+			So(saved.RefundedMoney, ShouldEqual, 10)
+			So(saved.RefundingQuota, ShouldEqual, 0)
+			So(saved.RefundFromStatus, ShouldEqual, "")
+			var user User
+			DB.First(&user, 1)
+			So(user.Quota, ShouldEqual, 0)
+		})
+		Convey("rollback", func() {
+			So(RollbackTopUpRefund(topUp, refund, TopUpEventSourceReconciler, 0, "test"), ShouldBeNil)
+			saved := GetTopUpById(1)
+			So(saved.Status, ShouldEqual, TopUpStatusSuccess)
+			So(saved.RefundingQuota, ShouldEqual, 0)
+			var user User
+			DB.First(&user, 1)
+			So(user.Quota, ShouldEqual, credited)
+			// 撤销后可以再次退款
+			_, _, err := ReserveTopUpRefund(1, 0, "test")
+			So(err, ShouldBeNil)
+		})
+		Convey("only once", func() {
+			So(FinishTopUpRefund(topUp, refund, TopUpEventSourceReconciler, 0), ShouldBeNil)
+			So(RollbackTopUpRefund(GetTopUpById(1), refund, TopUpEventSourceReconciler, 0, "test"), ShouldNotBeNil)
+			So(GetTopUpById(1).Status, ShouldEqual, TopUpStatusRefunded)
+		})
+	})
+}
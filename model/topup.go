@@ -11,6 +11,23 @@ type TopUp struct {
 	TradeNo    string  `json:"trade_no"`
 	CreateTime int64   `json:"create_time"`
 	Status     string  `json:"status"`
+	// 套餐订单关联的套餐和操作，普通充值为空
+	PlanId     int    `json:"plan_id" gorm:"default:0"`
+	PlanAction string `json:"plan_action" gorm:"type:varchar(16)"`
+	// 支付服务商和币种，Money 按 Currency 计价
+	Provider string `json:"provider" gorm:"type:varchar(16);default:'epay'"`
+	Currency string `json:"currency" gorm:"type:varchar(8);default:'CNY'"`
+	// 服务商的订单号和支付号，退款和查单时使用
+	ProviderOrderId   string `json:"provider_order_id" gorm:"type:varchar(128)"`
+	ProviderPaymentId string `json:"provider_payment_id" gorm:"type:varchar(128)"`
+	// 已退款的金额和扣回的额度
+	RefundedMoney float64 `json:"refunded_money" gorm:"default:0"`
+	RefundedQuota int     `json:"refunded_quota" gorm:"default:0"`
+	// 退款中的订单正在退还的金额、扣回的额度、退款前的状态和开始退款的时间，对账任务据此完成或撤销退款
+	RefundingMoney   float64 `json:"refunding_money" gorm:"default:0"`
+	RefundingQuota   int     `json:"refunding_quota" gorm:"default:0"`
+	RefundFromStatus string  `json:"refund_from_status" gorm:"type:varchar(32)"`
+	RefundTime       int64   `json:"refund_time" gorm:"default:0"`
 }
 
 type TopUpQueryParams struct {
@@ -32,6 +49,11 @@ func (topUp *TopUp) Update() error {
 	return err
 }
 
+// UpdateProviderOrderId 保存拉起支付时服务商返回的订单号，只更新这一列，避免覆盖回调修改的状态
+func (topUp *TopUp) UpdateProviderOrderId() error {
+	return DB.Model(&TopUp{}).Where("id = ?", topUp.Id).Update("provider_order_id", topUp.ProviderOrderId).Error
+}
+
 func GetTopUpById(id int) *TopUp {
 	var topUp *TopUp
 	var err error
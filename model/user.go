@@ -44,14 +44,20 @@ type User struct {
 }
 
 type RechargeRecord struct {
-	ID        uint  `gorm:"primaryKey" json:"id"` // 充值记录ID
-	UserID    uint  `gorm:"index" json:"user_id"` // 对应的用户ID
-	Amount    int   `json:"amount"`               // 充值额度
-	StartDate int64 `json:"start_date"`           // 充值的起始时间
-	EndDate   int64 `json:"end_date"`             // 充值的结束时间
-	CreatedAt int64 `json:"created_at"`           // 创建时间戳
-	UpdatedAt int64 `json:"updated_at"`           // 更新时间戳
-	Version   int64 `json:"version" gorm:"type:bigint;default:0"`
+	ID             uint   `gorm:"primaryKey" json:"id"` // 充值记录ID
+	UserID         uint   `gorm:"index" json:"user_id"` // 对应的用户ID
+	Amount         int    `json:"amount"`               // 充值额度
+	StartDate      int64  `json:"start_date"`           // 充值的起始时间
+	EndDate        int64  `json:"end_date"`             // 充值的结束时间
+	CreatedAt      int64  `json:"created_at"`           // 创建时间戳
+	UpdatedAt      int64  `json:"updated_at"`           // 更新时间戳
+	Version        int64  `json:"version" gorm:"type:bigint;default:0"`
+	SubscriptionId int    `json:"subscription_id" gorm:"index;default:0"` // 订阅套餐发放的额度对应的订阅，普通充值为 0
+	Source         string `json:"source" gorm:"type:varchar(32);index"`   // 额度来源，与账本类型一致
+	OriginalAmount int    `json:"original_amount"`                        // 发放时的额度
+	Promotional    bool   `json:"promotional"`                            // 是否为赠送额度
+	Reference      string `json:"reference" gorm:"type:varchar(128)"`     // 订单号、兑换码等
+	NotifiedAt     int64  `json:"notified_at" gorm:"bigint;default:0"`    // 发送过期提醒的时间
 }
 
 // CheckUserExistOrDeleted check if user exist or deleted, if not exist, return false, nil, if deleted or exist, return true, nil
@@ -201,13 +207,22 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 
 	// 更新用户额度
 	user.AffQuota -= transferAmount
-	user.Quota += transferAmount
 
 	// 保存用户状态
 	if err := tx.Save(user).Error; err != nil {
 		return err
 	}
 
+	err = creditQuotaLot(tx, &RechargeRecord{
+		UserID:  uint(user.Id),
+		Amount:  transferAmount,
+		EndDate: PromoQuotaExpireAt(),
+		Source:  LedgerTypeAffiliate,
+	}, "邀请额度转入余额")
+	if err != nil {
+		return err
+	}
+
 	// 提交事务
 	return tx.Commit().Error
 }
@@ -290,7 +305,7 @@ func (user *User) Insert(inviterId int) error {
 			return err
 		}
 	}
-	user.Quota = config.QuotaForNewUser
+	user.Quota = 0
 	user.AccessToken = common.GetUUID()
 	user.AffCode = common.GetRandomString(4)
 	result := DB.Create(user)
@@ -298,11 +313,18 @@ func (user *User) Insert(inviterId int) error {
 		return result.Error
 	}
 	if config.QuotaForNewUser > 0 {
+		err = CreditUserQuota(user.Id, config.QuotaForNewUser, LedgerTypeGift, PromoQuotaExpireAt(), "", "新用户注册赠送")
+		if err != nil {
+			common.SysError("failed to credit quota for new user: " + err.Error())
+		}
 		RecordLog(user.Id, LogTypeSystem, 0, fmt.Sprintf("新用户注册赠送 %s", common.LogQuota(config.QuotaForNewUser)))
 	}
 	if inviterId != 0 {
 		if config.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, config.QuotaForInvitee)
+			err = CreditUserQuota(user.Id, config.QuotaForInvitee, LedgerTypeAffiliate, PromoQuotaExpireAt(), fmt.Sprintf("inviter:%d", inviterId), "使用邀请码赠送")
+			if err != nil {
+				common.SysError("failed to credit quota for invitee: " + err.Error())
+			}
 			RecordLog(user.Id, LogTypeSystem, 0, fmt.Sprintf("使用邀请码赠送 %s", common.LogQuota(config.QuotaForInvitee)))
 		}
 		if config.QuotaForInviter > 0 {
@@ -365,7 +387,17 @@ func (user *User) Update(updatePassword bool) error {
 	}
 	newUser := *user
 	DB.First(&user, user.Id)
+	// 余额的变化单独处理，以便同步额度批次和账本
+	quotaDelta := 0
+	if newUser.Quota != 0 {
+		quotaDelta = newUser.Quota - user.Quota
+		newUser.Quota = 0
+	}
 	err = DB.Model(user).Updates(newUser).Error
+	if err == nil && quotaDelta != 0 {
+		err = adjustUserQuota(user.Id, quotaDelta)
+		user.Quota += quotaDelta
+	}
 	if err == nil {
 		if common.RedisEnabled {
 			_ = common.RedisSet(fmt.Sprintf("user_group:%d", user.Id), user.Group, time.Duration(UserId2GroupCacheSeconds)*time.Second)
@@ -576,43 +608,6 @@ func increaseUserQuota(id int, quota int) (err error) {
 	return err
 }
 
-func IncreaseRechargeQuota(id int, topupratio string, quota int) (err error) {
-	var endQuotaAt int64
-
-	// 如果topupratio不为空且不是"-1"，计算结束时间戳；如果是"-1"，则设置无限期。
-	if topupratio != "" && topupratio != "-1" {
-		days, convErr := strconv.Atoi(topupratio)
-		if convErr != nil {
-			return convErr
-		}
-		currentTime := time.Now().Unix()
-		endQuotaAt = currentTime + int64(days*24*60*60)
-	} else if topupratio == "-1" {
-		endQuotaAt = -1 // 表示无限期
-	}
-
-	// 启动一个事务处理增加配额和插入充值记录
-	err = DB.Transaction(func(tx *gorm.DB) error {
-
-		// 只有当topupratio不为空时，才添加充值记录
-		if topupratio != "" {
-			record := &RechargeRecord{
-				UserID:    uint(id),
-				Amount:    quota,
-				StartDate: time.Now().Unix(), // 使用当前时间作为StartDate
-				EndDate:   endQuotaAt,        // 根据topupratio设置EndDate
-			}
-			if err := tx.Create(&record).Error; err != nil {
-				return err
-			}
-		}
-
-		return nil
-	})
-
-	return err
-}
-
 func DecreaseUserQuota(id int, quota int) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
@@ -637,52 +632,8 @@ func decreaseUserQuota(userID int, quotaToDecrease int) error {
 			return fmt.Errorf("insufficient user quota: available %d, required %d", user.Quota, quotaToDecrease)
 		}
 
-		// 3. 更新用户配额
-		if err := tx.Model(&User{}).Where("id = ?", userID).Update("quota", gorm.Expr("quota - ?", quotaToDecrease)).Error; err != nil {
-			return err
-		}
-
-		// 4. 获取充值记录
-		var records []RechargeRecord
-		if err := tx.Where("user_id = ? AND amount > 0", userID).
-			Order("end_date ASC").
-			Find(&records).Error; err != nil {
-			return err
-		}
-
-		// 如果没有充值记录，直接返回，不进行后续操作
-		if len(records) == 0 {
-			log.Printf("No recharge records found for user %d, quota decreased without updating records", userID)
-			return nil
-		}
-
-		// 5. 更新充值记录
-		remainingDecrease := quotaToDecrease
-		for i := range records {
-			var newAmount int
-			if records[i].Amount <= remainingDecrease {
-				newAmount = 0
-				remainingDecrease -= records[i].Amount
-			} else {
-				newAmount = records[i].Amount - remainingDecrease
-				remainingDecrease = 0
-			}
-
-			if err := tx.Model(&RechargeRecord{}).Where("id = ?", records[i].ID).Update("amount", newAmount).Error; err != nil {
-				return err
-			}
-
-			if remainingDecrease == 0 {
-				break
-			}
-		}
-
-		// 6. 检查是否所有配额都已正确扣除
-		if remainingDecrease > 0 {
-			log.Printf("Quota inconsistency detected for user %d: remaining decrease %d", userID, remainingDecrease)
-		}
-
-		return nil
+		// 3. 更新用户配额，额度批次在请求结算时扣除
+		return tx.Model(&User{}).Where("id = ?", userID).Update("quota", gorm.Expr("quota - ?", quotaToDecrease)).Error
 	})
 }
 
@@ -735,65 +686,6 @@ func GetUsernameById(id int) (username string) {
 	return username
 }
 
-func UpdateUserQuotaData() {
-	ticker := time.NewTicker(time.Hour)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		common.SysLog("正在更新用户余额日期...")
-
-		// 获取当前时间戳
-		currentTime := time.Now().Unix()
-
-		// 预查询是否存在过期记录，减少不必要的事务
-		var count int64
-		DB.Model(&RechargeRecord{}).Where("end_date <= ? AND end_date != -1 AND amount > 0", currentTime).Count(&count)
-		if count == 0 {
-			continue // 如果没有记录，跳过此次循环
-		}
-
-		// 启动一个事务来更新用户余额和处理过期的充值记录
-		err := DB.Transaction(func(tx *gorm.DB) error {
-			// 查找所有已经过期且金额大于0的充值记录
-			var expiredRecords []RechargeRecord
-			err := tx.Where("end_date <= ? AND end_date != -1 AND amount > 0", currentTime).Find(&expiredRecords).Error
-			if err != nil {
-				return err
-			}
-
-			// 对于每个过期的充值记录，减少对应用户在User主表中的配额，并将充值记录的Amount更新为0表示已处理
-			for _, record := range expiredRecords {
-				err = tx.Model(&User{}).Where("id = ?", record.UserID).
-					Update("quota", gorm.Expr("quota - ?", record.Amount)).Error
-				if err != nil {
-					return err
-				}
-
-				// 设置过期记录的金额为0，表示已经从用户余额中扣除
-				record.Amount = 0
-				err = tx.Save(&record).Error
-				if err != nil {
-					return err
-				}
-			}
-
-			// 执行删除所有处理过的过期记录（即金额为0的记录）
-			err = tx.Where("amount = 0").Delete(&RechargeRecord{}).Error
-			if err != nil {
-				return err
-			}
-
-			return nil
-		})
-
-		if err != nil {
-			common.SysLog(fmt.Sprintf("更新用户余额失败：%s", err))
-		} else {
-			common.SysLog("成功更新用户余额并清理过期充值记录。")
-		}
-	}
-}
-
 func GetRole(id int) int {
 	var role int
 	// 查询用户的角色
@@ -0,0 +1,133 @@
+package payment
+
+import (
+	"net/http"
+	"net/url"
+	"one-api/common/config"
+	"one-api/epay"
+	"one-api/model"
+	"strconv"
+	"strings"
+)
+
+type EpayProvider struct {
+	client *epay.Client
+}
+
+func newEpayProvider() (Provider, error) {
+	if config.PayAddress == "" || config.EpayId == "" || config.EpayKey == "" {
+		return nil, ErrProviderNotConfigured
+	}
+	client, err := epay.NewClientWithUrl(&epay.Config{
+		PartnerID: config.EpayId,
+		Key:       config.EpayKey,
+	}, config.PayAddress)
+	if err != nil {
+		return nil, err
+	}
+	return &EpayProvider{client: client}, nil
+}
+
+func (p *EpayProvider) Name() string {
+	return "epay"
+}
+
+func (p *EpayProvider) CreateOrder(topUp *model.TopUp, method string) (*Checkout, error) {
+	var payType epay.PurchaseType
+	if method == "zfb" {
+		payType = epay.Alipay
+	}
+	if method == "wx" {
+		payType = epay.WechatPay
+	}
+	returnUrl, _ := url.Parse(config.ServerAddress + "/log")
+	notifyUrl, _ := url.Parse(config.ServerAddress + "/api/user/payment/epay/notify")
+	uri, params, err := p.client.Purchase(&epay.PurchaseArgs{
+		Type:           payType,
+		ServiceTradeNo: topUp.TradeNo,
+		Name:           "B" + strings.TrimPrefix(topUp.TradeNo, "A"),
+		Money:          strconv.FormatFloat(topUp.Money, 'f', 2, 64),
+		Device:         epay.PC,
+		NotifyUrl:      notifyUrl,
+		ReturnUrl:      returnUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Checkout{Url: uri, Params: params}, nil
+}
+
+func (p *EpayProvider) VerifyWebhook(req *http.Request) (*OrderResult, error) {
+	params := make(map[string]string)
+	for key := range req.URL.Query() {
+		params[key] = req.URL.Query().Get(key)
+	}
+	verifyInfo, err := p.client.Verify(params)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyInfo.VerifyStatus {
+		return nil, errVerifyFailed
+	}
+	status := OrderStatusPending
+	if verifyInfo.TradeStatus == epay.StatusTradeSuccess {
+		status = OrderStatusPaid
+	}
+	money, _ := strconv.ParseFloat(verifyInfo.Money, 64)
+	return &OrderResult{
+		TradeNo:         verifyInfo.ServiceTradeNo,
+		Status:          status,
+		ProviderOrderId: verifyInfo.TradeNo,
+		Money:           money,
+	}, nil
+}
+
+func (p *EpayProvider) WriteWebhookResponse(w http.ResponseWriter, success bool) {
+	if success {
+		_, _ = w.Write([]byte("success"))
+	} else {
+		_, _ = w.Write([]byte("fail"))
+	}
+}
+
+func (p *EpayProvider) QueryOrder(topUp *model.TopUp) (*OrderResult, error) {
+	res, err := p.client.Query(topUp.TradeNo)
+	if err != nil {
+		return nil, err
+	}
+	status := OrderStatusPending
+	if res.Status == epay.OrderStatusPaid {
+		status = OrderStatusPaid
+	}
+	money, _ := strconv.ParseFloat(res.Money, 64)
+	return &OrderResult{
+		TradeNo:         topUp.TradeNo,
+		Status:          status,
+		ProviderOrderId: res.TradeNo,
+		Money:           money,
+	}, nil
+}
+
+func (p *EpayProvider) Refund(topUp *model.TopUp, money float64) error {
+	tradeNo := topUp.ProviderOrderId
+	if tradeNo == "" {
+		res, err := p.client.Query(topUp.TradeNo)
+		if err != nil {
+			return err
+		}
+		tradeNo = res.TradeNo
+	}
+	return p.client.Refund(tradeNo, strconv.FormatFloat(money, 'f', 2, 64))
+}
+
+// QueryRefund 易支付没有退款查询接口，退款后订单状态变为已退款
+func (p *EpayProvider) QueryRefund(topUp *model.TopUp) (string, error) {
+	res, err := p.client.Query(topUp.TradeNo)
+	if err != nil {
+		return "", err
+	}
+	if res.Status == epay.OrderStatusRefunded {
+		return RefundStatusSucceeded, nil
+	}
+	return RefundStatusNone, nil
+}
@@ -0,0 +1,92 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/model"
+)
+
+const (
+	OrderStatusPending = "pending"
+	OrderStatusPaid    = "paid"
+	OrderStatusClosed  = "closed"
+)
+
+// 服务商处的退款状态
+const (
+	RefundStatusNone      = "none" // 没有退款或退款已失败
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+)
+
+// Checkout 拉起支付需要的信息，Params 不为空时前端以表单提交到 Url，否则直接跳转
+type Checkout struct {
+	Url    string
+	Params map[string]string
+}
+
+// OrderResult 回调或查单得到的订单状态
+type OrderResult struct {
+	// 商家订单号，即 TopUp.TradeNo
+	TradeNo           string
+	Status            string
+	ProviderOrderId   string
+	ProviderPaymentId string
+	// 实际支付的金额，为 0 时表示服务商没有返回
+	Money float64
+}
+
+// Provider 支付服务商，订单在服务商处的状态记录在 model.TopUp 上
+type Provider interface {
+	Name() string
+	// CreateOrder 在服务商处创建订单，topUp 的 TradeNo、Money 和 Currency 需要已经填好
+	CreateOrder(topUp *model.TopUp, method string) (*Checkout, error)
+	// VerifyWebhook 校验回调的签名并解析订单状态，与订单无关的通知返回空的 TradeNo
+	VerifyWebhook(req *http.Request) (*OrderResult, error)
+	// WriteWebhookResponse 按服务商要求的格式应答回调
+	WriteWebhookResponse(w http.ResponseWriter, success bool)
+	// QueryOrder 主动查询订单状态
+	QueryOrder(topUp *model.TopUp) (*OrderResult, error)
+	// Refund 退款，money 按订单的币种计价，可以小于订单金额。
+	// 返回错误时服务商可能已经退款，需要用 QueryRefund 确认
+	Refund(topUp *model.TopUp, money float64) error
+	// QueryRefund 查询订单在服务商处的退款状态
+	QueryRefund(topUp *model.TopUp) (string, error)
+}
+
+var ErrProviderNotConfigured = errors.New("当前管理员未配置支付信息")
+
+var errVerifyFailed = errors.New("signature verification failed")
+
+var providers = map[string]func() (Provider, error){
+	"epay":   newEpayProvider,
+	"stripe": newStripeProvider,
+}
+
+// GetProvider 按名称获取支付服务商，每次使用最新的配置创建
+func GetProvider(name string) (Provider, error) {
+	newProvider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment provider: %s", name)
+	}
+	return newProvider()
+}
+
+// GetProviderByCurrency 按币种选择支付服务商，返回规范化的币种和相对人民币的汇率
+func GetProviderByCurrency(currency string) (Provider, string, float64, error) {
+	currency, paymentCurrency, ok := common.GetPaymentCurrency(currency)
+	if !ok {
+		return nil, "", 0, fmt.Errorf("不支持的币种：%s", currency)
+	}
+	provider, err := GetProvider(paymentCurrency.Provider)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	rate := paymentCurrency.Rate
+	if rate <= 0 {
+		rate = 1
+	}
+	return provider, currency, rate, nil
+}
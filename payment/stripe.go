@@ -0,0 +1,302 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"one-api/common/config"
+	"one-api/model"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	stripeApiBase = "https://api.stripe.com/v1"
+	// 回调签名的时间戳与当前时间相差超过该值时拒绝，防止重放
+	stripeSignatureTolerance = 5 * time.Minute
+)
+
+// 金额没有小数位的币种，见 https://docs.stripe.com/currencies#zero-decimal
+var stripeZeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true, "KRW": true, "MGA": true,
+	"PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+var stripeHttpClient = &http.Client{Timeout: 30 * time.Second}
+
+// StripeProvider 使用 Stripe Checkout 收款
+type StripeProvider struct {
+	secret        string
+	webhookSecret string
+}
+
+type stripeCheckoutSession struct {
+	Id                string `json:"id"`
+	Url               string `json:"url"`
+	ClientReferenceId string `json:"client_reference_id"`
+	Status            string `json:"status"`
+	PaymentStatus     string `json:"payment_status"`
+	PaymentIntent     string `json:"payment_intent"`
+	AmountTotal       int64  `json:"amount_total"`
+	Currency          string `json:"currency"`
+}
+
+type stripeEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+func newStripeProvider() (Provider, error) {
+	if config.StripeApiSecret == "" || config.StripeWebhookSecret == "" {
+		return nil, ErrProviderNotConfigured
+	}
+	return &StripeProvider{secret: config.StripeApiSecret, webhookSecret: config.StripeWebhookSecret}, nil
+}
+
+func (p *StripeProvider) Name() string {
+	return "stripe"
+}
+
+func stripeAmount(money float64, currency string) int64 {
+	if stripeZeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return int64(math.Round(money))
+	}
+	return int64(math.Round(money * 100))
+}
+
+func stripeMoney(amount int64, currency string) float64 {
+	if stripeZeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return float64(amount)
+	}
+	return float64(amount) / 100
+}
+
+func (p *StripeProvider) request(method string, path string, form url.Values, res interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, stripeApiBase+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.secret)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := stripeHttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		var errRes struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&errRes)
+		return fmt.Errorf("stripe api error: status %d, %s", resp.StatusCode, errRes.Error.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+func (p *StripeProvider) CreateOrder(topUp *model.TopUp, method string) (*Checkout, error) {
+	returnUrl := config.ServerAddress + "/log"
+	form := url.Values{
+		"mode":                                   {"payment"},
+		"success_url":                            {returnUrl},
+		"cancel_url":                             {returnUrl},
+		"client_reference_id":                    {topUp.TradeNo},
+		"metadata[trade_no]":                     {topUp.TradeNo},
+		"metadata[user_id]":                      {strconv.Itoa(topUp.UserId)},
+		"line_items[0][quantity]":                {"1"},
+		"line_items[0][price_data][currency]":    {strings.ToLower(topUp.Currency)},
+		"line_items[0][price_data][unit_amount]": {strconv.FormatInt(stripeAmount(topUp.Money, topUp.Currency), 10)},
+		"line_items[0][price_data][product_data][name]": {fmt.Sprintf("%s %s", config.SystemName, topUp.TradeNo)},
+	}
+	if topUp.PlanId != 0 {
+		// 套餐订单超过支付时限后不能再支付，与下单时的重复订单检查一致
+		form.Set("expires_at", strconv.FormatInt(time.Now().Add(model.PlanOrderPayWindow).Unix(), 10))
+	}
+	var session stripeCheckoutSession
+	if err := p.request(http.MethodPost, "/checkout/sessions", form, &session); err != nil {
+		return nil, err
+	}
+	topUp.ProviderOrderId = session.Id
+	return &Checkout{Url: session.Url}, nil
+}
+
+// verifySignature 校验 Stripe-Signature，格式为 t=时间戳,v1=签名[,v1=签名]
+func (p *StripeProvider) verifySignature(payload []byte, header string) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return errVerifyFailed
+	}
+	if time.Since(time.Unix(t, 0)).Abs() > stripeSignatureTolerance {
+		return errors.New("signature timestamp is outside the tolerance")
+	}
+	mac := hmac.New(sha256.New, []byte(p.webhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, signature := range signatures {
+		actual, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(expected, actual) {
+			return nil
+		}
+	}
+	return errVerifyFailed
+}
+
+func stripeSessionResult(session *stripeCheckoutSession) *OrderResult {
+	status := OrderStatusPending
+	if session.PaymentStatus == "paid" || session.PaymentStatus == "no_payment_required" {
+		status = OrderStatusPaid
+	} else if session.Status == "expired" {
+		status = OrderStatusClosed
+	}
+	return &OrderResult{
+		TradeNo:           session.ClientReferenceId,
+		Status:            status,
+		ProviderOrderId:   session.Id,
+		ProviderPaymentId: session.PaymentIntent,
+		Money:             stripeMoney(session.AmountTotal, session.Currency),
+	}
+}
+
+func (p *StripeProvider) VerifyWebhook(req *http.Request) (*OrderResult, error) {
+	payload, err := io.ReadAll(io.LimitReader(req.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if err := p.verifySignature(payload, req.Header.Get("Stripe-Signature")); err != nil {
+		return nil, err
+	}
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded",
+		"checkout.session.async_payment_failed", "checkout.session.expired":
+	default:
+		return &OrderResult{}, nil
+	}
+	var session stripeCheckoutSession
+	if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+		return nil, err
+	}
+	result := stripeSessionResult(&session)
+	if event.Type == "checkout.session.async_payment_failed" {
+		result.Status = OrderStatusClosed
+	}
+	return result, nil
+}
+
+func (p *StripeProvider) WriteWebhookResponse(w http.ResponseWriter, success bool) {
+	if success {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (p *StripeProvider) QueryOrder(topUp *model.TopUp) (*OrderResult, error) {
+	if topUp.ProviderOrderId == "" {
+		return nil, errors.New("stripe checkout session id is empty")
+	}
+	var session stripeCheckoutSession
+	err := p.request(http.MethodGet, "/checkout/sessions/"+url.PathEscape(topUp.ProviderOrderId), nil, &session)
+	if err != nil {
+		return nil, err
+	}
+	return stripeSessionResult(&session), nil
+}
+
+func (p *StripeProvider) paymentIntent(topUp *model.TopUp) (string, error) {
+	paymentId := topUp.ProviderPaymentId
+	if paymentId == "" {
+		result, err := p.QueryOrder(topUp)
+		if err != nil {
+			return "", err
+		}
+		paymentId = result.ProviderPaymentId
+	}
+	if paymentId == "" {
+		return "", errors.New("stripe payment intent is empty")
+	}
+	return paymentId, nil
+}
+
+func (p *StripeProvider) Refund(topUp *model.TopUp, money float64) error {
+	paymentId, err := p.paymentIntent(topUp)
+	if err != nil {
+		return err
+	}
+	form := url.Values{
+		"payment_intent":     {paymentId},
+		"amount":             {strconv.FormatInt(stripeAmount(money, topUp.Currency), 10)},
+		"metadata[trade_no]": {topUp.TradeNo},
+	}
+	var refund struct {
+		Id string `json:"id"`
+	}
+	return p.request(http.MethodPost, "/refunds", form, &refund)
+}
+
+// QueryRefund 查询支付的退款记录，有成功的退款时为已退款，有处理中的退款时为退款中
+func (p *StripeProvider) QueryRefund(topUp *model.TopUp) (string, error) {
+	paymentId, err := p.paymentIntent(topUp)
+	if err != nil {
+		return "", err
+	}
+	var refunds struct {
+		Data []struct {
+			Status   string            `json:"status"`
+			Metadata map[string]string `json:"metadata"`
+		} `json:"data"`
+	}
+	err = p.request(http.MethodGet, "/refunds?limit=100&payment_intent="+url.QueryEscape(paymentId), nil, &refunds)
+	if err != nil {
+		return "", err
+	}
+	status := RefundStatusNone
+	for _, refund := range refunds.Data {
+		if refund.Metadata["trade_no"] != topUp.TradeNo {
+			continue
+		}
+		switch refund.Status {
+		case "succeeded":
+			return RefundStatusSucceeded, nil
+		case "pending", "requires_action":
+			status = RefundStatusPending
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,55 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func stripeTestSignature(secret string, timestamp string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestStripeVerifySignature(t *testing.T) {
+	const payload = `{"id":"evt_test"}`
+	provider := &StripeProvider{webhookSecret: "whsec_test"}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-2*stripeSignatureTolerance).Unix(), 10)
+	valid := stripeTestSignature("whsec_test", now, payload)
+	cases := []struct {
+		name    string
+		payload string
+		header  string
+		ok      bool
+	}{
+		{"valid signature", payload, "t=" + now + ",v1=" + valid, true},
+		{"valid signature among several", payload, "t=" + now + ",v1=deadbeef,v1=" + valid, true},
+		{"spaces around parts", payload, "t=" + now + ", v1=" + valid, true},
+		{"tampered payload", `{"id":"evt_other"}`, "t=" + now + ",v1=" + valid, false},
+		{"wrong secret", payload, "t=" + now + ",v1=" + stripeTestSignature("whsec_other", now, payload), false},
+		{"stale timestamp", payload, "t=" + stale + ",v1=" + stripeTestSignature("whsec_test", stale, payload), false},
+		{"missing timestamp", payload, "v1=" + valid, false},
+		{"missing signature", payload, "t=" + now, false},
+		{"invalid hex", payload, "t=" + now + ",v1=zz", false},
+		{"empty header", payload, "", false},
+	}
+	Convey("TestStripeVerifySignature", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				err := provider.verifySignature([]byte(c.payload), c.header)
+				if c.ok {
+					So(err, ShouldBeNil)
+				} else {
+					So(err, ShouldNotBeNil)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,694 @@
+package anthropic
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"one-api/common"
+	"one-api/relay/channel/openai"
+	"one-api/relay/model"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 本文件负责 Claude Messages 与 OpenAI ChatCompletions 之间的互转，
+// 使 /v1/messages 请求可以由 OpenAI、Gemini、DeepSeek、Ollama 等非 Claude 渠道处理。
+
+type compatRequest struct {
+	Model         string          `json:"model"`
+	Messages      []compatMessage `json:"messages"`
+	System        json.RawMessage `json:"system"`
+	MaxTokens     uint            `json:"max_tokens"`
+	Metadata      *Metadata       `json:"metadata"`
+	StopSequences []string        `json:"stop_sequences"`
+	Stream        bool            `json:"stream"`
+	Temperature   *float64        `json:"temperature"`
+	TopP          float64         `json:"top_p"`
+	Thinking      *Thinking       `json:"thinking"`
+	Tools         []compatTool    `json:"tools"`
+	ToolChoice    *compatChoice   `json:"tool_choice"`
+}
+
+type compatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type compatTool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type compatChoice struct {
+	Type                   string `json:"type"`
+	Name                   string `json:"name"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use"`
+}
+
+type compatSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+	Url       string `json:"url"`
+}
+
+type compatBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text"`
+	Source    *compatSource   `json:"source"`
+	Id        string          `json:"id"`
+	Name      string          `json:"name"`
+	Input     json.RawMessage `json:"input"`
+	ToolUseId string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content"`
+	Title     string          `json:"title"`
+}
+
+// parseCompatBlocks 解析 content，content 可以是字符串或内容块数组
+func parseCompatBlocks(raw json.RawMessage) ([]compatBlock, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []compatBlock{{Type: "text", Text: text}}, nil
+	}
+	var blocks []compatBlock
+	err := json.Unmarshal(raw, &blocks)
+	return blocks, err
+}
+
+// sourceToPart 把图片或文档块转换为 OpenAI 的 content part
+func sourceToPart(block compatBlock) map[string]any {
+	source := block.Source
+	if source == nil {
+		return nil
+	}
+	switch {
+	case source.Type == "text":
+		return map[string]any{"type": "text", "text": source.Data}
+	case block.Type == "image" && source.Type == "url":
+		return map[string]any{"type": "image_url", "image_url": map[string]any{"url": source.Url}}
+	case block.Type == "image" && source.Type == "base64":
+		return map[string]any{"type": "image_url", "image_url": map[string]any{
+			"url": fmt.Sprintf("data:%s;base64,%s", source.MediaType, source.Data),
+		}}
+	case block.Type == "document" && source.Type == "base64":
+		filename := block.Title
+		if filename == "" {
+			filename = "document.pdf"
+		}
+		return map[string]any{"type": "file", "file": map[string]any{
+			"filename":  filename,
+			"file_data": fmt.Sprintf("data:%s;base64,%s", source.MediaType, source.Data),
+		}}
+	case block.Type == "document" && source.Type == "url":
+		return map[string]any{"type": "file", "file": map[string]any{"file_url": source.Url}}
+	}
+	return nil
+}
+
+// partsToContent 纯文本内容合并为字符串，兼容不支持数组 content 的渠道
+func partsToContent(parts []map[string]any) any {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part["type"] != "text" {
+			return parts
+		}
+		texts = append(texts, common.AsString(part["text"]))
+	}
+	return strings.Join(texts, "\n")
+}
+
+func convertCompatUserMessage(blocks []compatBlock) ([]model.Message, error) {
+	var messages []model.Message
+	var parts []map[string]any
+	// tool_result 中的图片无法放进 tool 消息，追加为随后的 user 消息
+	var toolImages []map[string]any
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, map[string]any{"type": "text", "text": block.Text})
+		case "image", "document":
+			if part := sourceToPart(block); part != nil {
+				parts = append(parts, part)
+			}
+		case "tool_result":
+			resultBlocks, err := parseCompatBlocks(block.Content)
+			if err != nil {
+				return nil, err
+			}
+			var texts []string
+			for _, resultBlock := range resultBlocks {
+				switch resultBlock.Type {
+				case "text":
+					texts = append(texts, resultBlock.Text)
+				case "image", "document":
+					if part := sourceToPart(resultBlock); part != nil {
+						toolImages = append(toolImages, part)
+					}
+				}
+			}
+			messages = append(messages, model.Message{
+				Role:       "tool",
+				Content:    strings.Join(texts, "\n"),
+				ToolCallId: block.ToolUseId,
+			})
+		}
+	}
+	parts = append(toolImages, parts...)
+	if len(parts) > 0 {
+		messages = append(messages, model.Message{Role: "user", Content: partsToContent(parts)})
+	}
+	return messages, nil
+}
+
+func convertCompatAssistantMessage(blocks []compatBlock) model.Message {
+	message := model.Message{Role: "assistant"}
+	var texts []string
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "tool_use":
+			arguments := string(block.Input)
+			if arguments == "" || arguments == "null" {
+				arguments = "{}"
+			}
+			message.ToolCalls = append(message.ToolCalls, model.Tool{
+				Id:   block.Id,
+				Type: "function",
+				Function: model.Function{
+					Name:      block.Name,
+					Arguments: arguments,
+				},
+			})
+		}
+		// thinking / redacted_thinking 块不回传，多数渠道不接受历史推理内容
+	}
+	if len(texts) > 0 {
+		message.Content = strings.Join(texts, "")
+	} else if len(message.ToolCalls) == 0 {
+		message.Content = ""
+	}
+	return message
+}
+
+// supportsReasoningEffort 仅对支持 reasoning_effort 的模型传递该参数
+func supportsReasoningEffort(modelName string) bool {
+	for _, prefix := range []string{"o1", "o3", "o4", "gpt-5"} {
+		if strings.HasPrefix(modelName, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConvertClaudeRequest2OpenAI 把 Claude Messages 请求体转换为 ChatCompletions 请求
+func ConvertClaudeRequest2OpenAI(body []byte, modelName string) (*model.GeneralOpenAIRequest, error) {
+	var claudeRequest compatRequest
+	if err := json.Unmarshal(body, &claudeRequest); err != nil {
+		return nil, err
+	}
+	request := &model.GeneralOpenAIRequest{
+		Model:       modelName,
+		Stream:      claudeRequest.Stream,
+		MaxTokens:   claudeRequest.MaxTokens,
+		Temperature: claudeRequest.Temperature,
+		TopP:        claudeRequest.TopP,
+	}
+	if len(claudeRequest.StopSequences) > 0 {
+		request.Stop = claudeRequest.StopSequences
+	}
+	if claudeRequest.Metadata != nil {
+		request.User = claudeRequest.Metadata.UserId
+	}
+	if claudeRequest.Thinking != nil && claudeRequest.Thinking.Type == "enabled" && supportsReasoningEffort(modelName) {
+		switch budget := claudeRequest.Thinking.BudgetTokens; {
+		case budget < 4096:
+			request.ReasoningEffort = "low"
+		case budget < 16384:
+			request.ReasoningEffort = "medium"
+		default:
+			request.ReasoningEffort = "high"
+		}
+	}
+
+	systemBlocks, err := parseCompatBlocks(claudeRequest.System)
+	if err != nil {
+		return nil, fmt.Errorf("invalid system: %w", err)
+	}
+	var systemTexts []string
+	for _, block := range systemBlocks {
+		if block.Type == "text" {
+			systemTexts = append(systemTexts, block.Text)
+		}
+	}
+	if len(systemTexts) > 0 {
+		request.Messages = append(request.Messages, model.Message{Role: "system", Content: strings.Join(systemTexts, "\n")})
+	}
+
+	for _, message := range claudeRequest.Messages {
+		blocks, err := parseCompatBlocks(message.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid message content: %w", err)
+		}
+		if message.Role == "assistant" {
+			request.Messages = append(request.Messages, convertCompatAssistantMessage(blocks))
+			continue
+		}
+		messages, err := convertCompatUserMessage(blocks)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tool_result content: %w", err)
+		}
+		request.Messages = append(request.Messages, messages...)
+	}
+
+	for _, tool := range claudeRequest.Tools {
+		// 服务端工具（web_search、bash 等）无法转换
+		if tool.Type != "" && tool.Type != "custom" {
+			continue
+		}
+		var parameters any = json.RawMessage(`{"type":"object","properties":{}}`)
+		if len(tool.InputSchema) > 0 {
+			parameters = tool.InputSchema
+		}
+		request.Tools = append(request.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  parameters,
+			},
+		})
+	}
+	if claudeRequest.ToolChoice != nil && len(request.Tools) > 0 {
+		switch claudeRequest.ToolChoice.Type {
+		case "auto":
+			request.ToolChoice = "auto"
+		case "any":
+			request.ToolChoice = "required"
+		case "none":
+			request.ToolChoice = "none"
+		case "tool":
+			request.ToolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": claudeRequest.ToolChoice.Name},
+			}
+		}
+		if claudeRequest.ToolChoice.DisableParallelToolUse {
+			parallel := false
+			request.ParallelToolCalls = &parallel
+		}
+	}
+	return request, nil
+}
+
+func stopReasonOpenAI2Claude(reason string) string {
+	switch reason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+func compatUsage(usage *model.Usage) map[string]any {
+	result := map[string]any{
+		"input_tokens":  usage.PromptTokens,
+		"output_tokens": usage.CompletionTokens,
+	}
+	if details := usage.PromptTokensDetails; details != nil && (details.CachedTokens > 0 || details.CacheCreationTokens > 0) {
+		result["input_tokens"] = usage.PromptTokens - details.CachedTokens - details.CacheCreationTokens
+		result["cache_read_input_tokens"] = details.CachedTokens
+		if details.CacheCreationTokens > 0 {
+			result["cache_creation_input_tokens"] = details.CacheCreationTokens
+		}
+	}
+	return result
+}
+
+// ResponseOpenAI2Claude 把非流式 ChatCompletions 响应转换为 Claude Messages 响应
+func ResponseOpenAI2Claude(response *openai.TextResponse, id string, modelName string) map[string]any {
+	content := make([]map[string]any, 0)
+	stopReason := "end_turn"
+	if len(response.Choices) > 0 {
+		choice := response.Choices[0]
+		thinking, text := openai.SplitThinkContent(choice.Message.StringContent())
+		if choice.Message.ReasoningContent != "" {
+			thinking = choice.Message.ReasoningContent
+		}
+		if thinking != "" {
+			content = append(content, map[string]any{"type": "thinking", "thinking": thinking, "signature": ""})
+		}
+		if text != "" {
+			content = append(content, map[string]any{"type": "text", "text": text})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			var input any = map[string]any{}
+			if arguments := common.AsString(toolCall.Function.Arguments); arguments != "" {
+				if err := json.Unmarshal([]byte(arguments), &input); err != nil {
+					input = map[string]any{}
+				}
+			}
+			content = append(content, map[string]any{
+				"type":  "tool_use",
+				"id":    toolCall.Id,
+				"name":  toolCall.Function.Name,
+				"input": input,
+			})
+		}
+		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
+		if len(choice.Message.ToolCalls) > 0 {
+			stopReason = "tool_use"
+		}
+	}
+	return map[string]any{
+		"id":            id,
+		"type":          "message",
+		"role":          "assistant",
+		"model":         modelName,
+		"content":       content,
+		"stop_reason":   stopReason,
+		"stop_sequence": nil,
+		"usage":         compatUsage(&response.Usage),
+	}
+}
+
+type compatToolCallDelta struct {
+	Index    int    `json:"index"`
+	Id       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type compatStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          *string               `json:"content"`
+			ReasoningContent string                `json:"reasoning_content"`
+			Reasoning        string                `json:"reasoning"`
+			ToolCalls        []compatToolCallDelta `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *model.Usage `json:"usage"`
+}
+
+// CompatResponseWriter 拦截适配器写出的 OpenAI 格式响应，并实时转换为 Claude Messages 格式。
+// 流式响应逐行转换为 message_start / content_block_* / message_delta / message_stop 事件，
+// 非流式响应在 Finish 时整体转换。
+type CompatResponseWriter struct {
+	gin.ResponseWriter
+	stream       bool
+	id           string
+	modelName    string
+	promptTokens int
+	statusCode   int
+	buffer       bytes.Buffer
+
+	started       bool
+	blockIndex    int
+	blockType     string
+	inThinkTag    bool
+	toolBlocks    map[int]bool
+	currentTool   int
+	hasToolUse    bool
+	finishReason  string
+	upstreamUsage *model.Usage
+}
+
+func NewCompatResponseWriter(writer gin.ResponseWriter, stream bool, modelName string, promptTokens int) *CompatResponseWriter {
+	return &CompatResponseWriter{
+		ResponseWriter: writer,
+		stream:         stream,
+		id:             "msg_" + common.GetRandomString(24),
+		modelName:      modelName,
+		promptTokens:   promptTokens,
+		statusCode:     200,
+		blockIndex:     -1,
+		toolBlocks:     make(map[int]bool),
+		currentTool:    -1,
+	}
+}
+
+func (w *CompatResponseWriter) WriteHeader(code int) {
+	if w.stream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.statusCode = code
+}
+
+func (w *CompatResponseWriter) WriteHeaderNow() {
+	if w.stream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *CompatResponseWriter) Status() int {
+	if w.stream {
+		return w.ResponseWriter.Status()
+	}
+	return w.statusCode
+}
+
+func (w *CompatResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *CompatResponseWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+	for {
+		line, err := w.buffer.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行留到下次
+			w.buffer.Reset()
+			w.buffer.Write(line)
+			break
+		}
+		w.handleLine(string(bytes.TrimSpace(line)))
+	}
+	return len(data), nil
+}
+
+func (w *CompatResponseWriter) sendEvent(event string, data any) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		common.SysError("error marshalling claude stream event: " + err.Error())
+		return
+	}
+	_, _ = w.ResponseWriter.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", event, jsonData))
+}
+
+func (w *CompatResponseWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.sendEvent("message_start", map[string]any{
+		"type": "message_start",
+		"message": map[string]any{
+			"id":            w.id,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         w.modelName,
+			"content":       []any{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage": map[string]any{
+				"input_tokens":  w.promptTokens,
+				"output_tokens": 0,
+			},
+		},
+	})
+}
+
+func (w *CompatResponseWriter) closeBlock() {
+	if w.blockType == "" {
+		return
+	}
+	w.sendEvent("content_block_stop", map[string]any{"type": "content_block_stop", "index": w.blockIndex})
+	w.blockType = ""
+	w.currentTool = -1
+}
+
+func (w *CompatResponseWriter) openBlock(blockType string, block map[string]any) {
+	w.closeBlock()
+	w.blockIndex++
+	w.blockType = blockType
+	w.sendEvent("content_block_start", map[string]any{
+		"type":          "content_block_start",
+		"index":         w.blockIndex,
+		"content_block": block,
+	})
+}
+
+func (w *CompatResponseWriter) sendThinking(thinking string) {
+	if thinking == "" {
+		return
+	}
+	if w.blockType != "thinking" {
+		w.openBlock("thinking", map[string]any{"type": "thinking", "thinking": "", "signature": ""})
+	}
+	w.sendEvent("content_block_delta", map[string]any{
+		"type":  "content_block_delta",
+		"index": w.blockIndex,
+		"delta": map[string]any{"type": "thinking_delta", "thinking": thinking},
+	})
+}
+
+func (w *CompatResponseWriter) sendText(text string) {
+	if text == "" {
+		return
+	}
+	if w.blockType != "text" {
+		w.openBlock("text", map[string]any{"type": "text", "text": ""})
+	}
+	w.sendEvent("content_block_delta", map[string]any{
+		"type":  "content_block_delta",
+		"index": w.blockIndex,
+		"delta": map[string]any{"type": "text_delta", "text": text},
+	})
+}
+
+// sendContent 处理正文，OpenAI 适配器会把推理内容包在 <think></think> 中
+func (w *CompatResponseWriter) sendContent(content string) {
+	if !w.inThinkTag && w.blockIndex < 0 && strings.HasPrefix(content, "<think>") {
+		w.inThinkTag = true
+		content = strings.TrimPrefix(content, "<think>")
+	}
+	if w.inThinkTag {
+		end := strings.Index(content, "</think>")
+		if end < 0 {
+			w.sendThinking(content)
+			return
+		}
+		w.sendThinking(content[:end])
+		w.inThinkTag = false
+		content = strings.TrimLeft(content[end+len("</think>"):], "\n")
+	}
+	w.sendText(content)
+}
+
+func (w *CompatResponseWriter) sendToolCall(toolCall compatToolCallDelta) {
+	if !w.toolBlocks[toolCall.Index] {
+		if toolCall.Id == "" && toolCall.Function.Name == "" {
+			return
+		}
+		w.toolBlocks[toolCall.Index] = true
+		w.hasToolUse = true
+		id := toolCall.Id
+		if id == "" {
+			id = "toolu_" + common.GetRandomString(24)
+		}
+		w.openBlock("tool_use", map[string]any{"type": "tool_use", "id": id, "name": toolCall.Function.Name, "input": map[string]any{}})
+		w.currentTool = toolCall.Index
+	}
+	// Claude 的内容块必须顺序输出，已关闭的工具块无法再追加参数
+	if toolCall.Index != w.currentTool || toolCall.Function.Arguments == "" {
+		return
+	}
+	w.sendEvent("content_block_delta", map[string]any{
+		"type":  "content_block_delta",
+		"index": w.blockIndex,
+		"delta": map[string]any{"type": "input_json_delta", "partial_json": toolCall.Function.Arguments},
+	})
+}
+
+func (w *CompatResponseWriter) handleLine(line string) {
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || data == "[DONE]" {
+		return
+	}
+	var chunk compatStreamChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return
+	}
+	w.start()
+	if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+		w.upstreamUsage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		w.sendThinking(delta.ReasoningContent)
+		w.sendThinking(delta.Reasoning)
+		if delta.Content != nil {
+			w.sendContent(*delta.Content)
+		}
+		for _, toolCall := range delta.ToolCalls {
+			w.sendToolCall(toolCall)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.finishReason = *choice.FinishReason
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Finish 输出收尾内容，usage 为适配器最终统计的用量
+func (w *CompatResponseWriter) Finish(usage *model.Usage) error {
+	if usage == nil {
+		usage = w.upstreamUsage
+	}
+	if usage == nil {
+		usage = &model.Usage{PromptTokens: w.promptTokens}
+	}
+	if !w.stream {
+		var response openai.TextResponse
+		if err := json.Unmarshal(w.buffer.Bytes(), &response); err != nil {
+			return err
+		}
+		if response.Usage.TotalTokens == 0 {
+			response.Usage = *usage
+		}
+		body, err := json.Marshal(ResponseOpenAI2Claude(&response, w.id, w.modelName))
+		if err != nil {
+			return err
+		}
+		header := w.ResponseWriter.Header()
+		header.Del("Content-Length")
+		header.Del("Content-Encoding")
+		header.Set("Content-Type", "application/json")
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		_, err = w.ResponseWriter.Write(body)
+		return err
+	}
+	if w.buffer.Len() > 0 {
+		w.handleLine(strings.TrimSpace(w.buffer.String()))
+		w.buffer.Reset()
+	}
+	w.start()
+	w.closeBlock()
+	stopReason := stopReasonOpenAI2Claude(w.finishReason)
+	if w.hasToolUse {
+		stopReason = "tool_use"
+	}
+	w.sendEvent("message_delta", map[string]any{
+		"type":  "message_delta",
+		"delta": map[string]any{"stop_reason": stopReason, "stop_sequence": nil},
+		"usage": compatUsage(usage),
+	})
+	w.sendEvent("message_stop", map[string]any{"type": "message_stop"})
+	w.ResponseWriter.Flush()
+	return nil
+}
@@ -145,9 +145,42 @@ func createBaseRequest(request model.GeneralOpenAIRequest) *Request {
 	if claudeRequest.MaxTokens == 0 {
 		claudeRequest.MaxTokens = 4096
 	}
+	if claudeRequest.Thinking == nil {
+		if thinking, maxTokens := ReasoningEffort2Thinking(request, claudeRequest.MaxTokens); thinking != nil {
+			claudeRequest.Thinking = thinking
+			claudeRequest.MaxTokens = maxTokens
+			claudeRequest.Temperature = nil
+			claudeRequest.TopP = 0
+		}
+	}
 	return claudeRequest
 }
 
+// supportsThinking Claude 3.7 之前的模型不支持 thinking
+func supportsThinking(modelName string) bool {
+	if strings.HasPrefix(modelName, "claude-3-7") {
+		return true
+	}
+	for _, prefix := range []string{"claude-instant", "claude-2", "claude-3-"} {
+		if strings.HasPrefix(modelName, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReasoningEffort2Thinking 把 reasoning_effort 转换为 thinking 配置，max_tokens 必须大于思考预算
+func ReasoningEffort2Thinking(request model.GeneralOpenAIRequest, maxTokens uint) (*Thinking, uint) {
+	budget := request.ReasoningBudgetTokens()
+	if budget == 0 || !supportsThinking(request.Model) {
+		return nil, maxTokens
+	}
+	if maxTokens <= uint(budget) {
+		maxTokens = uint(budget) + 4096
+	}
+	return &Thinking{Type: "enabled", BudgetTokens: budget}, maxTokens
+}
+
 func ConvertToolsLegacy(tools []model.Tool) []Tool {
 	claudeTools := make([]Tool, 0, len(tools))
 	for _, tool := range tools {
@@ -474,6 +507,39 @@ func convertToContent(c map[string]interface{}) Content {
 	return content
 }
 
+// ToUsage 转换为 OpenAI 口径的 usage，Claude 的 input_tokens 不包括读取和写入缓存的部分，合计后作为 prompt_tokens
+func (u Usage) ToUsage() model.Usage {
+	promptTokens := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	usage := model.Usage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      promptTokens + u.OutputTokens,
+	}
+	if u.CacheCreationInputTokens > 0 || u.CacheReadInputTokens > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{
+			CachedTokens:        u.CacheReadInputTokens,
+			CacheCreationTokens: u.CacheCreationInputTokens,
+		}
+	}
+	return usage
+}
+
+// Merge 合并流中 message_start 和 message_delta 的 usage，message_delta 中的数值是累计值，非零时覆盖
+func (u *Usage) Merge(other Usage) {
+	if other.InputTokens > 0 {
+		u.InputTokens = other.InputTokens
+	}
+	if other.OutputTokens > 0 {
+		u.OutputTokens = other.OutputTokens
+	}
+	if other.CacheCreationInputTokens > 0 {
+		u.CacheCreationInputTokens = other.CacheCreationInputTokens
+	}
+	if other.CacheReadInputTokens > 0 {
+		u.CacheReadInputTokens = other.CacheReadInputTokens
+	}
+}
+
 func ResponseClaude2OpenAI(claudeResponse *Response) *openai.TextResponse {
 
 	var responseText string
@@ -535,11 +601,7 @@ func ResponseClaude2OpenAI(claudeResponse *Response) *openai.TextResponse {
 		Object:  "chat.completion",
 		Created: helper.GetTimestamp(),
 		Choices: []openai.TextResponseChoice{choice},
-		Usage: model.Usage{
-			PromptTokens:     claudeResponse.Usage.InputTokens,
-			CompletionTokens: claudeResponse.Usage.OutputTokens,
-			TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-		},
+		Usage:   claudeResponse.Usage.ToUsage(),
 	}
 
 	return &fullTextResponse
@@ -559,8 +621,10 @@ func StreamResponseClaude2OpenAI(claudeResponse *StreamResponse) (*openai.ChatCo
 				Id:    claudeResponse.Message.Id,
 				Model: claudeResponse.Message.Model,
 				Usage: Usage{
-					InputTokens:  claudeResponse.Message.Usage.InputTokens,
-					OutputTokens: 0,
+					InputTokens:              claudeResponse.Message.Usage.InputTokens,
+					OutputTokens:             0,
+					CacheCreationInputTokens: claudeResponse.Message.Usage.CacheCreationInputTokens,
+					CacheReadInputTokens:     claudeResponse.Message.Usage.CacheReadInputTokens,
 				},
 			}
 		}
@@ -675,6 +739,7 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 	}()
 	common.SetEventStreamHeaders(c)
 	var usage model.Usage
+	var claudeUsage Usage
 	var modelName string
 	var id string
 	var streamError *model.ErrorWithStatusCode
@@ -692,8 +757,8 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 			}
 			response, meta := StreamResponseClaude2OpenAI(&claudeResponse)
 			if meta != nil {
-				usage.PromptTokens += meta.Usage.InputTokens
-				usage.CompletionTokens += meta.Usage.OutputTokens
+				claudeUsage.Merge(meta.Usage)
+				usage = claudeUsage.ToUsage()
 				if len(meta.Id) > 0 { // only message_start has an id, otherwise it's a finish_reason event.
 					id = meta.Id
 					modelName = meta.Model
@@ -738,11 +803,7 @@ func StreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusC
 					Created: createdTime,
 					Model:   modelName,
 					Choices: []openai.ChatCompletionsStreamResponseChoice{},
-					Usage: &model.Usage{
-						PromptTokens:     usage.PromptTokens,
-						CompletionTokens: usage.CompletionTokens,
-						TotalTokens:      usage.PromptTokens + usage.CompletionTokens,
-					},
+					Usage:   &usage,
 				}
 
 				usageJsonStr, err := json.Marshal(usageResponse)
@@ -795,11 +856,7 @@ func Handler(c *gin.Context, resp *http.Response, promptTokens int, modelName st
 	if len(claudeResponse.Content) > 0 && claudeResponse.Content[0].Text != "" {
 		aitext = claudeResponse.Content[0].Text
 	}
-	usage := model.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := claudeResponse.Usage.ToUsage()
 	fullTextResponse.Usage = usage
 	jsonResponse, err := json.Marshal(fullTextResponse)
 	if err != nil {
@@ -818,6 +875,7 @@ func ClaudeStreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithS
 	common.SetEventStreamHeaders(c)
 	var responseTextBuilder strings.Builder
 	var usage model.Usage
+	var claudeUsage Usage
 	responseText := ""
 	sendStopMessage := false
 
@@ -887,8 +945,8 @@ func ClaudeStreamHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithS
 
 			response, meta := StreamResponseClaude2OpenAI(&claudeResponse)
 			if meta != nil {
-				usage.PromptTokens += meta.Usage.InputTokens
-				usage.CompletionTokens += meta.Usage.OutputTokens
+				claudeUsage.Merge(meta.Usage)
+				usage = claudeUsage.ToUsage()
 			}
 			if response != nil {
 				responsePart := response.Choices[0].Delta.Content.(string)
@@ -956,11 +1014,7 @@ func ClaudeHandler(c *gin.Context, resp *http.Response, promptTokens int, modelN
 			aitext = responseText
 		}
 	}
-	usage := model.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := claudeResponse.Usage.ToUsage()
 
 	if err != nil {
 		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil, ""
@@ -141,11 +141,7 @@ func Handler(c *gin.Context, awsCli *bedrockruntime.Client, modelName string) (*
 		responseText = claudeResponse.Content[0].Text
 	}
 
-	usage := relaymodel.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := claudeResponse.Usage.ToUsage()
 	openaiResp.Usage = usage
 
 	c.JSON(http.StatusOK, openaiResp)
@@ -202,6 +198,7 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	var usage relaymodel.Usage
+	var claudeUsage anthropic.Usage
 	var id string
 	var lastToolCallChoice openai.ChatCompletionsStreamResponseChoice
 
@@ -244,8 +241,8 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 
 			response, meta := anthropic.StreamResponseClaude2OpenAI(claudeResp)
 			if meta != nil {
-				usage.PromptTokens += meta.Usage.InputTokens
-				usage.CompletionTokens += meta.Usage.OutputTokens
+				claudeUsage.Merge(meta.Usage)
+				usage = claudeUsage.ToUsage()
 				if len(meta.Id) > 0 { // only message_start has an id, otherwise it's a finish_reason event.
 					id = meta.Id
 					return true
@@ -354,11 +351,7 @@ func ClaudeHandler(c *gin.Context, awsCli *bedrockruntime.Client, modelName stri
 			responseText = "<think>" + thinkingText + "</think>\n\n" + responseText
 		}
 	}
-	usage := relaymodel.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := claudeResponse.Usage.ToUsage()
 
 	c.JSON(http.StatusOK, claudeResponse)
 	return nil, &usage, responseText
@@ -412,6 +405,7 @@ func StreamClaudeHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaym
 
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	var usage relaymodel.Usage
+	var claudeUsage anthropic.Usage
 	var responseTextBuilder strings.Builder
 
 	c.Stream(func(w io.Writer) bool {
@@ -447,8 +441,8 @@ func StreamClaudeHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaym
 			// 使用相同的转换逻辑
 			response, meta := anthropic.StreamResponseClaude2OpenAI(&claudeResponse)
 			if meta != nil {
-				usage.PromptTokens += meta.Usage.InputTokens
-				usage.CompletionTokens += meta.Usage.OutputTokens
+				claudeUsage.Merge(meta.Usage)
+				usage = claudeUsage.ToUsage()
 			}
 			if response != nil {
 				responsePart := response.Choices[0].Delta.Content.(string)
@@ -542,11 +536,7 @@ func CohereHandler(c *gin.Context, awsCli *bedrockruntime.Client, modelName stri
 	openaiResp := anthropic.ResponseClaude2OpenAI(claudeResponse)
 	openaiResp.Model = modelName
 
-	usage := relaymodel.Usage{
-		PromptTokens:     claudeResponse.Usage.InputTokens,
-		CompletionTokens: claudeResponse.Usage.OutputTokens,
-		TotalTokens:      claudeResponse.Usage.InputTokens + claudeResponse.Usage.OutputTokens,
-	}
+	usage := claudeResponse.Usage.ToUsage()
 	openaiResp.Usage = usage
 
 	c.JSON(http.StatusOK, openaiResp)
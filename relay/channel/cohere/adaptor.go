@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"one-api/relay/channel"
+	"one-api/relay/constant"
 	"one-api/relay/model"
 	"one-api/relay/util"
 
@@ -27,6 +28,9 @@ func (a *Adaptor) Init(meta *util.RelayMeta) {
 }
 
 func (a *Adaptor) GetRequestURL(meta *util.RelayMeta) (string, error) {
+	if meta.Mode == constant.RelayModeRerank {
+		return fmt.Sprintf("%s/v1/rerank", meta.BaseURL), nil
+	}
 	return fmt.Sprintf("%s/v1/chat", meta.BaseURL), nil
 }
 
@@ -40,6 +44,9 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, meta *util.RelayMeta, request *
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
+	if meta.Mode == constant.RelayModeRerank {
+		return ConvertRerankRequest(*request), nil
+	}
 	return ConvertRequest(*request), nil
 }
 
@@ -48,7 +55,9 @@ func (a *Adaptor) DoRequest(c *gin.Context, meta *util.RelayMeta, requestBody io
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *util.RelayMeta) (aitext string, usage *model.Usage, err *model.ErrorWithStatusCode) {
-	if meta.IsStream {
+	if meta.Mode == constant.RelayModeRerank {
+		err, usage = RerankHandler(c, resp, meta.ActualModelName)
+	} else if meta.IsStream {
 		err, usage, aitext = StreamHandler(c, resp)
 	} else {
 		err, usage, aitext = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
@@ -1,5 +1,7 @@
 package cohere
 
+import "one-api/relay/model"
+
 type Request struct {
 	Message          string        `json:"message" required:"true"`
 	Model            string        `json:"model,omitempty"`  // 默认值为"command-r"
@@ -139,6 +141,22 @@ type APIVersion struct {
 type BilledUnits struct {
 	InputTokens  int `json:"input_tokens"`
 	OutputTokens int `json:"output_tokens"`
+	SearchUnits  int `json:"search_units,omitempty"`
+}
+
+type RerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            int      `json:"top_n,omitempty"`
+	ReturnDocuments bool     `json:"return_documents,omitempty"`
+}
+
+type RerankResponse struct {
+	Id      string               `json:"id"`
+	Results []model.RerankResult `json:"results"`
+	Meta    Meta                 `json:"meta"`
+	Message string               `json:"message,omitempty"`
 }
 
 type Usage struct {
@@ -0,0 +1,80 @@
+package cohere
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"one-api/relay/channel/openai"
+	"one-api/relay/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchUnitTokens Cohere rerank 按 search unit 计费，每个 search unit 折算为 1000 token，
+// 模型倍率为 1 时即 $0.002 / search
+const SearchUnitTokens = 1000
+
+func ConvertRerankRequest(request model.GeneralOpenAIRequest) *RerankRequest {
+	rerankRequest := RerankRequest{
+		Model:     request.Model,
+		Query:     request.Query,
+		Documents: request.ParseDocuments(),
+		TopN:      request.TopN,
+	}
+	if request.ReturnDocuments != nil {
+		rerankRequest.ReturnDocuments = *request.ReturnDocuments
+	}
+	return &rerankRequest
+}
+
+func RerankHandler(c *gin.Context, resp *http.Response, modelName string) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var cohereResponse RerankResponse
+	err = json.Unmarshal(responseBody, &cohereResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	if cohereResponse.Id == "" {
+		return &model.ErrorWithStatusCode{
+			Error: model.Error{
+				Message: cohereResponse.Message,
+				Type:    "cohere_error",
+				Param:   "",
+				Code:    resp.StatusCode,
+			},
+			StatusCode: resp.StatusCode,
+		}, nil
+	}
+	searchUnits := cohereResponse.Meta.BilledUnits.SearchUnits
+	if searchUnits == 0 {
+		searchUnits = 1
+	}
+	usage := model.Usage{
+		PromptTokens: searchUnits * SearchUnitTokens,
+		TotalTokens:  searchUnits * SearchUnitTokens,
+	}
+	rerankResponse := model.RerankResponse{
+		Id:      cohereResponse.Id,
+		Model:   modelName,
+		Results: cohereResponse.Results,
+		Meta: map[string]any{
+			"billed_units": map[string]int{"search_units": searchUnits},
+		},
+	}
+	jsonResponse, err := json.Marshal(rerankResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return nil, &usage
+}
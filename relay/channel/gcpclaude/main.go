@@ -42,6 +42,7 @@ func createBaseRequest(request model.GeneralOpenAIRequest) *Request {
 	claudeRequest := &Request{
 		MaxTokens:   request.MaxTokens,
 		Stream:      request.Stream,
+		Thinking:    request.Thinking,
 		Temperature: request.Temperature,
 		TopP:        request.TopP,
 		TopK:        request.TopK,
@@ -50,6 +51,14 @@ func createBaseRequest(request model.GeneralOpenAIRequest) *Request {
 	if claudeRequest.MaxTokens == 0 {
 		claudeRequest.MaxTokens = 4096
 	}
+	if claudeRequest.Thinking == nil {
+		if thinking, maxTokens := anthropic.ReasoningEffort2Thinking(request, claudeRequest.MaxTokens); thinking != nil {
+			claudeRequest.Thinking = thinking
+			claudeRequest.MaxTokens = maxTokens
+			claudeRequest.Temperature = nil
+			claudeRequest.TopP = 0
+		}
+	}
 	if claudeRequest.AnthropicVersion == "" {
 		claudeRequest.AnthropicVersion = "vertex-2023-10-16"
 	}
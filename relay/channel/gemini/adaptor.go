@@ -1,10 +1,12 @@
 package gemini
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"one-api/common"
 	"one-api/relay/channel"
 	"one-api/relay/constant"
 	"one-api/relay/model"
@@ -22,6 +24,10 @@ func (a *Adaptor) Init(meta *util.RelayMeta) {
 }
 
 func (a *Adaptor) GetRequestURL(meta *util.RelayMeta) (string, error) {
+	// 原生接口透传，路径已在 relay 中按实际模型重写
+	if meta.Mode == constant.RelayModeGemini || meta.Mode == constant.RelayModeGeminiCountTokens {
+		return meta.BaseURL + meta.RequestURLPath, nil
+	}
 	version := "v1"
 	action := ""
 
@@ -59,6 +65,12 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, meta *util.RelayMeta, request *
 		return nil, errors.New("request is nil")
 	}
 	switch meta.Mode {
+	case constant.RelayModeGemini, constant.RelayModeGeminiCountTokens:
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(body), nil
 	case constant.RelayModeEmbeddings:
 		geminiEmbeddingRequest := ConvertEmbeddingRequest(*request)
 		return geminiEmbeddingRequest, nil
@@ -79,6 +91,10 @@ func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error)
 	return request, nil
 }
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *util.RelayMeta) (aitext string, usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.Mode == constant.RelayModeGemini || meta.Mode == constant.RelayModeGeminiCountTokens {
+		err, usage, aitext = NativeHandler(c, resp, meta.IsStream, meta.PromptTokens)
+		return
+	}
 	if meta.IsStream {
 		var responseText string
 		err, responseText, usage = StreamHandler(c, resp)
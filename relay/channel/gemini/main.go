@@ -54,6 +54,10 @@ func ConvertRequest(textRequest model.GeneralOpenAIRequest) *ChatRequest {
 			MaxOutputTokens: textRequest.MaxTokens,
 		},
 	}
+	// 仅 2.5 及之后的模型支持思考预算
+	if budget := textRequest.ReasoningBudgetTokens(); budget > 0 && !strings.HasPrefix(textRequest.Model, "gemini-1") && !strings.HasPrefix(textRequest.Model, "gemini-2.0") {
+		geminiRequest.GenerationConfig.ThinkingConfig = &ThinkingConfig{ThinkingBudget: budget}
+	}
 	if textRequest.Tools != nil {
 		functions := make([]model.Function, 0, len(textRequest.Tools))
 		for _, tool := range textRequest.Tools {
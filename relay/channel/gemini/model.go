@@ -1,10 +1,12 @@
 package gemini
 
 type ChatRequest struct {
-	Contents         []ChatContent        `json:"contents"`
-	SafetySettings   []ChatSafetySettings `json:"safety_settings,omitempty"`
-	GenerationConfig ChatGenerationConfig `json:"generation_config,omitempty"`
-	Tools            []ChatTools          `json:"tools,omitempty"`
+	Contents          []ChatContent        `json:"contents"`
+	SystemInstruction *ChatContent         `json:"systemInstruction,omitempty"`
+	SafetySettings    []ChatSafetySettings `json:"safetySettings,omitempty"`
+	GenerationConfig  ChatGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []ChatTools          `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig          `json:"toolConfig,omitempty"`
 }
 
 type InlineData struct {
@@ -16,6 +18,16 @@ type FunctionCall struct {
 	FunctionName string `json:"name"`
 	Arguments    any    `json:"args"`
 }
+
+type FunctionResponse struct {
+	Name     string `json:"name"`
+	Response any    `json:"response"`
+}
+
+type FileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileUri  string `json:"fileUri"`
+}
 type EmbeddingRequest struct {
 	Model                string      `json:"model"`
 	Content              ChatContent `json:"content"`
@@ -30,6 +42,10 @@ type EmbeddingResponse struct {
 	Embeddings []EmbeddingData `json:"embeddings"`
 	Error      *Error          `json:"error,omitempty"`
 }
+type CountTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
+}
+
 type EmbeddingData struct {
 	Values []float64 `json:"values"`
 }
@@ -39,9 +55,12 @@ type Error struct {
 	Status  string `json:"status,omitempty"`
 }
 type Part struct {
-	Text         string        `json:"text,omitempty"`
-	InlineData   *InlineData   `json:"inlineData,omitempty"`
-	FunctionCall *FunctionCall `json:"functionCall,omitempty"`
+	Text             string            `json:"text,omitempty"`
+	Thought          bool              `json:"thought,omitempty"`
+	InlineData       *InlineData       `json:"inlineData,omitempty"`
+	FileData         *FileData         `json:"fileData,omitempty"`
+	FunctionCall     *FunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *FunctionResponse `json:"functionResponse,omitempty"`
 }
 
 type ChatContent struct {
@@ -55,27 +74,44 @@ type ChatSafetySettings struct {
 }
 
 type ChatTools struct {
-	FunctionDeclarations any `json:"function_declarations,omitempty"`
+	FunctionDeclarations any `json:"functionDeclarations,omitempty"`
+}
+
+type ToolConfig struct {
+	FunctionCallingConfig *FunctionCallingConfig `json:"functionCallingConfig,omitempty"`
+}
+
+type FunctionCallingConfig struct {
+	Mode                 string   `json:"mode,omitempty"`
+	AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
 }
 
 type ChatGenerationConfig struct {
-	Temperature     *float64 `json:"temperature,omitempty"`
-	TopP            float64  `json:"topP,omitempty"`
-	TopK            float64  `json:"topK,omitempty"`
-	MaxOutputTokens uint     `json:"maxOutputTokens,omitempty"`
-	CandidateCount  int      `json:"candidateCount,omitempty"`
-	StopSequences   []string `json:"stopSequences,omitempty"`
+	Temperature      *float64        `json:"temperature,omitempty"`
+	TopP             float64         `json:"topP,omitempty"`
+	TopK             float64         `json:"topK,omitempty"`
+	MaxOutputTokens  uint            `json:"maxOutputTokens,omitempty"`
+	CandidateCount   int             `json:"candidateCount,omitempty"`
+	StopSequences    []string        `json:"stopSequences,omitempty"`
+	ResponseMimeType string          `json:"responseMimeType,omitempty"`
+	ResponseSchema   any             `json:"responseSchema,omitempty"`
+	ThinkingConfig   *ThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+type ThinkingConfig struct {
+	ThinkingBudget  int  `json:"thinkingBudget"`
+	IncludeThoughts bool `json:"includeThoughts,omitempty"`
 }
 
 type ChatResponse struct {
-	Candidates     []ChatCandidate    `json:"candidates"`
-	ModelVersion   string             `json:"modelVersion"`
-	UsageMetadata  UsageMetadata      `json:"usageMetadata"`
-	PromptFeedback ChatPromptFeedback `json:"promptFeedback"`
+	Candidates     []ChatCandidate     `json:"candidates"`
+	ModelVersion   string              `json:"modelVersion"`
+	UsageMetadata  UsageMetadata       `json:"usageMetadata"`
+	PromptFeedback *ChatPromptFeedback `json:"promptFeedback,omitempty"`
 }
 
 type UsageMetadata struct {
-	TotalTokens          int `json:"totalTokens"`
+	TotalTokens          int `json:"totalTokens,omitempty"`
 	PromptTokenCount     int `json:"promptTokenCount,omitempty"`
 	TotalTokenCount      int `json:"totalTokenCount,omitempty"`
 	CandidatesTokenCount int `json:"candidatesTokenCount,omitempty"`
@@ -91,9 +127,9 @@ type TokenDetail struct {
 
 type ChatCandidate struct {
 	Content       ChatContent        `json:"content"`
-	FinishReason  string             `json:"finishReason"`
+	FinishReason  string             `json:"finishReason,omitempty"`
 	Index         int64              `json:"index"`
-	SafetyRatings []ChatSafetyRating `json:"safetyRatings"`
+	SafetyRatings []ChatSafetyRating `json:"safetyRatings,omitempty"`
 }
 
 type ChatSafetyRating struct {
@@ -0,0 +1,755 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common"
+	"one-api/relay/channel/openai"
+	"one-api/relay/model"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 本文件负责 Gemini 原生接口（/v1beta/models/{model}:{action}）的透传与转换，
+// Gemini 渠道直接透传，其它渠道转换为 ChatCompletions / Embeddings 后再把响应转换回原生格式。
+
+type FunctionDeclaration struct {
+	Name                 string          `json:"name"`
+	Description          string          `json:"description,omitempty"`
+	Parameters           json.RawMessage `json:"parameters,omitempty"`
+	ParametersJsonSchema json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+type NativeEmbedRequest struct {
+	Content              ChatContent `json:"content"`
+	OutputDimensionality int         `json:"outputDimensionality,omitempty"`
+}
+
+type NativeCountTokensRequest struct {
+	Contents               []ChatContent `json:"contents"`
+	GenerateContentRequest *ChatRequest  `json:"generateContentRequest"`
+}
+
+// 这些字段的值由调用方定义（函数参数、JSON Schema），不做键名转换
+var opaqueNativeKeys = map[string]bool{
+	"args":                 true,
+	"response":             true,
+	"parameters":           true,
+	"parametersJsonSchema": true,
+	"responseSchema":       true,
+	"responseJsonSchema":   true,
+}
+
+func camelCase(key string) string {
+	if !strings.Contains(key, "_") {
+		return key
+	}
+	var sb strings.Builder
+	upper := false
+	for _, r := range key {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// camelizeKeys 原生接口同时接受 snake_case 与 camelCase，统一为 camelCase 后再解析
+func camelizeKeys(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(value))
+		for k, item := range value {
+			k = camelCase(k)
+			if opaqueNativeKeys[k] {
+				result[k] = item
+			} else {
+				result[k] = camelizeKeys(item)
+			}
+		}
+		return result
+	case []any:
+		for i, item := range value {
+			value[i] = camelizeKeys(item)
+		}
+		return value
+	}
+	return v
+}
+
+func unmarshalNative(body []byte, v any) error {
+	var raw any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return err
+	}
+	data, err := json.Marshal(camelizeKeys(raw))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// lowerSchemaTypes Gemini 的 Schema 类型为大写（OBJECT、STRING），转换为 JSON Schema 的小写形式
+func lowerSchemaTypes(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for k, item := range value {
+			if k == "type" {
+				if s, ok := item.(string); ok {
+					value[k] = strings.ToLower(s)
+					continue
+				}
+			}
+			value[k] = lowerSchemaTypes(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = lowerSchemaTypes(item)
+		}
+	}
+	return v
+}
+
+func nativeSchema(raw json.RawMessage) any {
+	var schema any
+	if err := json.Unmarshal(raw, &schema); err != nil || schema == nil {
+		return nil
+	}
+	return lowerSchemaTypes(schema)
+}
+
+func nativePartsText(parts []Part) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Text != "" && !part.Thought {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "")
+}
+
+func nativeMediaPart(mimeType string, url string, inline bool) map[string]any {
+	if strings.HasPrefix(mimeType, "image/") {
+		return map[string]any{"type": "image_url", "image_url": map[string]any{"url": url}}
+	}
+	if inline {
+		return map[string]any{"type": "file", "file": map[string]any{"file_data": url}}
+	}
+	return map[string]any{"type": "file", "file": map[string]any{"file_url": url}}
+}
+
+// ConvertNativeRequest2OpenAI 把 generateContent 请求体转换为 ChatCompletions 请求
+func ConvertNativeRequest2OpenAI(nativeRequest *ChatRequest, modelName string, stream bool) (*model.GeneralOpenAIRequest, error) {
+	config := nativeRequest.GenerationConfig
+	request := &model.GeneralOpenAIRequest{
+		Model:       modelName,
+		Stream:      stream,
+		MaxTokens:   config.MaxOutputTokens,
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+		TopK:        int(config.TopK),
+	}
+	if len(config.StopSequences) > 0 {
+		request.Stop = config.StopSequences
+	}
+	if config.ThinkingConfig != nil {
+		switch budget := config.ThinkingConfig.ThinkingBudget; {
+		case budget <= 0:
+		case budget < 4096:
+			request.ReasoningEffort = "low"
+		case budget < 16384:
+			request.ReasoningEffort = "medium"
+		default:
+			request.ReasoningEffort = "high"
+		}
+	}
+	if config.ResponseMimeType == "application/json" {
+		request.ResponseFormat = map[string]any{"type": "json_object"}
+		if config.ResponseSchema != nil {
+			request.ResponseFormat = map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   "response",
+					"schema": lowerSchemaTypes(config.ResponseSchema),
+				},
+			}
+		}
+	}
+
+	if nativeRequest.SystemInstruction != nil {
+		if system := nativePartsText(nativeRequest.SystemInstruction.Parts); system != "" {
+			request.Messages = append(request.Messages, model.Message{Role: "system", Content: system})
+		}
+	}
+	// Gemini 按函数名对应调用与结果，这里为每次调用生成 id 并按顺序匹配
+	pendingCalls := make(map[string][]string)
+	callCount := 0
+	for _, content := range nativeRequest.Contents {
+		if content.Role == "model" {
+			message := model.Message{Role: "assistant"}
+			for _, part := range content.Parts {
+				if part.FunctionCall == nil {
+					continue
+				}
+				callCount++
+				id := fmt.Sprintf("call_%d", callCount)
+				pendingCalls[part.FunctionCall.FunctionName] = append(pendingCalls[part.FunctionCall.FunctionName], id)
+				arguments, _ := json.Marshal(part.FunctionCall.Arguments)
+				if string(arguments) == "null" {
+					arguments = []byte("{}")
+				}
+				message.ToolCalls = append(message.ToolCalls, model.Tool{
+					Id:       id,
+					Type:     "function",
+					Function: model.Function{Name: part.FunctionCall.FunctionName, Arguments: string(arguments)},
+				})
+			}
+			if text := nativePartsText(content.Parts); text != "" || len(message.ToolCalls) == 0 {
+				message.Content = text
+			}
+			request.Messages = append(request.Messages, message)
+			continue
+		}
+		var parts []map[string]any
+		for _, part := range content.Parts {
+			switch {
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				id := ""
+				if ids := pendingCalls[name]; len(ids) > 0 {
+					id, pendingCalls[name] = ids[0], ids[1:]
+				}
+				result, _ := json.Marshal(part.FunctionResponse.Response)
+				request.Messages = append(request.Messages, model.Message{Role: "tool", Content: string(result), ToolCallId: id})
+			case part.InlineData != nil:
+				url := fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data)
+				parts = append(parts, nativeMediaPart(part.InlineData.MimeType, url, true))
+			case part.FileData != nil:
+				parts = append(parts, nativeMediaPart(part.FileData.MimeType, part.FileData.FileUri, false))
+			case part.Text != "" && !part.Thought:
+				parts = append(parts, map[string]any{"type": "text", "text": part.Text})
+			}
+		}
+		if len(parts) > 0 {
+			request.Messages = append(request.Messages, model.Message{Role: "user", Content: nativePartsToContent(parts)})
+		}
+	}
+
+	for _, tool := range nativeRequest.Tools {
+		if tool.FunctionDeclarations == nil {
+			// googleSearch、codeExecution 等内置工具无法转换
+			continue
+		}
+		data, err := json.Marshal(tool.FunctionDeclarations)
+		if err != nil {
+			return nil, err
+		}
+		var declarations []FunctionDeclaration
+		if err := json.Unmarshal(data, &declarations); err != nil {
+			return nil, fmt.Errorf("invalid functionDeclarations: %w", err)
+		}
+		for _, declaration := range declarations {
+			parameters := nativeSchema(declaration.ParametersJsonSchema)
+			if parameters == nil {
+				parameters = nativeSchema(declaration.Parameters)
+			}
+			if parameters == nil {
+				parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			request.Tools = append(request.Tools, model.Tool{
+				Type: "function",
+				Function: model.Function{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  parameters,
+				},
+			})
+		}
+	}
+	if len(request.Tools) > 0 && nativeRequest.ToolConfig != nil && nativeRequest.ToolConfig.FunctionCallingConfig != nil {
+		callingConfig := nativeRequest.ToolConfig.FunctionCallingConfig
+		switch callingConfig.Mode {
+		case "AUTO":
+			request.ToolChoice = "auto"
+		case "NONE":
+			request.ToolChoice = "none"
+		case "ANY":
+			request.ToolChoice = "required"
+			if len(callingConfig.AllowedFunctionNames) == 1 {
+				request.ToolChoice = map[string]any{
+					"type":     "function",
+					"function": map[string]any{"name": callingConfig.AllowedFunctionNames[0]},
+				}
+			}
+		}
+	}
+	return request, nil
+}
+
+// nativePartsToContent 纯文本内容合并为字符串，兼容不支持数组 content 的渠道
+func nativePartsToContent(parts []map[string]any) any {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part["type"] != "text" {
+			return parts
+		}
+		texts = append(texts, common.AsString(part["text"]))
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ParseNativeRequest 解析原生请求并转换为内部统一的请求结构，action 为 URL 中的方法名
+func ParseNativeRequest(body []byte, modelName string, action string) (*model.GeneralOpenAIRequest, error) {
+	switch action {
+	case "generateContent", "streamGenerateContent":
+		var nativeRequest ChatRequest
+		if err := unmarshalNative(body, &nativeRequest); err != nil {
+			return nil, err
+		}
+		return ConvertNativeRequest2OpenAI(&nativeRequest, modelName, action == "streamGenerateContent")
+	case "countTokens":
+		var countRequest NativeCountTokensRequest
+		if err := unmarshalNative(body, &countRequest); err != nil {
+			return nil, err
+		}
+		nativeRequest := countRequest.GenerateContentRequest
+		if nativeRequest == nil {
+			nativeRequest = &ChatRequest{Contents: countRequest.Contents}
+		}
+		return ConvertNativeRequest2OpenAI(nativeRequest, modelName, false)
+	case "embedContent":
+		var embedRequest NativeEmbedRequest
+		if err := unmarshalNative(body, &embedRequest); err != nil {
+			return nil, err
+		}
+		return &model.GeneralOpenAIRequest{
+			Model:      modelName,
+			Input:      nativePartsText(embedRequest.Content.Parts),
+			Dimensions: embedRequest.OutputDimensionality,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported method: %s", action)
+}
+
+func nativeUsage(metadata UsageMetadata, promptTokens int) *model.Usage {
+	if metadata.TotalTokenCount == 0 && metadata.PromptTokenCount == 0 {
+		return &model.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	}
+	usage := &model.Usage{
+		PromptTokens:     metadata.PromptTokenCount,
+		CompletionTokens: metadata.CandidatesTokenCount + metadata.ThoughtsTokenCount,
+		TotalTokens:      metadata.TotalTokenCount,
+	}
+	if metadata.ThoughtsTokenCount > 0 {
+		usage.CompletionTokensDetails = &model.CompletionTokensDetails{ReasoningTokens: metadata.ThoughtsTokenCount}
+	}
+	return usage
+}
+
+func usageMetadata(usage *model.Usage) UsageMetadata {
+	reasoningTokens := 0
+	if usage.CompletionTokensDetails != nil {
+		reasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	return UsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens - reasoningTokens,
+		ThoughtsTokenCount:   reasoningTokens,
+		TotalTokenCount:      usage.PromptTokens + usage.CompletionTokens,
+	}
+}
+
+// NativeHandler 透传 Gemini 原生接口的响应，并从 usageMetadata 中统计用量
+func NativeHandler(c *gin.Context, resp *http.Response, stream bool, promptTokens int) (*model.ErrorWithStatusCode, *model.Usage, string) {
+	defer resp.Body.Close()
+	c.Writer.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	if !stream {
+		responseBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil, ""
+		}
+		c.Writer.WriteHeader(resp.StatusCode)
+		_, _ = c.Writer.Write(responseBody)
+		var geminiResponse ChatResponse
+		_ = json.Unmarshal(responseBody, &geminiResponse)
+		return nil, nativeUsage(geminiResponse.UsageMetadata, promptTokens), nativeResponseText(&geminiResponse)
+	}
+
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(resp.StatusCode)
+	var metadata UsageMetadata
+	var responseText strings.Builder
+	var arrayBody bytes.Buffer
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			_, _ = c.Writer.Write(line)
+			c.Writer.Flush()
+			trimmed := bytes.TrimSpace(line)
+			if bytes.HasPrefix(trimmed, []byte("data:")) {
+				var geminiResponse ChatResponse
+				if json.Unmarshal(bytes.TrimSpace(trimmed[len("data:"):]), &geminiResponse) == nil {
+					responseText.WriteString(nativeResponseText(&geminiResponse))
+					if geminiResponse.UsageMetadata.TotalTokenCount > 0 {
+						metadata = geminiResponse.UsageMetadata
+					}
+				}
+			} else if len(trimmed) > 0 {
+				// 未指定 alt=sse 时响应为 JSON 数组
+				arrayBody.Write(line)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if arrayBody.Len() > 0 {
+		var geminiResponses []ChatResponse
+		if json.Unmarshal(arrayBody.Bytes(), &geminiResponses) == nil {
+			for i := range geminiResponses {
+				responseText.WriteString(nativeResponseText(&geminiResponses[i]))
+				if geminiResponses[i].UsageMetadata.TotalTokenCount > 0 {
+					metadata = geminiResponses[i].UsageMetadata
+				}
+			}
+		}
+	}
+	return nil, nativeUsage(metadata, promptTokens), responseText.String()
+}
+
+func nativeResponseText(response *ChatResponse) string {
+	if len(response.Candidates) == 0 {
+		return ""
+	}
+	return nativePartsText(response.Candidates[0].Content.Parts)
+}
+
+func finishReasonOpenAI2Gemini(reason string) string {
+	switch reason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+func functionCallPart(name string, arguments string) Part {
+	var args any = map[string]any{}
+	if arguments != "" {
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			args = map[string]any{}
+		}
+	}
+	return Part{FunctionCall: &FunctionCall{FunctionName: name, Arguments: args}}
+}
+
+type nativeToolCallDelta struct {
+	Index    int `json:"index"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type nativeStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          *string               `json:"content"`
+			ReasoningContent string                `json:"reasoning_content"`
+			Reasoning        string                `json:"reasoning"`
+			ToolCalls        []nativeToolCallDelta `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *model.Usage `json:"usage"`
+}
+
+// NativeCompatWriter 替换 c.Writer，把适配器输出的 OpenAI 格式响应转换为 Gemini 原生格式
+type NativeCompatWriter struct {
+	gin.ResponseWriter
+	stream       bool
+	sse          bool
+	embedding    bool
+	modelName    string
+	promptTokens int
+	statusCode   int
+	buffer       bytes.Buffer
+
+	wroteChunk    bool
+	inThinkTag    bool
+	toolCalls     []*nativeToolCallDelta
+	finishReason  string
+	upstreamUsage *model.Usage
+}
+
+// NewNativeCompatWriter sse 为 false 时流式响应以 JSON 数组输出，与原生接口未指定 alt=sse 时一致
+func NewNativeCompatWriter(writer gin.ResponseWriter, stream bool, sse bool, embedding bool, modelName string, promptTokens int) *NativeCompatWriter {
+	return &NativeCompatWriter{
+		ResponseWriter: writer,
+		stream:         stream,
+		sse:            sse,
+		embedding:      embedding,
+		modelName:      modelName,
+		promptTokens:   promptTokens,
+		statusCode:     200,
+	}
+}
+
+func (w *NativeCompatWriter) WriteHeader(code int) {
+	if w.stream {
+		w.prepareStreamHeader()
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.statusCode = code
+}
+
+func (w *NativeCompatWriter) WriteHeaderNow() {
+	if w.stream {
+		w.prepareStreamHeader()
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *NativeCompatWriter) Status() int {
+	if w.stream {
+		return w.ResponseWriter.Status()
+	}
+	return w.statusCode
+}
+
+func (w *NativeCompatWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *NativeCompatWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+	for {
+		line, err := w.buffer.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行留到下次
+			w.buffer.Reset()
+			w.buffer.Write(line)
+			break
+		}
+		w.handleLine(string(bytes.TrimSpace(line)))
+	}
+	return len(data), nil
+}
+
+func (w *NativeCompatWriter) prepareStreamHeader() {
+	if !w.sse && !w.ResponseWriter.Written() {
+		w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	}
+}
+
+func (w *NativeCompatWriter) sendChunk(response *ChatResponse) {
+	jsonData, err := json.Marshal(response)
+	if err != nil {
+		common.SysError("error marshalling gemini stream response: " + err.Error())
+		return
+	}
+	w.prepareStreamHeader()
+	switch {
+	case w.sse:
+		_, _ = w.ResponseWriter.WriteString("data: " + string(jsonData) + "\r\n\r\n")
+	case !w.wroteChunk:
+		_, _ = w.ResponseWriter.WriteString("[" + string(jsonData))
+	default:
+		_, _ = w.ResponseWriter.WriteString(",\r\n" + string(jsonData))
+	}
+	w.wroteChunk = true
+}
+
+func (w *NativeCompatWriter) sendPart(part Part) {
+	w.sendChunk(&ChatResponse{
+		Candidates:   []ChatCandidate{{Content: ChatContent{Role: "model", Parts: []Part{part}}}},
+		ModelVersion: w.modelName,
+	})
+}
+
+// sendContent 处理正文，OpenAI 适配器会把推理内容包在 <think></think> 中
+func (w *NativeCompatWriter) sendContent(content string) {
+	if !w.inThinkTag && !w.wroteChunk && strings.HasPrefix(content, "<think>") {
+		w.inThinkTag = true
+		content = strings.TrimPrefix(content, "<think>")
+	}
+	if w.inThinkTag {
+		end := strings.Index(content, "</think>")
+		if end < 0 {
+			if content != "" {
+				w.sendPart(Part{Text: content, Thought: true})
+			}
+			return
+		}
+		if end > 0 {
+			w.sendPart(Part{Text: content[:end], Thought: true})
+		}
+		w.inThinkTag = false
+		content = strings.TrimLeft(content[end+len("</think>"):], "\n")
+	}
+	if content != "" {
+		w.sendPart(Part{Text: content})
+	}
+}
+
+func (w *NativeCompatWriter) handleLine(line string) {
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || data == "[DONE]" {
+		return
+	}
+	var chunk nativeStreamChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return
+	}
+	if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+		w.upstreamUsage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		for _, reasoning := range []string{delta.ReasoningContent, delta.Reasoning} {
+			if reasoning != "" {
+				w.sendPart(Part{Text: reasoning, Thought: true})
+			}
+		}
+		if delta.Content != nil {
+			w.sendContent(*delta.Content)
+		}
+		// Gemini 的函数调用不分片，参数收集完整后在结束时输出
+		for _, toolCall := range delta.ToolCalls {
+			for len(w.toolCalls) <= toolCall.Index {
+				w.toolCalls = append(w.toolCalls, &nativeToolCallDelta{})
+			}
+			current := w.toolCalls[toolCall.Index]
+			if toolCall.Function.Name != "" {
+				current.Function.Name = toolCall.Function.Name
+			}
+			current.Function.Arguments += toolCall.Function.Arguments
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.finishReason = *choice.FinishReason
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// buildResponse 根据非流式 ChatCompletions 响应生成原生响应
+func (w *NativeCompatWriter) buildResponse(response *openai.TextResponse, usage *model.Usage) *ChatResponse {
+	parts := make([]Part, 0)
+	finishReason := "STOP"
+	if len(response.Choices) > 0 {
+		choice := response.Choices[0]
+		thinking, text := openai.SplitThinkContent(choice.Message.StringContent())
+		if choice.Message.ReasoningContent != "" {
+			thinking = choice.Message.ReasoningContent
+		}
+		if thinking != "" {
+			parts = append(parts, Part{Text: thinking, Thought: true})
+		}
+		if text != "" {
+			parts = append(parts, Part{Text: text})
+		}
+		for _, toolCall := range choice.Message.ToolCalls {
+			parts = append(parts, functionCallPart(toolCall.Function.Name, common.AsString(toolCall.Function.Arguments)))
+		}
+		finishReason = finishReasonOpenAI2Gemini(choice.FinishReason)
+	}
+	return &ChatResponse{
+		Candidates: []ChatCandidate{{
+			Content:      ChatContent{Role: "model", Parts: parts},
+			FinishReason: finishReason,
+		}},
+		ModelVersion:  w.modelName,
+		UsageMetadata: usageMetadata(usage),
+	}
+}
+
+func (w *NativeCompatWriter) writeJSON(body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	header := w.ResponseWriter.Header()
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	header.Set("Content-Type", "application/json")
+	w.ResponseWriter.WriteHeader(w.statusCode)
+	_, err = w.ResponseWriter.Write(data)
+	return err
+}
+
+// Finish 输出收尾内容，usage 为适配器最终统计的用量
+func (w *NativeCompatWriter) Finish(usage *model.Usage) error {
+	if usage == nil {
+		usage = w.upstreamUsage
+	}
+	if usage == nil {
+		usage = &model.Usage{PromptTokens: w.promptTokens}
+	}
+	if w.embedding {
+		var response openai.EmbeddingResponse
+		if err := json.Unmarshal(w.buffer.Bytes(), &response); err != nil {
+			return err
+		}
+		values := make([]float64, 0)
+		if len(response.Data) > 0 {
+			values = response.Data[0].Embedding
+		}
+		return w.writeJSON(map[string]any{"embedding": EmbeddingData{Values: values}})
+	}
+	if !w.stream {
+		var response openai.TextResponse
+		if err := json.Unmarshal(w.buffer.Bytes(), &response); err != nil {
+			return err
+		}
+		if response.Usage.TotalTokens > 0 {
+			usage = &response.Usage
+		}
+		return w.writeJSON(w.buildResponse(&response, usage))
+	}
+	if w.buffer.Len() > 0 {
+		w.handleLine(strings.TrimSpace(w.buffer.String()))
+		w.buffer.Reset()
+	}
+	parts := make([]Part, 0, len(w.toolCalls))
+	for _, toolCall := range w.toolCalls {
+		if toolCall.Function.Name != "" {
+			parts = append(parts, functionCallPart(toolCall.Function.Name, toolCall.Function.Arguments))
+		}
+	}
+	w.sendChunk(&ChatResponse{
+		Candidates: []ChatCandidate{{
+			Content:      ChatContent{Role: "model", Parts: parts},
+			FinishReason: finishReasonOpenAI2Gemini(w.finishReason),
+		}},
+		ModelVersion:  w.modelName,
+		UsageMetadata: usageMetadata(usage),
+	})
+	if !w.sse {
+		_, _ = w.ResponseWriter.WriteString("]")
+	}
+	w.ResponseWriter.Flush()
+	return nil
+}
@@ -0,0 +1,71 @@
+package jina
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"one-api/relay/channel"
+	"one-api/relay/channel/openai"
+	"one-api/relay/constant"
+	"one-api/relay/model"
+	"one-api/relay/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Adaptor Jina 的 rerank 与 embeddings 接口均与本站格式一致，请求和响应直接透传
+type Adaptor struct{}
+
+func (a *Adaptor) Init(meta *util.RelayMeta) {
+
+}
+
+func (a *Adaptor) GetRequestURL(meta *util.RelayMeta) (string, error) {
+	switch meta.Mode {
+	case constant.RelayModeRerank:
+		return fmt.Sprintf("%s/v1/rerank", meta.BaseURL), nil
+	case constant.RelayModeEmbeddings:
+		return fmt.Sprintf("%s/v1/embeddings", meta.BaseURL), nil
+	}
+	return "", fmt.Errorf("unsupported relay mode %d for jina", meta.Mode)
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *util.RelayMeta) error {
+	channel.SetupCommonRequestHeader(c, req, meta)
+	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, meta *util.RelayMeta, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return request, nil
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, meta *util.RelayMeta, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoRequestHelper(a, c, meta, requestBody)
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *util.RelayMeta) (aitext string, usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.Mode == constant.RelayModeRerank {
+		err, usage = openai.RerankHandler(c, resp, meta.PromptTokens)
+	} else {
+		err, usage, aitext = openai.Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
+	}
+	return
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return "Jina"
+}
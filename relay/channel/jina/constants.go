@@ -0,0 +1,9 @@
+package jina
+
+var ModelList = []string{
+	"jina-reranker-v2-base-multilingual",
+	"jina-reranker-m0",
+	"jina-colbert-v2",
+	"jina-embeddings-v3",
+	"jina-clip-v2",
+}
@@ -288,6 +288,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *MidjourneyResponse {
 	tokenId := c.GetInt("token_id")
 	channelType := c.GetInt("channel")
 	userId := c.GetInt("id")
+	orgId := c.GetInt("org_id")
 	consumeQuota := c.GetBool("consume_quota")
 	group := c.GetString("group")
 	channelId := c.GetInt("channel_id")
@@ -509,7 +510,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *MidjourneyResponse {
 
 	ratio := modelRatio * groupRatio
 
-	userQuota, err := model.CacheGetUserQuota(c, userId)
+	userQuota, err := model.CacheGetPayerQuota(c, userId, orgId)
 	if err != nil {
 		return &MidjourneyResponse{
 			Code:        4,
@@ -593,7 +594,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *MidjourneyResponse {
 			if err != nil {
 				common.SysError("error consuming token remain quota: " + err.Error())
 			}
-			err = model.CacheDecreaseUserQuota(ctx, userId, quota)
+			err = model.CacheDecreasePayerQuota(ctx, userId, orgId, quota)
 			if err != nil {
 				logger.Error(ctx, "decrease_user_quota_failed"+err.Error())
 			}
@@ -660,6 +661,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayMode int) *MidjourneyResponse {
 	ChannelIsImageURLEnabled, _ := model.GetChannelByIdIsImageURLEnabled(c.GetInt("channel_id"))
 	midjourneyTask := &model.Midjourney{
 		UserId:            userId,
+		TokenId:           tokenId,
 		Code:              midjResponse.Code,
 		Action:            midjRequest.Action,
 		MjId:              midjResponse.Result,
@@ -161,6 +161,8 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *util.Rel
 			err, usage = ImagesEditsHandler(c, resp)
 		case constant.RelayResponses:
 			err, usage, aitext = ResponsesHandler(c, resp, meta.PromptTokens, meta.OriginModelName)
+		case constant.RelayModeRerank:
+			err, usage = RerankHandler(c, resp, meta.PromptTokens)
 
 		default:
 			err, usage, aitext = Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
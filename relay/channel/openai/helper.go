@@ -1,6 +1,9 @@
 package openai
 
-import "one-api/relay/model"
+import (
+	"one-api/relay/model"
+	"strings"
+)
 
 func ResponseText2Usage(responseText string, modeName string, promptTokens int) *model.Usage {
 	usage := &model.Usage{}
@@ -9,3 +12,19 @@ func ResponseText2Usage(responseText string, modeName string, promptTokens int)
 	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 	return usage
 }
+
+// SplitThinkContent 拆分 Handler 注入到正文中的 <think> 标签
+func SplitThinkContent(content string) (thinking string, text string) {
+	if !strings.HasPrefix(content, "<think>") {
+		return "", content
+	}
+	end := strings.Index(content, "</think>")
+	if end < 0 {
+		return strings.TrimPrefix(content, "<think>"), ""
+	}
+	thinking = content[len("<think>"):end]
+	text = content[end+len("</think>"):]
+	text = strings.TrimPrefix(text, "\\n\\n")
+	text = strings.TrimLeft(text, "\n")
+	return thinking, text
+}
@@ -272,6 +272,8 @@ func updateUsageFromResponse(usage *model.RealtimeUsage, responseUsage *model.Re
 	usage.InputTokenDetails.AudioTokens += responseUsage.InputTokenDetails.AudioTokens
 	usage.InputTokenDetails.CachedTokens += responseUsage.InputTokenDetails.CachedTokens
 	usage.InputTokenDetails.TextTokens += responseUsage.InputTokenDetails.TextTokens
+	usage.InputTokenDetails.CachedTokensDetails.TextTokens += responseUsage.InputTokenDetails.CachedTokensDetails.TextTokens
+	usage.InputTokenDetails.CachedTokensDetails.AudioTokens += responseUsage.InputTokenDetails.CachedTokensDetails.AudioTokens
 	usage.OutputTokenDetails.AudioTokens += responseUsage.OutputTokenDetails.AudioTokens
 	usage.OutputTokenDetails.TextTokens += responseUsage.OutputTokenDetails.TextTokens
 }
@@ -287,6 +289,8 @@ func preConsumeUsage(ctx *gin.Context, meta *util.RelayMeta, usage *model.Realti
 	totalUsage.InputTokenDetails.CachedTokens += usage.InputTokenDetails.CachedTokens
 	totalUsage.InputTokenDetails.TextTokens += usage.InputTokenDetails.TextTokens
 	totalUsage.InputTokenDetails.AudioTokens += usage.InputTokenDetails.AudioTokens
+	totalUsage.InputTokenDetails.CachedTokensDetails.TextTokens += usage.InputTokenDetails.CachedTokensDetails.TextTokens
+	totalUsage.InputTokenDetails.CachedTokensDetails.AudioTokens += usage.InputTokenDetails.CachedTokensDetails.AudioTokens
 	totalUsage.OutputTokenDetails.TextTokens += usage.OutputTokenDetails.TextTokens
 	totalUsage.OutputTokenDetails.AudioTokens += usage.OutputTokenDetails.AudioTokens
 	// clear usage
@@ -302,7 +306,7 @@ func GetStringIfEmpty(str string, defaultValue string) string {
 }
 
 func PreWssConsumeQuota(ctx *gin.Context, meta *util.RelayMeta, usage *model.RealtimeUsage) error {
-	userQuota, err := omodel.GetUserQuota(meta.UserId)
+	userQuota, err := omodel.GetPayerQuota(meta.UserId, meta.OrgId)
 	if err != nil {
 		return err
 	}
@@ -313,23 +317,13 @@ func PreWssConsumeQuota(ctx *gin.Context, meta *util.RelayMeta, usage *model.Rea
 	}
 
 	modelName := meta.OriginModelName
-	textInputTokens := usage.InputTokenDetails.TextTokens
-	textOutTokens := usage.OutputTokenDetails.TextTokens
-	audioInputTokens := usage.InputTokenDetails.AudioTokens
-	audioOutTokens := usage.OutputTokenDetails.AudioTokens
-
-	completionRatio := common.GetCompletionRatio(modelName)
-	audioRatio := common.GetAudioRatio(meta.OriginModelName)
-	audioCompletionRatio := common.GetAudioCompletionRatio(modelName)
 	groupRatio := common.GetGroupRatio(meta.Group)
 	modelRatio := common.GetModelRatio(modelName)
 
 	ratio := groupRatio * modelRatio
 
-	quota := textInputTokens + int(math.Round(float64(textOutTokens)*completionRatio))
-	quota += int(math.Round(float64(audioInputTokens)*audioRatio)) + int(math.Round(float64(audioOutTokens)*audioRatio*audioCompletionRatio))
-
-	quota = int(math.Round(float64(quota) * ratio))
+	weightedTokens, _ := util.WeightedTokens(modelName, util.NewRealtimeTokenUsage(usage))
+	quota := int(math.Round(weightedTokens * ratio))
 	if ratio != 0 && quota <= 0 {
 		quota = 1
 	}
@@ -348,7 +342,7 @@ func PreWssConsumeQuota(ctx *gin.Context, meta *util.RelayMeta, usage *model.Rea
 		return fmt.Errorf("user_quota_failed: %w", err)
 	}
 	// 更新redis配额
-	if err := omodel.CacheDecreaseUserQuota(ctx, meta.UserId, int(quota)); err != nil {
+	if err := omodel.CacheDecreasePayerQuota(ctx, meta.UserId, meta.OrgId, int(quota)); err != nil {
 		return fmt.Errorf("decrease_user_quota_failed: %w", err)
 	}
 	//common.LogInfo(ctx, "realtime streaming consume quota success, quota: "+fmt.Sprintf("%d", quota))
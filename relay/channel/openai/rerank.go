@@ -0,0 +1,38 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"one-api/relay/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RerankHandler 透传 Jina 格式的 rerank 响应，上游未返回用量时按请求 token 数计费
+func RerankHandler(c *gin.Context, resp *http.Response, promptTokens int) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var rerankResponse model.RerankResponse
+	err = json.Unmarshal(responseBody, &rerankResponse)
+	if err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	usage := &model.Usage{
+		PromptTokens: promptTokens,
+		TotalTokens:  promptTokens,
+	}
+	if rerankResponse.Usage != nil && rerankResponse.Usage.TotalTokens > 0 {
+		usage.PromptTokens = rerankResponse.Usage.TotalTokens
+		usage.TotalTokens = rerankResponse.Usage.TotalTokens
+	}
+	sendHTTPResponse(c, resp.StatusCode, resp.Header, bytes.NewBuffer(responseBody))
+	return nil, usage
+}
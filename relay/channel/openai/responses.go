@@ -86,18 +86,10 @@ func ResponsesHandler(c *gin.Context, resp *http.Response, promptTokens int, ori
 		return ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil, ""
 	}
 
-	// 尝试从 Anthropic 格式中提取 usage 信息
+	// 尝试从 Responses 格式中提取 usage 信息
 	if usageMap, ok := responseMap["usage"].(map[string]interface{}); ok {
-		inputTokens, _ := usageMap["input_tokens"].(float64)
-		outputTokens, _ := usageMap["output_tokens"].(float64)
-		totalTokens, _ := usageMap["total_tokens"].(float64)
-
-		if totalTokens > 0 {
-			return nil, &model.Usage{
-				PromptTokens:     int(inputTokens),
-				CompletionTokens: int(outputTokens),
-				TotalTokens:      int(totalTokens),
-			}, responseText
+		if usage := parseResponsesUsage(usageMap); usage != nil {
+			return nil, usage, responseText
 		}
 	}
 
@@ -178,17 +170,7 @@ func ResponsesStreamHandler(c *gin.Context, resp *http.Response, relayMode int,
 
 					// 从完整响应中提取 usage 信息
 					if usageMap, ok := responseObj["usage"].(map[string]interface{}); ok {
-						inputTokens, _ := usageMap["input_tokens"].(float64)
-						outputTokens, _ := usageMap["output_tokens"].(float64)
-						totalTokens, _ := usageMap["total_tokens"].(float64)
-
-						if totalTokens > 0 {
-							usage = &model.Usage{
-								PromptTokens:     int(inputTokens),
-								CompletionTokens: int(outputTokens),
-								TotalTokens:      int(totalTokens),
-							}
-						}
+						usage = parseResponsesUsage(usageMap)
 					}
 				}
 			}
@@ -214,17 +196,7 @@ func ResponsesStreamHandler(c *gin.Context, resp *http.Response, relayMode int,
 	// 如果没有从流中提取到 usage 信息，但有最后的完整响应
 	if usage == nil && lastCompleteResponse != nil {
 		if usageMap, ok := lastCompleteResponse["usage"].(map[string]interface{}); ok {
-			inputTokens, _ := usageMap["input_tokens"].(float64)
-			outputTokens, _ := usageMap["output_tokens"].(float64)
-			totalTokens, _ := usageMap["total_tokens"].(float64)
-
-			if totalTokens > 0 {
-				usage = &model.Usage{
-					PromptTokens:     int(inputTokens),
-					CompletionTokens: int(outputTokens),
-					TotalTokens:      int(totalTokens),
-				}
-			}
+			usage = parseResponsesUsage(usageMap)
 		}
 	}
 
@@ -240,3 +212,29 @@ func ResponsesStreamHandler(c *gin.Context, resp *http.Response, relayMode int,
 
 	return nil, responseText, toolCount, usage
 }
+
+// parseResponsesUsage 解析 Responses API 的 usage，包括命中缓存的输入 token 和推理 token
+func parseResponsesUsage(usageMap map[string]interface{}) *model.Usage {
+	inputTokens, _ := usageMap["input_tokens"].(float64)
+	outputTokens, _ := usageMap["output_tokens"].(float64)
+	totalTokens, _ := usageMap["total_tokens"].(float64)
+	if totalTokens <= 0 {
+		return nil
+	}
+	usage := &model.Usage{
+		PromptTokens:     int(inputTokens),
+		CompletionTokens: int(outputTokens),
+		TotalTokens:      int(totalTokens),
+	}
+	if details, ok := usageMap["input_tokens_details"].(map[string]interface{}); ok {
+		if cachedTokens, _ := details["cached_tokens"].(float64); cachedTokens > 0 {
+			usage.PromptTokensDetails = &model.PromptTokensDetails{CachedTokens: int(cachedTokens)}
+		}
+	}
+	if details, ok := usageMap["output_tokens_details"].(map[string]interface{}); ok {
+		if reasoningTokens, _ := details["reasoning_tokens"].(float64); reasoningTokens > 0 {
+			usage.CompletionTokensDetails = &model.CompletionTokensDetails{ReasoningTokens: int(reasoningTokens)}
+		}
+	}
+	return usage
+}
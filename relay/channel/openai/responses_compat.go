@@ -0,0 +1,790 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"one-api/common"
+	"one-api/relay/model"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 本文件负责 Responses API 与 ChatCompletions 之间的互转，
+// 使 /v1/responses 请求可以由 Claude、Gemini、AWS Claude、GCP Claude 等渠道处理。
+
+type responsesCompatRequest struct {
+	Model              string                `json:"model"`
+	Input              json.RawMessage       `json:"input"`
+	Instructions       string                `json:"instructions"`
+	MaxOutputTokens    uint                  `json:"max_output_tokens"`
+	Temperature        *float64              `json:"temperature"`
+	TopP               float64               `json:"top_p"`
+	Stream             bool                  `json:"stream"`
+	Tools              []responsesCompatTool `json:"tools"`
+	ToolChoice         json.RawMessage       `json:"tool_choice"`
+	ParallelToolCalls  *bool                 `json:"parallel_tool_calls"`
+	User               string                `json:"user"`
+	PreviousResponseId string                `json:"previous_response_id"`
+	Reasoning          *struct {
+		Effort string `json:"effort"`
+	} `json:"reasoning"`
+	Text *struct {
+		Format *responsesCompatFormat `json:"format"`
+	} `json:"text"`
+}
+
+type responsesCompatTool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+	Strict      *bool           `json:"strict"`
+}
+
+type responsesCompatFormat struct {
+	Type   string          `json:"type"`
+	Name   string          `json:"name"`
+	Schema json.RawMessage `json:"schema"`
+	Strict *bool           `json:"strict"`
+}
+
+type responsesCompatItem struct {
+	Type      string          `json:"type"`
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	CallId    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"`
+}
+
+type responsesCompatPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Refusal  string `json:"refusal"`
+	ImageUrl string `json:"image_url"`
+	Detail   string `json:"detail"`
+	FileId   string `json:"file_id"`
+	FileData string `json:"file_data"`
+	FileUrl  string `json:"file_url"`
+	Filename string `json:"filename"`
+}
+
+// parseResponsesParts 解析 content，content 可以是字符串或内容数组
+func parseResponsesParts(raw json.RawMessage) ([]responsesCompatPart, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []responsesCompatPart{{Type: "input_text", Text: text}}, nil
+	}
+	var parts []responsesCompatPart
+	err := json.Unmarshal(raw, &parts)
+	return parts, err
+}
+
+func convertResponsesPart(part responsesCompatPart) (map[string]any, error) {
+	switch part.Type {
+	case "input_text", "output_text", "text":
+		return map[string]any{"type": "text", "text": part.Text}, nil
+	case "refusal":
+		return map[string]any{"type": "text", "text": part.Refusal}, nil
+	case "input_image":
+		if part.ImageUrl == "" {
+			return nil, errors.New("input_image with file_id is not supported by this channel")
+		}
+		imageUrl := map[string]any{"url": part.ImageUrl}
+		if part.Detail != "" && part.Detail != "auto" {
+			imageUrl["detail"] = part.Detail
+		}
+		return map[string]any{"type": "image_url", "image_url": imageUrl}, nil
+	case "input_file":
+		file := map[string]any{}
+		switch {
+		case part.FileData != "":
+			file["file_data"] = part.FileData
+		case part.FileUrl != "":
+			file["file_url"] = part.FileUrl
+		default:
+			return nil, errors.New("input_file with file_id is not supported by this channel")
+		}
+		if part.Filename != "" {
+			file["filename"] = part.Filename
+		}
+		return map[string]any{"type": "file", "file": file}, nil
+	}
+	return nil, nil
+}
+
+// responsesPartsToContent 纯文本内容合并为字符串，兼容不支持数组 content 的渠道
+func responsesPartsToContent(parts []map[string]any) any {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part["type"] != "text" {
+			return parts
+		}
+		texts = append(texts, common.AsString(part["text"]))
+	}
+	return strings.Join(texts, "\n")
+}
+
+func convertResponsesContent(raw json.RawMessage) ([]map[string]any, error) {
+	parts, err := parseResponsesParts(raw)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]map[string]any, 0, len(parts))
+	for _, part := range parts {
+		converted, err := convertResponsesPart(part)
+		if err != nil {
+			return nil, err
+		}
+		if converted != nil {
+			result = append(result, converted)
+		}
+	}
+	return result, nil
+}
+
+// convertResponsesInput 把 input 条目转换为 ChatCompletions 消息
+func convertResponsesInput(raw json.RawMessage) ([]model.Message, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return []model.Message{{Role: "user", Content: text}}, nil
+	}
+	var items []responsesCompatItem
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	var messages []model.Message
+	// function_call_output 中的图片无法放进 tool 消息，在工具结果之后追加为 user 消息
+	var toolImages []map[string]any
+	flushToolImages := func() {
+		if len(toolImages) > 0 {
+			messages = append(messages, model.Message{Role: "user", Content: toolImages})
+			toolImages = nil
+		}
+	}
+	for _, item := range items {
+		if item.Type != "function_call_output" {
+			flushToolImages()
+		}
+		switch item.Type {
+		case "", "message":
+			parts, err := convertResponsesContent(item.Content)
+			if err != nil {
+				return nil, err
+			}
+			role := item.Role
+			if role == "developer" {
+				role = "system"
+			}
+			messages = append(messages, model.Message{Role: role, Content: responsesPartsToContent(parts)})
+		case "function_call":
+			arguments := item.Arguments
+			if arguments == "" {
+				arguments = "{}"
+			}
+			toolCall := model.Tool{
+				Id:       item.CallId,
+				Type:     "function",
+				Function: model.Function{Name: item.Name, Arguments: arguments},
+			}
+			// 连续的 function_call 合并到同一条 assistant 消息
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == "assistant" {
+				messages[last].ToolCalls = append(messages[last].ToolCalls, toolCall)
+				continue
+			}
+			messages = append(messages, model.Message{Role: "assistant", ToolCalls: []model.Tool{toolCall}})
+		case "function_call_output":
+			parts, err := convertResponsesContent(item.Output)
+			if err != nil {
+				return nil, err
+			}
+			var texts []string
+			for _, part := range parts {
+				if part["type"] == "text" {
+					texts = append(texts, common.AsString(part["text"]))
+				} else {
+					toolImages = append(toolImages, part)
+				}
+			}
+			messages = append(messages, model.Message{
+				Role:       "tool",
+				Content:    strings.Join(texts, "\n"),
+				ToolCallId: item.CallId,
+			})
+		case "reasoning":
+			// 历史推理内容不回传，多数渠道不接受
+		default:
+			return nil, fmt.Errorf("input item type '%s' is not supported by this channel", item.Type)
+		}
+	}
+	flushToolImages()
+	return messages, nil
+}
+
+func convertResponsesToolChoice(raw json.RawMessage) any {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if raw[0] == '"' {
+		var choice string
+		_ = json.Unmarshal(raw, &choice)
+		return choice
+	}
+	var choice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &choice); err != nil || choice.Type != "function" {
+		return nil
+	}
+	return map[string]any{
+		"type":     "function",
+		"function": map[string]any{"name": choice.Name},
+	}
+}
+
+// ConvertResponsesRequest2ChatCompletions 把 Responses 请求体转换为 ChatCompletions 请求
+func ConvertResponsesRequest2ChatCompletions(body []byte, modelName string) (*model.GeneralOpenAIRequest, error) {
+	var responsesRequest responsesCompatRequest
+	if err := json.Unmarshal(body, &responsesRequest); err != nil {
+		return nil, err
+	}
+	if responsesRequest.PreviousResponseId != "" {
+		return nil, errors.New("previous_response_id is not supported by this channel, please send the full conversation in input")
+	}
+	request := &model.GeneralOpenAIRequest{
+		Model:             modelName,
+		Stream:            responsesRequest.Stream,
+		MaxTokens:         responsesRequest.MaxOutputTokens,
+		Temperature:       responsesRequest.Temperature,
+		TopP:              responsesRequest.TopP,
+		ParallelToolCalls: responsesRequest.ParallelToolCalls,
+		User:              responsesRequest.User,
+		ResponsesCompat:   true,
+	}
+	if responsesRequest.Reasoning != nil && responsesRequest.Reasoning.Effort != "none" {
+		request.ReasoningEffort = responsesRequest.Reasoning.Effort
+	}
+	if responsesRequest.Text != nil && responsesRequest.Text.Format != nil {
+		switch format := responsesRequest.Text.Format; format.Type {
+		case "json_object":
+			request.ResponseFormat = map[string]any{"type": "json_object"}
+		case "json_schema":
+			request.ResponseFormat = map[string]any{
+				"type": "json_schema",
+				"json_schema": map[string]any{
+					"name":   format.Name,
+					"schema": format.Schema,
+					"strict": format.Strict,
+				},
+			}
+		}
+	}
+	if responsesRequest.Instructions != "" {
+		request.Messages = append(request.Messages, model.Message{Role: "system", Content: responsesRequest.Instructions})
+	}
+	messages, err := convertResponsesInput(responsesRequest.Input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input: %w", err)
+	}
+	request.Messages = append(request.Messages, messages...)
+
+	for _, tool := range responsesRequest.Tools {
+		// 内置工具（web_search、file_search 等）无法转换
+		if tool.Type != "function" {
+			continue
+		}
+		var parameters any = json.RawMessage(`{"type":"object","properties":{}}`)
+		if len(tool.Parameters) > 0 && string(tool.Parameters) != "null" {
+			parameters = tool.Parameters
+		}
+		request.Tools = append(request.Tools, model.Tool{
+			Type: "function",
+			Function: model.Function{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  parameters,
+			},
+		})
+	}
+	if len(request.Tools) > 0 {
+		request.ToolChoice = convertResponsesToolChoice(responsesRequest.ToolChoice)
+	}
+	return request, nil
+}
+
+type responsesOutputItem struct {
+	Id        string
+	Type      string
+	Text      string
+	CallId    string
+	Name      string
+	Arguments string
+}
+
+// toMap 生成 output 条目，done 为 false 时输出 output_item.added 所需的空条目
+func (item *responsesOutputItem) toMap(done bool) map[string]any {
+	status := "in_progress"
+	if done {
+		status = "completed"
+	}
+	switch item.Type {
+	case "reasoning":
+		summary := []any{}
+		if done {
+			summary = append(summary, map[string]any{"type": "summary_text", "text": item.Text})
+		}
+		return map[string]any{"id": item.Id, "type": "reasoning", "summary": summary}
+	case "function_call":
+		arguments := ""
+		if done {
+			arguments = item.Arguments
+		}
+		return map[string]any{
+			"id":        item.Id,
+			"type":      "function_call",
+			"status":    status,
+			"call_id":   item.CallId,
+			"name":      item.Name,
+			"arguments": arguments,
+		}
+	default:
+		content := []any{}
+		if done {
+			content = append(content, item.textPart())
+		}
+		return map[string]any{
+			"id":      item.Id,
+			"type":    "message",
+			"status":  status,
+			"role":    "assistant",
+			"content": content,
+		}
+	}
+}
+
+func (item *responsesOutputItem) textPart() map[string]any {
+	return map[string]any{"type": "output_text", "text": item.Text, "annotations": []any{}}
+}
+
+func responsesUsage(usage *model.Usage) map[string]any {
+	cachedTokens, reasoningTokens := 0, 0
+	if usage.PromptTokensDetails != nil {
+		cachedTokens = usage.PromptTokensDetails.CachedTokens
+	}
+	if usage.CompletionTokensDetails != nil {
+		reasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	}
+	return map[string]any{
+		"input_tokens":          usage.PromptTokens,
+		"input_tokens_details":  map[string]any{"cached_tokens": cachedTokens},
+		"output_tokens":         usage.CompletionTokens,
+		"output_tokens_details": map[string]any{"reasoning_tokens": reasoningTokens},
+		"total_tokens":          usage.PromptTokens + usage.CompletionTokens,
+	}
+}
+
+type responsesToolCallDelta struct {
+	Index    int    `json:"index"`
+	Id       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type responsesStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content          *string                  `json:"content"`
+			ReasoningContent string                   `json:"reasoning_content"`
+			Reasoning        string                   `json:"reasoning"`
+			ToolCalls        []responsesToolCallDelta `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *model.Usage `json:"usage"`
+}
+
+// ResponsesCompatWriter 替换 c.Writer，把适配器输出的 ChatCompletions 响应转换为 Responses 格式
+type ResponsesCompatWriter struct {
+	gin.ResponseWriter
+	stream       bool
+	id           string
+	modelName    string
+	promptTokens int
+	createdAt    int64
+	statusCode   int
+	buffer       bytes.Buffer
+
+	started        bool
+	sequenceNumber int
+	output         []*responsesOutputItem
+	current        int
+	toolItems      map[int]int
+	openTools      []int
+	inThinkTag     bool
+	finishReason   string
+	upstreamUsage  *model.Usage
+}
+
+func NewResponsesCompatWriter(writer gin.ResponseWriter, stream bool, modelName string, promptTokens int) *ResponsesCompatWriter {
+	return &ResponsesCompatWriter{
+		ResponseWriter: writer,
+		stream:         stream,
+		id:             "resp_" + common.GetRandomString(24),
+		modelName:      modelName,
+		promptTokens:   promptTokens,
+		createdAt:      common.GetTimestamp(),
+		statusCode:     200,
+		current:        -1,
+		toolItems:      make(map[int]int),
+	}
+}
+
+func (w *ResponsesCompatWriter) WriteHeader(code int) {
+	if w.stream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.statusCode = code
+}
+
+func (w *ResponsesCompatWriter) WriteHeaderNow() {
+	if w.stream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *ResponsesCompatWriter) Status() int {
+	if w.stream {
+		return w.ResponseWriter.Status()
+	}
+	return w.statusCode
+}
+
+func (w *ResponsesCompatWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ResponsesCompatWriter) Write(data []byte) (int, error) {
+	w.buffer.Write(data)
+	if !w.stream {
+		return len(data), nil
+	}
+	for {
+		line, err := w.buffer.ReadBytes('\n')
+		if err != nil {
+			// 不完整的行留到下次
+			w.buffer.Reset()
+			w.buffer.Write(line)
+			break
+		}
+		w.handleLine(string(bytes.TrimSpace(line)))
+	}
+	return len(data), nil
+}
+
+func (w *ResponsesCompatWriter) response(status string, usage *model.Usage) map[string]any {
+	output := make([]any, 0, len(w.output))
+	for _, item := range w.output {
+		output = append(output, item.toMap(status != "in_progress"))
+	}
+	var incompleteDetails any
+	if status == "incomplete" {
+		incompleteDetails = map[string]any{"reason": "max_output_tokens"}
+	}
+	var usageMap any
+	if usage != nil {
+		usageMap = responsesUsage(usage)
+	}
+	return map[string]any{
+		"id":                  w.id,
+		"object":              "response",
+		"created_at":          w.createdAt,
+		"status":              status,
+		"error":               nil,
+		"incomplete_details":  incompleteDetails,
+		"model":               w.modelName,
+		"output":              output,
+		"parallel_tool_calls": true,
+		"tool_choice":         "auto",
+		"tools":               []any{},
+		"usage":               usageMap,
+	}
+}
+
+func (w *ResponsesCompatWriter) sendEvent(eventType string, data map[string]any) {
+	data["type"] = eventType
+	data["sequence_number"] = w.sequenceNumber
+	w.sequenceNumber++
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		common.SysError("error marshalling responses stream event: " + err.Error())
+		return
+	}
+	_, _ = w.ResponseWriter.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", eventType, jsonData))
+}
+
+func (w *ResponsesCompatWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.sendEvent("response.created", map[string]any{"response": w.response("in_progress", nil)})
+	w.sendEvent("response.in_progress", map[string]any{"response": w.response("in_progress", nil)})
+}
+
+func (w *ResponsesCompatWriter) openItem(item *responsesOutputItem) int {
+	w.output = append(w.output, item)
+	index := len(w.output) - 1
+	w.sendEvent("response.output_item.added", map[string]any{"output_index": index, "item": item.toMap(false)})
+	return index
+}
+
+func (w *ResponsesCompatWriter) closeItem(index int) {
+	item := w.output[index]
+	switch item.Type {
+	case "reasoning":
+		part := map[string]any{"type": "summary_text", "text": item.Text}
+		w.sendEvent("response.reasoning_summary_text.done", map[string]any{"item_id": item.Id, "output_index": index, "summary_index": 0, "text": item.Text})
+		w.sendEvent("response.reasoning_summary_part.done", map[string]any{"item_id": item.Id, "output_index": index, "summary_index": 0, "part": part})
+	case "function_call":
+		w.sendEvent("response.function_call_arguments.done", map[string]any{"item_id": item.Id, "output_index": index, "arguments": item.Arguments})
+	default:
+		w.sendEvent("response.output_text.done", map[string]any{"item_id": item.Id, "output_index": index, "content_index": 0, "text": item.Text})
+		w.sendEvent("response.content_part.done", map[string]any{"item_id": item.Id, "output_index": index, "content_index": 0, "part": item.textPart()})
+	}
+	w.sendEvent("response.output_item.done", map[string]any{"output_index": index, "item": item.toMap(true)})
+}
+
+// closeCurrent 关闭正在输出的 message / reasoning 条目，工具调用条目在结束时统一关闭
+func (w *ResponsesCompatWriter) closeCurrent() {
+	if w.current < 0 {
+		return
+	}
+	w.closeItem(w.current)
+	w.current = -1
+}
+
+func (w *ResponsesCompatWriter) sendReasoning(text string) {
+	if text == "" {
+		return
+	}
+	if w.current < 0 || w.output[w.current].Type != "reasoning" {
+		w.closeCurrent()
+		item := &responsesOutputItem{Id: "rs_" + common.GetRandomString(24), Type: "reasoning"}
+		w.current = w.openItem(item)
+		w.sendEvent("response.reasoning_summary_part.added", map[string]any{
+			"item_id":       item.Id,
+			"output_index":  w.current,
+			"summary_index": 0,
+			"part":          map[string]any{"type": "summary_text", "text": ""},
+		})
+	}
+	item := w.output[w.current]
+	item.Text += text
+	w.sendEvent("response.reasoning_summary_text.delta", map[string]any{"item_id": item.Id, "output_index": w.current, "summary_index": 0, "delta": text})
+}
+
+func (w *ResponsesCompatWriter) sendText(text string) {
+	if text == "" {
+		return
+	}
+	if w.current < 0 || w.output[w.current].Type != "message" {
+		w.closeCurrent()
+		item := &responsesOutputItem{Id: "msg_" + common.GetRandomString(24), Type: "message"}
+		w.current = w.openItem(item)
+		w.sendEvent("response.content_part.added", map[string]any{
+			"item_id":       item.Id,
+			"output_index":  w.current,
+			"content_index": 0,
+			"part":          map[string]any{"type": "output_text", "text": "", "annotations": []any{}},
+		})
+	}
+	item := w.output[w.current]
+	item.Text += text
+	w.sendEvent("response.output_text.delta", map[string]any{"item_id": item.Id, "output_index": w.current, "content_index": 0, "delta": text})
+}
+
+// sendContent 处理正文，OpenAI 适配器会把推理内容包在 <think></think> 中
+func (w *ResponsesCompatWriter) sendContent(content string) {
+	if !w.inThinkTag && len(w.output) == 0 && strings.HasPrefix(content, "<think>") {
+		w.inThinkTag = true
+		content = strings.TrimPrefix(content, "<think>")
+	}
+	if w.inThinkTag {
+		end := strings.Index(content, "</think>")
+		if end < 0 {
+			w.sendReasoning(content)
+			return
+		}
+		w.sendReasoning(content[:end])
+		w.inThinkTag = false
+		content = strings.TrimLeft(content[end+len("</think>"):], "\n")
+	}
+	w.sendText(content)
+}
+
+func (w *ResponsesCompatWriter) sendToolCall(toolCall responsesToolCallDelta) {
+	index, ok := w.toolItems[toolCall.Index]
+	if !ok {
+		if toolCall.Id == "" && toolCall.Function.Name == "" {
+			return
+		}
+		w.closeCurrent()
+		callId := toolCall.Id
+		if callId == "" {
+			callId = "call_" + common.GetRandomString(24)
+		}
+		index = w.openItem(&responsesOutputItem{
+			Id:     "fc_" + common.GetRandomString(24),
+			Type:   "function_call",
+			CallId: callId,
+			Name:   toolCall.Function.Name,
+		})
+		w.toolItems[toolCall.Index] = index
+		w.openTools = append(w.openTools, index)
+	}
+	if toolCall.Function.Arguments == "" {
+		return
+	}
+	item := w.output[index]
+	item.Arguments += toolCall.Function.Arguments
+	w.sendEvent("response.function_call_arguments.delta", map[string]any{"item_id": item.Id, "output_index": index, "delta": toolCall.Function.Arguments})
+}
+
+func (w *ResponsesCompatWriter) handleLine(line string) {
+	if !strings.HasPrefix(line, "data:") {
+		return
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if data == "" || data == "[DONE]" {
+		return
+	}
+	var chunk responsesStreamChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return
+	}
+	w.start()
+	if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+		w.upstreamUsage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		delta := choice.Delta
+		w.sendReasoning(delta.ReasoningContent)
+		w.sendReasoning(delta.Reasoning)
+		if delta.Content != nil {
+			w.sendContent(*delta.Content)
+		}
+		for _, toolCall := range delta.ToolCalls {
+			w.sendToolCall(toolCall)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			w.finishReason = *choice.FinishReason
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *ResponsesCompatWriter) finalStatus() string {
+	if w.finishReason == "length" {
+		return "incomplete"
+	}
+	return "completed"
+}
+
+// buildOutput 根据非流式 ChatCompletions 响应生成 output 条目
+func (w *ResponsesCompatWriter) buildOutput(response *TextResponse) {
+	if len(response.Choices) == 0 {
+		return
+	}
+	choice := response.Choices[0]
+	w.finishReason = choice.FinishReason
+	thinking, text := SplitThinkContent(choice.Message.StringContent())
+	if choice.Message.ReasoningContent != "" {
+		thinking = choice.Message.ReasoningContent
+	}
+	if thinking != "" {
+		w.output = append(w.output, &responsesOutputItem{Id: "rs_" + common.GetRandomString(24), Type: "reasoning", Text: thinking})
+	}
+	if text != "" {
+		w.output = append(w.output, &responsesOutputItem{Id: "msg_" + common.GetRandomString(24), Type: "message", Text: text})
+	}
+	for _, toolCall := range choice.Message.ToolCalls {
+		callId := toolCall.Id
+		if callId == "" {
+			callId = "call_" + common.GetRandomString(24)
+		}
+		w.output = append(w.output, &responsesOutputItem{
+			Id:        "fc_" + common.GetRandomString(24),
+			Type:      "function_call",
+			CallId:    callId,
+			Name:      toolCall.Function.Name,
+			Arguments: common.AsString(toolCall.Function.Arguments),
+		})
+	}
+}
+
+// Finish 输出收尾内容，usage 为适配器最终统计的用量
+func (w *ResponsesCompatWriter) Finish(usage *model.Usage) error {
+	if usage == nil {
+		usage = w.upstreamUsage
+	}
+	if usage == nil {
+		usage = &model.Usage{PromptTokens: w.promptTokens}
+	}
+	if !w.stream {
+		var response TextResponse
+		if err := json.Unmarshal(w.buffer.Bytes(), &response); err != nil {
+			return err
+		}
+		if response.Usage.TotalTokens > 0 {
+			usage = &response.Usage
+		}
+		w.buildOutput(&response)
+		body, err := json.Marshal(w.response(w.finalStatus(), usage))
+		if err != nil {
+			return err
+		}
+		header := w.ResponseWriter.Header()
+		header.Del("Content-Length")
+		header.Del("Content-Encoding")
+		header.Set("Content-Type", "application/json")
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		_, err = w.ResponseWriter.Write(body)
+		return err
+	}
+	if w.buffer.Len() > 0 {
+		w.handleLine(strings.TrimSpace(w.buffer.String()))
+		w.buffer.Reset()
+	}
+	w.start()
+	w.closeCurrent()
+	for _, index := range w.openTools {
+		w.closeItem(index)
+	}
+	status := w.finalStatus()
+	w.sendEvent("response."+status, map[string]any{"response": w.response(status, usage)})
+	w.ResponseWriter.Flush()
+	return nil
+}
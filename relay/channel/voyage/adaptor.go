@@ -0,0 +1,78 @@
+package voyage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"one-api/relay/channel"
+	"one-api/relay/channel/openai"
+	"one-api/relay/constant"
+	"one-api/relay/model"
+	"one-api/relay/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Adaptor Voyage 的 rerank 与 embeddings 接口，rerank 响应转换为统一格式
+type Adaptor struct{}
+
+func (a *Adaptor) Init(meta *util.RelayMeta) {
+
+}
+
+func (a *Adaptor) GetRequestURL(meta *util.RelayMeta) (string, error) {
+	switch meta.Mode {
+	case constant.RelayModeRerank:
+		return fmt.Sprintf("%s/v1/rerank", meta.BaseURL), nil
+	case constant.RelayModeEmbeddings:
+		return fmt.Sprintf("%s/v1/embeddings", meta.BaseURL), nil
+	}
+	return "", fmt.Errorf("unsupported relay mode %d for voyage", meta.Mode)
+}
+
+func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *util.RelayMeta) error {
+	channel.SetupCommonRequestHeader(c, req, meta)
+	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	return nil
+}
+
+func (a *Adaptor) ConvertRequest(c *gin.Context, meta *util.RelayMeta, request *model.GeneralOpenAIRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if meta.Mode == constant.RelayModeRerank {
+		return ConvertRerankRequest(*request), nil
+	}
+	return ConvertEmbeddingRequest(*request), nil
+}
+
+func (a *Adaptor) ConvertImageRequest(request *model.ImageRequest) (any, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *Adaptor) DoRequest(c *gin.Context, meta *util.RelayMeta, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoRequestHelper(a, c, meta, requestBody)
+}
+
+func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, meta *util.RelayMeta) (aitext string, usage *model.Usage, err *model.ErrorWithStatusCode) {
+	if meta.Mode == constant.RelayModeRerank {
+		err, usage = RerankHandler(c, resp, meta.PromptTokens)
+	} else {
+		err, usage, aitext = openai.Handler(c, resp, meta.PromptTokens, meta.ActualModelName)
+		// Voyage 的 embeddings 用量只返回 total_tokens
+		if usage != nil && usage.PromptTokens == 0 {
+			usage.PromptTokens = usage.TotalTokens
+		}
+	}
+	return
+}
+
+func (a *Adaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *Adaptor) GetChannelName() string {
+	return "Voyage"
+}
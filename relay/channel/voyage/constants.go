@@ -0,0 +1,7 @@
+package voyage
+
+var ModelList = []string{
+	"rerank-2", "rerank-2-lite",
+	"voyage-3", "voyage-3-lite", "voyage-3-large",
+	"voyage-code-3", "voyage-finance-2", "voyage-law-2",
+}
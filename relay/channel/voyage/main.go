@@ -0,0 +1,88 @@
+package voyage
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"one-api/relay/channel/openai"
+	"one-api/relay/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ConvertRerankRequest(request model.GeneralOpenAIRequest) *RerankRequest {
+	rerankRequest := RerankRequest{
+		Model:     request.Model,
+		Query:     request.Query,
+		Documents: request.ParseDocuments(),
+		TopK:      request.TopN,
+	}
+	if request.ReturnDocuments != nil {
+		rerankRequest.ReturnDocuments = *request.ReturnDocuments
+	}
+	return &rerankRequest
+}
+
+func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *EmbeddingRequest {
+	return &EmbeddingRequest{
+		Model:           request.Model,
+		Input:           request.Input,
+		OutputDimension: request.Dimensions,
+	}
+}
+
+func responseVoyage2Rerank(response *RerankResponse) *model.RerankResponse {
+	rerankResponse := model.RerankResponse{
+		Model:   response.Model,
+		Results: make([]model.RerankResult, 0, len(response.Data)),
+		Usage: &model.RerankUsage{
+			PromptTokens: response.Usage.TotalTokens,
+			TotalTokens:  response.Usage.TotalTokens,
+		},
+	}
+	for _, data := range response.Data {
+		result := model.RerankResult{
+			Index:          data.Index,
+			RelevanceScore: data.RelevanceScore,
+		}
+		if data.Document != nil {
+			result.Document = &model.RerankDocument{Text: *data.Document}
+		}
+		rerankResponse.Results = append(rerankResponse.Results, result)
+	}
+	return &rerankResponse
+}
+
+func RerankHandler(c *gin.Context, resp *http.Response, promptTokens int) (*model.ErrorWithStatusCode, *model.Usage) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapper(err, "close_response_body_failed", http.StatusInternalServerError), nil
+	}
+	var voyageResponse RerankResponse
+	err = json.Unmarshal(responseBody, &voyageResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	rerankResponse := responseVoyage2Rerank(&voyageResponse)
+	if rerankResponse.Usage.TotalTokens == 0 {
+		rerankResponse.Usage.PromptTokens = promptTokens
+		rerankResponse.Usage.TotalTokens = promptTokens
+	}
+	usage := model.Usage{
+		PromptTokens: rerankResponse.Usage.PromptTokens,
+		TotalTokens:  rerankResponse.Usage.TotalTokens,
+	}
+	jsonResponse, err := json.Marshal(rerankResponse)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_response_body_failed", http.StatusInternalServerError), nil
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(resp.StatusCode)
+	_, _ = c.Writer.Write(jsonResponse)
+	return nil, &usage
+}
@@ -0,0 +1,33 @@
+package voyage
+
+type RerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopK            int      `json:"top_k,omitempty"`
+	ReturnDocuments bool     `json:"return_documents,omitempty"`
+}
+
+type RerankData struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+	Document       *string `json:"document,omitempty"`
+}
+
+type Usage struct {
+	TotalTokens int `json:"total_tokens"`
+}
+
+type RerankResponse struct {
+	Object string       `json:"object"`
+	Data   []RerankData `json:"data"`
+	Model  string       `json:"model"`
+	Usage  Usage        `json:"usage"`
+}
+
+type EmbeddingRequest struct {
+	Model           string `json:"model"`
+	Input           any    `json:"input"`
+	InputType       string `json:"input_type,omitempty"`
+	OutputDimension int    `json:"output_dimension,omitempty"`
+}
@@ -23,6 +23,8 @@ const (
 	APITypeCohere
 	APITypeDeepL
 	APITypeGCP
+	APITypeJina
+	APITypeVoyage
 )
 
 func ChannelType2APIType(channelType int) int {
@@ -60,6 +62,10 @@ func ChannelType2APIType(channelType int) int {
 		apiType = APITypeDeepL
 	case common.ChannelTypeGCP:
 		apiType = APITypeGCP
+	case common.ChannelTypeJina:
+		apiType = APITypeJina
+	case common.ChannelTypeVoyage:
+		apiType = APITypeVoyage
 	}
 	return apiType
 }
@@ -31,6 +31,9 @@ const (
 	RelayModeMessages
 	RelayRealtime
 	RelayResponses
+	RelayModeGemini
+	RelayModeGeminiCountTokens
+	RelayModeRerank
 )
 
 func Path2RelayMode(path string) int {
@@ -59,8 +62,14 @@ func Path2RelayMode(path string) int {
 		relayMode = RelayModeMessages
 	} else if strings.HasPrefix(path, "/v1/realtime") {
 		relayMode = RelayRealtime
+	} else if strings.HasPrefix(path, "/v1/rerank") {
+		relayMode = RelayModeRerank
 	} else if strings.HasPrefix(path, "/v1/responses") {
 		relayMode = RelayResponses
+	} else if strings.HasPrefix(path, "/v1beta/models/") && strings.HasSuffix(path, ":countTokens") {
+		relayMode = RelayModeGeminiCountTokens
+	} else if strings.HasPrefix(path, "/v1beta/models/") {
+		relayMode = RelayModeGemini
 	}
 	return relayMode
 }
@@ -98,3 +107,12 @@ func MidjourneyRelayMode(path string) int {
 	}
 	return relayMode
 }
+
+// GeminiModelAction 从 /v1beta/models/{model}:{action} 中解析模型名和方法
+func GeminiModelAction(path string) (modelName string, action string) {
+	path = strings.TrimPrefix(path, "/v1beta/models/")
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
@@ -141,7 +141,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *dbmodel.ErrorWithStatusCod
 		}
 	}
 
-	userQuota, err := model.CacheGetUserQuota(c, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(c, meta.UserId, meta.OrgId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -149,7 +149,7 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *dbmodel.ErrorWithStatusCod
 	if userQuota-preConsumedQuota < 0 {
 		return openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
-	err = model.CacheDecreaseUserQuota(c, meta.UserId, preConsumedQuota)
+	err = model.CacheDecreasePayerQuota(c, meta.UserId, meta.OrgId, preConsumedQuota)
 	if err != nil {
 		return openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -399,11 +399,11 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *dbmodel.ErrorWithStatusCod
 				quota = 1
 			}
 			quotaDelta := quota - preConsumedQuota
-			err = model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
+			err = model.SettleTokenQuota(meta.TokenId, preConsumedQuota, quotaDelta)
 			if err != nil {
 				common.SysError("error consuming token remain quota: " + err.Error())
 			}
-			err = model.CacheDecreaseUserQuota(ctx, meta.UserId, quotaDelta)
+			err = model.CacheDecreasePayerQuota(ctx, meta.UserId, meta.OrgId, quotaDelta)
 			if err != nil {
 				logger.Error(ctx, "decrease_user_quota_failed"+err.Error())
 			}
@@ -420,7 +420,9 @@ func RelayAudioHelper(c *gin.Context, relayMode int) *dbmodel.ErrorWithStatusCod
 				model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 				channelId := c.GetInt("channel_id")
 				model.UpdateChannelUsedQuota(channelId, quota)
+				model.UpdateChannelKeyUsedQuota(meta.ChannelKeyId, quota)
 			}
+			recordRateLimitTokens(meta, c.GetString("original_model"), promptTokens)
 
 		}()
 	}(c.Request.Context(), estimatedTokens)
@@ -9,6 +9,7 @@ import (
 	"one-api/common"
 	"one-api/common/config"
 	"one-api/common/logger"
+	"one-api/relay/channel/anthropic"
 	"one-api/relay/channel/openai"
 	"one-api/relay/constant"
 	"one-api/relay/helper"
@@ -97,6 +98,14 @@ func RelayClaude(c *gin.Context) *model.ErrorWithStatusCode {
 	if adaptor == nil {
 		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
 	}
+	isClaudeAPIType := meta.APIType == constant.APITypeGCP || meta.APIType == constant.APITypeAwsClaude || meta.APIType == constant.APITypeAnthropic
+	// 非 Claude 渠道：请求转换为 ChatCompletions，响应再转换回 Claude 格式
+	useCompat := !isClaudeAPIType && !meta.Config.ClaudePassthrough
+	if useCompat {
+		meta.IsClaude = false
+		meta.Mode = constant.RelayModeChatCompletions
+		meta.RequestURLPath = "/v1/chat/completions"
+	}
 	adaptor.Init(meta)
 	// get request body
 	var requestBody io.Reader
@@ -109,7 +118,28 @@ func RelayClaude(c *gin.Context) *model.ErrorWithStatusCode {
 	} else {
 		requestBody = c.Request.Body
 	}
-	if meta.APIType == constant.APITypeGCP || meta.APIType == constant.APITypeAwsClaude || meta.APIType == constant.APITypeAnthropic {
+	var compatWriter *anthropic.CompatResponseWriter
+	if useCompat {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusInternalServerError)
+		}
+		openaiRequest, err := anthropic.ConvertClaudeRequest2OpenAI(body, textRequest.Model)
+		if err != nil {
+			return openai.ErrorWrapper(err, "convert_request_failed", http.StatusBadRequest)
+		}
+		convertedRequest, err := adaptor.ConvertRequest(c, meta, openaiRequest)
+		if err != nil {
+			return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+		}
+		jsonData, err := json.Marshal(convertedRequest)
+		if err != nil {
+			return openai.ErrorWrapper(err, "json_marshal_failed", http.StatusInternalServerError)
+		}
+		logger.Debugf(ctx, "converted request: \n%s", string(jsonData))
+		requestBody = bytes.NewBuffer(jsonData)
+		compatWriter = anthropic.NewCompatResponseWriter(c.Writer, meta.IsStream, meta.OriginModelName, meta.PromptTokens)
+	} else if isClaudeAPIType {
 		convertedRequest, err := adaptor.ConvertRequest(c, meta, textRequest)
 		if err != nil {
 			return openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
@@ -144,7 +174,16 @@ func RelayClaude(c *gin.Context) *model.ErrorWithStatusCode {
 	}
 
 	// 执行 DoResponse 方法
+	if compatWriter != nil {
+		c.Writer = compatWriter
+	}
+	streamGuard := util.NewStreamGuard(c, meta.IsStream, resp, startTime)
 	aitext, usage, respErr := adaptor.DoResponse(c, resp, meta)
+	respErr = streamGuard.Finish(respErr)
+	meta.AttemptsLog = streamGuard.AttemptsLog(meta.AttemptsLog)
+	if compatWriter != nil {
+		c.Writer = compatWriter.ResponseWriter
+	}
 	if respErr != nil {
 		if meta.ChannelType == common.ChannelTypeAwsClaude {
 			actualStatusCode := determineActualStatusCode(respErr.StatusCode, respErr.Message)
@@ -155,6 +194,11 @@ func RelayClaude(c *gin.Context) *model.ErrorWithStatusCode {
 		util.ResetStatusCode(respErr, statusCodeMappingStr)
 		return respErr
 	}
+	if compatWriter != nil {
+		if err := compatWriter.Finish(usage); err != nil {
+			logger.Errorf(ctx, "convert response to claude format failed: %s", err.Error())
+		}
+	}
 	// 记录结束时间
 	endTime := time.Now()
 
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"one-api/common"
+	"one-api/common/ctxkey"
+	"one-api/common/logger"
+	"one-api/relay/channel/gemini"
+	"one-api/relay/channel/openai"
+	"one-api/relay/constant"
+	"one-api/relay/helper"
+	"one-api/relay/model"
+	"one-api/relay/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compatResponseWriter 把适配器输出的 OpenAI 格式响应转换为其它协议的格式
+type compatResponseWriter interface {
+	gin.ResponseWriter
+	Finish(usage *model.Usage) error
+}
+
+// geminiModelAction 解析原生 Gemini 接口的模型和方法，模型以选择渠道时确定的为准，虚拟模型此时已经是真实模型
+func geminiModelAction(c *gin.Context) (string, string) {
+	modelName, action := constant.GeminiModelAction(c.Request.URL.Path)
+	if originalModel := c.GetString(ctxkey.OriginalModel); originalModel != "" {
+		modelName = originalModel
+	}
+	return modelName, action
+}
+
+// RelayGeminiCountTokens 处理原生 countTokens 接口，Gemini 渠道透传，其它渠道本地估算，均不计费
+func RelayGeminiCountTokens(c *gin.Context) *model.ErrorWithStatusCode {
+	ctx := c.Request.Context()
+	meta := util.GetRelayMeta(c)
+	modelName, action := geminiModelAction(c)
+	meta.OriginModelName = modelName
+	meta.ActualModelName, _ = util.GetMappedModelName(modelName, meta.ModelMapping)
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusInternalServerError)
+	}
+	if meta.APIType != constant.APITypeGemini {
+		request, err := gemini.ParseNativeRequest(body, meta.ActualModelName, action)
+		if err != nil {
+			return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
+		}
+		c.JSON(http.StatusOK, gemini.CountTokensResponse{
+			TotalTokens: openai.CountTokenChatRequest(request, request.Model),
+		})
+		return nil
+	}
+	adaptor := helper.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return openai.ErrorWrapper(fmt.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	meta.RequestURLPath = fmt.Sprintf("/v1beta/models/%s:%s", meta.ActualModelName, action)
+	adaptor.Init(meta)
+	resp, err := adaptor.DoRequest(c, meta, bytes.NewBuffer(body))
+	if err != nil {
+		logger.Errorf(ctx, "DoRequest failed: %s", err.Error())
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		openaiErr := util.RelayErrorHandler(resp)
+		util.ResetStatusCode(openaiErr, c.GetString("status_code_mapping"))
+		return openaiErr
+	}
+	_, _, respErr := adaptor.DoResponse(c, resp, meta)
+	return respErr
+}
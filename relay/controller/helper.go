@@ -12,6 +12,7 @@ import (
 	"one-api/common/config"
 	"one-api/common/logger"
 	"one-api/model"
+	"one-api/relay/channel/gemini"
 	"one-api/relay/channel/openai"
 	"one-api/relay/constant"
 	relaymodel "one-api/relay/model"
@@ -24,6 +25,14 @@ import (
 )
 
 func getAndValidateTextRequest(c *gin.Context, relayMode int) (*relaymodel.GeneralOpenAIRequest, error) {
+	if relayMode == constant.RelayModeGemini {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return nil, err
+		}
+		modelName, action := geminiModelAction(c)
+		return gemini.ParseNativeRequest(body, modelName, action)
+	}
 	textRequest := &relaymodel.GeneralOpenAIRequest{}
 	err := common.UnmarshalBodyReusable(c, textRequest)
 	if err != nil {
@@ -190,12 +199,28 @@ func getPromptTokens(textRequest *relaymodel.GeneralOpenAIRequest, relayMode int
 		return openai.CountTokenInput(textRequest.Prompt, textRequest.Model)
 	case constant.RelayModeModerations:
 		return openai.CountTokenInput(textRequest.Input, textRequest.Model)
+	case constant.RelayModeRerank:
+		return openai.CountTokenInput(append([]string{textRequest.Query}, textRequest.ParseDocuments()...), textRequest.Model)
+	case constant.RelayModeGemini:
+		if textRequest.Input != nil {
+			return openai.CountTokenInput(textRequest.Input, textRequest.Model)
+		}
+		return openai.CountTokenChatRequest(textRequest, textRequest.Model)
 	}
 	return 0
 }
 
 func preConsumeQuota(ctx context.Context, preConsumedQuota int, meta *util.RelayMeta) (int, *relaymodel.ErrorWithStatusCode) {
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	if meta.IsBatch {
+		preConsumedQuota = int(float64(preConsumedQuota) * config.BatchDiscountRatio)
+	}
+	if meta.TokenSpendLimited {
+		err := model.CheckTokenSpendLimit(meta.TokenId, preConsumedQuota)
+		if err != nil {
+			return preConsumedQuota, openai.ErrorWrapper(err, "token_spend_limit_exceeded", http.StatusForbidden)
+		}
+	}
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		return preConsumedQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -203,7 +228,7 @@ func preConsumeQuota(ctx context.Context, preConsumedQuota int, meta *util.Relay
 		logger.Errorf(ctx, "userID #%d user quota is not enough", meta.UserId)
 		return preConsumedQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
-	err = model.CacheDecreaseUserQuota(ctx, meta.UserId, preConsumedQuota)
+	err = model.CacheDecreasePayerQuota(ctx, meta.UserId, meta.OrgId, preConsumedQuota)
 	if err != nil {
 		return preConsumedQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -228,6 +253,11 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *util.R
 		logger.Error(ctx, "usage is nil, which is unexpected")
 		return
 	}
+	cachedTokens := 0
+	if usage.PromptTokensDetails != nil {
+		cachedTokens = usage.PromptTokensDetails.CachedTokens
+	}
+	model.RecordChannelCacheUsage(meta.ChannelId, usage.PromptTokens, cachedTokens)
 	usertext := ""
 	if textRequest.Messages != nil && len(textRequest.Messages) > 0 {
 		for _, message := range textRequest.Messages {
@@ -250,6 +280,8 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *util.R
 				usertext = string(jsonBytes)
 			}
 		}
+	} else if textRequest.Query != "" {
+		usertext = textRequest.Query
 	} else if textRequest.Prompt != "" {
 		// 处理 Prompt 字段
 		if promptStr, ok := textRequest.Prompt.(string); ok {
@@ -263,7 +295,7 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *util.R
 			}
 		}
 	}
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -274,10 +306,13 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *util.R
 	completionRatio := common.GetCompletionRatio(textRequest.Model)
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
-	quota = promptTokens + int(float64(completionTokens)*completionRatio)
+	weightedTokens, billingDetail := util.WeightedTokens(textRequest.Model, util.NewTokenUsage(usage))
 
 	modelRatioString = fmt.Sprintf("模型倍率 %.2f，补全倍率%.2f", modelRatio, completionRatio)
-	quota = int(float64(quota) * ratio)
+	if billingDetail != "" {
+		modelRatioString += "，" + billingDetail
+	}
+	quota = int(weightedTokens * ratio)
 	if BillingByRequestEnabled {
 		shouldUseModelRatio2 := !ModelRatioEnabled || (ModelRatioEnabled && meta.BillingEnabled)
 		if shouldUseModelRatio2 {
@@ -289,6 +324,10 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *util.R
 			}
 		}
 	}
+	if meta.IsBatch {
+		quota = int(float64(quota) * config.BatchDiscountRatio)
+		modelRatioString += fmt.Sprintf("，批处理折扣 %.2f", config.BatchDiscountRatio)
+	}
 	if ratio != 0 && quota <= 0 {
 		quota = 1
 	}
@@ -313,16 +352,19 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *util.R
 	logger.Info(ctx, fmt.Sprintf("用户%d 扣费%d，预扣费 %d 实际扣费 %d。", meta.UserId, quotaDelta, preConsumedQuota, quota))
 
 	multiplier := fmt.Sprintf("%s，分组倍率 %.2f", modelRatioString, groupRatio)
+	if meta.VirtualModel != "" {
+		multiplier += fmt.Sprintf("，虚拟模型 %s", meta.VirtualModel)
+	}
 	LogContentEnabled, _ := strconv.ParseBool(config.OptionMap["LogContentEnabled"])
 	logContent := ""
 	if LogContentEnabled {
 		logContent = fmt.Sprintf("用户: %s \nAI: %s", usertext, aitext)
 	}
-	err = model.PostConsumeTokenQuota(meta.TokenId, quotaDelta)
+	err = model.SettleTokenQuota(meta.TokenId, preConsumedQuota, quotaDelta)
 	if err != nil {
 		logger.Error(ctx, "error consuming token remain quota: "+err.Error())
 	}
-	err = model.CacheDecreaseUserQuota(ctx, meta.UserId, quotaDelta)
+	err = model.CacheDecreasePayerQuota(ctx, meta.UserId, meta.OrgId, quotaDelta)
 	if err != nil {
 		logger.Error(ctx, "decrease_user_quota_failed"+err.Error())
 	}
@@ -339,9 +381,25 @@ func postConsumeQuota(ctx context.Context, usage *relaymodel.Usage, meta *util.R
 		model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, meta.ChannelName, promptTokens, completionTokens, textRequest.Model, meta.TokenName, quota, logContent, meta.TokenId, multiplier, userQuota, int(duration), meta.IsStream, meta.AttemptsLog, meta.RelayIp)
 		model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, quota)
 		model.UpdateChannelUsedQuota(meta.ChannelId, quota)
+		model.UpdateChannelKeyUsedQuota(meta.ChannelKeyId, quota)
 	}
+	// 免费模型同样计入 TPM 限制
+	recordRateLimitTokens(meta, meta.OriginModelName, promptTokens+completionTokens)
+}
 
+// recordRateLimitTokens 请求完成后把实际消耗的 token 计入分组模型、令牌和渠道的 TPM 窗口
+func recordRateLimitTokens(meta *util.RelayMeta, modelName string, tokens int) {
+	// 分组模型限制按客户端请求的虚拟模型统计
+	if meta.VirtualModel != "" {
+		modelName = meta.VirtualModel
+	}
+	common.RecordGroupModelTokens(meta.Group, modelName, meta.UserId, tokens)
+	model.RecordChannelTokens(meta.ChannelId, meta.ChannelTPMLimit, tokens)
+	if meta.TokenTPM > 0 && tokens > 0 {
+		common.RateWindowAdd(model.TokenTPMKey(meta.TokenId), int64(tokens))
+	}
 }
+
 func isErrorHappened(meta *util.RelayMeta, resp *http.Response) bool {
 	if resp == nil {
 		if meta.ChannelType == common.ChannelTypeAwsClaude {
@@ -379,17 +437,11 @@ func determineActualStatusCode(statusCode int, errorMessage string) int {
 }
 
 func PostWssConsumeQuota(ctx *gin.Context, usage *relaymodel.RealtimeUsage, meta *util.RelayMeta, textRequest *relaymodel.GeneralOpenAIRequest, ratio float64, preConsumedQuota int64, modelRatio float64, groupRatio float64, duration int, ip string) {
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(ctx, meta.UserId, meta.OrgId)
 	if err != nil {
 		logger.Warn(ctx, "Failed to get user quota: "+err.Error())
 	}
 
-	textInputTokens := usage.InputTokenDetails.TextTokens
-	textOutTokens := usage.OutputTokenDetails.TextTokens
-
-	audioInputTokens := usage.InputTokenDetails.AudioTokens
-	audioOutTokens := usage.OutputTokenDetails.AudioTokens
-
 	completionRatio := common.GetCompletionRatio(meta.OriginModelName)
 	audioRatio := common.GetAudioRatio(meta.OriginModelName)
 	audioCompletionRatio := common.GetAudioCompletionRatio(meta.OriginModelName)
@@ -405,9 +457,8 @@ func PostWssConsumeQuota(ctx *gin.Context, usage *relaymodel.RealtimeUsage, meta
 		shouldUseModelRatio2 := !ModelRatioEnabled || (ModelRatioEnabled && meta.BillingEnabled)
 		if shouldUseModelRatio2 {
 			modelRatio2, ok := common.GetModelRatio2(meta.OriginModelName)
-			quota = int64(math.Round(float64(textInputTokens) + float64(textOutTokens)*completionRatio))
-			quota += int64(math.Round(float64(audioInputTokens)*audioRatio + float64(audioOutTokens)*audioRatio*audioCompletionRatio))
-			quota = int64(math.Round(float64(quota) * ratio))
+			weightedTokens, _ := util.WeightedTokens(meta.OriginModelName, util.NewRealtimeTokenUsage(usage))
+			quota = int64(math.Round(weightedTokens * ratio))
 			if ok {
 				ratio = modelRatio2 * groupRatio
 				quota = int64(ratio * config.QuotaPerUnit)
@@ -431,7 +482,9 @@ func PostWssConsumeQuota(ctx *gin.Context, usage *relaymodel.RealtimeUsage, meta
 
 		// 更新渠道使用的配额
 		model.UpdateChannelUsedQuota(meta.ChannelId, int(quota))
+		model.UpdateChannelKeyUsedQuota(meta.ChannelKeyId, int(quota))
 	}
+	recordRateLimitTokens(meta, meta.OriginModelName, int(usage.InputTokens+usage.OutputTokens))
 	other := GenerateWssOtherInfo(ctx, meta, usage, modelRatio, groupRatio, completionRatio, audioRatio, audioCompletionRatio)
 	otherJson, _ := json.Marshal(other)
 	model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, meta.ChannelName, int(usage.InputTokens), int(usage.OutputTokens), textRequest.Model, meta.TokenName, int(quota), "", meta.TokenId, string(otherJson), userQuota, int(duration), meta.IsStream, meta.AttemptsLog, meta.RelayIp)
@@ -459,6 +512,11 @@ func GenerateWssOtherInfo(ctx *gin.Context, meta *util.RelayMeta, usage *relaymo
 	info["audio_ratio"] = audioRatio                      // 音频基础比率
 	info["audio_completion_ratio"] = audioCompletionRatio // 音频补全比率
 
+	// 缓存、长上下文等计费明细
+	if _, billingDetail := util.WeightedTokens(meta.OriginModelName, util.NewRealtimeTokenUsage(usage)); billingDetail != "" {
+		info["billing_detail"] = billingDetail
+	}
+
 	return info
 }
 
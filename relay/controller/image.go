@@ -97,7 +97,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	modelRatio := common.GetModelRatio(imageRequest.Model)
 	groupRatio := common.GetGroupRatio(meta.Group)
 	ratio := modelRatio * groupRatio
-	userQuota, err := model.CacheGetUserQuota(c, meta.UserId)
+	userQuota, err := model.CacheGetPayerQuota(c, meta.UserId, meta.OrgId)
 	if err != nil {
 		return openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -200,7 +200,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 		if err != nil {
 			logger.SysError("error consuming token remain quota: " + err.Error())
 		}
-		err = model.CacheDecreaseUserQuota(ctx, meta.UserId, finalQuota)
+		err = model.CacheDecreasePayerQuota(ctx, meta.UserId, meta.OrgId, finalQuota)
 		if err != nil {
 			logger.Error(ctx, "decrease_user_quota_failed"+err.Error())
 		}
@@ -215,7 +215,9 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			model.RecordConsumeLog(ctx, meta.UserId, meta.ChannelId, meta.ChannelName, promptTokens, completionTokens, imageRequest.Model, tokenName, finalQuota, logContent, meta.TokenId, modelQuota, userQuota, int(useTimeSeconds), false, meta.AttemptsLog, meta.RelayIp)
 			model.UpdateUserUsedQuotaAndRequestCount(meta.UserId, finalQuota)
 			model.UpdateChannelUsedQuota(meta.ChannelId, finalQuota)
+			model.UpdateChannelKeyUsedQuota(meta.ChannelKeyId, finalQuota)
 		}
+		recordRateLimitTokens(meta, meta.OriginModelName, promptTokens+completionTokens)
 	}(c.Request.Context())
 
 	// do response
@@ -9,7 +9,9 @@ import (
 	"one-api/common"
 	"one-api/common/config"
 	"one-api/common/logger"
+	"one-api/relay/channel/gemini"
 	"one-api/relay/channel/openai"
+	"one-api/relay/constant"
 	"one-api/relay/helper"
 	"one-api/relay/model"
 	"one-api/relay/util"
@@ -38,6 +40,40 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	meta.OriginModelName = textRequest.Model
 	textRequest.Model, _ = util.GetMappedModelName(textRequest.Model, meta.ModelMapping)
 	meta.ActualModelName = textRequest.Model
+	// Claude、Gemini 渠道不支持 Responses API，转换为 ChatCompletions 后再交给适配器
+	useResponsesCompat := meta.Mode == constant.RelayResponses && (meta.APIType == constant.APITypeAnthropic || meta.APIType == constant.APITypeGemini || meta.APIType == constant.APITypeAwsClaude || meta.APIType == constant.APITypeGCP)
+	if useResponsesCompat {
+		body, err := common.GetRequestBody(c)
+		if err != nil {
+			return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusInternalServerError)
+		}
+		textRequest, err = openai.ConvertResponsesRequest2ChatCompletions(body, textRequest.Model)
+		if err != nil {
+			return openai.ErrorWrapper(err, "convert_request_failed", http.StatusBadRequest)
+		}
+		meta.Mode = constant.RelayModeChatCompletions
+		meta.RequestURLPath = "/v1/chat/completions"
+	}
+	// Gemini 原生接口：Gemini 渠道透传，其它渠道按 ChatCompletions / Embeddings 处理
+	useGeminiCompat := false
+	if meta.Mode == constant.RelayModeGemini {
+		_, action := constant.GeminiModelAction(c.Request.URL.Path)
+		switch {
+		case meta.APIType == constant.APITypeGemini:
+			meta.RequestURLPath = fmt.Sprintf("/v1beta/models/%s:%s", meta.ActualModelName, action)
+			if c.Query("alt") == "sse" {
+				meta.RequestURLPath += "?alt=sse"
+			}
+		case action == "embedContent":
+			useGeminiCompat = true
+			meta.Mode = constant.RelayModeEmbeddings
+			meta.RequestURLPath = "/v1/embeddings"
+		default:
+			useGeminiCompat = true
+			meta.Mode = constant.RelayModeChatCompletions
+			meta.RequestURLPath = "/v1/chat/completions"
+		}
+	}
 	// get model ratio & group ratio
 	modelRatio := common.GetModelRatio(textRequest.Model)
 	groupRatio := common.GetGroupRatio(meta.Group)
@@ -151,7 +187,21 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 	}
 
 	// 执行 DoResponse 方法
+	var compatWriter compatResponseWriter
+	if useResponsesCompat {
+		compatWriter = openai.NewResponsesCompatWriter(c.Writer, meta.IsStream, meta.OriginModelName, meta.PromptTokens)
+	} else if useGeminiCompat {
+		compatWriter = gemini.NewNativeCompatWriter(c.Writer, meta.IsStream, c.Query("alt") == "sse", meta.Mode == constant.RelayModeEmbeddings, meta.OriginModelName, meta.PromptTokens)
+	}
+	writer := c.Writer
+	if compatWriter != nil {
+		c.Writer = compatWriter
+	}
+	streamGuard := util.NewStreamGuard(c, meta.IsStream, resp, startTime)
 	aitext, usage, respErr := adaptor.DoResponse(c, resp, meta)
+	respErr = streamGuard.Finish(respErr)
+	meta.AttemptsLog = streamGuard.AttemptsLog(meta.AttemptsLog)
+	c.Writer = writer
 	if respErr != nil {
 		if meta.ChannelType == common.ChannelTypeAwsClaude {
 			actualStatusCode := determineActualStatusCode(respErr.StatusCode, respErr.Message)
@@ -162,6 +212,11 @@ func RelayTextHelper(c *gin.Context) *model.ErrorWithStatusCode {
 		util.ResetStatusCode(respErr, statusCodeMappingStr)
 		return respErr
 	}
+	if compatWriter != nil {
+		if err := compatWriter.Finish(usage); err != nil {
+			logger.Errorf(ctx, "convert response failed: %s", err.Error())
+		}
+	}
 	// 记录结束时间
 	endTime := time.Now()
 
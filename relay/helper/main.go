@@ -12,11 +12,13 @@ import (
 	"one-api/relay/channel/deepl"
 	"one-api/relay/channel/gcpclaude"
 	"one-api/relay/channel/gemini"
+	"one-api/relay/channel/jina"
 	"one-api/relay/channel/ollama"
 	"one-api/relay/channel/openai"
 	"one-api/relay/channel/palm"
 	"one-api/relay/channel/stability"
 	"one-api/relay/channel/tencent"
+	"one-api/relay/channel/voyage"
 	"one-api/relay/channel/xunfei"
 	"one-api/relay/channel/zhipu"
 	"one-api/relay/constant"
@@ -58,6 +60,10 @@ func GetAdaptor(apiType int) channel.Adaptor {
 		return &cohere.Adaptor{}
 	case constant.APITypeGCP:
 		return &gcpclaude.Adaptor{}
+	case constant.APITypeJina:
+		return &jina.Adaptor{}
+	case constant.APITypeVoyage:
+		return &voyage.Adaptor{}
 	}
 	return nil
 }
@@ -25,6 +25,8 @@ type GeneralOpenAIRequest struct {
 	Seed                float64        `json:"seed,omitempty"`
 	Tools               []Tool         `json:"tools,omitempty"`
 	ToolChoice          any            `json:"tool_choice,omitempty"`
+	ParallelToolCalls   *bool          `json:"parallel_tool_calls,omitempty"`
+	ReasoningEffort     string         `json:"reasoning_effort,omitempty"`
 	FunctionCall        any            `json:"function_call,omitempty"`
 	User                string         `json:"user,omitempty"`
 	LogProbs            bool           `json:"logprobs,omitempty"`
@@ -32,6 +34,12 @@ type GeneralOpenAIRequest struct {
 	EncodingFormat      string         `json:"encoding_format,omitempty"`
 	Dimensions          int            `json:"dimensions,omitempty"`
 	AnthropicVersion    string         `json:"anthropic_version,omitempty"`
+	Query               string         `json:"query,omitempty"`
+	Documents           []any          `json:"documents,omitempty"`
+	TopN                int            `json:"top_n,omitempty"`
+	ReturnDocuments     *bool          `json:"return_documents,omitempty"`
+	// 请求由 Responses 接口转换而来，只有这类请求的 reasoning_effort 会转换为 Claude、Gemini 的思考配置
+	ResponsesCompat bool `json:"-"`
 }
 
 func (r GeneralOpenAIRequest) ParseInput() []string {
@@ -52,3 +60,37 @@ func (r GeneralOpenAIRequest) ParseInput() []string {
 	}
 	return input
 }
+
+// ReasoningBudgetTokens 把 Responses 请求的 reasoning_effort 换算为思考预算 token 数，未设置时返回 0。
+// 普通 ChatCompletions 请求的 reasoning_effort 不开启思考，避免改变已有请求的 temperature 和 max_tokens
+func (r GeneralOpenAIRequest) ReasoningBudgetTokens() int {
+	if !r.ResponsesCompat {
+		return 0
+	}
+	switch r.ReasoningEffort {
+	case "minimal":
+		return 1024
+	case "low":
+		return 2048
+	case "medium":
+		return 8192
+	case "high":
+		return 24576
+	}
+	return 0
+}
+
+// ParseDocuments 把 rerank 的 documents 统一为字符串列表，对象形式的文档取其 text 字段
+func (r GeneralOpenAIRequest) ParseDocuments() []string {
+	documents := make([]string, 0, len(r.Documents))
+	for _, document := range r.Documents {
+		switch v := document.(type) {
+		case string:
+			documents = append(documents, v)
+		case map[string]any:
+			text, _ := v["text"].(string)
+			documents = append(documents, text)
+		}
+	}
+	return documents
+}
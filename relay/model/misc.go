@@ -16,6 +16,8 @@ type PromptTokensDetails struct {
 	TextTokens           int `json:"text_tokens,omitempty"`
 	ImageTokens          int `json:"image_tokens,omitempty"`
 	CachedTokensInternal int `json:"cached_tokens_internal,omitempty"`
+	// 写入提示词缓存的 token，目前只有 Claude 返回
+	CacheCreationTokens int `json:"cache_creation_tokens,omitempty"`
 }
 
 type CompletionTokensDetails struct {
@@ -30,10 +30,16 @@ func (r *RealtimeUsage) Error() string {
 }
 
 type InputTokenDetails struct {
-	CachedTokens int `json:"cached_tokens"`
-	TextTokens   int `json:"text_tokens"`
-	AudioTokens  int `json:"audio_tokens"`
-	ImageTokens  int `json:"image_tokens"`
+	CachedTokens        int                 `json:"cached_tokens"`
+	TextTokens          int                 `json:"text_tokens"`
+	AudioTokens         int                 `json:"audio_tokens"`
+	ImageTokens         int                 `json:"image_tokens"`
+	CachedTokensDetails CachedTokensDetails `json:"cached_tokens_details"`
+}
+
+type CachedTokensDetails struct {
+	TextTokens  int `json:"text_tokens"`
+	AudioTokens int `json:"audio_tokens"`
 }
 
 type OutputTokenDetails struct {
@@ -0,0 +1,25 @@
+package model
+
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+type RerankResult struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+type RerankUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// RerankResponse /v1/rerank 的统一响应格式，与 Jina、Cohere 的格式兼容
+type RerankResponse struct {
+	Id      string         `json:"id,omitempty"`
+	Model   string         `json:"model,omitempty"`
+	Results []RerankResult `json:"results"`
+	Meta    any            `json:"meta,omitempty"`
+	Usage   *RerankUsage   `json:"usage,omitempty"`
+}
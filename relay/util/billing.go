@@ -2,18 +2,128 @@ package util
 
 import (
 	"context"
+	"fmt"
+	"one-api/common"
 	"one-api/common/logger"
 	"one-api/model"
+	relaymodel "one-api/relay/model"
+	"strings"
 )
 
 func ReturnPreConsumedQuota(ctx context.Context, preConsumedQuota int, tokenId int) {
 	if preConsumedQuota != 0 {
 		go func(ctx context.Context) {
 			// return pre-consumed quota
-			err := model.PostConsumeTokenQuota(tokenId, -preConsumedQuota)
+			err := model.ReturnPreConsumedTokenQuota(tokenId, preConsumedQuota)
 			if err != nil {
 				logger.Error(ctx, "error return pre-consumed quota: "+err.Error())
 			}
 		}(ctx)
 	}
 }
+
+// TokenUsage 按计费维度拆分的 token 数
+type TokenUsage struct {
+	PromptTokens        int // 全部输入 token，包括下面各项
+	CachedTokens        int // 命中缓存的文本输入
+	CacheCreationTokens int // 写入缓存的输入
+	AudioTokens         int // 音频输入，包括命中缓存的部分
+	CachedAudioTokens   int
+	ImageTokens         int
+	CompletionTokens    int // 全部输出 token，包括推理和音频输出
+	ReasoningTokens     int
+	AudioOutputTokens   int
+}
+
+func NewTokenUsage(usage *relaymodel.Usage) TokenUsage {
+	tokens := TokenUsage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+	if details := usage.PromptTokensDetails; details != nil {
+		tokens.CachedTokens = details.CachedTokens
+		tokens.CacheCreationTokens = details.CacheCreationTokens
+		tokens.AudioTokens = details.AudioTokens
+		tokens.ImageTokens = details.ImageTokens
+	}
+	if details := usage.CompletionTokensDetails; details != nil {
+		tokens.ReasoningTokens = details.ReasoningTokens
+		tokens.AudioOutputTokens = details.AudioTokens
+	}
+	return tokens
+}
+
+// NewRealtimeTokenUsage 上游没有返回缓存明细时，命中缓存的 token 按文本计算
+func NewRealtimeTokenUsage(usage *relaymodel.RealtimeUsage) TokenUsage {
+	input := usage.InputTokenDetails
+	cachedText := input.CachedTokensDetails.TextTokens
+	cachedAudio := input.CachedTokensDetails.AudioTokens
+	if cachedText+cachedAudio == 0 {
+		cachedText = input.CachedTokens
+	}
+	return TokenUsage{
+		PromptTokens:      input.TextTokens + input.AudioTokens + input.ImageTokens,
+		CachedTokens:      cachedText,
+		AudioTokens:       input.AudioTokens,
+		CachedAudioTokens: cachedAudio,
+		ImageTokens:       input.ImageTokens,
+		CompletionTokens:  usage.OutputTokenDetails.TextTokens + usage.OutputTokenDetails.AudioTokens,
+		AudioOutputTokens: usage.OutputTokenDetails.AudioTokens,
+	}
+}
+
+// WeightedTokens 按模型的缓存、推理、音频、图片倍率和长上下文分档把 token 折算为按输入价格计算的 token 数，
+// 乘以模型倍率和分组倍率即为额度，detail 为用于消费日志的计费明细
+func WeightedTokens(modelName string, tokens TokenUsage) (weighted float64, detail string) {
+	completionRatio := common.GetCompletionRatio(modelName)
+	cacheRatio := common.GetCacheRatio(modelName)
+	cacheCreationRatio := common.GetCacheCreationRatio(modelName)
+	reasoningRatio := common.GetReasoningRatio(modelName)
+	imageRatio := common.GetImageInputRatio(modelName)
+	audioRatio := common.GetAudioRatio(modelName)
+	audioCompletionRatio := common.GetAudioCompletionRatio(modelName)
+
+	textInput := max(tokens.PromptTokens-tokens.CachedTokens-tokens.CacheCreationTokens-tokens.AudioTokens-tokens.ImageTokens, 0)
+	prompt := float64(textInput) +
+		float64(tokens.CachedTokens)*cacheRatio +
+		float64(tokens.CacheCreationTokens)*cacheCreationRatio +
+		float64(tokens.AudioTokens-tokens.CachedAudioTokens)*audioRatio +
+		float64(tokens.CachedAudioTokens)*audioRatio*cacheRatio +
+		float64(tokens.ImageTokens)*imageRatio
+	reasoning := min(tokens.ReasoningTokens, tokens.CompletionTokens)
+	audioOutput := min(tokens.AudioOutputTokens, tokens.CompletionTokens-reasoning)
+	textOutput := tokens.CompletionTokens - reasoning - audioOutput
+	completion := (float64(textOutput)+float64(reasoning)*reasoningRatio)*completionRatio +
+		float64(audioOutput)*audioRatio*audioCompletionRatio
+
+	var details []string
+	if cached := tokens.CachedTokens + tokens.CachedAudioTokens; cached > 0 {
+		details = append(details, fmt.Sprintf("缓存命中 %d tokens × %.2f", cached, cacheRatio))
+	}
+	if tokens.CacheCreationTokens > 0 {
+		details = append(details, fmt.Sprintf("缓存写入 %d tokens × %.2f", tokens.CacheCreationTokens, cacheCreationRatio))
+	}
+	if reasoning > 0 {
+		details = append(details, fmt.Sprintf("推理 %d tokens × %.2f", reasoning, reasoningRatio))
+	}
+	if tokens.AudioTokens > 0 || audioOutput > 0 {
+		details = append(details, fmt.Sprintf("音频输入 %d tokens、输出 %d tokens，音频倍率 %.2f，音频补全倍率 %.2f", tokens.AudioTokens, audioOutput, audioRatio, audioCompletionRatio))
+	}
+	if tokens.ImageTokens > 0 {
+		details = append(details, fmt.Sprintf("图片输入 %d tokens × %.2f", tokens.ImageTokens, imageRatio))
+	}
+	if tier, ok := common.GetContextTier(modelName, tokens.PromptTokens); ok {
+		promptRatio, tierCompletionRatio := tier.PromptRatio, tier.CompletionRatio
+		// 未配置的倍率按 1 计算
+		if promptRatio <= 0 {
+			promptRatio = 1
+		}
+		if tierCompletionRatio <= 0 {
+			tierCompletionRatio = 1
+		}
+		prompt *= promptRatio
+		completion *= tierCompletionRatio
+		details = append(details, fmt.Sprintf("长上下文（输入超过 %d tokens）输入 × %.2f，输出 × %.2f", tier.Threshold, promptRatio, tierCompletionRatio))
+	}
+	return prompt + completion, strings.Join(details, "，")
+}
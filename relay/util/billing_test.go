@@ -0,0 +1,50 @@
+package util
+
+import (
+	"one-api/common"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func setupBillingRatios() {
+	const model = "test-billing-model"
+	common.UpdateCompletionRatioByJSONString(`{"` + model + `":2}`)
+	common.UpdateCacheRatioByJSONString(`{"` + model + `":0.1}`)
+	common.UpdateCacheCreationRatioByJSONString(`{"` + model + `":1.25}`)
+	common.UpdateReasoningRatioByJSONString(`{"` + model + `":1.5}`)
+	common.UpdateImageInputRatioByJSONString(`{"` + model + `":2}`)
+	common.UpdateAudioRatioByJSONString(`{"` + model + `":10}`)
+	common.UpdateAudioCompletionRatioByJSONString(`{"` + model + `":2}`)
+	common.UpdateModelContextTiersByJSONString(`{"` + model + `":[{"threshold":1000,"prompt_ratio":2,"completion_ratio":1.5}]}`)
+}
+
+func TestWeightedTokens(t *testing.T) {
+	setupBillingRatios()
+	cases := []struct {
+		name     string
+		tokens   TokenUsage
+		weighted float64
+		detail   bool
+	}{
+		{"plain text", TokenUsage{PromptTokens: 100, CompletionTokens: 50}, 200, false},
+		{"cache hit", TokenUsage{PromptTokens: 100, CachedTokens: 40}, 64, true},
+		{"cache creation", TokenUsage{PromptTokens: 100, CacheCreationTokens: 20}, 105, true},
+		{"reasoning", TokenUsage{CompletionTokens: 50, ReasoningTokens: 20}, 120, true},
+		{"reasoning capped by completion", TokenUsage{CompletionTokens: 10, ReasoningTokens: 20}, 30, true},
+		{"audio input", TokenUsage{PromptTokens: 100, CachedTokens: 10, AudioTokens: 30, CachedAudioTokens: 10}, 271, true},
+		{"audio output", TokenUsage{CompletionTokens: 50, AudioOutputTokens: 20}, 460, true},
+		{"image input", TokenUsage{PromptTokens: 100, ImageTokens: 40}, 140, true},
+		{"at tier threshold", TokenUsage{PromptTokens: 1000, CompletionTokens: 100}, 1200, false},
+		{"above tier threshold", TokenUsage{PromptTokens: 2000, CompletionTokens: 100}, 4300, true},
+	}
+	Convey("TestWeightedTokens", t, func() {
+		for _, c := range cases {
+			Convey(c.name, func() {
+				weighted, detail := WeightedTokens("test-billing-model", c.tokens)
+				So(weighted, ShouldAlmostEqual, c.weighted, 1e-9)
+				So(detail != "", ShouldEqual, c.detail)
+			})
+		}
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"one-api/common"
 	"one-api/common/config"
+	"one-api/model"
 	relaymodel "one-api/relay/model"
 	"strconv"
 	"strings"
@@ -22,6 +23,29 @@ func ShouldDisableChannel(err *relaymodel.Error, statusCode int, channelAutoBan
 	if channelAutoBan == 0 {
 		return false
 	}
+	return isFatalChannelError(err, statusCode)
+}
+
+// ChannelFailureKind 对渠道错误分类，供熔断器使用
+func ChannelFailureKind(err *relaymodel.Error, statusCode int) int {
+	if err == nil {
+		return model.ChannelFailureNone
+	}
+	if isFatalChannelError(err, statusCode) {
+		return model.ChannelFailureAuth
+	}
+	if statusCode == http.StatusTooManyRequests {
+		return model.ChannelFailureRateLimit
+	}
+	if statusCode >= http.StatusInternalServerError || statusCode < http.StatusBadRequest {
+		return model.ChannelFailureServer
+	}
+	return model.ChannelFailureNone
+}
+
+// isFatalChannelError 判断是否为鉴权失败、余额不足等需要人工处理的错误，
+// 5xx 等临时错误交给熔断器处理，不会永久禁用渠道
+func isFatalChannelError(err *relaymodel.Error, statusCode int) bool {
 	if err == nil {
 		return false
 	}
@@ -43,9 +67,6 @@ func ShouldDisableChannel(err *relaymodel.Error, statusCode int, channelAutoBan
 	if statusCode == http.StatusUnauthorized {
 		return true
 	}
-	if statusCode == http.StatusBadGateway {
-		return true
-	}
 	if statusCode == http.StatusNotAcceptable {
 		return true
 	}
@@ -0,0 +1,90 @@
+package util
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HedgeArbiterKey 对冲请求的各个尝试在上下文中共享同一个 HedgeArbiter
+const HedgeArbiterKey = "hedge_arbiter"
+
+// HedgeArbiter 决定对冲请求中哪个尝试胜出：最先返回首个内容的尝试把输出写给客户端，
+// 其余尝试被中断，返回错误后预扣的额度会退回，不会重复计费
+type HedgeArbiter struct {
+	mu            sync.Mutex
+	guards        []*StreamGuard
+	winner        *gin.Context
+	won           chan struct{}
+	attemptsLog   string
+	winnerChannel int
+}
+
+func NewHedgeArbiter() *HedgeArbiter {
+	return &HedgeArbiter{won: make(chan struct{})}
+}
+
+// Won 有尝试胜出时关闭
+func (h *HedgeArbiter) Won() <-chan struct{} {
+	return h.won
+}
+
+func (h *HedgeArbiter) IsWinner(c *gin.Context) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.winner == c
+}
+
+func (h *HedgeArbiter) SetAttemptsLog(log string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.attemptsLog = log
+}
+
+func (h *HedgeArbiter) getAttemptsLog() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.attemptsLog == "" || h.winner == nil {
+		return h.attemptsLog
+	}
+	return fmt.Sprintf("%s，渠道「%d」胜出", h.attemptsLog, h.winnerChannel)
+}
+
+// register 已经有尝试胜出时返回 false，新的尝试应当立即中断
+func (h *HedgeArbiter) register(g *StreamGuard) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.winner != nil {
+		return false
+	}
+	g.header = g.ResponseWriter.Header().Clone()
+	h.guards = append(h.guards, g)
+	return true
+}
+
+// claim 尝试成为胜出者，成功后中断其余尝试
+func (h *HedgeArbiter) claim(g *StreamGuard) bool {
+	h.mu.Lock()
+	if h.winner != nil {
+		won := h.winner == g.c
+		h.mu.Unlock()
+		return won
+	}
+	h.winner = g.c
+	h.winnerChannel = g.c.GetInt("channel_id")
+	g.copyHeader()
+	close(h.won)
+	losers := make([]*StreamGuard, 0, len(h.guards))
+	for _, guard := range h.guards {
+		if guard != g {
+			losers = append(losers, guard)
+		}
+	}
+	h.mu.Unlock()
+	for _, guard := range losers {
+		guard.abort(http.StatusServiceUnavailable, HedgeCancelledCode, "对冲请求已由其它渠道完成")
+	}
+	return true
+}
@@ -1,10 +1,14 @@
 package util
 
+import "one-api/common"
+
+// GetMappedModelName 先精确匹配映射的键，再按通配符、正则匹配
 func GetMappedModelName(modelName string, mapping map[string]string) (string, bool) {
 	if mapping == nil {
 		return modelName, false
 	}
-	mappedModelName := mapping[modelName]
+	// 渠道的模型映射每个请求只查找一次，不缓存其中的模式
+	mappedModelName, _ := common.LookupModelMap(mapping, common.ModelPatternSetOf(mapping), modelName)
 	if mappedModelName != "" {
 		return mappedModelName, true
 	}
@@ -18,9 +18,15 @@ type RelayMeta struct {
 	ChannelType          int
 	ChannelId            int
 	ChannelName          string
+	ChannelKeyId         int
+	ChannelTPMLimit      int
 	TokenId              int
 	TokenName            string
+	TokenTPM             int
+	TokenSpendLimited    bool
+	VirtualModel         string
 	UserId               int
+	OrgId                int
 	Group                string
 	ModelMapping         map[string]string
 	Headers              map[string]string
@@ -50,6 +56,7 @@ type RelayMeta struct {
 	FirstResponseTime    time.Time
 	StartTime            time.Time
 	SupportsCacheControl bool
+	IsBatch              bool
 }
 
 func GetRelayMeta(c *gin.Context) *RelayMeta {
@@ -57,10 +64,16 @@ func GetRelayMeta(c *gin.Context) *RelayMeta {
 		Mode:                 constant.Path2RelayMode(c.Request.URL.Path),
 		ChannelType:          c.GetInt("channel"),
 		ChannelId:            c.GetInt("channel_id"),
+		ChannelKeyId:         c.GetInt(ctxkey.ChannelKeyId),
+		ChannelTPMLimit:      c.GetInt("channel_tpm_limit"),
 		ChannelName:          c.GetString("channel_name"),
 		TokenId:              c.GetInt("token_id"),
 		TokenName:            c.GetString("token_name"),
+		TokenTPM:             c.GetInt("token_tpm"),
+		TokenSpendLimited:    c.GetBool("token_spend_limited"),
+		VirtualModel:         c.GetString("virtual_model"),
 		UserId:               c.GetInt("id"),
+		OrgId:                c.GetInt("org_id"),
 		Group:                c.GetString("group"),
 		ModelMapping:         c.GetStringMapString("model_mapping"),
 		Headers:              c.GetStringMapString("headers"),
@@ -74,6 +87,7 @@ func GetRelayMeta(c *gin.Context) *RelayMeta {
 		ProxyURL:             c.GetString("proxy_url"),
 		RelayIp:              c.GetString("relayIp"),
 		SupportsCacheControl: c.GetBool("supports_cache_control"),
+		IsBatch:              c.GetBool("is_batch"),
 	}
 
 	if meta.BaseURL == "" {
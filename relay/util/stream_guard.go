@@ -0,0 +1,396 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"one-api/common/config"
+	"one-api/common/logger"
+	relaymodel "one-api/relay/model"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HedgeCancelledCode 对冲请求中落败的尝试返回的错误码，不计为渠道故障
+const HedgeCancelledCode = "hedge_cancelled"
+
+// 首个有效内容到达前最多缓冲的字节数，超过后直接放行，避免异常响应占用内存
+const streamGuardMaxBuffer = 64 * 1024
+
+// 这些字段非空时认为上游已经开始输出内容
+var streamContentKeys = map[string]bool{
+	"content":           true,
+	"text":              true,
+	"delta":             true,
+	"reasoning_content": true,
+	"reasoning":         true,
+	"thinking":          true,
+	"partial_json":      true,
+	"arguments":         true,
+	"refusal":           true,
+}
+
+// 这些字段出现时说明流已经正常结束或开始调用工具，同样放行
+var streamFinishKeys = map[string]bool{
+	"finish_reason": true,
+	"finishReason":  true,
+	"stop_reason":   true,
+	"tool_calls":    true,
+	"function_call": true,
+	"functionCall":  true,
+}
+
+// StreamGuard 包装流式请求的响应，在首个有效内容到达前缓冲输出，
+// 上游报错、超时或提前结束时丢弃缓冲，由调用方切换渠道重试，客户端不会收到残缺的流；
+// 同时监控上游的空闲时间，长时间没有数据时中断上游连接
+type StreamGuard struct {
+	gin.ResponseWriter
+	c       *gin.Context
+	request *http.Request
+	cancel  context.CancelFunc
+	hedge   *HedgeArbiter
+
+	mu         sync.Mutex
+	header     http.Header
+	sse        bool
+	decided    bool
+	committed  bool
+	status     int
+	buffer     bytes.Buffer
+	line       []byte
+	body       io.Closer
+	abortErr   *relaymodel.ErrorWithStatusCode
+	firstTimer *time.Timer
+	idleTimer  *time.Timer
+}
+
+type streamGuardBody struct {
+	io.ReadCloser
+	guard *StreamGuard
+}
+
+func (b *streamGuardBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.guard.touch()
+	}
+	return n, err
+}
+
+// NewStreamGuard 非流式请求返回 nil，startTime 为向上游发起请求的时间，用于计算首字超时；
+// resp 为空时（如 AWS SDK 发起的请求）通过取消请求上下文中断上游
+func NewStreamGuard(c *gin.Context, isStream bool, resp *http.Response, startTime time.Time) *StreamGuard {
+	if !isStream {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	guard := &StreamGuard{
+		ResponseWriter: c.Writer,
+		c:              c,
+		request:        c.Request,
+		cancel:         cancel,
+		status:         http.StatusOK,
+	}
+	if resp != nil && resp.Body != nil {
+		guard.body = resp.Body
+		resp.Body = &streamGuardBody{ReadCloser: resp.Body, guard: guard}
+	}
+	if config.StreamFirstTokenTimeout > 0 {
+		timeout := time.Duration(config.StreamFirstTokenTimeout)*time.Second - time.Since(startTime)
+		guard.firstTimer = time.AfterFunc(max(timeout, 0), func() {
+			guard.abort(http.StatusGatewayTimeout, "stream_first_token_timeout", fmt.Sprintf("上游超过 %d 秒未返回首个内容", config.StreamFirstTokenTimeout))
+		})
+	}
+	if config.StreamIdleTimeout > 0 {
+		guard.idleTimer = time.AfterFunc(time.Duration(config.StreamIdleTimeout)*time.Second, func() {
+			guard.abort(http.StatusGatewayTimeout, "stream_idle_timeout", fmt.Sprintf("上游超过 %d 秒没有返回数据", config.StreamIdleTimeout))
+		})
+	}
+	// 对冲请求的各个尝试共用同一个客户端响应，读写响应头需要由 HedgeArbiter 加锁
+	if hedge, ok := c.Get(HedgeArbiterKey); ok {
+		guard.hedge = hedge.(*HedgeArbiter)
+		if !guard.hedge.register(guard) {
+			guard.header = http.Header{}
+			guard.abort(http.StatusServiceUnavailable, HedgeCancelledCode, "对冲请求已由其它渠道完成")
+		}
+	} else {
+		guard.header = c.Writer.Header().Clone()
+	}
+	c.Writer = guard
+	c.Request = c.Request.WithContext(ctx)
+	return guard
+}
+
+// AttemptsLog 在原有的重试记录后追加对冲请求的记录
+func (g *StreamGuard) AttemptsLog(attemptsLog string) string {
+	if g == nil || g.hedge == nil {
+		return attemptsLog
+	}
+	hedgeLog := g.hedge.getAttemptsLog()
+	if hedgeLog == "" {
+		return attemptsLog
+	}
+	if attemptsLog == "" {
+		return hedgeLog
+	}
+	return attemptsLog + "\n" + hedgeLog
+}
+
+// Finish 在 DoResponse 返回后调用，恢复原来的 Writer，
+// 首个有效内容到达前上游失败时返回错误，此时客户端尚未收到任何数据，可以安全重试
+func (g *StreamGuard) Finish(respErr *relaymodel.ErrorWithStatusCode) *relaymodel.ErrorWithStatusCode {
+	if g == nil {
+		return respErr
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.firstTimer != nil {
+		g.firstTimer.Stop()
+	}
+	if g.idleTimer != nil {
+		g.idleTimer.Stop()
+	}
+	g.cancel()
+	g.c.Writer = g.ResponseWriter
+	g.c.Request = g.request
+	if g.committed {
+		if g.abortErr != nil {
+			logger.Warnf(g.c.Request.Context(), "stream aborted after first token: %s", g.abortErr.Message)
+		}
+		return respErr
+	}
+	g.buffer.Reset()
+	if respErr != nil {
+		return respErr
+	}
+	if g.abortErr != nil {
+		return g.abortErr
+	}
+	return streamGuardError(http.StatusBadGateway, "stream_ended_without_content", "上游流在返回首个内容前结束")
+}
+
+func (g *StreamGuard) touch() {
+	if g.idleTimer != nil {
+		g.idleTimer.Reset(time.Duration(config.StreamIdleTimeout) * time.Second)
+	}
+}
+
+// abort 中断上游连接，流式处理函数读取响应体失败后会自行返回
+func (g *StreamGuard) abort(statusCode int, code string, message string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.abortErr != nil || (g.committed && code == "stream_first_token_timeout") {
+		return
+	}
+	g.dropLocked(streamGuardError(statusCode, code, message))
+}
+
+// Header 首个内容到达前使用单独的响应头，失败的尝试设置的响应头不会影响重试
+func (g *StreamGuard) Header() http.Header {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.committed {
+		return g.ResponseWriter.Header()
+	}
+	return g.header
+}
+
+// dropLocked 在持有锁时记录错误、丢弃缓冲并中断上游
+func (g *StreamGuard) dropLocked(err *relaymodel.ErrorWithStatusCode) {
+	g.buffer.Reset()
+	g.line = nil
+	if g.abortErr == nil {
+		g.abortErr = err
+	}
+	g.cancel()
+	if g.body != nil {
+		_ = g.body.Close()
+	}
+}
+
+func (g *StreamGuard) WriteHeader(code int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.committed {
+		g.ResponseWriter.WriteHeader(code)
+		return
+	}
+	g.status = code
+}
+
+func (g *StreamGuard) WriteHeaderNow() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.committed {
+		g.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (g *StreamGuard) Write(data []byte) (int, error) {
+	g.touch()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.committed {
+		return g.ResponseWriter.Write(data)
+	}
+	if g.abortErr != nil {
+		return len(data), nil
+	}
+	if !g.decided {
+		g.decided = true
+		g.sse = strings.HasPrefix(g.header.Get("Content-Type"), "text/event-stream")
+	}
+	g.buffer.Write(data)
+	if !g.sse || g.buffer.Len() > streamGuardMaxBuffer || g.scan(data) {
+		if err := g.commit(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (g *StreamGuard) WriteString(s string) (int, error) {
+	return g.Write([]byte(s))
+}
+
+func (g *StreamGuard) Flush() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.committed {
+		g.ResponseWriter.Flush()
+	}
+}
+
+// commit 把缓冲的内容写给客户端，之后的输出直接透传
+func (g *StreamGuard) commit() error {
+	if g.hedge != nil && !g.hedge.claim(g) {
+		g.dropLocked(streamGuardError(http.StatusServiceUnavailable, HedgeCancelledCode, "对冲请求已由其它渠道完成"))
+		return nil
+	}
+	g.committed = true
+	if g.firstTimer != nil {
+		g.firstTimer.Stop()
+	}
+	if g.hedge == nil {
+		g.copyHeader()
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+	_, err := g.ResponseWriter.Write(g.buffer.Bytes())
+	g.buffer.Reset()
+	g.line = nil
+	if err == nil {
+		g.ResponseWriter.Flush()
+	}
+	return err
+}
+
+func (g *StreamGuard) copyHeader() {
+	header := g.ResponseWriter.Header()
+	for key, values := range g.header {
+		header[key] = values
+	}
+}
+
+// scan 逐行检查新写入的 SSE 数据，出现有效内容时返回 true，上游在流中报错时中断请求
+func (g *StreamGuard) scan(data []byte) bool {
+	g.line = append(g.line, data...)
+	for {
+		idx := bytes.IndexByte(g.line, '\n')
+		if idx < 0 {
+			return false
+		}
+		line := strings.TrimSpace(string(g.line[:idx]))
+		g.line = g.line[idx+1:]
+		payload, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		payload = strings.TrimSpace(payload)
+		if payload == "" {
+			continue
+		}
+		if payload == "[DONE]" {
+			return true
+		}
+		var chunk any
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			// 无法识别的格式直接放行
+			return true
+		}
+		if obj, ok := chunk.(map[string]any); ok && obj["error"] != nil {
+			g.dropLocked(streamChunkError(obj["error"]))
+			return false
+		}
+		if streamChunkHasContent(chunk) {
+			return true
+		}
+	}
+}
+
+func streamGuardError(statusCode int, code string, message string) *relaymodel.ErrorWithStatusCode {
+	return &relaymodel.ErrorWithStatusCode{
+		Error: relaymodel.Error{
+			Message: message,
+			Type:    "chat_api_error",
+			Code:    code,
+		},
+		StatusCode: statusCode,
+	}
+}
+
+func streamChunkHasContent(value any) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if streamFinishKeys[key] && item != nil && item != "" {
+				return true
+			}
+			if s, ok := item.(string); ok && streamContentKeys[key] && s != "" {
+				return true
+			}
+			if streamChunkHasContent(item) {
+				return true
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if streamChunkHasContent(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// streamChunkError 把流中的错误事件转换为中继错误，保留上游的错误信息用于判断是否禁用渠道
+func streamChunkError(value any) *relaymodel.ErrorWithStatusCode {
+	err := &relaymodel.ErrorWithStatusCode{
+		Error: relaymodel.Error{
+			Message: "上游在返回首个内容前报错",
+			Type:    "upstream_error",
+			Code:    "stream_upstream_error",
+		},
+		StatusCode: http.StatusBadGateway,
+	}
+	switch v := value.(type) {
+	case string:
+		err.Message = v
+	case map[string]any:
+		if message, ok := v["message"].(string); ok && message != "" {
+			err.Message = message
+		}
+		if errType, ok := v["type"].(string); ok && errType != "" {
+			err.Type = errType
+		}
+		if code, ok := v["code"]; ok && code != nil {
+			err.Code = code
+		}
+	}
+	return err
+}
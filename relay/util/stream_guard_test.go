@@ -0,0 +1,91 @@
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"one-api/common/config"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	streamRoleChunk    = "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n\n"
+	streamContentChunk = "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n"
+	streamErrorChunk   = "data: {\"error\":{\"message\":\"overloaded\",\"type\":\"server_error\"}}\n\n"
+)
+
+func newStreamGuardTest(startTime time.Time) (*gin.Context, *httptest.ResponseRecorder, *StreamGuard) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	guard := NewStreamGuard(c, true, nil, startTime)
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	return c, recorder, guard
+}
+
+func TestStreamGuard(t *testing.T) {
+	Convey("StreamGuard", t, func() {
+		firstTokenTimeout, idleTimeout := config.StreamFirstTokenTimeout, config.StreamIdleTimeout
+		config.StreamFirstTokenTimeout, config.StreamIdleTimeout = 0, 0
+		defer func() {
+			config.StreamFirstTokenTimeout, config.StreamIdleTimeout = firstTokenTimeout, idleTimeout
+		}()
+
+		Convey("non-stream requests are not guarded", func() {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+			So(NewStreamGuard(c, false, nil, time.Now()), ShouldBeNil)
+			So(NewStreamGuard(c, false, nil, time.Now()).Finish(nil), ShouldBeNil)
+		})
+		Convey("buffers until the first content and then passes everything through", func() {
+			c, recorder, guard := newStreamGuardTest(time.Now())
+			c.Writer.WriteString(streamRoleChunk)
+			So(recorder.Body.Len(), ShouldEqual, 0)
+			c.Writer.WriteString(streamContentChunk)
+			So(recorder.Body.String(), ShouldEqual, streamRoleChunk+streamContentChunk)
+			So(recorder.Header().Get("Content-Type"), ShouldEqual, "text/event-stream")
+			So(guard.Finish(nil), ShouldBeNil)
+		})
+		Convey("a stream that ends before any content can be retried", func() {
+			c, recorder, guard := newStreamGuardTest(time.Now())
+			c.Writer.WriteString(streamRoleChunk)
+			err := guard.Finish(nil)
+			So(err, ShouldNotBeNil)
+			So(err.Code, ShouldEqual, "stream_ended_without_content")
+			So(recorder.Body.Len(), ShouldEqual, 0)
+			So(c.Writer, ShouldNotHaveSameTypeAs, guard)
+		})
+		Convey("an error event before any content keeps the upstream error", func() {
+			c, recorder, guard := newStreamGuardTest(time.Now())
+			c.Writer.WriteString(streamRoleChunk + streamErrorChunk)
+			c.Writer.WriteString(streamContentChunk)
+			err := guard.Finish(nil)
+			So(err, ShouldNotBeNil)
+			So(err.Message, ShouldEqual, "overloaded")
+			So(err.Type, ShouldEqual, "server_error")
+			So(recorder.Body.Len(), ShouldEqual, 0)
+		})
+		Convey("errors after the first content are not retried", func() {
+			c, recorder, guard := newStreamGuardTest(time.Now())
+			c.Writer.WriteString(streamContentChunk)
+			c.Writer.WriteString(streamErrorChunk)
+			So(guard.Finish(nil), ShouldBeNil)
+			So(recorder.Body.String(), ShouldEqual, streamContentChunk+streamErrorChunk)
+		})
+		Convey("the first token timeout aborts the attempt", func() {
+			config.StreamFirstTokenTimeout = 1
+			c, recorder, guard := newStreamGuardTest(time.Now().Add(-time.Second))
+			time.Sleep(50 * time.Millisecond)
+			So(c.Request.Context().Err(), ShouldNotBeNil)
+			c.Writer.WriteString(streamContentChunk)
+			err := guard.Finish(nil)
+			So(err, ShouldNotBeNil)
+			So(err.StatusCode, ShouldEqual, http.StatusGatewayTimeout)
+			So(err.Code, ShouldEqual, "stream_first_token_timeout")
+			So(recorder.Body.Len(), ShouldEqual, 0)
+		})
+	})
+}
@@ -32,6 +32,13 @@ func ValidateTextRequest(textRequest *model.GeneralOpenAIRequest, relayMode int)
 		if textRequest.Input == "" {
 			return errors.New("field input is required")
 		}
+	case constant.RelayModeRerank:
+		if textRequest.Query == "" {
+			return errors.New("field query is required")
+		}
+		if len(textRequest.Documents) == 0 {
+			return errors.New("field documents is required")
+		}
 	case constant.RelayModeEdits:
 		if textRequest.Instruction == "" {
 			return errors.New("field instruction is required")
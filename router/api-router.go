@@ -34,6 +34,7 @@ func SetApiRouter(router *gin.Engine) {
 			//userRoute.POST("/tokenlog", middleware.CriticalRateLimit(), controller.TokenLog)
 			userRoute.GET("/logout", controller.Logout)
 			userRoute.GET("/epay/notify", controller.EpayNotify)
+			userRoute.Any("/payment/:provider/notify", controller.PaymentNotify)
 
 			selfRoute := userRoute.Group("/")
 			selfRoute.Use(middleware.UserAuth())
@@ -49,6 +50,9 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/topup", controller.TopUp)
 				selfRoute.POST("/pay", controller.RequestEpay)
 				selfRoute.POST("/amount", controller.RequestAmount)
+				selfRoute.GET("/subscription", controller.GetSelfSubscription)
+				selfRoute.POST("/subscription", controller.RequestSubscription)
+				selfRoute.POST("/subscription/cancel", controller.CancelSelfSubscription)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.POST("/aff_withdrawal", controller.AffQuota)
 				selfRoute.GET("/option", controller.GetUserOptions)
@@ -56,6 +60,7 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/group", controller.GetUserGroups)
 				selfRoute.POST("/quota_alert", controller.SetUserQuotaAlert)
 				selfRoute.GET("/quota_alert", controller.GetUserQuotaAlertSettings)
+				selfRoute.GET("/quota_lots", controller.GetSelfQuotaLots)
 			}
 
 			adminRoute := userRoute.Group("/")
@@ -87,7 +92,13 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/", controller.GetAllChannels)
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ListChannelModels)
+			channelRoute.GET("/live_stats", controller.GetChannelLiveStats)
+			channelRoute.GET("/breakers", controller.GetChannelBreakers)
+			channelRoute.POST("/breakers/reset", controller.ResetChannelBreaker)
+			channelRoute.GET("/queues", controller.GetChannelQueues)
 			channelRoute.GET("/:id", controller.GetChannel)
+			channelRoute.GET("/:id/keys", controller.GetChannelKeys)
+			channelRoute.PUT("/:id/keys", controller.UpdateChannelKey)
 			channelRoute.GET("/test", controller.TestAllChannels)
 			channelRoute.GET("/test/:id", controller.TestChannel)
 			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
@@ -123,15 +134,65 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.PUT("/", controller.UpdateRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
+		planRoute := apiRouter.Group("/plan")
+		planRoute.GET("/", middleware.UserAuth(), controller.GetPlans)
+		planRoute.Use(middleware.AdminAuth())
+		{
+			planRoute.GET("/all", controller.GetAllPlans)
+			planRoute.POST("/", controller.AddPlan)
+			planRoute.PUT("/", controller.UpdatePlan)
+			planRoute.DELETE("/:id", controller.DeletePlan)
+			planRoute.GET("/subscriptions", controller.GetAllSubscriptions)
+		}
+		ledgerRoute := apiRouter.Group("/ledger")
+		ledgerRoute.Use(middleware.AdminAuth())
+		{
+			ledgerRoute.GET("/", controller.GetQuotaLedgers)
+			ledgerRoute.GET("/balance", controller.GetQuotaLedgerBalance)
+			ledgerRoute.POST("/reconcile", controller.ReconcileQuotaLedger)
+		}
 		topupsRoute := apiRouter.Group("/topups")
 		topupsRoute.Use(middleware.AdminAuth())
 		{
 			topupsRoute.GET("/", controller.GetAllTopUps)
 			topupsRoute.GET("/search", controller.SearchTopUps)
 			topupsRoute.GET("/:id", controller.GetTopUp)
+			topupsRoute.GET("/:id/events", controller.GetTopUpEvents)
+			topupsRoute.POST("/:id/refund", controller.RefundTopUp)
 			topupsRoute.DELETE("/delete", controller.DeleteTopUp)
 		}
 
+		orgRoute := apiRouter.Group("/org")
+		orgRoute.Use(middleware.UserAuth())
+		{
+			orgRoute.GET("/", controller.GetSelfOrganizations)
+			orgRoute.POST("/", controller.CreateOrganization)
+			orgRoute.POST("/invitation/accept", controller.AcceptOrgInvitation)
+			orgRoute.GET("/:id", controller.GetOrganization)
+			orgRoute.PUT("/:id", controller.UpdateOrganization)
+			orgRoute.GET("/:id/members", controller.GetOrgMembers)
+			orgRoute.PUT("/:id/members/:user_id", controller.UpdateOrgMember)
+			orgRoute.DELETE("/:id/members/:user_id", controller.RemoveOrgMember)
+			orgRoute.GET("/:id/invitations", controller.GetOrgInvitations)
+			orgRoute.POST("/:id/invitations", controller.CreateOrgInvitation)
+			orgRoute.DELETE("/:id/invitations/:invitation_id", controller.RevokeOrgInvitation)
+			orgRoute.POST("/:id/deposit", controller.DepositOrgQuota)
+			orgRoute.GET("/:id/tokens", controller.GetOrgTokens)
+			orgRoute.POST("/:id/tokens", controller.AddOrgToken)
+			orgRoute.DELETE("/:id/tokens/:token_id", controller.DeleteOrgToken)
+			orgRoute.GET("/:id/channels", controller.GetOrgChannels)
+			orgRoute.POST("/:id/channels", controller.AddOrgChannel)
+			orgRoute.PUT("/:id/channels", controller.UpdateOrgChannel)
+			orgRoute.DELETE("/:id/channels/:channel_id", controller.DeleteOrgChannel)
+		}
+		orgAdminRoute := apiRouter.Group("/organizations")
+		orgAdminRoute.Use(middleware.AdminAuth())
+		{
+			orgAdminRoute.GET("/", controller.GetAllOrganizations)
+			orgAdminRoute.POST("/:id/quota", controller.AdjustOrgQuota)
+			orgAdminRoute.PUT("/:id/status", controller.UpdateOrganizationStatus)
+		}
+
 		logRoute := apiRouter.Group("/log")
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
@@ -43,12 +43,27 @@ func SetRelayRouter(router *gin.Engine) {
 	{
 		// WebSocket 路由
 		wsRouter := relayV1Router.Group("")
-		wsRouter.Use(middleware.Distribute())
+		wsRouter.Use(middleware.GroupModelRateLimit(), middleware.Distribute())
 		wsRouter.GET("/realtime", controller.WssRelay)
 	}
+	{
+		// 文件和批处理接口不经过渠道分发
+		filesRouter := relayV1Router.Group("/files")
+		filesRouter.GET("", controller.ListFiles)
+		filesRouter.POST("", controller.UploadFile)
+		filesRouter.GET("/:id", controller.RetrieveFile)
+		filesRouter.DELETE("/:id", controller.DeleteFile)
+		filesRouter.GET("/:id/content", controller.RetrieveFileContent)
+
+		batchesRouter := relayV1Router.Group("/batches")
+		batchesRouter.GET("", controller.ListBatches)
+		batchesRouter.POST("", controller.CreateBatch)
+		batchesRouter.GET("/:id", controller.RetrieveBatch)
+		batchesRouter.POST("/:id/cancel", controller.CancelBatch)
+	}
 	{
 		httpRouter := relayV1Router.Group("")
-		httpRouter.Use(middleware.Distribute())
+		httpRouter.Use(middleware.GroupModelRateLimit(), middleware.Distribute())
 		httpRouter.POST("/completions", controller.Relay)
 		httpRouter.POST("/chat/completions", controller.Relay)
 		httpRouter.POST("/edits", controller.Relay)
@@ -57,14 +72,10 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/images/variations", controller.RelayNotImplemented)
 		httpRouter.POST("/embeddings", controller.Relay)
 		httpRouter.POST("/engines/:model/embeddings", controller.Relay)
+		httpRouter.POST("/rerank", controller.Relay)
 		httpRouter.POST("/audio/transcriptions", controller.Relay)
 		httpRouter.POST("/audio/translations", controller.Relay)
 		httpRouter.POST("/audio/speech", controller.Relay)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine_tuning/jobs", controller.RelayNotImplemented)
 		httpRouter.GET("/fine_tuning/jobs", controller.RelayNotImplemented)
 		httpRouter.GET("/fine_tuning/jobs/:id", controller.RelayNotImplemented)
@@ -101,6 +112,12 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/messages", controller.Relay)
 		httpRouter.POST("/responses", controller.Relay)
 	}
+	// Gemini 原生接口：/v1beta/models/{model}:generateContent 等
+	relayV1BetaRouter := router.Group("/v1beta")
+	relayV1BetaRouter.Use(middleware.RelayPanicRecover(), middleware.TokenAuth(), middleware.GroupModelRateLimit(), middleware.Distribute())
+	{
+		relayV1BetaRouter.POST("/models/:action", controller.Relay)
+	}
 	relayMjTurboRouter := router.Group("/mj-turbo/mj")
 	configureMidjourneyRoutes(relayMjTurboRouter)
 
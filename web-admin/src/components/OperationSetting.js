@@ -4,6 +4,17 @@ import {API, showError, showSuccess, timestamp2string, verifyJSON} from '../help
 
 import { Button,Form,  Typography, Divider, Tooltip, Spin, Layout,TextArea,Input,Checkbox } from '@douyinfe/semi-ui';
 
+// 按缓存、推理、音频、图片和长上下文计费的附加倍率，未配置的模型使用默认值
+const extraRatioOptions = [
+    { key: 'CacheRatio', label: '缓存命中倍率', placeholder: '为一个 JSON 文本，键为模型名称，值为命中缓存的输入相对输入价格的倍率' },
+    { key: 'CacheCreationRatio', label: '缓存写入倍率', placeholder: '为一个 JSON 文本，键为模型名称，值为写入缓存的输入相对输入价格的倍率' },
+    { key: 'ReasoningRatio', label: '推理倍率', placeholder: '为一个 JSON 文本，键为模型名称，值为推理 token 相对补全价格的倍率' },
+    { key: 'ImageInputRatio', label: '图片输入倍率', placeholder: '为一个 JSON 文本，键为模型名称，值为图片输入相对输入价格的倍率' },
+    { key: 'AudioRatio', label: '音频倍率', placeholder: '为一个 JSON 文本，键为模型名称，值为音频输入相对输入价格的倍率' },
+    { key: 'AudioCompletionRatio', label: '音频补全倍率', placeholder: '为一个 JSON 文本，键为模型名称，值为音频输出相对音频输入价格的倍率' },
+    { key: 'ModelContextTiers', label: '长上下文分档', placeholder: '为一个 JSON 文本，例如 {"claude-sonnet-4*": [{"threshold": 200000, "prompt_ratio": 2, "completion_ratio": 1.5}]}' },
+];
+
 const OperationSetting = () => {
     let now = new Date();
     let [inputs, setInputs] = useState({
@@ -16,6 +27,13 @@ const OperationSetting = () => {
         ModelPrice : '',
         GroupRatio: '',
         CompletionRatio: '',
+        CacheRatio: '',
+        CacheCreationRatio: '',
+        ReasoningRatio: '',
+        ImageInputRatio: '',
+        AudioRatio: '',
+        AudioCompletionRatio: '',
+        ModelContextTiers: '',
         TopUpLink: '',
         ChatLink: '',
         QuotaPerUnit: 0,
@@ -58,7 +76,7 @@ const OperationSetting = () => {
         if (success) {
             let newInputs = {};
             data.forEach((item) => {
-                if (item.key === 'ModelRatio' || item.key === 'GroupRatio' || item.key === 'ModelPrice' || item.key === 'CompletionRatio') {
+                if (item.key === 'ModelRatio' || item.key === 'GroupRatio' || item.key === 'ModelPrice' || item.key === 'CompletionRatio' || extraRatioOptions.some((option) => option.key === item.key)) {
                     item.value = JSON.stringify(JSON.parse(item.value), null, 2);
                 }
                 newInputs[item.key] = item.value;
@@ -166,6 +184,15 @@ const OperationSetting = () => {
             }
             await updateOption('CompletionRatio', inputs.CompletionRatio);
         }
+        for (const option of extraRatioOptions) {
+            if (originInputs[option.key] !== inputs[option.key]) {
+                if (!verifyJSON(inputs[option.key])) {
+                    showError(`${option.label}不是合法的 JSON 字符串`);
+                    return;
+                }
+                await updateOption(option.key, inputs[option.key]);
+            }
+        }
         await updateOption('ModelRatioEnabled', inputs.ModelRatioEnabled);
         await updateOption('BillingByRequestEnabled', inputs.BillingByRequestEnabled);
     };
@@ -495,6 +522,20 @@ const OperationSetting = () => {
                                     />
                                 </div>
                             </div>
+                            <div style={{ display: 'flex', flexWrap: 'wrap', gap: '20px', padding: '20px', border: '1px solid #e0e0e0', borderRadius: '8px', boxShadow: '0 2px 4px rgba(0, 0, 0, 0.1)' }}>
+                                {extraRatioOptions.map((option) => (
+                                    <div key={option.key} style={{ flex: '1 1 calc(20% - 20px)', display: 'flex', flexDirection: 'column', gap: '10px' }}>
+                                        <Typography.Text strong>{option.label}</Typography.Text>
+                                        <TextArea
+                                            placeholder={option.placeholder}
+                                            value={inputs[option.key]}
+                                            onChange={(value) => handleInputChange(option.key, value)}
+                                            autosize={{ minRows: 6 }}
+                                            style={{ maxHeight: '400px', overflowY: 'auto' }}
+                                        />
+                                    </div>
+                                ))}
+                            </div>
                             <Button onClick={submitGroupRatio} style={{ width: '15%', padding: '10px 0', borderRadius: '8px', backgroundColor: '#1890ff', color: '#fff', fontWeight: 'bold' }}>保存倍率设置</Button>
                             <Divider style={{ marginTop: '20px', marginBottom: '10px' }} />
                             <div style={{ display: 'flex', alignItems: 'center', marginBottom: '20px', gap: '10px' }}>
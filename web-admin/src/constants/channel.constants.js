@@ -14,6 +14,8 @@ export const CHANNEL_OPTIONS = [
     {key: 38, text: 'DeepSeek', value: 38, color: 'lime' , label: 'DeepSeek'},
     {key: 39, text: 'togetherai', value: 39, color: 'teal' , label: 'togetherai'},
     {key: 37, text: 'Cohere', value: 37, color: 'teal' , label: 'Cohere'},
+    {key: 44, text: 'Jina', value: 44, color: 'teal' , label: 'Jina'},
+    {key: 45, text: 'Voyage', value: 45, color: 'teal' , label: 'Voyage'},
     {key: 41, text: '豆包', value: 41, color: 'blue' , label: '豆包'},
     {key: 30, text: '百川大模型', value: 30, color: 'orange' , label: '百川大模型'},
     {key: 31, text: 'MiniMax', value: 31, color: 'red' , label: 'MiniMax'},
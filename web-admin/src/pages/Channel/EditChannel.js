@@ -69,6 +69,10 @@ const EditChannel = (props) => {
         weight:'',
         groups: ['default'],
         proxy_url :'',
+        cost_ratio: 1,
+        multi_key_mode: '',
+        max_concurrency: 0,
+        tpm_limit: 0,
         region: '',
         sk: '',
         ak: '',
@@ -185,7 +189,7 @@ const EditChannel = (props) => {
                     localModels = ['yi-34b-chat-0205','yi-34b-chat-200k','yi-vl-plus'];
                     break;
                 case 37:
-                    localModels = ['command','command-nightly','command-light','command-light-nightly','command-r','command-r-plus'];
+                    localModels = ['command','command-nightly','command-light','command-light-nightly','command-r','command-r-plus','rerank-v3.5','rerank-english-v3.0','rerank-multilingual-v3.0'];
                     break;
                 case 38:
                     localModels = ['deepseek-coder','deepseek-chat'];
@@ -199,6 +203,12 @@ const EditChannel = (props) => {
                 case 43:
                     localModels = ['grok-3-beta', 'grok-3-mini-beta', 'grok-3-fast-beta', 'grok-3-mini-fast-beta', 'grok-2-image', 'grok-2', 'grok-2-vision', 'grok-beta', 'grok-vision-beta'];
                     break;
+                case 44:
+                    localModels = ['jina-reranker-v2-base-multilingual', 'jina-reranker-m0', 'jina-colbert-v2', 'jina-embeddings-v3', 'jina-clip-v2'];
+                    break;
+                case 45:
+                    localModels = ['rerank-2', 'rerank-2-lite', 'voyage-3', 'voyage-3-lite', 'voyage-3-large', 'voyage-code-3', 'voyage-finance-2', 'voyage-law-2'];
+                    break;
     
             }
             setInputs((inputs) => ({...inputs, models: localModels}));
@@ -449,6 +459,9 @@ const EditChannel = (props) => {
         localInputs.is_image_url_enabled = isimageurenabled ? 1 : 0;
         localInputs.claude_original_request = claudeoriginalrequest;
         localInputs.rate_limit_count = rateLimitedConut;
+        localInputs.cost_ratio = parseFloat(inputs.cost_ratio) || 1;
+        localInputs.max_concurrency = parseInt(inputs.max_concurrency, 10) || 0;
+        localInputs.tpm_limit = parseInt(inputs.tpm_limit, 10) || 0;
         if (localInputs.base_url && localInputs.base_url.endsWith('/')) {
             localInputs.base_url = localInputs.base_url.slice(0, localInputs.base_url.length - 1);
         }
@@ -487,6 +500,7 @@ const EditChannel = (props) => {
                 supports_cache_control: supportsCacheControl,
                 is_tools: istools,
                 proxy_url: inputs.proxy_url,
+                cost_ratio: parseFloat(inputs.cost_ratio) || 1,
                 claude_original_request: claudeoriginalrequest,
                 rate_limit_count: parseInt(rateLimitedConut, 10) || 0, 
             };
@@ -709,7 +723,7 @@ const EditChannel = (props) => {
                                 </div>
 
                                 {
-                                    batch ?
+                                    batch || inputs.multi_key_mode ?
                                     <TextArea
                                         label='密钥'
                                         name='key'
@@ -753,6 +767,27 @@ const EditChannel = (props) => {
                             </div>
                         )
                     }
+                    {
+                        inputs.type !== 35 && inputs.type !== 42 && (
+                            <>
+                                <div style={{marginTop: 10}}>
+                                    <Typography.Text strong>多密钥模式（开启后多个密钥保存在同一个渠道中轮换使用）：</Typography.Text>
+                                </div>
+                                <Select
+                                    name='multi_key_mode'
+                                    optionList={[
+                                        {label: '不启用', value: ''},
+                                        {label: '轮询', value: 'round_robin'},
+                                        {label: '随机', value: 'random'},
+                                    ]}
+                                    onChange={value => {
+                                        handleInputChange('multi_key_mode', value)
+                                    }}
+                                    value={inputs.multi_key_mode || ''}
+                                />
+                            </>
+                        )
+                    }
                     <div style={{marginTop: 10}}>
                         <Typography.Text strong>分组：</Typography.Text>
                     </div>
@@ -1327,6 +1362,42 @@ const EditChannel = (props) => {
                         value={inputs.proxy_url}
                         autoComplete='new-password'
                     />
+                    <div style={{marginTop: 10}}>
+                        <Typography.Text strong>成本倍率（用于最低成本选择策略）</Typography.Text>
+                    </div>
+                    <Input
+                        name='cost_ratio'
+                        placeholder={'渠道的相对成本，默认为 1'}
+                        onChange={value => {
+                            handleInputChange('cost_ratio', value)
+                        }}
+                        value={inputs.cost_ratio}
+                        autoComplete='off'
+                    />
+                    <div style={{marginTop: 10}}>
+                        <Typography.Text strong>最大并发请求数（0 表示不限制，流式请求在结束前一直占用）</Typography.Text>
+                    </div>
+                    <Input
+                        name='max_concurrency'
+                        placeholder={'上游允许的最大并发请求数'}
+                        onChange={value => {
+                            handleInputChange('max_concurrency', value)
+                        }}
+                        value={inputs.max_concurrency}
+                        autoComplete='off'
+                    />
+                    <div style={{marginTop: 10}}>
+                        <Typography.Text strong>每分钟 Token 数上限（0 表示不限制）</Typography.Text>
+                    </div>
+                    <Input
+                        name='tpm_limit'
+                        placeholder={'上游允许的每分钟 Token 数'}
+                        onChange={value => {
+                            handleInputChange('tpm_limit', value)
+                        }}
+                        value={inputs.tpm_limit}
+                        autoComplete='off'
+                    />
 
                 </Spin>
             </SideSheet>
@@ -53,8 +53,28 @@ const originInputs = {
   unlimited_quota: false,
   billing_enabled:false,
   group: '',
+  rpm: 0,
+  tpm: 0,
+  max_concurrency: 0,
+  daily_quota_limit: 0,
+  weekly_quota_limit: 0,
+  monthly_quota_limit: 0,
+  hedge_delay: 0,
 };
 
+const spendLimitFields = [
+  { name: 'daily_quota_limit', label: '每日消费上限（$）' },
+  { name: 'weekly_quota_limit', label: '每周消费上限（$）' },
+  { name: 'monthly_quota_limit', label: '每月消费上限（$）' },
+];
+
+const rateLimitFields = [
+  { name: 'rpm', label: '每分钟请求数（RPM）' },
+  { name: 'tpm', label: '每分钟 Token 数（TPM）' },
+  { name: 'max_concurrency', label: '最大并发请求数' },
+  { name: 'hedge_delay', label: '对冲等待时间（毫秒）' },
+];
+
 const EditModal = ({ open, tokenId, onCancel, onOk }) => {
   const theme = useTheme();
   const [inputs, setInputs] = useState(originInputs);
@@ -92,6 +112,12 @@ const EditModal = ({ open, tokenId, onCancel, onOk }) => {
           adjustedValues.remain_quota = parseFloat(adjustedValues.remain_quota) * quotaPerUnit;
         }
         adjustedValues.models = values.models.join(',');
+        rateLimitFields.forEach(({ name }) => {
+          adjustedValues[name] = parseInt(adjustedValues[name], 10) || 0;
+        });
+        spendLimitFields.forEach(({ name }) => {
+          adjustedValues[name] = Math.round((parseFloat(adjustedValues[name]) || 0) * quotaPerUnit);
+        });
 
         // Add 4 random chars for each token when in batch add mode
         if (batchAddCount > 1) {
@@ -172,6 +198,9 @@ const EditModal = ({ open, tokenId, onCancel, onOk }) => {
       setInputs({
         ...data,
         remain_quota: parseFloat(data.remain_quota)/quotaPerUnit, 
+        daily_quota_limit: (data.daily_quota_limit || 0)/quotaPerUnit,
+        weekly_quota_limit: (data.weekly_quota_limit || 0)/quotaPerUnit,
+        monthly_quota_limit: (data.monthly_quota_limit || 0)/quotaPerUnit,
         models: data.models ? data.models.split(',') : [] ,
         group: data.group || '' 
       });
@@ -455,6 +484,23 @@ const EditModal = ({ open, tokenId, onCancel, onOk }) => {
                 )}
               </FormControl>
 
+              {[...rateLimitFields, ...spendLimitFields].map(({ name, label }) => (
+                <FormControl key={name} fullWidth sx={{ ...theme.typography.otherInput }}>
+                  <InputLabel htmlFor={`token-${name}-label`}>{label}</InputLabel>
+                  <OutlinedInput
+                    id={`token-${name}-label`}
+                    label={label}
+                    type="number"
+                    value={values[name]}
+                    name={name}
+                    onBlur={handleBlur}
+                    onChange={handleChange}
+                    inputProps={{ min: 0 }}
+                  />
+                  <FormHelperText>为 0 时不限制</FormHelperText>
+                </FormControl>
+              ))}
+
               <FormControl fullWidth error={Boolean(touched.fixed_content && errors.fixed_content)} sx={{ ...theme.typography.otherInput }}>
                 <InputLabel htmlFor="channel-fixed_content-label">自定义后缀</InputLabel>
                 <OutlinedInput